@@ -0,0 +1,148 @@
+//go:build bench
+
+// Package main provides modelplex-bench, a load generator for a running modelplex instance.
+// It fires concurrent chat completion requests and reports throughput and latency percentiles.
+//
+// It is kept out of the default build; run it with:
+//
+//	go run -tags bench ./cmd/modelplex-bench --socket ./modelplex.socket -n 1000 -c 50
+//
+// Point the model at a provider whose upstream answers instantly (e.g. a local stub server)
+// to measure modelplex's own overhead rather than the provider's.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+
+	modelplex "github.com/modelplex/modelplex/pkg/client"
+)
+
+// Options defines command line options
+type Options struct {
+	Socket      string        `short:"s" long:"socket" default:"./modelplex.socket" description:"Unix socket of the instance"`
+	URL         string        `long:"url" description:"Base URL of the instance's HTTP listener, used instead of --socket"`
+	Requests    int           `short:"n" long:"requests" default:"100" description:"Total number of requests"`
+	Concurrency int           `short:"c" long:"concurrency" default:"10" description:"Number of concurrent workers"`
+	Model       string        `short:"m" long:"model" default:"gpt-4" description:"Model to request"`
+	Prompt      string        `short:"p" long:"prompt" default:"Hello" description:"User message to send"`
+	Timeout     time.Duration `long:"timeout" default:"60s" description:"Timeout for each request"`
+}
+
+func main() {
+	var opts Options
+	parser := flags.NewParser(&opts, flags.Default)
+	parser.Name = "modelplex-bench"
+
+	if _, err := parser.Parse(); err != nil {
+		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+			os.Exit(0)
+		}
+		os.Exit(1)
+	}
+	if opts.Requests <= 0 || opts.Concurrency <= 0 {
+		fmt.Fprintln(os.Stderr, "--requests and --concurrency must be positive")
+		os.Exit(1)
+	}
+
+	client, url := opts.target()
+	body, err := json.Marshal(map[string]interface{}{
+		"model":    opts.Model,
+		"messages": []map[string]string{{"role": "user", "content": opts.Prompt}},
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	target := opts.URL
+	if target == "" {
+		target = opts.Socket
+	}
+	fmt.Printf("Sending %d requests for %s with %d workers to %s\n", opts.Requests, opts.Model, opts.Concurrency, target)
+	start := time.Now()
+	results := run(opts.Requests, opts.Concurrency, func() result {
+		return send(client, url, body, opts.Timeout)
+	})
+	newReport(results, time.Since(start)).write(os.Stdout)
+}
+
+// target returns the client and chat completions URL for the instance under test.
+func (o *Options) target() (*http.Client, string) {
+	if o.URL != "" {
+		return &http.Client{}, strings.TrimSuffix(o.URL, "/") + "/models/v1/chat/completions"
+	}
+	return modelplex.NewSocketClient(o.Socket).HTTPClient(), "http://modelplex/models/v1/chat/completions"
+}
+
+// result is the outcome of one request.
+type result struct {
+	latency time.Duration
+	// outcome is "ok", the HTTP status of a failed request, or the transport error
+	outcome string
+}
+
+// run calls send requests times from a pool of concurrency workers, returning every result.
+func run(requests, concurrency int, send func() result) []result {
+	results := make([]result, requests)
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for range min(concurrency, requests) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = send()
+			}
+		}()
+	}
+
+	for i := range requests {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// send makes one chat completion request, reading the whole response.
+func send(client *http.Client, url string, body []byte, timeout time.Duration) result {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return result{outcome: err.Error()}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return result{latency: time.Since(start), outcome: err.Error()}
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(io.Discard, resp.Body)
+	latency := time.Since(start)
+	switch {
+	case err != nil:
+		return result{latency: latency, outcome: err.Error()}
+	case resp.StatusCode != http.StatusOK:
+		return result{latency: latency, outcome: resp.Status}
+	default:
+		return result{latency: latency, outcome: outcomeOK}
+	}
+}
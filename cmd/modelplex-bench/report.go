@@ -0,0 +1,106 @@
+//go:build bench
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	outcomeOK = "ok"
+
+	// Histogram buckets double in width from histogramBase up
+	histogramBase = time.Millisecond
+	// Width of the longest histogram bar, in characters
+	histogramWidth = 40
+)
+
+// percentiles reported for successful requests
+var percentiles = []float64{50, 90, 99}
+
+// report summarizes a benchmark run.
+type report struct {
+	elapsed   time.Duration
+	total     int
+	latencies []time.Duration // of successful requests, sorted
+	failures  map[string]int
+}
+
+func newReport(results []result, elapsed time.Duration) *report {
+	r := &report{elapsed: elapsed, total: len(results), failures: make(map[string]int)}
+	for _, res := range results {
+		if res.outcome == outcomeOK {
+			r.latencies = append(r.latencies, res.latency)
+		} else {
+			r.failures[res.outcome]++
+		}
+	}
+	slices.Sort(r.latencies)
+	return r
+}
+
+// percentile returns the latency below which p percent of successful requests completed,
+// using the nearest-rank method.
+func (r *report) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	rank := int(p / 100 * float64(len(r.latencies)))
+	return r.latencies[min(rank, len(r.latencies)-1)]
+}
+
+// histogram counts successful requests into buckets [0, base), [base, 2*base), [2*base, 4*base)...
+// It returns each bucket's upper bound with its count, up to the bucket holding the slowest request.
+func (r *report) histogram() (bounds []time.Duration, counts []int) {
+	bound := histogramBase
+	i := 0
+	for i < len(r.latencies) {
+		count := 0
+		for i < len(r.latencies) && r.latencies[i] < bound {
+			count++
+			i++
+		}
+		bounds = append(bounds, bound)
+		counts = append(counts, count)
+		bound *= 2
+	}
+	return bounds, counts
+}
+
+func (r *report) write(w io.Writer) {
+	succeeded := len(r.latencies)
+	fmt.Fprintf(w, "\nCompleted %d requests in %s (%.1f req/s)\n",
+		r.total, r.elapsed.Round(time.Millisecond), float64(r.total)/r.elapsed.Seconds())
+	fmt.Fprintf(w, "Succeeded: %d, failed: %d\n", succeeded, r.total-succeeded)
+
+	outcomes := make([]string, 0, len(r.failures))
+	for outcome := range r.failures {
+		outcomes = append(outcomes, outcome)
+	}
+	sort.Strings(outcomes)
+	for _, outcome := range outcomes {
+		fmt.Fprintf(w, "  %6d  %s\n", r.failures[outcome], outcome)
+	}
+
+	if succeeded == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\nLatency: min %s, max %s\n", r.latencies[0], r.latencies[succeeded-1])
+	for _, p := range percentiles {
+		fmt.Fprintf(w, "  p%-3g %s\n", p, r.percentile(p))
+	}
+
+	bounds, counts := r.histogram()
+	largest := slices.Max(counts)
+	fmt.Fprintln(w, "\nHistogram:")
+	for i, bound := range bounds {
+		bar := strings.Repeat("#", counts[i]*histogramWidth/largest)
+		fmt.Fprintf(w, "  < %-8s %6d  %s\n", bound, counts[i], bar)
+	}
+}
@@ -0,0 +1,60 @@
+//go:build bench
+
+package main
+
+import (
+	"bytes"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	var calls, active, peak atomic.Int32
+	results := run(50, 4, func() result {
+		calls.Add(1)
+		n := active.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		active.Add(-1)
+		return result{latency: time.Millisecond, outcome: outcomeOK}
+	})
+
+	assert.Len(t, results, 50)
+	assert.EqualValues(t, 50, calls.Load())
+	assert.LessOrEqual(t, peak.Load(), int32(4))
+}
+
+func TestReport(t *testing.T) {
+	var results []result
+	for i := 1; i <= 100; i++ {
+		results = append(results, result{latency: time.Duration(i) * time.Millisecond, outcome: outcomeOK})
+	}
+	results = append(results, result{outcome: "502 Bad Gateway"}, result{outcome: "502 Bad Gateway"})
+
+	r := newReport(results, time.Second)
+	assert.Equal(t, 51*time.Millisecond, r.percentile(50))
+	assert.Equal(t, 91*time.Millisecond, r.percentile(90))
+	assert.Equal(t, 100*time.Millisecond, r.percentile(99))
+	assert.Equal(t, map[string]int{"502 Bad Gateway": 2}, r.failures)
+
+	bounds, counts := r.histogram()
+	assert.Equal(t, []time.Duration{
+		time.Millisecond, 2 * time.Millisecond, 4 * time.Millisecond, 8 * time.Millisecond,
+		16 * time.Millisecond, 32 * time.Millisecond, 64 * time.Millisecond, 128 * time.Millisecond,
+	}, bounds)
+	assert.Equal(t, []int{0, 1, 2, 4, 8, 16, 32, 37}, counts)
+
+	var out bytes.Buffer
+	r.write(&out)
+	assert.Contains(t, out.String(), "Completed 102 requests in 1s (102.0 req/s)")
+	assert.Contains(t, out.String(), "Succeeded: 100, failed: 2")
+	assert.Contains(t, out.String(), "p99  100ms")
+}
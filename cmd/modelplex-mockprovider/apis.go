@@ -0,0 +1,205 @@
+package main
+
+import (
+	"time"
+)
+
+// OpenAI's chat completions and text completions, streamed as server-sent events ending in "[DONE]"
+var (
+	openAIChatAPI = &api{
+		streamType: "text/event-stream",
+		response: func(c *completion) interface{} {
+			return openAIResponse(c, "chat.completion", map[string]interface{}{
+				"index":         0,
+				"message":       map[string]interface{}{"role": "assistant", "content": c.text()},
+				"finish_reason": "stop",
+			})
+		},
+		stream: func(s *streamer, c *completion) {
+			streamOpenAI(s, c, "chat.completion.chunk", func(piece string) map[string]interface{} {
+				return map[string]interface{}{"index": 0, "delta": map[string]interface{}{"content": piece}}
+			})
+		},
+		errorBody: openAIError,
+	}
+
+	openAITextAPI = &api{
+		streamType: "text/event-stream",
+		response: func(c *completion) interface{} {
+			return openAIResponse(c, "text_completion", map[string]interface{}{
+				"index":         0,
+				"text":          c.text(),
+				"finish_reason": "stop",
+			})
+		},
+		stream: func(s *streamer, c *completion) {
+			streamOpenAI(s, c, "text_completion", func(piece string) map[string]interface{} {
+				return map[string]interface{}{"index": 0, "text": piece}
+			})
+		},
+		errorBody: openAIError,
+	}
+)
+
+func openAIResponse(c *completion, object string, choice map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"id":      "mock-" + object,
+		"object":  object,
+		"created": time.Now().Unix(),
+		"model":   c.model,
+		"choices": []interface{}{choice},
+		"usage": map[string]interface{}{
+			"prompt_tokens":     c.promptTokens,
+			"completion_tokens": len(c.pieces),
+			"total_tokens":      c.promptTokens + len(c.pieces),
+		},
+	}
+}
+
+// streamOpenAI streams a chunk of the given object type for each piece, then one with the
+// finish reason, then "[DONE]". choice builds a chunk's choice, without its finish reason.
+func streamOpenAI(s *streamer, c *completion, object string, choice func(piece string) map[string]interface{}) {
+	chunk := func(choice map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"id": "mock-" + object, "object": object, "created": time.Now().Unix(), "model": c.model,
+			"choices": []interface{}{choice},
+		}
+	}
+
+	for _, piece := range c.pieces {
+		next := choice(piece)
+		next["finish_reason"] = nil
+		if !s.sendSSE("", chunk(next)) {
+			return
+		}
+	}
+	last := choice("")
+	last["finish_reason"] = "stop"
+	if s.sendSSE("", chunk(last)) {
+		s.send("data: [DONE]\n\n")
+	}
+}
+
+func openAIError(message string) interface{} {
+	return map[string]interface{}{"error": map[string]interface{}{"message": message, "type": "server_error"}}
+}
+
+// Anthropic's messages, streamed as named server-sent events
+var anthropicAPI = &api{
+	streamType: "text/event-stream",
+	response: func(c *completion) interface{} {
+		return map[string]interface{}{
+			"id":          "msg_mock",
+			"type":        "message",
+			"role":        "assistant",
+			"model":       c.model,
+			"content":     []interface{}{map[string]interface{}{"type": "text", "text": c.text()}},
+			"stop_reason": "end_turn",
+			"usage":       map[string]interface{}{"input_tokens": c.promptTokens, "output_tokens": len(c.pieces)},
+		}
+	},
+	stream: func(s *streamer, c *completion) {
+		events := []struct {
+			name    string
+			payload map[string]interface{}
+		}{
+			{"message_start", map[string]interface{}{"type": "message_start", "message": map[string]interface{}{
+				"id": "msg_mock", "type": "message", "role": "assistant", "model": c.model, "content": []interface{}{},
+				"usage": map[string]interface{}{"input_tokens": c.promptTokens, "output_tokens": 0},
+			}}},
+			{"content_block_start", map[string]interface{}{
+				"type": "content_block_start", "index": 0, "content_block": map[string]interface{}{"type": "text", "text": ""},
+			}},
+		}
+		for _, piece := range c.pieces {
+			events = append(events, struct {
+				name    string
+				payload map[string]interface{}
+			}{"content_block_delta", map[string]interface{}{
+				"type": "content_block_delta", "index": 0, "delta": map[string]interface{}{"type": "text_delta", "text": piece},
+			}})
+		}
+		events = append(events, []struct {
+			name    string
+			payload map[string]interface{}
+		}{
+			{"content_block_stop", map[string]interface{}{"type": "content_block_stop", "index": 0}},
+			{"message_delta", map[string]interface{}{
+				"type": "message_delta", "delta": map[string]interface{}{"stop_reason": "end_turn"},
+				"usage": map[string]interface{}{"output_tokens": len(c.pieces)},
+			}},
+			{"message_stop", map[string]interface{}{"type": "message_stop"}},
+		}...)
+
+		for _, event := range events {
+			if !s.sendSSE(event.name, event.payload) {
+				return
+			}
+		}
+	},
+	errorBody: func(message string) interface{} {
+		return map[string]interface{}{"type": "error", "error": map[string]interface{}{"type": "api_error", "message": message}}
+	},
+}
+
+// Ollama's chat and generate endpoints, which stream newline-delimited JSON unless asked not to
+var (
+	ollamaChatAPI = &api{
+		streamByDefault: true,
+		streamType:      "application/x-ndjson",
+		response: func(c *completion) interface{} {
+			return ollamaResponse(c, ollamaMessage(c.text()), true)
+		},
+		stream: func(s *streamer, c *completion) {
+			streamOllama(s, c, ollamaMessage)
+		},
+		errorBody: ollamaError,
+	}
+
+	ollamaGenerateAPI = &api{
+		streamByDefault: true,
+		streamType:      "application/x-ndjson",
+		response: func(c *completion) interface{} {
+			return ollamaResponse(c, ollamaGenerated(c.text()), true)
+		},
+		stream: func(s *streamer, c *completion) {
+			streamOllama(s, c, ollamaGenerated)
+		},
+		errorBody: ollamaError,
+	}
+)
+
+func ollamaMessage(text string) map[string]interface{} {
+	return map[string]interface{}{"message": map[string]interface{}{"role": "assistant", "content": text}}
+}
+
+func ollamaGenerated(text string) map[string]interface{} {
+	return map[string]interface{}{"response": text}
+}
+
+// ollamaResponse completes fields, the text of a response or stream line, with Ollama's metadata.
+func ollamaResponse(c *completion, fields map[string]interface{}, done bool) map[string]interface{} {
+	fields["model"] = c.model
+	fields["created_at"] = time.Now().UTC().Format(time.RFC3339Nano)
+	fields["done"] = done
+	if done {
+		fields["done_reason"] = "stop"
+		fields["prompt_eval_count"] = c.promptTokens
+		fields["eval_count"] = len(c.pieces)
+	}
+	return fields
+}
+
+// streamOllama streams a line for each piece, then a final line marked done.
+func streamOllama(s *streamer, c *completion, text func(string) map[string]interface{}) {
+	for _, piece := range c.pieces {
+		if !s.sendLine(ollamaResponse(c, text(piece), false)) {
+			return
+		}
+	}
+	s.sendLine(ollamaResponse(c, text(""), true))
+}
+
+func ollamaError(message string) interface{} {
+	return map[string]interface{}{"error": message}
+}
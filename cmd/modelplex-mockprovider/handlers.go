@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// bytesPerToken roughly converts request sizes into the prompt token counts reported in usage
+const bytesPerToken = 4
+
+// mockProvider answers requests as configured by its options.
+type mockProvider struct {
+	opts *Options
+}
+
+// newRouter returns the handler for every API the mock provider imitates.
+func newRouter(opts *Options) *mux.Router {
+	p := &mockProvider{opts: opts}
+	router := mux.NewRouter()
+
+	// OpenAI, and Anthropic's messages, under the /v1 of their base URLs
+	router.HandleFunc("/v1/chat/completions", p.handle(openAIChatAPI)).Methods("POST")
+	router.HandleFunc("/v1/completions", p.handle(openAITextAPI)).Methods("POST")
+	router.HandleFunc("/v1/models", p.handleOpenAIModels).Methods("GET")
+	router.HandleFunc("/v1/messages", p.handle(anthropicAPI)).Methods("POST")
+
+	// Ollama
+	router.HandleFunc("/api/chat", p.handle(ollamaChatAPI)).Methods("POST")
+	router.HandleFunc("/api/generate", p.handle(ollamaGenerateAPI)).Methods("POST")
+	router.HandleFunc("/api/tags", p.handleOllamaTags).Methods("GET")
+
+	return router
+}
+
+// completion is a request being answered: the reply is sent as pieces, one per streamed chunk.
+type completion struct {
+	model        string
+	pieces       []string
+	promptTokens int
+}
+
+// text returns the whole reply.
+func (c *completion) text() string {
+	return strings.Join(c.pieces, "")
+}
+
+// api describes how one upstream API shapes its responses.
+type api struct {
+	// streamByDefault is set for APIs that stream unless the request says otherwise, like Ollama's
+	streamByDefault bool
+	streamType      string
+	response        func(c *completion) interface{}
+	stream          func(s *streamer, c *completion)
+	errorBody       func(message string) interface{}
+}
+
+// handle returns a handler answering completion requests in api's format, after the configured
+// latency, failing at the configured error rate.
+func (p *mockProvider) handle(api *api) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model  string `json:"model"`
+			Stream *bool  `json:"stream"`
+		}
+		body, err := io.ReadAll(r.Body)
+		if err == nil {
+			err = json.Unmarshal(body, &req)
+		}
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, api.errorBody(fmt.Sprintf("invalid request: %v", err)))
+			return
+		}
+
+		if !sleep(r.Context(), p.opts.Latency) {
+			return
+		}
+		if rand.Float64() < p.opts.ErrorRate { // #nosec G404 -- failure injection needs no cryptographic randomness
+			if p.opts.ErrorStatus == http.StatusTooManyRequests || p.opts.ErrorStatus == http.StatusServiceUnavailable {
+				w.Header().Set("Retry-After", "1")
+			}
+			writeJSON(w, p.opts.ErrorStatus, api.errorBody(fmt.Sprintf("injected failure (status %d)", p.opts.ErrorStatus)))
+			return
+		}
+
+		c := &completion{
+			model:        req.Model,
+			pieces:       strings.SplitAfter(p.opts.Reply, " "),
+			promptTokens: len(body) / bytesPerToken,
+		}
+		stream := api.streamByDefault
+		if req.Stream != nil {
+			stream = *req.Stream
+		}
+		if !stream {
+			writeJSON(w, http.StatusOK, api.response(c))
+			return
+		}
+
+		w.Header().Set("Content-Type", api.streamType)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		api.stream(&streamer{w: w, ctx: r.Context(), delay: p.opts.ChunkDelay}, c)
+	}
+}
+
+func (p *mockProvider) handleOpenAIModels(w http.ResponseWriter, _ *http.Request) {
+	data := make([]map[string]interface{}, 0, len(p.opts.Models))
+	for _, model := range p.opts.Models {
+		data = append(data, map[string]interface{}{
+			"id": model, "object": "model", "created": 0, "owned_by": "modelplex-mockprovider",
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"object": "list", "data": data})
+}
+
+func (p *mockProvider) handleOllamaTags(w http.ResponseWriter, _ *http.Request) {
+	models := make([]map[string]interface{}, 0, len(p.opts.Models))
+	for _, model := range p.opts.Models {
+		models = append(models, map[string]interface{}{"name": model, "model": model})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"models": models})
+}
+
+// streamer writes the chunks of a streamed response, waiting delay between them.
+type streamer struct {
+	w     http.ResponseWriter
+	ctx   context.Context
+	delay time.Duration
+	sent  bool
+}
+
+// send writes one chunk and flushes it. It returns false, and the stream should end,
+// once the client has gone away.
+func (s *streamer) send(chunk string) bool {
+	if s.sent && !sleep(s.ctx, s.delay) {
+		return false
+	}
+	s.sent = true
+
+	if _, err := io.WriteString(s.w, chunk); err != nil {
+		return false
+	}
+	if err := http.NewResponseController(s.w).Flush(); err != nil {
+		slog.Debug("Failed to flush stream", "error", err)
+	}
+	return true
+}
+
+// sendSSE sends payload as a server-sent event, named event unless that's empty.
+func (s *streamer) sendSSE(event string, payload interface{}) bool {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return false
+	}
+	if event == "" {
+		return s.send(fmt.Sprintf("data: %s\n\n", data))
+	}
+	return s.send(fmt.Sprintf("event: %s\ndata: %s\n\n", event, data))
+}
+
+// sendLine sends payload as a line of newline-delimited JSON.
+func (s *streamer) sendLine(payload interface{}) bool {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return false
+	}
+	return s.send(string(data) + "\n")
+}
+
+// sleep waits for d, returning false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(payload); err != nil {
+		slog.Error("Failed to encode response", "error", err)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/providers"
+)
+
+func newTestServer(t *testing.T, opts Options) *httptest.Server {
+	t.Helper()
+	if opts.Models == nil {
+		opts.Models = []string{"mock-model"}
+	}
+	if opts.Reply == "" {
+		opts.Reply = "Hello from the mock"
+	}
+	if opts.ErrorStatus == 0 {
+		opts.ErrorStatus = http.StatusInternalServerError
+	}
+	server := httptest.NewServer(newRouter(&opts))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// collectStream returns the text of a stream's chunks, failing the test if the stream does.
+func collectStream(t *testing.T, chunks <-chan providers.StreamChunk, chat bool) string {
+	t.Helper()
+	text := ""
+	for chunk := range chunks {
+		require.NoError(t, chunk.Err)
+		if chunk.Done {
+			break
+		}
+		data, ok := chunk.Data.(map[string]interface{})
+		require.True(t, ok)
+		choices, ok := data["choices"].([]interface{})
+		require.True(t, ok)
+		if len(choices) == 0 {
+			continue
+		}
+		choice := choices[0].(map[string]interface{})
+		if chat {
+			if delta, ok := choice["delta"].(map[string]interface{}); ok {
+				content, _ := delta["content"].(string)
+				text += content
+			}
+		} else {
+			content, _ := choice["text"].(string)
+			text += content
+		}
+	}
+	return text
+}
+
+func chatContent(t *testing.T, result interface{}) string {
+	t.Helper()
+	choices := result.(map[string]interface{})["choices"].([]interface{})
+	require.Len(t, choices, 1)
+	message := choices[0].(map[string]interface{})["message"].(map[string]interface{})
+	return message["content"].(string)
+}
+
+func TestMockProvider_Providers(t *testing.T) {
+	server := newTestServer(t, Options{})
+	messages := []map[string]interface{}{{"role": "user", "content": "Hi"}}
+
+	tests := []struct {
+		name     string
+		provider providers.Provider
+	}{
+		{"openai", providers.NewOpenAIProvider(&config.Provider{Name: "openai", BaseURL: server.URL + "/v1"})},
+		{"anthropic", providers.NewAnthropicProvider(&config.Provider{
+			Name: "anthropic", BaseURL: server.URL + "/v1", NormalizeResponses: true,
+		})},
+		{"ollama", providers.NewOllamaProvider(&config.Provider{
+			Name: "ollama", BaseURL: server.URL, NormalizeResponses: true,
+		})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			result, err := tt.provider.ChatCompletion(ctx, "mock-model", messages, nil)
+			require.NoError(t, err)
+			assert.Equal(t, "Hello from the mock", chatContent(t, result))
+
+			chunks, err := tt.provider.ChatCompletionStream(ctx, "mock-model", messages, nil)
+			require.NoError(t, err)
+			assert.Equal(t, "Hello from the mock", collectStream(t, chunks, true))
+
+			_, err = tt.provider.Completion(ctx, "mock-model", "Hi", nil)
+			require.NoError(t, err)
+
+			chunks, err = tt.provider.CompletionStream(ctx, "mock-model", "Hi", nil)
+			require.NoError(t, err)
+			assert.Equal(t, "Hello from the mock", collectStream(t, chunks, false))
+		})
+	}
+}
+
+func TestMockProvider_DiscoverModels(t *testing.T) {
+	server := newTestServer(t, Options{Models: []string{"mock-a", "mock-b"}})
+	provider := providers.NewOllamaProvider(&config.Provider{Name: "ollama", BaseURL: server.URL})
+
+	models, err := provider.DiscoverModels(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mock-a", "mock-b"}, models)
+
+	resp, err := http.Get(server.URL + "/v1/models")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestMockProvider_ErrorRate(t *testing.T) {
+	server := newTestServer(t, Options{ErrorRate: 1, ErrorStatus: http.StatusTooManyRequests})
+	provider := providers.NewOpenAIProvider(&config.Provider{Name: "openai", BaseURL: server.URL + "/v1"})
+
+	_, err := provider.ChatCompletion(context.Background(), "mock-model",
+		[]map[string]interface{}{{"role": "user", "content": "Hi"}}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "429")
+}
+
+func TestMockProvider_Latency(t *testing.T) {
+	server := newTestServer(t, Options{Latency: 50 * time.Millisecond})
+	provider := providers.NewOpenAIProvider(&config.Provider{Name: "openai", BaseURL: server.URL + "/v1"})
+
+	start := time.Now()
+	_, err := provider.Completion(context.Background(), "mock-model", "Hi", nil)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestOptions_Validate(t *testing.T) {
+	valid := Options{ErrorRate: 0.5, ErrorStatus: http.StatusServiceUnavailable}
+	require.NoError(t, valid.validate())
+
+	for _, opts := range []Options{
+		{ErrorRate: 1.5, ErrorStatus: http.StatusInternalServerError},
+		{ErrorStatus: http.StatusOK},
+		{ErrorStatus: http.StatusInternalServerError, Latency: -time.Second},
+	} {
+		assert.Error(t, opts.validate())
+	}
+}
@@ -0,0 +1,81 @@
+// Package main provides modelplex-mockprovider, a fake upstream that answers like the OpenAI,
+// Anthropic and Ollama APIs, so modelplex can be exercised end-to-end without credentials:
+//
+//	go run ./cmd/modelplex-mockprovider --listen 127.0.0.1:9090 --latency 200ms --error-rate 0.1
+//
+// Providers point at it with base_url "http://127.0.0.1:9090/v1" for the openai and anthropic
+// types, and "http://127.0.0.1:9090" for ollama. Every completion replies with the same text,
+// streamed word by word when the request asks for a stream.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+)
+
+const (
+	readTimeout = 30 * time.Second
+	// Injected errors must be HTTP error statuses
+	minErrorStatus = 400
+	maxErrorStatus = 599
+)
+
+// Options defines command line options
+type Options struct {
+	Listen      string        `short:"l" long:"listen" default:"127.0.0.1:9090" description:"Address to listen on"`
+	Models      []string      `short:"m" long:"model" default:"mock-model" description:"Model to list (repeatable)"`
+	Reply       string        `long:"reply" default:"Hello from modelplex-mockprovider!" description:"Completion text"`
+	Latency     time.Duration `long:"latency" description:"Delay before each response, e.g. 200ms"`
+	ChunkDelay  time.Duration `long:"chunk-delay" default:"20ms" description:"Delay between streamed chunks"`
+	ErrorRate   float64       `long:"error-rate" description:"Fraction of completions that fail, from 0 to 1"`
+	ErrorStatus int           `long:"error-status" default:"500" description:"HTTP status of failed completions"`
+}
+
+func main() {
+	var opts Options
+	parser := flags.NewParser(&opts, flags.Default)
+	parser.Name = "modelplex-mockprovider"
+
+	if _, err := parser.Parse(); err != nil {
+		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+			os.Exit(0)
+		}
+		os.Exit(1)
+	}
+	if err := opts.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	server := &http.Server{
+		Addr:        opts.Listen,
+		Handler:     newRouter(&opts),
+		ReadTimeout: readTimeout,
+	}
+	slog.Info("Mock provider listening", "address", opts.Listen, "models", opts.Models,
+		"latency", opts.Latency, "error_rate", opts.ErrorRate)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Mock provider failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// validate checks the options that flag parsing can't.
+func (o *Options) validate() error {
+	if o.ErrorRate < 0 || o.ErrorRate > 1 {
+		return fmt.Errorf("--error-rate must be between 0 and 1, got %v", o.ErrorRate)
+	}
+	if o.ErrorStatus < minErrorStatus || o.ErrorStatus > maxErrorStatus {
+		return fmt.Errorf("--error-status must be an HTTP error status, got %d", o.ErrorStatus)
+	}
+	if o.Latency < 0 || o.ChunkDelay < 0 {
+		return errors.New("--latency and --chunk-delay must not be negative")
+	}
+	return nil
+}
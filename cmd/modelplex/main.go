@@ -2,8 +2,10 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -11,15 +13,18 @@ import (
 	"github.com/jessevdk/go-flags"
 
 	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/monitoring"
 	"github.com/modelplex/modelplex/internal/server"
 )
 
 // Options defines command line options
 type Options struct {
-	Config  string `short:"c" long:"config" default:"config.toml" description:"Path to configuration file"`
-	Socket  string `short:"s" long:"socket" default:"./modelplex.socket" description:"Path to Unix socket"`
-	Verbose bool   `short:"v" long:"verbose" description:"Enable verbose logging"`
-	Version bool   `long:"version" description:"Show version information"`
+	Config    string `short:"c" long:"config" default:"config.toml" description:"Path to configuration file"`
+	Socket    string `short:"s" long:"socket" default:"./modelplex.socket" description:"Path to Unix socket"`
+	HTTP      string `long:"http" description:"Also serve HTTP and internal endpoints on this address"`
+	Verbose   bool   `short:"v" long:"verbose" description:"Enable verbose logging"`
+	LogFormat string `long:"log-format" choice:"text" choice:"json" description:"Log format, overrides server.log_format"`
+	Version   bool   `long:"version" description:"Show version information"`
 }
 
 var (
@@ -30,9 +35,7 @@ var (
 
 func main() {
 	var opts Options
-	parser := flags.NewParser(&opts, flags.Default)
-	parser.Name = "modelplex"
-	parser.Usage = "[OPTIONS]"
+	parser := newParser(&opts)
 
 	_, err := parser.Parse()
 	if err != nil {
@@ -50,39 +53,98 @@ func main() {
 	}
 
 	if opts.Verbose {
-		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
-			Level:     slog.LevelDebug,
-			AddSource: true,
-		})))
+		monitoring.Level.Set(slog.LevelDebug)
+	}
+	setupLogging(opts.LogFormat, opts.Verbose)
+	if opts.Verbose {
 		slog.Info("Verbose logging enabled")
-	} else {
-		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
-			Level: slog.LevelInfo,
-		})))
 	}
 
-	cfg, err := config.Load(opts.Config)
+	if parser.Active != nil && parser.Active.Name == "models" {
+		if err := listModels(opts.Config, os.Stdout); err != nil {
+			slog.Error("Failed to list models", "error", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	configOption := parser.FindOptionByLongName("config")
+	cfg, err := loadConfig(opts.Config, configOption.IsSet() && !configOption.IsSetDefault())
 	if err != nil {
 		slog.Error("Failed to load config", "file", opts.Config, "error", err)
 		os.Exit(1)
 	}
 
+	if opts.LogFormat == "" && cfg.Server.LogFormat != "" {
+		setupLogging(cfg.Server.LogFormat, opts.Verbose)
+	}
+
 	slog.Info("Loaded configuration", "file", opts.Config)
-	slog.Info("Starting server", "socket", opts.Socket)
+	slog.Info("Starting server", "socket", opts.Socket, "http", opts.HTTP)
 
-	srv := server.New(cfg, opts.Socket)
+	srv := server.NewWithHTTPAddress(cfg, opts.Socket, opts.HTTP)
+	srv.SetConfigPath(opts.Config)
 
 	go func() {
-		if err := srv.Start(); err != nil {
+		if err := srv.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			slog.Error("Server failed", "error", err)
 			os.Exit(1)
 		}
 	}()
 
+	// SIGHUP reloads the config file; an invalid config is logged and the running one kept
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := <-sigChan; sig == syscall.SIGHUP; sig = <-sigChan {
+		if _, err := srv.Reload(); err != nil {
+			slog.Error("Config reload failed", "error", err)
+		}
+	}
 
 	slog.Info("Shutting down...")
 	srv.Stop()
 }
+
+// loadConfig loads the config file at path. If it's the default path, rather than one given
+// explicitly, and there's no file there, modelplex starts without providers instead of failing,
+// so it can be tried before writing a config; creating the file and sending SIGHUP loads it.
+func loadConfig(path string, explicit bool) (*config.Config, error) {
+	cfg, err := config.Load(path)
+	if err != nil && !explicit && errors.Is(err, config.ErrConfigNotFound) {
+		slog.Warn("Config file not found, starting without providers", "file", path)
+		return &config.Config{}, nil
+	}
+	return cfg, err
+}
+
+// newParser returns the command line parser for opts, with its optional subcommands.
+func newParser(opts *Options) *flags.Parser {
+	parser := flags.NewParser(opts, flags.Default)
+	parser.Name = "modelplex"
+	parser.Usage = "[OPTIONS] [models]"
+	parser.SubcommandsOptional = true
+
+	if _, err := parser.AddCommand("models", "List models and their providers",
+		"Load the config, discover models, and print each model with the providers serving it, "+
+			"without starting a server.", &ModelsCommand{}); err != nil {
+		panic(err)
+	}
+	return parser
+}
+
+// setupLogging installs the default logger, writing text or JSON to stderr at monitoring.Level.
+// Verbose logging also includes the source location of each log call.
+func setupLogging(format string, verbose bool) {
+	handlerOpts := &slog.HandlerOptions{
+		Level:     monitoring.Level,
+		AddSource: verbose,
+	}
+
+	var handler slog.Handler
+	if format == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, handlerOpts)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, handlerOpts)
+	}
+	slog.SetDefault(slog.New(handler))
+}
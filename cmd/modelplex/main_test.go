@@ -1,6 +1,10 @@
 package main
 
 import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/jessevdk/go-flags"
@@ -117,3 +121,98 @@ func TestOptionsStructTags(t *testing.T) {
 	require.True(t, ok)
 	assert.Equal(t, flags.ErrHelp, flagsErr.Type)
 }
+
+func TestLoadConfig_Missing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+
+	// The default path may be missing, but not one given explicitly
+	cfg, err := loadConfig(path, false)
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Providers)
+
+	_, err = loadConfig(path, true)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// Only a missing file is tolerated
+	require.NoError(t, os.WriteFile(path, []byte("not toml ["), 0o600))
+	_, err = loadConfig(path, false)
+	require.Error(t, err)
+}
+
+func TestNewParser_ModelsCommand(t *testing.T) {
+	var opts Options
+	parser := newParser(&opts)
+
+	_, err := parser.ParseArgs([]string{"models", "--config", "foo.toml"})
+	require.NoError(t, err)
+	require.NotNil(t, parser.Active)
+	assert.Equal(t, "models", parser.Active.Name)
+	assert.Equal(t, "foo.toml", opts.Config)
+
+	// Without a command the server runs
+	opts = Options{}
+	parser = newParser(&opts)
+	_, err = parser.ParseArgs([]string{})
+	require.NoError(t, err)
+	assert.Nil(t, parser.Active)
+}
+
+func TestListModels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+[[providers]]
+name = "backup"
+type = "openai"
+models = ["gpt-4"]
+priority = 2
+
+[[providers]]
+name = "openai"
+type = "openai"
+models = ["gpt-4", "gpt-3.5-turbo"]
+priority = 1
+`), 0o600))
+
+	var out bytes.Buffer
+	require.NoError(t, listModels(path, &out))
+	assert.Equal(t, "MODEL          PROVIDERS\n"+
+		"gpt-3.5-turbo  openai\n"+
+		"gpt-4          openai, backup\n", out.String())
+}
+
+func TestListModels_Routing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+[server]
+default_provider = "local"
+
+[[providers]]
+name = "openai"
+type = "openai"
+models = ["gpt-4o"]
+
+[[providers]]
+name = "local"
+type = "ollama"
+base_url = "http://127.0.0.1:1"
+
+[[models]]
+name = "fast"
+alias_for = ["llama3"]
+`), 0o600))
+
+	var out bytes.Buffer
+	require.NoError(t, listModels(path, &out))
+	assert.Equal(t, "MODEL           PROVIDERS\n"+
+		"fast -> llama3  local (default)\n"+
+		"gpt-4o          openai\n", out.String())
+}
+
+func TestListModels_InvalidConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(path, []byte(`invalid toml [[[`), 0o600))
+
+	err := listModels(path, io.Discard)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), path)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/monitoring"
+	"github.com/modelplex/modelplex/internal/multiplexer"
+)
+
+const (
+	// modelsDiscoveryTimeout bounds model discovery for the models command
+	modelsDiscoveryTimeout = 10 * time.Second
+	tabPadding             = 2
+)
+
+// ModelsCommand lists the models the config routes, without starting a server.
+type ModelsCommand struct{}
+
+// listModels loads the config at path, discovers models from providers that support it, and
+// writes each routable model with the providers serving it, in routing order, to w. Models are
+// routed as the server routes them, so an alias is listed with the model it resolves to, and a
+// model only the default provider serves is marked as such.
+func listModels(path string, w io.Writer) error {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return fmt.Errorf("cannot load %s: %w", path, err)
+	}
+
+	mux := multiplexer.NewFromConfig(cfg, monitoring.NewMetrics())
+	ctx, cancel := context.WithTimeout(context.Background(), modelsDiscoveryTimeout)
+	mux.DiscoverModels(ctx)
+	cancel()
+
+	table := tabwriter.NewWriter(w, 0, 0, tabPadding, ' ', 0)
+	fmt.Fprintln(table, "MODEL\tPROVIDERS")
+	for _, route := range mux.Routing() {
+		model, providers := route.Model, strings.Join(route.Providers, ", ")
+		if route.ResolvesTo != "" {
+			model += " -> " + route.ResolvesTo
+		}
+		if route.Default {
+			providers += " (default)"
+		}
+		fmt.Fprintf(table, "%s\t%s\n", model, providers)
+	}
+	return table.Flush()
+}
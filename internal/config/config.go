@@ -2,31 +2,108 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/pelletier/go-toml/v2"
+
+	"github.com/modelplex/modelplex/pkg/provider"
 )
 
 // Config represents the main configuration structure for modelplex.
 type Config struct {
-	Providers []Provider `toml:"providers"`
-	MCP       MCPConfig  `toml:"mcp"`
-	Server    Server     `toml:"server"`
+	Providers     []Provider      `toml:"providers"`
+	MCP           MCPConfig       `toml:"mcp"`
+	Server        Server          `toml:"server"`
+	ModelDefaults []ModelDefaults `toml:"model_defaults"`
+	Models        []Model         `toml:"models"`
 }
 
 // Provider represents configuration for an AI provider.
-type Provider struct {
-	Name     string   `toml:"name"`
-	Type     string   `toml:"type"`
-	BaseURL  string   `toml:"base_url"`
-	APIKey   string   `toml:"api_key"`
-	Models   []string `toml:"models"`
-	Priority int      `toml:"priority"`
+// It is defined in pkg/provider so custom providers can be configured too.
+type Provider = provider.Config
+
+// TransformConfig configures a request/response transform for a provider.
+type TransformConfig = provider.TransformConfig
+
+// ModelPriority overrides a provider's priority for routing one model.
+type ModelPriority = provider.ModelPriority
+
+// ModelDefaults holds default generation parameters for one model. Every key other
+// than "model" is a request parameter applied when the request doesn't set it:
+//
+//	[[model_defaults]]
+//	model = "gpt-4"
+//	temperature = 0.2
+//	max_tokens = 1000
+type ModelDefaults map[string]interface{}
+
+// Model returns the model these defaults apply to.
+func (d ModelDefaults) Model() string {
+	model, _ := d["model"].(string)
+	return model
+}
+
+// Params returns the default parameters, excluding the "model" key.
+func (d ModelDefaults) Params() map[string]interface{} {
+	params := make(map[string]interface{}, len(d))
+	for key, value := range d {
+		if key != "model" {
+			params[key] = value
+		}
+	}
+	return params
+}
+
+// Model describes what a model can do, or defines an alias for several models:
+//
+//	[[models]]
+//	name = "gpt-4o"
+//	capabilities = ["vision", "tools"]
+//
+//	[[models]]
+//	name = "best"
+//	alias_for = ["gpt-4o-mini", "gpt-4o"]
+//
+// Requests that require capabilities, such as "vision" for messages with images, are only
+// routed to models that have them all. Models without a configured capabilities list are
+// assumed to have any. An alias resolves to the first of its models that has the required
+// capabilities and is served by a provider.
+//
+// InputCost and OutputCost are a model's prices in USD per million prompt and completion
+// tokens, from which the cost of each request to it is estimated.
+//
+// SystemPrompt is added to chat requests for the model, or alias, as SystemPromptMode says,
+// like a provider's system_prompt; it's added before the provider's.
+//
+// MaxMessages, if set, rejects chat requests for the model, or alias, with more messages than it,
+// like a provider's max_messages.
+type Model struct {
+	Name             string   `toml:"name"`
+	Capabilities     []string `toml:"capabilities"`
+	AliasFor         []string `toml:"alias_for"`
+	InputCost        float64  `toml:"input_cost"`
+	OutputCost       float64  `toml:"output_cost"`
+	SystemPrompt     string   `toml:"system_prompt"`
+	SystemPromptMode string   `toml:"system_prompt_mode"`
+	MaxMessages      int      `toml:"max_messages"`
 }
 
 // MCPConfig represents MCP (Model Context Protocol) configuration.
 type MCPConfig struct {
 	Servers []MCPServer `toml:"servers"`
+	// RequireMCP fails startup if any MCP server can't be started, instead of running without it.
+	RequireMCP bool `toml:"require_mcp"`
+	// ToolTimeout bounds each tool call made through /mcp/v1/tools (default 60s).
+	ToolTimeout Duration `toml:"tool_timeout"`
+	// AllowedTools, if set, are the only tools listed and callable, whatever the servers provide.
+	AllowedTools []string `toml:"allowed_tools"`
 }
 
 // MCPServer represents configuration for a single MCP server.
@@ -34,25 +111,484 @@ type MCPServer struct {
 	Name    string   `toml:"name"`
 	Command string   `toml:"command"`
 	Args    []string `toml:"args"`
+	// MaxMessageSize is the largest message, in bytes, read from the server (default 16MiB).
+	// Tool results such as file contents are sent as a single line, so this bounds them.
+	MaxMessageSize int `toml:"max_message_size"`
 }
 
 // Server represents HTTP server configuration.
 type Server struct {
-	LogLevel       string `toml:"log_level"`
-	MaxRequestSize int64  `toml:"max_request_size"`
+	LogLevel string `toml:"log_level"`
+	// LogFormat is "text" (default) or "json"; the --log-format flag takes precedence.
+	LogFormat string `toml:"log_format"`
+	// LogRequests logs every request routed to a provider, with its model, duration and outcome.
+	LogRequests    bool  `toml:"log_requests"`
+	MaxRequestSize int64 `toml:"max_request_size"`
+	// Offline only allows providers that don't need external network access (see OfflineCapable),
+	// so requests can't leave an air-gapped machine whatever else the config says.
+	Offline bool `toml:"offline"`
+	// DefaultProvider names the provider that models no provider serves are routed to.
+	// If empty, requests for unknown models fail with 404.
+	DefaultProvider string `toml:"default_provider"`
+	// NoProviderPolicy decides where models no provider serves are routed: see the NoProvider*
+	// policies. It defaults to NoProviderFallbackDefault if DefaultProvider is set, and to
+	// NoProviderError otherwise.
+	NoProviderPolicy string `toml:"no_provider_policy"`
+	// ModelPrefix is stripped from requested model names (default "modelplex-").
+	ModelPrefix string `toml:"model_prefix"`
+	// PrefixModels advertises models with ModelPrefix prepended in /models.
+	PrefixModels bool `toml:"prefix_models"`
+	// RepairJSON fixes common mistakes, such as trailing commas or missing closing brackets, in chat
+	// completions that should be JSON objects according to their request's response_format but aren't.
+	RepairJSON bool `toml:"repair_json"`
+	// InjectUsage adds a "_modelplex" object, with the same usage as the X-Modelplex-Usage header,
+	// to non-streaming completions. It's off by default, as strict clients may reject unknown fields.
+	InjectUsage bool `toml:"inject_usage"`
+	// ListenBacklog sets the HTTP listener's accept queue length (default: the system's maximum).
+	ListenBacklog int `toml:"listen_backlog"`
+	// CreateSocketDir creates the socket's parent directory if it doesn't exist.
+	CreateSocketDir bool         `toml:"create_socket_dir"`
+	Idempotency     Idempotency  `toml:"idempotency"`
+	RateLimit       RateLimit    `toml:"rate_limit"`
+	Batch           Batch        `toml:"batch"`
+	Realtime        Realtime     `toml:"realtime"`
+	StartupProbe    StartupProbe `toml:"startup_probe"`
+	Reload          Reload       `toml:"reload"`
+	// MaxRequestTimeout caps the timeout clients can set with the X-Modelplex-Timeout header (default 10m).
+	MaxRequestTimeout Duration `toml:"max_request_timeout"`
+	// MaxEmbeddingInputs is the most inputs one embeddings request may contain (default 2048).
+	MaxEmbeddingInputs int `toml:"max_embedding_inputs"`
+	// CaptureFile, if set, is a JSONL file every request to the OpenAI-compatible endpoints is
+	// appended to, with its response and with credentials redacted, for debugging or replay. It's
+	// rotated once it would grow beyond CaptureMaxSize bytes (default 100MiB). Both only take effect on restart.
+	CaptureFile    string `toml:"capture_file"`
+	CaptureMaxSize int64  `toml:"capture_max_size"`
+	// HeartbeatInterval is how often a summary of the requests served and the providers' health
+	// is logged, with some jitter. It's off by default.
+	HeartbeatInterval Duration `toml:"heartbeat_interval"`
+	// ConnectionPool tunes the connections kept open to upstream providers.
+	ConnectionPool ConnectionPool `toml:"connection_pool"`
+	// Socket tunes client connections to the Unix socket.
+	Socket Socket `toml:"socket"`
+	// HTTP configures the HTTP listener enabled with --http.
+	HTTP HTTP `toml:"http"`
+	// Shadow copies chat completions to a provider to compare its responses with the ones clients get.
+	Shadow Shadow `toml:"shadow"`
+}
+
+// Shadow configures a shadow provider, which is sent a copy of each non-streaming chat completion
+// that succeeds, in the background, and whose response is compared with the one the client got,
+// to validate a migration or compare models. Shadow responses never reach clients.
+type Shadow struct {
+	// Provider names the shadow provider, which then only serves copies, never clients directly.
+	// Empty disables shadowing.
+	Provider string `toml:"provider"`
+	// Model, if set, is requested from the shadow provider instead of the client's model.
+	Model string `toml:"model"`
+	// SampleRate is the fraction of requests copied, greater than 0 and at most 1 (default 1).
+	SampleRate float64 `toml:"sample_rate"`
+	// MaxConcurrent bounds the copies in flight; requests beyond it aren't copied (default 4).
+	MaxConcurrent int `toml:"max_concurrent"`
+	// Timeout bounds each copy (default 2m).
+	Timeout Duration `toml:"timeout"`
+}
+
+// Socket configures the keep-alive connections of clients on the Unix socket, independently of
+// the HTTP listener's, which only take effect on restart, and the models the socket serves.
+type Socket struct {
+	// Models, if set, are the only models served on the socket, as requested (an alias, not the
+	// models it resolves to): others are left out of /models and fail as not found. Empty serves none.
+	Models []string `toml:"models"`
+	// IdleTimeout is how long a connection is kept open waiting for its next request (default 5m),
+	// so agents sending requests in bursts keep their connection. Negative keeps it open indefinitely.
+	IdleTimeout Duration `toml:"idle_timeout"`
+	// DisableKeepAlives closes each connection after one request.
+	DisableKeepAlives bool `toml:"disable_keep_alives"`
+}
+
+// HTTP configures the HTTP listener.
+type HTTP struct {
+	// Models, if set, are the only models served on the HTTP listener, as with Socket.Models.
+	Models []string `toml:"models"`
+}
+
+// ConnectionPool configures the HTTP connection pool shared by provider clients.
+type ConnectionPool struct {
+	// MaxIdleConns is how many idle connections are kept per upstream host (default 100).
+	MaxIdleConns int `toml:"max_idle_conns"`
+	// MaxConnsPerHost limits connections per upstream host, including active ones (default 0, unlimited).
+	MaxConnsPerHost int `toml:"max_conns_per_host"`
+	// IdleConnTimeout is how long an idle connection is kept (default 90s).
+	IdleConnTimeout Duration `toml:"idle_conn_timeout"`
+}
+
+// StartupProbe configures checking that each provider's upstream is reachable once the server starts.
+// Providers that don't respond are reported as degraded in /_internal/status and re-probed in the background.
+type StartupProbe struct {
+	Disabled bool `toml:"disabled"`
+	// Retries is how many times an unreachable provider is re-probed before it's marked degraded (default 3).
+	Retries int `toml:"retries"`
+	// Interval is the delay between startup retries (default 2s).
+	Interval Duration `toml:"interval"`
+	// RetryInterval is the delay between background re-probes of degraded providers (default 30s).
+	RetryInterval Duration `toml:"retry_interval"`
+}
+
+// RateLimit configures per-client token-bucket rate limiting on the HTTP listener.
+// Clients are identified by their bearer API key, or by IP address if they send none.
+type RateLimit struct {
+	// RequestsPerMinute is the default limit per client; 0 leaves clients unlimited.
+	RequestsPerMinute int `toml:"requests_per_minute"`
+	// Keys overrides RequestsPerMinute for specific API keys; clients sending other keys are limited by IP.
+	Keys map[string]int `toml:"keys"`
+	// MaxClients bounds the number of tracked clients (default 10000).
+	MaxClients int `toml:"max_clients"`
+}
+
+// Batch bounds the chat completion batches sent to /models/v1/chat/completions/batch.
+type Batch struct {
+	// MaxItems is the most requests one batch may contain (default 100). MaxRequests is its former
+	// name, used if MaxItems isn't set.
+	MaxItems    int `toml:"max_items"`
+	MaxRequests int `toml:"max_requests"`
+	// MaxConcurrency is how many batch requests are sent upstream at once (default 8), across all
+	// batches, so concurrent batches can't add up to more than the upstreams allow.
+	MaxConcurrency int `toml:"max_concurrency"`
+}
+
+// Realtime configures streaming chat completions over a WebSocket at /models/v1/realtime.
+type Realtime struct {
+	Enabled bool `toml:"enabled"`
+	// PingInterval is how often idle connections are pinged to keep them alive (default 30s).
+	PingInterval Duration `toml:"ping_interval"`
+}
+
+// Reload configures how a reloaded config is swapped in.
+type Reload struct {
+	// Drain holds new requests while those in flight finish with the old config, then swaps
+	// in the new one, so that no request is served by the old config after a reload returns.
+	// Without it, the new config is swapped in at once and serves alongside in-flight requests.
+	Drain bool `toml:"drain"`
+	// DrainTimeout bounds how long a draining reload waits for requests in flight (default 30s),
+	// after which it swaps in the new config anyway.
+	DrainTimeout Duration `toml:"drain_timeout"`
 }
 
+// Idempotency configures replaying responses for requests that carry an Idempotency-Key header.
+type Idempotency struct {
+	Enabled bool `toml:"enabled"`
+	// TTL is how long a completed response is replayed for (default 10m).
+	TTL Duration `toml:"ttl"`
+	// MaxEntries bounds the number of remembered keys (default 1000).
+	MaxEntries int `toml:"max_entries"`
+}
+
+// Duration is a time.Duration that decodes from TOML strings such as "30s" or "10m".
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalText parses a duration string using time.ParseDuration.
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
+
+// MarshalText formats the duration using time.Duration.String.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
+
+// Errors returned by Load, wrapping the underlying error, so callers can tell a missing config file
+// from a malformed or invalid one.
+var (
+	// ErrConfigNotFound is returned when there's no file at the config path.
+	ErrConfigNotFound = errors.New("config file not found")
+	// ErrConfigParse is returned when the config file isn't valid TOML, or has values of the wrong type.
+	ErrConfigParse = errors.New("cannot parse config")
+	// ErrConfigInvalid is returned when the config parses, but Validate rejects it.
+	ErrConfigInvalid = errors.New("invalid config")
+)
+
 // Load reads and parses a TOML configuration file.
 func Load(path string) (*Config, error) {
 	data, err := os.ReadFile(path) // #nosec G304 -- config file path is provided by user via CLI flag
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %w", ErrConfigNotFound, err)
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	var cfg Config
 	if err := toml.Unmarshal(data, &cfg); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrConfigParse, err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrConfigInvalid, err)
 	}
 
 	return &cfg, nil
 }
+
+// Validate checks the configuration for semantic errors that TOML parsing can't catch.
+func (c *Config) Validate() error {
+	switch c.Server.LogFormat {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("server.log_format: unknown format %q (expected \"text\" or \"json\")", c.Server.LogFormat)
+	}
+
+	models := make(map[string]bool)
+	discovers := false
+	defaultProviderFound := c.Server.DefaultProvider == ""
+	offlineCapable := false
+	for i, provider := range c.Providers {
+		if provider.Name == c.Server.DefaultProvider {
+			defaultProviderFound = true
+		}
+		if OfflineCapable(&c.Providers[i]) {
+			offlineCapable = true
+		}
+		if err := validateProvider(&c.Providers[i]); err != nil {
+			return fmt.Errorf("providers[%d]: %w", i, err)
+		}
+		if len(provider.Models) == 0 {
+			discovers = true
+		}
+		for _, model := range provider.Models {
+			models[model] = true
+		}
+	}
+
+	if c.Server.Offline && !offlineCapable {
+		return errors.New("server.offline: no provider works offline (only ollama providers on localhost or a Unix socket do)")
+	}
+
+	if !defaultProviderFound {
+		return fmt.Errorf("server.default_provider: no provider named %q", c.Server.DefaultProvider)
+	}
+	if err := c.Server.validateNoProviderPolicy(); err != nil {
+		return err
+	}
+	if err := c.validateShadow(); err != nil {
+		return err
+	}
+
+	for i, defaults := range c.ModelDefaults {
+		model := defaults.Model()
+		if model == "" {
+			return fmt.Errorf("model_defaults[%d]: missing model", i)
+		}
+		// Providers without a static model list discover models at runtime, so they can't be checked here
+		if !models[model] && !discovers {
+			return fmt.Errorf("model_defaults[%d]: model %q is not served by any provider", i, model)
+		}
+	}
+
+	return c.validateModels()
+}
+
+// Policies for routing models no provider serves
+const (
+	// NoProviderError rejects requests for them with 404
+	NoProviderError = "error"
+	// NoProviderFallbackDefault routes them to the default provider
+	NoProviderFallbackDefault = "fallback_default"
+	// NoProviderFallbackFirst routes them to the first provider in routing order, the one with the
+	// lowest priority
+	NoProviderFallbackFirst = "fallback_first"
+)
+
+// NoProvider returns the policy for models no provider serves, resolving the default.
+func (s *Server) NoProvider() string {
+	if s.NoProviderPolicy != "" {
+		return s.NoProviderPolicy
+	}
+	if s.DefaultProvider != "" {
+		return NoProviderFallbackDefault
+	}
+	return NoProviderError
+}
+
+// validateNoProviderPolicy checks that the policy is known, and that a default provider is set
+// exactly when the policy uses it.
+func (s *Server) validateNoProviderPolicy() error {
+	switch s.NoProvider() {
+	case NoProviderFallbackDefault:
+		if s.DefaultProvider == "" {
+			return fmt.Errorf("server.no_provider_policy: %q needs server.default_provider", NoProviderFallbackDefault)
+		}
+		return nil
+	case NoProviderError, NoProviderFallbackFirst:
+		if s.DefaultProvider != "" {
+			return fmt.Errorf("server.default_provider: unused with no_provider_policy %q", s.NoProviderPolicy)
+		}
+		return nil
+	default:
+		return fmt.Errorf("server.no_provider_policy: unknown policy %q (expected %q, %q or %q)",
+			s.NoProviderPolicy, NoProviderError, NoProviderFallbackDefault, NoProviderFallbackFirst)
+	}
+}
+
+// validateShadow checks that the shadow provider exists and isn't also the default provider,
+// and that its budget is valid.
+func (c *Config) validateShadow() error {
+	shadow := c.Server.Shadow
+	if shadow.Provider == "" {
+		return nil
+	}
+	found := false
+	for i := range c.Providers {
+		found = found || c.Providers[i].Name == shadow.Provider
+	}
+	if !found {
+		return fmt.Errorf("server.shadow.provider: no provider named %q", shadow.Provider)
+	}
+	if shadow.Provider == c.Server.DefaultProvider {
+		return fmt.Errorf("server.shadow.provider: %q is the default provider, which serves clients", shadow.Provider)
+	}
+	if shadow.SampleRate < 0 || shadow.SampleRate > 1 {
+		return fmt.Errorf("server.shadow.sample_rate: %v must be between 0 and 1", shadow.SampleRate)
+	}
+	if shadow.MaxConcurrent < 0 || shadow.Timeout.Duration < 0 {
+		return errors.New("server.shadow: max_concurrent and timeout must not be negative")
+	}
+	return nil
+}
+
+// validateProvider checks the settings of one provider.
+func validateProvider(provider *Provider) error {
+	if provider.Type == "vertex" && (provider.Project == "" || provider.Region == "") {
+		return errors.New("vertex providers need a project and region")
+	}
+	if provider.MaxMessages < 0 {
+		return errors.New("max_messages must not be negative")
+	}
+	if _, err := provider.TLSConfig(); err != nil {
+		return err
+	}
+	if _, err := provider.RefreshEvery(); err != nil {
+		return err
+	}
+	if _, _, err := provider.Timeouts(); err != nil {
+		return err
+	}
+	if _, err := provider.StrictNormalization(); err != nil {
+		return err
+	}
+	if _, err := provider.EchoUpstreamModel(); err != nil {
+		return err
+	}
+	if _, err := provider.Credentials(); err != nil {
+		return err
+	}
+	if _, err := provider.ModelPriorities(); err != nil {
+		return err
+	}
+	if _, _, err := provider.Templates(); err != nil {
+		return err
+	}
+	if _, err := provider.PromptMode(); err != nil {
+		return err
+	}
+	if _, err := provider.SessionHeaderName(); err != nil {
+		return err
+	}
+	if _, _, err := provider.APIKeyPlacement(); err != nil {
+		return err
+	}
+	if _, _, err := provider.RetryPolicy(); err != nil {
+		return err
+	}
+	if err := validatePath("chat_path", provider.ChatPath); err != nil {
+		return err
+	}
+	if err := validatePath("completion_path", provider.CompletionPath); err != nil {
+		return err
+	}
+	for j := range provider.Transforms {
+		if err := provider.Transforms[j].Validate(); err != nil {
+			return fmt.Errorf("transforms[%d]: %w", j, err)
+		}
+	}
+	return nil
+}
+
+// validateModels checks that models are named once each, and that aliases only refer to models.
+func (c *Config) validateModels() error {
+	aliases := make(map[string]bool)
+	for _, model := range c.Models {
+		if len(model.AliasFor) > 0 {
+			aliases[model.Name] = true
+		}
+	}
+
+	names := make(map[string]bool, len(c.Models))
+	for i, model := range c.Models {
+		switch {
+		case model.Name == "":
+			return fmt.Errorf("models[%d]: missing name", i)
+		case names[model.Name]:
+			return fmt.Errorf("models[%d]: model %q is already defined", i, model.Name)
+		case len(model.AliasFor) > 0 && len(model.Capabilities) > 0:
+			return fmt.Errorf("models[%d]: alias %q can't have capabilities; set them on its models", i, model.Name)
+		case len(model.AliasFor) > 0 && (model.InputCost != 0 || model.OutputCost != 0):
+			return fmt.Errorf("models[%d]: alias %q can't have costs; set them on its models", i, model.Name)
+		case model.InputCost < 0 || model.OutputCost < 0:
+			return fmt.Errorf("models[%d]: costs of %q must not be negative", i, model.Name)
+		case model.MaxMessages < 0:
+			return fmt.Errorf("models[%d]: max_messages of %q must not be negative", i, model.Name)
+		}
+		if _, err := provider.ParseSystemPromptMode(model.SystemPromptMode); err != nil {
+			return fmt.Errorf("models[%d]: %w", i, err)
+		}
+		names[model.Name] = true
+		for _, target := range model.AliasFor {
+			if aliases[target] {
+				return fmt.Errorf("models[%d]: alias %q refers to alias %q", i, model.Name, target)
+			}
+		}
+	}
+	return nil
+}
+
+// OfflineCapable reports whether a provider works without external network access, which is
+// what offline mode allows. Only Ollama on the local machine does: its base_url must be unset
+// (the default is localhost), a loopback address or a Unix socket.
+func OfflineCapable(p *Provider) bool {
+	return p.Type == "ollama" && isLocalURL(p.BaseURL)
+}
+
+// isLocalURL reports whether rawURL is empty or points at a loopback host or a Unix socket.
+func isLocalURL(rawURL string) bool {
+	if rawURL == "" {
+		return true
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	if u.Scheme == "unix" || strings.HasSuffix(u.Scheme, "+unix") {
+		return true
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// validatePath checks that an endpoint path override, if set, is an absolute path.
+func validatePath(key, path string) error {
+	if path != "" && !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("%s: %q must start with \"/\"", key, path)
+	}
+	return nil
+}
@@ -1,8 +1,11 @@
 package config
 
 import (
+	"io/fs"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -21,6 +24,7 @@ func TestLoad(t *testing.T) {
 [server]
 log_level = "info"
 max_request_size = 10485760
+default_provider = "openai"
 
 [[providers]]
 name = "openai"
@@ -40,6 +44,7 @@ args = ["-y", "@modelcontextprotocol/server-filesystem", "/tmp"]
 			validate: func(t *testing.T, cfg *Config) {
 				assert.Equal(t, "info", cfg.Server.LogLevel)
 				assert.Equal(t, int64(10485760), cfg.Server.MaxRequestSize)
+				assert.Equal(t, "openai", cfg.Server.DefaultProvider)
 				require.Len(t, cfg.Providers, 1)
 				assert.Equal(t, "openai", cfg.Providers[0].Name)
 				assert.Equal(t, "openai", cfg.Providers[0].Type)
@@ -67,6 +72,378 @@ log_level = "debug"
 				assert.Empty(t, cfg.MCP.Servers)
 			},
 		},
+		{
+			name: "offline with ollama",
+			configData: `
+[server]
+offline = true
+
+[[providers]]
+name = "openai"
+type = "openai"
+models = ["gpt-4"]
+
+[[providers]]
+name = "local"
+type = "ollama"
+`,
+			validate: func(t *testing.T, cfg *Config) {
+				assert.True(t, cfg.Server.Offline)
+				assert.False(t, OfflineCapable(&cfg.Providers[0]))
+				assert.True(t, OfflineCapable(&cfg.Providers[1]))
+			},
+		},
+		{
+			name: "offline with local ollama base_url",
+			configData: `
+[server]
+offline = true
+
+[[providers]]
+name = "loopback"
+type = "ollama"
+base_url = "http://127.0.0.1:11434"
+
+[[providers]]
+name = "ipv6"
+type = "ollama"
+base_url = "http://[::1]:11434"
+
+[[providers]]
+name = "socket"
+type = "ollama"
+base_url = "unix:///run/ollama.sock"
+`,
+			validate: func(t *testing.T, cfg *Config) {
+				for i := range cfg.Providers {
+					assert.True(t, OfflineCapable(&cfg.Providers[i]), cfg.Providers[i].Name)
+				}
+			},
+		},
+		{
+			name: "offline with remote ollama",
+			configData: `
+[server]
+offline = true
+
+[[providers]]
+name = "remote"
+type = "ollama"
+base_url = "http://gpu-box.internal:11434"
+`,
+			wantErr: true,
+		},
+		{
+			name: "json log format",
+			configData: `
+[server]
+log_format = "json"
+`,
+			validate: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, "json", cfg.Server.LogFormat)
+			},
+		},
+		{
+			name: "unknown log format",
+			configData: `
+[server]
+log_format = "xml"
+`,
+			wantErr: true,
+		},
+		{
+			name: "connection pool",
+			configData: `
+[server.connection_pool]
+max_idle_conns = 256
+max_conns_per_host = 512
+idle_conn_timeout = "2m"
+`,
+			validate: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, ConnectionPool{
+					MaxIdleConns:    256,
+					MaxConnsPerHost: 512,
+					IdleConnTimeout: Duration{2 * time.Minute},
+				}, cfg.Server.ConnectionPool)
+			},
+		},
+		{
+			name: "provider transforms",
+			configData: `
+[[providers]]
+name = "gateway"
+type = "openai"
+models = ["gpt-4"]
+
+[[providers.transforms]]
+type = "force_model"
+model = "gpt-4o"
+
+[[providers.transforms]]
+type = "default_params"
+params = { stop = ["END"] }
+`,
+			validate: func(t *testing.T, cfg *Config) {
+				require.Len(t, cfg.Providers[0].Transforms, 2)
+				assert.Equal(t, "gpt-4o", cfg.Providers[0].Transforms[0].Model)
+				assert.Equal(t, []interface{}{"END"}, cfg.Providers[0].Transforms[1].Params["stop"])
+			},
+		},
+		{
+			name: "unknown transform",
+			configData: `
+[[providers]]
+name = "gateway"
+type = "openai"
+models = ["gpt-4"]
+
+[[providers.transforms]]
+type = "rewrite_everything"
+`,
+			wantErr: true,
+		},
+		{
+			name: "missing ca_cert",
+			configData: `
+[[providers]]
+name = "vllm"
+type = "openai"
+base_url = "https://vllm.internal:8000/v1"
+models = ["llama-3"]
+ca_cert = "/nonexistent/ca.pem"
+`,
+			wantErr: true,
+		},
+		{
+			name: "relative chat_path",
+			configData: `
+[[providers]]
+name = "gateway"
+type = "openai"
+models = ["gpt-4"]
+chat_path = "v1/chat/completions"
+`,
+			wantErr: true,
+		},
+		{
+			name: "unknown default_provider",
+			configData: `
+[server]
+default_provider = "openia"
+
+[[providers]]
+name = "openai"
+type = "openai"
+models = ["gpt-4"]
+`,
+			wantErr: true,
+		},
+		{
+			name: "offline without a local provider",
+			configData: `
+[server]
+offline = true
+
+[[providers]]
+name = "openai"
+type = "openai"
+models = ["gpt-4"]
+`,
+			wantErr: true,
+		},
+		{
+			name: "invalid refresh_interval",
+			configData: `
+[[providers]]
+name = "local"
+type = "ollama"
+refresh_interval = "often"
+`,
+			wantErr: true,
+		},
+		{
+			name: "unknown normalize_mode",
+			configData: `
+[[providers]]
+name = "local"
+type = "ollama"
+normalize_responses = true
+normalize_mode = "pedantic"
+`,
+			wantErr: true,
+		},
+		{
+			name: "unknown model_echo",
+			configData: `
+[[providers]]
+name = "local"
+type = "ollama"
+normalize_responses = true
+model_echo = "response"
+`,
+			wantErr: true,
+		},
+		{
+			name: "unknown credential_source",
+			configData: `
+[[providers]]
+name = "openai"
+type = "openai"
+models = ["gpt-4"]
+credential_source = "vault"
+`,
+			wantErr: true,
+		},
+		{
+			name: "invalid connect_timeout",
+			configData: `
+[[providers]]
+name = "openai"
+type = "openai"
+models = ["gpt-4"]
+connect_timeout = "-5s"
+`,
+			wantErr: true,
+		},
+		{
+			name: "unknown shadow provider",
+			configData: `
+[server.shadow]
+provider = "missing"
+
+[[providers]]
+name = "openai"
+type = "openai"
+models = ["gpt-4"]
+`,
+			wantErr: true,
+		},
+		{
+			name: "shadow sample_rate out of range",
+			configData: `
+[server.shadow]
+provider = "openai"
+sample_rate = 1.5
+
+[[providers]]
+name = "openai"
+type = "openai"
+models = ["gpt-4"]
+`,
+			wantErr: true,
+		},
+		{
+			name: "template provider without response_template",
+			configData: `
+[[providers]]
+name = "gateway"
+type = "template"
+models = ["niche-1"]
+request_template = '{"model": {{json .Model}}}'
+`,
+			wantErr: true,
+		},
+		{
+			name: "invalid request_template",
+			configData: `
+[[providers]]
+name = "gateway"
+type = "template"
+models = ["niche-1"]
+request_template = '{"model": {{json .Model}'
+response_template = '{{.text}}'
+`,
+			wantErr: true,
+		},
+		{
+			name: "model_priority overridden twice",
+			configData: `
+[[providers]]
+name = "openai"
+type = "openai"
+models = ["gpt-4"]
+
+[[providers.model_priority]]
+model = "gpt-4"
+priority = 2
+
+[[providers.model_priority]]
+model = "gpt-4"
+priority = 3
+`,
+			wantErr: true,
+		},
+		{
+			name: "unknown system_prompt_mode",
+			configData: `
+[[providers]]
+name = "openai"
+type = "openai"
+system_prompt = "Answer in English."
+system_prompt_mode = "append"
+`,
+			wantErr: true,
+		},
+		{
+			name: "invalid retry_backoff",
+			configData: `
+[[providers]]
+name = "local"
+type = "ollama"
+retry_on_body_contains = ["model is loading"]
+retry_backoff = "soon"
+`,
+			wantErr: true,
+		},
+		{
+			name: "vertex without project",
+			configData: `
+[[providers]]
+name = "vertex"
+type = "vertex"
+region = "us-central1"
+`,
+			wantErr: true,
+		},
+		{
+			name: "unknown no_provider_policy",
+			configData: `
+[server]
+no_provider_policy = "fallback_random"
+`,
+			wantErr: true,
+		},
+		{
+			name: "fallback_default without default_provider",
+			configData: `
+[server]
+no_provider_policy = "fallback_default"
+`,
+			wantErr: true,
+		},
+		{
+			name: "default_provider unused by no_provider_policy",
+			configData: `
+[server]
+default_provider = "openai"
+no_provider_policy = "fallback_first"
+
+[[providers]]
+name = "openai"
+type = "openai"
+`,
+			wantErr: true,
+		},
+		{
+			name: "negative max_messages",
+			configData: `
+[[providers]]
+name = "openai"
+type = "openai"
+max_messages = -1
+`,
+			wantErr: true,
+		},
 		{
 			name:       "invalid toml",
 			configData: `invalid toml content [[[`,
@@ -103,7 +480,284 @@ log_level = "debug"
 	}
 }
 
+func TestLoad_Errors(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+		return path
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr error
+		// cause is an error wrapped along with wantErr, if any
+		cause error
+	}{
+		{name: "missing", path: filepath.Join(dir, "missing.toml"), wantErr: ErrConfigNotFound, cause: fs.ErrNotExist},
+		{name: "bad TOML", path: write("bad.toml", "[server\n"), wantErr: ErrConfigParse},
+		{name: "wrong type", path: write("type.toml", "[server]\nlog_level = 3\n"), wantErr: ErrConfigParse},
+		{
+			name:    "invalid",
+			path:    write("invalid.toml", "[server]\nlog_format = \"xml\"\n"),
+			wantErr: ErrConfigInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(tt.path)
+			require.ErrorIs(t, err, tt.wantErr)
+			for _, other := range []error{ErrConfigNotFound, ErrConfigParse, ErrConfigInvalid} {
+				if other != tt.wantErr {
+					assert.NotErrorIs(t, err, other)
+				}
+			}
+			if tt.cause != nil {
+				assert.ErrorIs(t, err, tt.cause)
+			}
+		})
+	}
+}
+
+func TestLoad_Idempotency(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "config-*.toml")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString(`
+[server.idempotency]
+enabled = true
+ttl = "90s"
+max_entries = 50
+`)
+	require.NoError(t, err)
+	require.NoError(t, tmpFile.Close())
+
+	cfg, err := Load(tmpFile.Name())
+	require.NoError(t, err)
+	assert.True(t, cfg.Server.Idempotency.Enabled)
+	assert.Equal(t, 90*time.Second, cfg.Server.Idempotency.TTL.Duration)
+	assert.Equal(t, 50, cfg.Server.Idempotency.MaxEntries)
+}
+
+func TestLoad_ListenerModels(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "config-*.toml")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString(`
+[server.socket]
+models = ["gpt-4o-mini", "llama3"]
+
+[server.http]
+models = []
+`)
+	require.NoError(t, err)
+	require.NoError(t, tmpFile.Close())
+
+	cfg, err := Load(tmpFile.Name())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gpt-4o-mini", "llama3"}, cfg.Server.Socket.Models)
+	// An empty list serves no models, unlike an unset one
+	assert.NotNil(t, cfg.Server.HTTP.Models)
+	assert.Empty(t, cfg.Server.HTTP.Models)
+}
+
+func TestLoad_ModelDefaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			data: `
+[[providers]]
+name = "openai"
+type = "openai"
+models = ["gpt-4"]
+
+[[model_defaults]]
+model = "gpt-4"
+temperature = 0.2
+max_tokens = 1000
+`,
+		},
+		{
+			name: "unknown model",
+			data: `
+[[providers]]
+name = "openai"
+type = "openai"
+models = ["gpt-4"]
+
+[[model_defaults]]
+model = "gpt-5"
+temperature = 0.2
+`,
+			wantErr: `model "gpt-5" is not served by any provider`,
+		},
+		{
+			name: "missing model",
+			data: `
+[[model_defaults]]
+temperature = 0.2
+`,
+			wantErr: "missing model",
+		},
+		{
+			name: "discovered models can't be checked",
+			data: `
+[[providers]]
+name = "groq"
+type = "groq"
+
+[[model_defaults]]
+model = "llama-3.1-8b-instant"
+temperature = 0.2
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.toml")
+			require.NoError(t, os.WriteFile(path, []byte(tt.data), 0o600))
+
+			cfg, err := Load(path)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, cfg.ModelDefaults, 1)
+			assert.NotEmpty(t, cfg.ModelDefaults[0].Model())
+			assert.Equal(t, 0.2, cfg.ModelDefaults[0].Params()["temperature"])
+			assert.NotContains(t, cfg.ModelDefaults[0].Params(), "model")
+		})
+	}
+}
+
+func TestLoad_Models(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			data: `
+[[models]]
+name = "gpt-4o"
+capabilities = ["vision", "tools"]
+input_cost = 2.5
+output_cost = 10
+
+[[models]]
+name = "best"
+alias_for = ["gpt-4o-mini", "gpt-4o"]
+`,
+		},
+		{
+			name:    "missing name",
+			data:    "[[models]]\ncapabilities = [\"vision\"]\n",
+			wantErr: "models[0]: missing name",
+		},
+		{
+			name: "defined twice",
+			data: `
+[[models]]
+name = "gpt-4o"
+capabilities = ["vision"]
+
+[[models]]
+name = "gpt-4o"
+capabilities = ["tools"]
+`,
+			wantErr: `models[1]: model "gpt-4o" is already defined`,
+		},
+		{
+			name: "alias with capabilities",
+			data: `
+[[models]]
+name = "best"
+alias_for = ["gpt-4o"]
+capabilities = ["vision"]
+`,
+			wantErr: `alias "best" can't have capabilities`,
+		},
+		{
+			name:    "alias with costs",
+			data:    "[[models]]\nname = \"best\"\nalias_for = [\"gpt-4o\"]\ninput_cost = 1.0\n",
+			wantErr: `alias "best" can't have costs`,
+		},
+		{
+			name:    "negative cost",
+			data:    "[[models]]\nname = \"gpt-4o\"\noutput_cost = -1.0\n",
+			wantErr: `costs of "gpt-4o" must not be negative`,
+		},
+		{
+			name:    "negative max_messages",
+			data:    "[[models]]\nname = \"gpt-4o\"\nmax_messages = -1\n",
+			wantErr: `max_messages of "gpt-4o" must not be negative`,
+		},
+		{
+			name:    "unknown system_prompt_mode",
+			data:    "[[models]]\nname = \"gpt-4o\"\nsystem_prompt = \"Be brief.\"\nsystem_prompt_mode = \"append\"\n",
+			wantErr: `models[0]: system_prompt_mode: unknown mode "append"`,
+		},
+		{
+			name: "alias of an alias",
+			data: `
+[[models]]
+name = "best"
+alias_for = ["gpt-4o"]
+
+[[models]]
+name = "better"
+alias_for = ["best"]
+`,
+			wantErr: `alias "better" refers to alias "best"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.toml")
+			require.NoError(t, os.WriteFile(path, []byte(tt.data), 0o600))
+
+			cfg, err := Load(path)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, []Model{
+				{Name: "gpt-4o", Capabilities: []string{"vision", "tools"}, InputCost: 2.5, OutputCost: 10},
+				{Name: "best", AliasFor: []string{"gpt-4o-mini", "gpt-4o"}},
+			}, cfg.Models)
+		})
+	}
+}
+
+func TestDuration_UnmarshalText_Invalid(t *testing.T) {
+	var d Duration
+	assert.Error(t, d.UnmarshalText([]byte("ten minutes")))
+}
+
 func TestLoadNonExistentFile(t *testing.T) {
 	_, err := Load("non-existent-file.toml")
 	assert.Error(t, err)
 }
+
+func TestServer_NoProvider(t *testing.T) {
+	assert.Equal(t, NoProviderError, (&Server{}).NoProvider())
+	assert.Equal(t, NoProviderFallbackDefault, (&Server{DefaultProvider: "openai"}).NoProvider())
+	assert.Equal(t, NoProviderFallbackFirst, (&Server{NoProviderPolicy: NoProviderFallbackFirst}).NoProvider())
+}
@@ -5,10 +5,13 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
 	"os/exec"
+	"reflect"
 	"sync"
 
 	"github.com/modelplex/modelplex/internal/config"
@@ -17,15 +20,69 @@ import (
 const (
 	// MCP protocol constants
 	mcpListToolsRequestID = 2
-	mcpCallToolRequestID  = 99
+	// Tool calls are numbered from here, clear of the requests made by initialize
+	mcpFirstCallRequestID = 100
+
+	// Messages are read with a buffer that starts small and grows up to the max message size
+	initialMessageBuffer  = 64 * 1024
+	defaultMaxMessageSize = 16 * 1024 * 1024
+
+	// MCP server states reported by Status
+	StatusRunning = "running"
+	StatusFailed  = "failed"
 )
 
 // Client manages connections to multiple MCP servers.
 type Client struct {
 	servers map[string]*Server
-	mu      sync.RWMutex
+	// failed holds why each server that couldn't be started failed
+	failed map[string]error
+	// names lists the configured servers in config order, and configs their configs by name
+	names   []string
+	configs map[string]config.MCPServer
+	// restarts counts how many times each server was restarted by Reload
+	restarts map[string]int
+	// allowed holds the only tools listed and callable, or is nil to allow all; see SetAllowedTools
+	allowed map[string]bool
+	// warnedDuplicates holds the qualified names of the duplicate tools warned about
+	warnedDuplicates sync.Map
+	mu               sync.RWMutex
+}
+
+// ReloadSummary describes which servers Reload started, stopped and restarted.
+type ReloadSummary struct {
+	Added     []string `json:"mcp_added,omitempty"`
+	Removed   []string `json:"mcp_removed,omitempty"`
+	Restarted []string `json:"mcp_restarted,omitempty"`
+}
+
+// ServerStatus reports whether an MCP server was started.
+type ServerStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Tools  int    `json:"tools"`
+	Error  string `json:"error,omitempty"`
 }
 
+// ServerInfo describes a configured MCP server: its status, how it's run, and how many times
+// Reload restarted it.
+type ServerInfo struct {
+	ServerStatus
+	Command  string   `json:"command"`
+	Args     []string `json:"args"`
+	Restarts int      `json:"restarts"`
+}
+
+// ErrToolNotFound is returned by CallTool when no running MCP server provides the tool.
+var ErrToolNotFound = errors.New("tool not found")
+
+// ErrToolNotAllowed is returned by CallTool for tools outside the allowlist set with SetAllowedTools.
+var ErrToolNotAllowed = errors.New("tool not allowed")
+
+// errDisconnected fails calls to a server that modelplex can no longer read from,
+// because its process exited or it sent a message larger than max_message_size.
+var errDisconnected = errors.New("MCP server disconnected")
+
 // Server represents a single MCP server connection.
 type Server struct {
 	name   string
@@ -35,6 +92,30 @@ type Server struct {
 	stderr io.ReadCloser
 	tools  []Tool
 	mu     sync.RWMutex
+
+	// maxMessageSize bounds each message read from stdout
+	maxMessageSize int
+
+	// writeMu serializes requests written to stdin
+	writeMu sync.Mutex
+	// pending holds the calls awaiting a response, by request ID; nil once the server has
+	// disconnected, with disconnectErr saying why
+	pending       map[int]*pendingCall
+	disconnectErr error
+	nextID        int
+}
+
+// pendingCall receives the response and progress notifications for one tool call.
+type pendingCall struct {
+	response chan Response
+	progress chan Progress
+}
+
+// Progress is a progress notification sent by a server while a tool call runs.
+type Progress struct {
+	Progress float64 `json:"progress"`
+	Total    float64 `json:"total,omitempty"`
+	Message  string  `json:"message,omitempty"`
 }
 
 // Tool represents an MCP tool with its schema.
@@ -66,26 +147,180 @@ type Error struct {
 	Message string `json:"message"`
 }
 
+func (e *Error) Error() string {
+	return fmt.Sprintf("MCP error %d: %s", e.Code, e.Message)
+}
+
+// message is any JSON-RPC message a server sends: a response, which has an ID,
+// or a notification, which has a method instead.
+type message struct {
+	Response
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// progressNotification is the params of a "notifications/progress" message.
+type progressNotification struct {
+	ProgressToken int `json:"progressToken"`
+	Progress
+}
+
 // NewMCPClient creates a new MCP client with the given server configurations.
+// Servers that fail to start are logged and reported by Status and Err; the others still run.
 func NewMCPClient(configs []config.MCPServer) *Client {
 	client := &Client{
-		servers: make(map[string]*Server),
+		servers:  make(map[string]*Server),
+		failed:   make(map[string]error),
+		configs:  make(map[string]config.MCPServer),
+		restarts: make(map[string]int),
 	}
 
+	client.mu.Lock()
+	defer client.mu.Unlock()
 	for _, cfg := range configs {
-		if err := client.StartServer(cfg); err != nil {
-			slog.Error("Failed to start MCP server", "server", cfg.Name, "error", err)
-		}
+		client.names = append(client.names, cfg.Name)
+		client.configs[cfg.Name] = cfg
+		client.start(cfg)
 	}
 
 	return client
 }
 
+// Reload applies a new list of server configs, comparing them to the current ones by name:
+// new servers are started, removed ones stopped, and those whose command or args changed
+// restarted. Unchanged servers keep running undisturbed, except that servers which failed
+// to start are retried.
+func (c *Client) Reload(configs []config.MCPServer) *ReloadSummary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	summary := &ReloadSummary{}
+	next := make(map[string]config.MCPServer, len(configs))
+	for _, cfg := range configs {
+		next[cfg.Name] = cfg
+	}
+
+	for _, name := range c.names {
+		if _, ok := next[name]; !ok {
+			c.stop(name)
+			delete(c.configs, name)
+			delete(c.restarts, name)
+			summary.Removed = append(summary.Removed, name)
+		}
+	}
+
+	c.names = c.names[:0]
+	for _, cfg := range configs {
+		c.names = append(c.names, cfg.Name)
+		previous, existed := c.configs[cfg.Name]
+		_, failed := c.failed[cfg.Name]
+		c.configs[cfg.Name] = cfg
+
+		switch {
+		case !existed:
+			summary.Added = append(summary.Added, cfg.Name)
+		case failed || !reflect.DeepEqual(previous, cfg):
+			c.stop(cfg.Name)
+			c.restarts[cfg.Name]++
+			summary.Restarted = append(summary.Restarted, cfg.Name)
+		default:
+			continue
+		}
+		c.start(cfg)
+	}
+
+	return summary
+}
+
+// start starts a server, recording why if it fails. The caller must hold mu.
+func (c *Client) start(cfg config.MCPServer) {
+	delete(c.failed, cfg.Name)
+	if err := c.startServer(cfg); err != nil {
+		slog.Error("Failed to start MCP server", "server", cfg.Name, "command", cfg.Command, "error", err)
+		c.failed[cfg.Name] = err
+	}
+}
+
+// stop stops the named server if it's running, and forgets any failure to start it. The caller must hold mu.
+func (c *Client) stop(name string) {
+	if server, ok := c.servers[name]; ok {
+		server.stop()
+		delete(c.servers, name)
+	}
+	delete(c.failed, name)
+}
+
+// Status returns whether each configured server was started, in config order.
+func (c *Client) Status() []ServerStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	statuses := make([]ServerStatus, 0, len(c.names))
+	for _, name := range c.names {
+		statuses = append(statuses, c.status(name))
+	}
+	return statuses
+}
+
+// status returns whether the named server was started. The caller must hold mu.
+func (c *Client) status(name string) ServerStatus {
+	status := ServerStatus{Name: name, Status: StatusRunning}
+	if err, failed := c.failed[name]; failed {
+		status.Status = StatusFailed
+		status.Error = err.Error()
+	} else if server, ok := c.servers[name]; ok {
+		server.mu.RLock()
+		status.Tools = len(server.tools)
+		server.mu.RUnlock()
+	}
+	return status
+}
+
+// Servers describes each configured server, in config order.
+func (c *Client) Servers() []ServerInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	servers := make([]ServerInfo, 0, len(c.names))
+	for _, name := range c.names {
+		cfg := c.configs[name]
+		args := cfg.Args
+		if args == nil {
+			args = []string{}
+		}
+		servers = append(servers, ServerInfo{
+			ServerStatus: c.status(name),
+			Command:      cfg.Command,
+			Args:         args,
+			Restarts:     c.restarts[name],
+		})
+	}
+	return servers
+}
+
+// Err returns an error naming every server that failed to start, or nil if they all started.
+func (c *Client) Err() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var errs []error
+	for _, name := range c.names {
+		if err, failed := c.failed[name]; failed {
+			errs = append(errs, fmt.Errorf("MCP server %q: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // StartServer starts a new MCP server process and establishes communication.
 func (c *Client) StartServer(cfg config.MCPServer) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	return c.startServer(cfg)
+}
 
+// startServer starts a server process. The caller must hold mu.
+func (c *Client) startServer(cfg config.MCPServer) error {
 	// #nosec G204 -- MCP command execution is intentional from trusted config
 	cmd := exec.Command(cfg.Command, cfg.Args...)
 
@@ -105,16 +340,26 @@ func (c *Client) StartServer(cfg config.MCPServer) error {
 	}
 
 	if err := cmd.Start(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%w (is %s installed and on PATH?)", err, cfg.Command)
+		}
 		return err
 	}
 
 	server := &Server{
-		name:   cfg.Name,
-		cmd:    cmd,
-		stdin:  stdin,
-		stdout: stdout,
-		stderr: stderr,
-		tools:  make([]Tool, 0),
+		name:    cfg.Name,
+		cmd:     cmd,
+		stdin:   stdin,
+		stdout:  stdout,
+		stderr:  stderr,
+		tools:   make([]Tool, 0),
+		pending: make(map[int]*pendingCall),
+		nextID:  mcpFirstCallRequestID,
+
+		maxMessageSize: cfg.MaxMessageSize,
+	}
+	if server.maxMessageSize <= 0 {
+		server.maxMessageSize = defaultMaxMessageSize
 	}
 
 	c.servers[cfg.Name] = server
@@ -165,22 +410,88 @@ func (s *Server) sendRequest(req Request) error {
 		return err
 	}
 
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
 	_, err = s.stdin.Write(append(data, '\n'))
 	return err
 }
 
+// handleOutput reads messages from the server until it exits, routing responses and progress
+// notifications to the calls waiting on them. Calls still waiting when it exits are failed.
 func (s *Server) handleOutput() {
 	scanner := bufio.NewScanner(s.stdout)
+	scanner.Buffer(make([]byte, 0, min(initialMessageBuffer, s.maxMessageSize)), s.maxMessageSize)
 	for scanner.Scan() {
-		line := scanner.Text()
-
-		var resp Response
-		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
 			slog.Error("Failed to parse MCP response", "server", s.name, "error", err)
 			continue
 		}
 
-		s.handleResponse(resp)
+		switch {
+		case msg.Method == "notifications/progress":
+			s.handleProgress(msg.Params)
+		case msg.Method != "":
+			slog.Debug("Ignoring MCP notification", "server", s.name, "method", msg.Method)
+		case s.deliver(msg.Response):
+		default:
+			s.handleResponse(msg.Response)
+		}
+	}
+
+	disconnectErr := fmt.Errorf("%w: %s", errDisconnected, s.name)
+	switch err := scanner.Err(); {
+	case errors.Is(err, bufio.ErrTooLong):
+		slog.Error("MCP server sent a message larger than max_message_size, disconnecting",
+			"server", s.name, "max_message_size", s.maxMessageSize)
+		disconnectErr = fmt.Errorf("%w: %s sent a message larger than max_message_size (%d bytes)",
+			errDisconnected, s.name, s.maxMessageSize)
+	case err != nil:
+		slog.Error("Failed to read from MCP server", "server", s.name, "error", err)
+	}
+
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = nil
+	s.disconnectErr = disconnectErr
+	s.mu.Unlock()
+	for _, call := range pending {
+		close(call.response)
+	}
+}
+
+// deliver hands resp to the tool call waiting for it, reporting whether there was one.
+func (s *Server) deliver(resp Response) bool {
+	s.mu.Lock()
+	call, ok := s.pending[resp.ID]
+	delete(s.pending, resp.ID)
+	s.mu.Unlock()
+
+	if ok {
+		call.response <- resp
+	}
+	return ok
+}
+
+// handleProgress relays a progress notification to the tool call it belongs to.
+// Notifications are dropped rather than block the server's output if the caller falls behind.
+func (s *Server) handleProgress(params json.RawMessage) {
+	var notification progressNotification
+	if err := json.Unmarshal(params, &notification); err != nil {
+		slog.Error("Failed to parse MCP progress notification", "server", s.name, "error", err)
+		return
+	}
+
+	s.mu.RLock()
+	call, ok := s.pending[notification.ProgressToken]
+	s.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	select {
+	case call.progress <- notification.Progress:
+	default:
 	}
 }
 
@@ -221,79 +532,216 @@ func (s *Server) handleResponse(resp Response) {
 	}
 }
 
-// ListTools returns all available tools from all connected MCP servers.
+// SetAllowedTools restricts the tools listed and callable to those named in tools, whatever the
+// servers provide. A nil list allows all tools.
+func (c *Client) SetAllowedTools(tools []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if tools == nil {
+		c.allowed = nil
+		return
+	}
+	c.allowed = make(map[string]bool, len(tools))
+	for _, tool := range tools {
+		c.allowed[tool] = true
+	}
+}
+
+// isAllowed reports whether tool may be listed and called: if it's allowed by its own name or,
+// as served by server, by its qualified name. The caller must hold mu.
+func (c *Client) isAllowed(server, tool string) bool {
+	return c.allowed == nil || c.allowed[tool] || c.allowed[qualifiedName(server, tool)]
+}
+
+// qualifiedName is the name a tool can always be called by, qualified with its server's name.
+func qualifiedName(server, tool string) string {
+	return server + "." + tool
+}
+
+// listedTool is a tool as ListTools lists it.
+type listedTool struct {
+	Tool
+	server *Server
+	// name is the tool's own name, which Tool.Name qualifies if another server provides it too
+	name string
+}
+
+// tools returns the tools of the running servers, in config order. Servers earlier in the config
+// take precedence: a tool that an earlier server also provides is listed by its qualified name,
+// "server.tool", while the earlier one keeps its own. The caller must hold mu.
+func (c *Client) tools() []listedTool {
+	var tools []listedTool
+	listed := make(map[string]string)
+	for _, name := range c.names {
+		server, ok := c.servers[name]
+		if !ok {
+			continue
+		}
+
+		server.mu.RLock()
+		for _, tool := range server.tools {
+			entry := listedTool{Tool: tool, server: server, name: tool.Name}
+			if first, ok := listed[tool.Name]; ok {
+				entry.Name = qualifiedName(name, tool.Name)
+				c.warnDuplicate(first, name, tool.Name)
+			} else {
+				listed[tool.Name] = name
+			}
+			tools = append(tools, entry)
+		}
+		server.mu.RUnlock()
+	}
+	return tools
+}
+
+// warnDuplicate logs, once per server and tool, that server provides a tool that first, which
+// is earlier in the config, also provides.
+func (c *Client) warnDuplicate(first, server, tool string) {
+	if _, warned := c.warnedDuplicates.LoadOrStore(qualifiedName(server, tool), true); warned {
+		return
+	}
+	slog.Warn("MCP tool provided by more than one server; listing it qualified",
+		"tool", tool, "server", server, "precedence", first, "name", qualifiedName(server, tool))
+}
+
+// ListTools returns the tools of the running MCP servers, except those not allowed. A tool that a
+// server earlier in the config also provides is listed by its qualified name, "server.tool".
 func (c *Client) ListTools() []Tool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
 	var allTools []Tool
-	for _, server := range c.servers {
-		server.mu.RLock()
-		allTools = append(allTools, server.tools...)
-		server.mu.RUnlock()
+	for _, tool := range c.tools() {
+		if c.isAllowed(tool.server.name, tool.name) {
+			allTools = append(allTools, tool.Tool)
+		}
 	}
 
 	return allTools
 }
 
 // CallTool executes a tool on the appropriate MCP server with context cancellation support.
+// Tools can be called by the name ListTools lists them by, or qualified as "server.tool".
 func (c *Client) CallTool(ctx context.Context, name string, args map[string]interface{}) (interface{}, error) {
+	return c.CallToolWithProgress(ctx, name, args, nil)
+}
+
+// CallToolWithProgress executes a tool like CallTool, asking the server for progress
+// notifications and passing each one to onProgress while the call runs.
+func (c *Client) CallToolWithProgress(
+	ctx context.Context, name string, args map[string]interface{}, onProgress func(Progress),
+) (interface{}, error) {
+	server, tool, err := c.serverFor(name)
+	if err != nil {
+		return nil, err
+	}
+	return server.callTool(ctx, tool, args, onProgress)
+}
+
+// serverFor returns the server providing the named tool, and the tool's own name, failing if the
+// tool isn't allowed or no server provides it.
+func (c *Client) serverFor(name string) (*Server, string, error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	for _, server := range c.servers {
-		server.mu.RLock()
-		found := false
-		for _, tool := range server.tools {
-			if tool.Name == name {
-				found = true
-				break
-			}
+	for _, tool := range c.tools() {
+		if tool.Name != name && qualifiedName(tool.server.name, tool.name) != name {
+			continue
 		}
-		server.mu.RUnlock()
-
-		if found {
-			return server.callTool(ctx, name, args)
+		if !c.isAllowed(tool.server.name, tool.name) {
+			break
 		}
+		return tool.server, tool.name, nil
 	}
 
-	return nil, fmt.Errorf("tool not found: %s", name)
+	if c.allowed != nil && !c.allowed[name] {
+		return nil, "", fmt.Errorf("%w: %s isn't in mcp.allowed_tools", ErrToolNotAllowed, name)
+	}
+	return nil, "", fmt.Errorf("%w: %s", ErrToolNotFound, name)
 }
 
-func (s *Server) callTool(ctx context.Context, name string, args map[string]interface{}) (interface{}, error) {
-	req := Request{
-		JSONRPC: "2.0",
-		ID:      mcpCallToolRequestID,
-		Method:  "tools/call",
-		Params: map[string]interface{}{
-			"name":      name,
-			"arguments": args,
-		},
+// progressBuffer is how many progress notifications are queued for a slow caller before they are dropped
+const progressBuffer = 16
+
+func (s *Server) callTool(
+	ctx context.Context, name string, args map[string]interface{}, onProgress func(Progress),
+) (interface{}, error) {
+	call := &pendingCall{
+		response: make(chan Response, 1),
+		progress: make(chan Progress, progressBuffer),
 	}
 
-	// Create a channel to receive the response
-	responseChan := make(chan interface{}, 1)
-	errorChan := make(chan error, 1)
+	s.mu.Lock()
+	if s.pending == nil {
+		s.mu.Unlock()
+		return nil, s.disconnectErr
+	}
+	id := s.nextID
+	s.nextID++
+	s.pending[id] = call
+	s.mu.Unlock()
+
+	params := map[string]interface{}{
+		"name":      name,
+		"arguments": args,
+	}
+	if onProgress != nil {
+		// The request ID doubles as the progress token, since it's already unique among calls in flight
+		params["_meta"] = map[string]interface{}{"progressToken": id}
+	}
+
+	if err := s.sendRequest(Request{JSONRPC: "2.0", ID: id, Method: "tools/call", Params: params}); err != nil {
+		s.forget(id)
+		return nil, err
+	}
 
-	// Send request in a goroutine to allow cancellation
-	go func() {
-		if err := s.sendRequest(req); err != nil {
-			errorChan <- err
-			return
+	for {
+		select {
+		case <-ctx.Done():
+			s.forget(id)
+			s.cancel(id, ctx.Err())
+			return nil, ctx.Err()
+		case progress := <-call.progress:
+			if onProgress != nil {
+				onProgress(progress)
+			}
+		case resp, ok := <-call.response:
+			// Progress is queued before the response arrives, so relay what's left first
+			for len(call.progress) > 0 {
+				if progress := <-call.progress; onProgress != nil {
+					onProgress(progress)
+				}
+			}
+			if !ok {
+				s.mu.RLock()
+				defer s.mu.RUnlock()
+				return nil, s.disconnectErr
+			}
+			if resp.Error != nil {
+				return nil, resp.Error
+			}
+			return resp.Result, nil
 		}
-		// For now, return a success response
-		// In a full implementation, this would read the actual MCP response
-		responseChan <- map[string]interface{}{"success": true}
-	}()
+	}
+}
 
-	// Wait for response or context cancellation
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	case err := <-errorChan:
-		return nil, err
-	case response := <-responseChan:
-		return response, nil
+// forget stops waiting for the response to request id.
+func (s *Server) forget(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, id)
+}
+
+// cancel tells the server that modelplex has given up on request id, so it can stop working on it.
+func (s *Server) cancel(id int, reason error) {
+	notification := Request{
+		JSONRPC: "2.0",
+		Method:  "notifications/cancelled",
+		Params:  map[string]interface{}{"requestId": id, "reason": reason.Error()},
+	}
+	if err := s.sendRequest(notification); err != nil {
+		slog.Debug("Failed to cancel MCP request", "server", s.name, "id", id, "error", err)
 	}
 }
 
@@ -303,15 +751,20 @@ func (c *Client) Stop() {
 	defer c.mu.Unlock()
 
 	for _, server := range c.servers {
-		if err := server.stdin.Close(); err != nil {
-			slog.Error("Error closing MCP server stdin", "error", err)
-		}
-		if err := server.cmd.Process.Kill(); err != nil {
-			slog.Error("Error killing MCP server process", "error", err)
-		}
-		if err := server.cmd.Wait(); err != nil {
-			slog.Error("Error waiting for MCP server process", "error", err)
-		}
+		server.stop()
+	}
+}
+
+// stop shuts down the server's process.
+func (s *Server) stop() {
+	if err := s.stdin.Close(); err != nil {
+		slog.Error("Error closing MCP server stdin", "server", s.name, "error", err)
+	}
+	if err := s.cmd.Process.Kill(); err != nil {
+		slog.Error("Error killing MCP server process", "server", s.name, "error", err)
+	}
+	if err := s.cmd.Wait(); err != nil {
+		slog.Error("Error waiting for MCP server process", "server", s.name, "error", err)
 	}
 }
 
@@ -0,0 +1,273 @@
+package mcp
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/test/testutil"
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv(testutil.FakeMCPServerEnv) != "" {
+		testutil.RunFakeMCPServer(os.Stdin, os.Stdout)
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// startFakeServer starts the fake MCP server from testutil and waits for its tools to load.
+func startFakeServer(t *testing.T) *Client {
+	t.Helper()
+	client := NewMCPClient([]config.MCPServer{testutil.FakeMCPServer(t, "fake")})
+	t.Cleanup(client.Stop)
+	require.NoError(t, client.Err())
+	require.Eventually(t, func() bool { return len(client.ListTools()) > 0 }, 5*time.Second, 10*time.Millisecond)
+	return client
+}
+
+func TestNewMCPClient_CommandNotFound(t *testing.T) {
+	client := NewMCPClient([]config.MCPServer{
+		{Name: "filesystem", Command: "modelplex-no-such-mcp-server", Args: []string{"/tmp"}},
+	})
+	defer client.Stop()
+
+	statuses := client.Status()
+	require.Len(t, statuses, 1)
+	assert.Equal(t, "filesystem", statuses[0].Name)
+	assert.Equal(t, StatusFailed, statuses[0].Status)
+	assert.Contains(t, statuses[0].Error, "modelplex-no-such-mcp-server")
+	assert.Contains(t, statuses[0].Error, "PATH")
+
+	err := client.Err()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `MCP server "filesystem"`)
+	assert.Contains(t, err.Error(), "modelplex-no-such-mcp-server")
+}
+
+func TestNewMCPClient_Started(t *testing.T) {
+	// cat stays running, reading the requests sent to it
+	client := NewMCPClient([]config.MCPServer{{Name: "cat", Command: "cat"}})
+	defer client.Stop()
+
+	assert.NoError(t, client.Err())
+	assert.Equal(t, []ServerStatus{{Name: "cat", Status: StatusRunning}}, client.Status())
+}
+
+func TestClient_CallTool(t *testing.T) {
+	client := startFakeServer(t)
+
+	result, err := client.CallTool(context.Background(), "count", nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"content": []interface{}{map[string]interface{}{"type": "text", "text": "done"}},
+	}, result)
+}
+
+func TestClient_CallToolWithProgress(t *testing.T) {
+	client := startFakeServer(t)
+
+	var progress []Progress
+	result, err := client.CallToolWithProgress(context.Background(), "count", nil, func(p Progress) {
+		progress = append(progress, p)
+	})
+	require.NoError(t, err)
+	assert.NotNil(t, result)
+	assert.Equal(t, []Progress{
+		{Progress: 1, Total: 3, Message: "step 1"},
+		{Progress: 2, Total: 3, Message: "step 2"},
+		{Progress: 3, Total: 3, Message: "step 3"},
+	}, progress)
+}
+
+func TestClient_CallTool_Concurrent(t *testing.T) {
+	client := startFakeServer(t)
+
+	// Each call must get its own response, whatever order they're answered in
+	errs := make(chan error)
+	for range 10 {
+		go func() {
+			_, err := client.CallToolWithProgress(context.Background(), "count", nil, func(Progress) {})
+			errs <- err
+		}()
+	}
+	for range 10 {
+		assert.NoError(t, <-errs)
+	}
+}
+
+func TestClient_CallTool_Errors(t *testing.T) {
+	client := startFakeServer(t)
+
+	_, err := client.CallTool(context.Background(), "missing", nil)
+	assert.ErrorIs(t, err, ErrToolNotFound)
+
+	_, err = client.CallTool(context.Background(), "fail", nil)
+	var mcpErr *Error
+	require.ErrorAs(t, err, &mcpErr)
+	assert.Equal(t, "tool failed", mcpErr.Message)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = client.CallTool(ctx, "hang", nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestClient_SetAllowedTools(t *testing.T) {
+	client := startFakeServer(t)
+	client.SetAllowedTools([]string{"count", "missing"})
+
+	tools := client.ListTools()
+	require.Len(t, tools, 1)
+	assert.Equal(t, "count", tools[0].Name)
+
+	_, err := client.CallTool(context.Background(), "count", nil)
+	require.NoError(t, err)
+	_, err = client.CallTool(context.Background(), "fail", nil)
+	require.ErrorIs(t, err, ErrToolNotAllowed)
+	assert.Contains(t, err.Error(), "fail isn't in mcp.allowed_tools")
+	// Allowed tools no server provides still aren't found
+	_, err = client.CallTool(context.Background(), "missing", nil)
+	require.ErrorIs(t, err, ErrToolNotFound)
+
+	// An empty allowlist allows nothing, and nil everything
+	client.SetAllowedTools([]string{})
+	assert.Empty(t, client.ListTools())
+	client.SetAllowedTools(nil)
+	assert.Len(t, client.ListTools(), 4)
+}
+
+func TestClient_DuplicateTools(t *testing.T) {
+	// Both servers provide the same tools
+	client := NewMCPClient([]config.MCPServer{testutil.FakeMCPServer(t, "second"), testutil.FakeMCPServer(t, "first")})
+	t.Cleanup(client.Stop)
+	require.Eventually(t, func() bool { return len(client.ListTools()) == 8 }, 5*time.Second, 10*time.Millisecond)
+
+	// Listing is in config order, the later server's tools qualified with its name
+	var names []string
+	for _, tool := range client.ListTools() {
+		names = append(names, tool.Name)
+	}
+	assert.Equal(t, []string{
+		"count", "fail", "hang", "large", "first.count", "first.fail", "first.hang", "first.large",
+	}, names)
+
+	// Calls by the plain name always go to the earlier server, and either can be called qualified
+	for range 10 {
+		server, tool, err := client.serverFor("count")
+		require.NoError(t, err)
+		assert.Equal(t, "second", server.name)
+		assert.Equal(t, "count", tool)
+	}
+	for _, name := range []string{"first", "second"} {
+		server, tool, err := client.serverFor(name + ".count")
+		require.NoError(t, err)
+		assert.Equal(t, name, server.name)
+		assert.Equal(t, "count", tool)
+	}
+	_, err := client.CallTool(context.Background(), "first.count", nil)
+	require.NoError(t, err)
+
+	// The allowlist can pick out one server's tool by its qualified name
+	client.SetAllowedTools([]string{"first.count"})
+	tools := client.ListTools()
+	require.Len(t, tools, 1)
+	assert.Equal(t, "first.count", tools[0].Name)
+	_, err = client.CallTool(context.Background(), "count", nil)
+	assert.ErrorIs(t, err, ErrToolNotAllowed)
+}
+
+func TestClient_Reload(t *testing.T) {
+	fake := testutil.FakeMCPServer(t, "unchanged")
+	changed := testutil.FakeMCPServer(t, "changed")
+	missing := config.MCPServer{Name: "missing", Command: "modelplex-no-such-mcp-server"}
+	removed := testutil.FakeMCPServer(t, "removed")
+
+	client := NewMCPClient([]config.MCPServer{fake, changed, missing, removed})
+	defer client.Stop()
+	unchangedServer := client.servers["unchanged"]
+
+	changed.Args = []string{"--verbose"}
+	added := testutil.FakeMCPServer(t, "added")
+	summary := client.Reload([]config.MCPServer{added, fake, changed, missing})
+
+	assert.Equal(t, &ReloadSummary{
+		Added:     []string{"added"},
+		Removed:   []string{"removed"},
+		Restarted: []string{"changed", "missing"},
+	}, summary)
+
+	// The unchanged server's process is left running
+	assert.Same(t, unchangedServer, client.servers["unchanged"])
+
+	var names []string
+	for _, status := range client.Status() {
+		names = append(names, status.Name)
+	}
+	assert.Equal(t, []string{"added", "unchanged", "changed", "missing"}, names)
+	assert.NotContains(t, client.servers, "removed")
+	assert.Contains(t, client.Err().Error(), "missing")
+
+	require.Eventually(t, func() bool {
+		_, err := client.CallTool(context.Background(), "count", nil)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Reloading the same config changes nothing, apart from retrying servers that failed
+	summary = client.Reload([]config.MCPServer{added, fake, changed, missing})
+	assert.Equal(t, &ReloadSummary{Restarted: []string{"missing"}}, summary)
+	assert.Same(t, unchangedServer, client.servers["unchanged"])
+
+	restarts := make(map[string]int)
+	for _, server := range client.Servers() {
+		restarts[server.Name] = server.Restarts
+	}
+	assert.Equal(t, map[string]int{"added": 0, "unchanged": 0, "changed": 1, "missing": 2}, restarts)
+}
+
+func TestClient_Servers(t *testing.T) {
+	client := startFakeServer(t)
+
+	servers := client.Servers()
+	require.Len(t, servers, 1)
+	assert.Equal(t, ServerInfo{
+		ServerStatus: ServerStatus{Name: "fake", Status: StatusRunning, Tools: 4},
+		Command:      os.Args[0],
+		Args:         []string{},
+	}, servers[0])
+}
+
+func TestClient_CallTool_LargeResult(t *testing.T) {
+	client := startFakeServer(t)
+
+	// Results are sent as a single line, longer than bufio.Scanner's default limit of 64KiB
+	result, err := client.CallTool(context.Background(), "large", nil)
+	require.NoError(t, err)
+	content := result.(map[string]interface{})["content"].([]interface{})
+	assert.Len(t, content[0].(map[string]interface{})["text"], testutil.FakeMCPServerLargeResultSize)
+
+	// The server keeps working afterwards
+	_, err = client.CallTool(context.Background(), "count", nil)
+	assert.NoError(t, err)
+}
+
+func TestClient_CallTool_MessageTooLarge(t *testing.T) {
+	cfg := testutil.FakeMCPServer(t, "fake")
+	cfg.MaxMessageSize = 4096
+	client := NewMCPClient([]config.MCPServer{cfg})
+	defer client.Stop()
+	require.Eventually(t, func() bool { return len(client.ListTools()) > 0 }, 5*time.Second, 10*time.Millisecond)
+
+	// A message over the limit disconnects the server, failing the call instead of hanging it
+	_, err := client.CallTool(context.Background(), "large", nil)
+	require.ErrorIs(t, err, errDisconnected)
+	assert.Contains(t, err.Error(), "max_message_size")
+
+	_, err = client.CallTool(context.Background(), "count", nil)
+	assert.ErrorIs(t, err, errDisconnected)
+}
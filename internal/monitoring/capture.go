@@ -0,0 +1,185 @@
+package monitoring
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// captureQueueSize is how many records can wait to be written before new ones are dropped
+	captureQueueSize = 1024
+	// captureFlushInterval is how often buffered records are written to the file
+	captureFlushInterval = time.Second
+	// captureFileMode keeps captures, which hold prompts and responses, private to their owner
+	captureFileMode = 0o600
+)
+
+// CaptureRecord is a request captured for debugging or replay, with the response it got.
+// Request and Response hold the bodies if they're JSON; a response that isn't, such as a stream
+// of server-sent events, is kept as text in Stream instead.
+type CaptureRecord struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Method    string            `json:"method"`
+	Path      string            `json:"path"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Request   json.RawMessage   `json:"request,omitempty"`
+	Status    int               `json:"status"`
+	Response  json.RawMessage   `json:"response,omitempty"`
+	Stream    string            `json:"stream,omitempty"`
+	Duration  time.Duration     `json:"duration"`
+}
+
+// Capture appends CaptureRecords to a JSONL file. Records are queued and written in the
+// background, flushed about every second, so capturing never blocks a request; records that
+// arrive while the queue is full are dropped. Once the file would grow beyond maxSize, it's
+// rotated to path + ".1", replacing the previous one.
+type Capture struct {
+	path    string
+	maxSize int64
+
+	file *os.File
+	buf  *bufio.Writer
+	size int64
+
+	records chan []byte
+	dropped atomic.Int64
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// NewCapture opens the capture file at path, appending to it if it exists, and starts writing
+// records to it until Close is called.
+func NewCapture(path string, maxSize int64) (*Capture, error) {
+	c := &Capture{
+		path:    path,
+		maxSize: maxSize,
+		records: make(chan []byte, captureQueueSize),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if err := c.open(); err != nil {
+		return nil, err
+	}
+
+	go c.run()
+	return c, nil
+}
+
+// Record queues record to be written, dropping it if the queue is full.
+func (c *Capture) Record(record *CaptureRecord) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		slog.Debug("Failed to encode capture record", "path", record.Path, "error", err)
+		return
+	}
+
+	select {
+	case c.records <- append(line, '\n'):
+	default:
+		c.dropped.Add(1)
+	}
+}
+
+// Close writes the records still queued and closes the file. Records made afterwards are dropped.
+func (c *Capture) Close() {
+	c.once.Do(func() { close(c.stop) })
+	<-c.stopped
+}
+
+// run writes queued records until Close is called.
+func (c *Capture) run() {
+	defer close(c.stopped)
+
+	ticker := time.NewTicker(captureFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case line := <-c.records:
+			c.write(line)
+		case <-ticker.C:
+			c.flush()
+		case <-c.stop:
+			c.drain()
+			return
+		}
+	}
+}
+
+// drain writes the records still queued, then closes the file.
+func (c *Capture) drain() {
+	for {
+		select {
+		case line := <-c.records:
+			c.write(line)
+		default:
+			c.flush()
+			if err := c.file.Close(); err != nil {
+				slog.Error("Failed to close capture file", "path", c.path, "error", err)
+			}
+			return
+		}
+	}
+}
+
+// write appends line to the file, rotating it first if line would take it beyond maxSize.
+func (c *Capture) write(line []byte) {
+	if c.size > 0 && c.size+int64(len(line)) > c.maxSize {
+		if err := c.rotate(); err != nil {
+			slog.Error("Failed to rotate capture file", "path", c.path, "error", err)
+		}
+	}
+
+	n, err := c.buf.Write(line)
+	c.size += int64(n)
+	if err != nil {
+		slog.Error("Failed to write capture file", "path", c.path, "error", err)
+	}
+}
+
+// flush writes the buffered records to the file, reporting any dropped since the last flush.
+func (c *Capture) flush() {
+	if err := c.buf.Flush(); err != nil {
+		slog.Error("Failed to write capture file", "path", c.path, "error", err)
+	}
+	if dropped := c.dropped.Swap(0); dropped > 0 {
+		slog.Warn("Dropped capture records while the queue was full", "path", c.path, "records", dropped)
+	}
+}
+
+// rotate renames the file to path + ".1" and starts a new one. If it can't be renamed,
+// records keep being appended to it.
+func (c *Capture) rotate() error {
+	c.flush()
+	if err := c.file.Close(); err != nil {
+		return err
+	}
+	renameErr := os.Rename(c.path, c.path+".1")
+	if err := c.open(); err != nil {
+		return err
+	}
+	return renameErr
+}
+
+// open opens the file for appending.
+func (c *Capture) open() error {
+	// #nosec G304 -- the capture path is provided by the config file
+	file, err := os.OpenFile(c.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, captureFileMode)
+	if err != nil {
+		return fmt.Errorf("cannot open capture file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("cannot open capture file: %w", err)
+	}
+
+	c.file, c.buf, c.size = file, bufio.NewWriter(file), info.Size()
+	return nil
+}
@@ -0,0 +1,61 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapture(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	capture, err := NewCapture(path, 1<<20)
+	require.NoError(t, err)
+
+	capture.Record(&CaptureRecord{Method: "POST", Path: "/v1/chat/completions", Status: 200,
+		Request: json.RawMessage(`{"model":"gpt-4"}`), Response: json.RawMessage(`{"id":"1"}`)})
+	capture.Record(&CaptureRecord{Method: "POST", Path: "/v1/chat/completions", Status: 200,
+		Stream: "data: [DONE]\n\n"})
+	capture.Close()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+
+	var record CaptureRecord
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal(t, "/v1/chat/completions", record.Path)
+	assert.JSONEq(t, `{"model":"gpt-4"}`, string(record.Request))
+	assert.JSONEq(t, `{"id":"1"}`, string(record.Response))
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &record))
+	assert.Equal(t, "data: [DONE]\n\n", record.Stream)
+
+	// Closing again is a no-op, and records made afterwards are dropped
+	capture.Close()
+	capture.Record(&CaptureRecord{Path: "/late"})
+}
+
+func TestCapture_Rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	capture, err := NewCapture(path, 200)
+	require.NoError(t, err)
+
+	for _, p := range []string{"/first", "/second", "/third"} {
+		capture.Record(&CaptureRecord{Path: p, Request: json.RawMessage(`{"prompt":"` + strings.Repeat("x", 50) + `"}`)})
+	}
+	capture.Close()
+
+	current, err := os.ReadFile(path)
+	require.NoError(t, err)
+	rotated, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(current), 200)
+	assert.LessOrEqual(t, len(rotated), 200)
+	assert.Contains(t, string(current), "/third")
+	assert.NotContains(t, string(current)+string(rotated), "/first", "only one rotated file is kept")
+}
@@ -0,0 +1,7 @@
+package monitoring
+
+import "log/slog"
+
+// Level is the minimum level of the process-wide logger. Handlers installed with slog.SetDefault
+// should use it as their level so it can be changed at runtime.
+var Level = new(slog.LevelVar)
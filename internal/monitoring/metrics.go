@@ -0,0 +1,142 @@
+package monitoring
+
+import "sync"
+
+// ProviderMetrics holds the counters collected for one provider.
+type ProviderMetrics struct {
+	// Requests routed to the provider, and how many of them failed
+	Requests int64 `json:"requests"`
+	Errors   int64 `json:"errors"`
+	// Prompt caching: tokens served from the cache (hits) and tokens written to it (misses)
+	CacheReadTokens     int64 `json:"cache_read_tokens"`
+	CacheCreationTokens int64 `json:"cache_creation_tokens"`
+	// Request and response body bytes sent to and received from the provider
+	BytesSent     int64 `json:"provider_bytes_sent"`
+	BytesReceived int64 `json:"provider_bytes_received"`
+	// Shadow compares the provider's responses with the primary's, if it's the shadow provider
+	Shadow ShadowMetrics `json:"shadow,omitzero"`
+}
+
+// ShadowMetrics holds the counters of the copies of requests sent to a shadow provider.
+type ShadowMetrics struct {
+	// Copies sent, how many failed, and how many of the rest answered the same as the primary provider
+	Requests int64 `json:"requests"`
+	Errors   int64 `json:"errors"`
+	Matches  int64 `json:"matches"`
+	// Requests not copied because the shadow provider's concurrency limit was reached
+	Skipped int64 `json:"skipped"`
+}
+
+// Metrics collects in-process counters keyed by provider name.
+// It is safe for concurrent use, and a nil *Metrics discards everything recorded to it.
+type Metrics struct {
+	mu        sync.Mutex
+	providers map[string]*ProviderMetrics
+}
+
+// NewMetrics creates an empty metrics collector.
+func NewMetrics() *Metrics {
+	return &Metrics{providers: make(map[string]*ProviderMetrics)}
+}
+
+// RecordRequest counts a request routed to provider, and whether it failed.
+func (m *Metrics) RecordRequest(provider string, failed bool) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pm := m.provider(provider)
+	pm.Requests++
+	if failed {
+		pm.Errors++
+	}
+}
+
+// RecordCacheUsage adds prompt cache token counts for provider.
+func (m *Metrics) RecordCacheUsage(provider string, readTokens, creationTokens int64) {
+	if m == nil || (readTokens == 0 && creationTokens == 0) {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pm := m.provider(provider)
+	pm.CacheReadTokens += readTokens
+	pm.CacheCreationTokens += creationTokens
+}
+
+// RecordBytes adds request body bytes sent to provider and response body bytes received from it.
+func (m *Metrics) RecordBytes(provider string, sent, received int64) {
+	if m == nil || (sent == 0 && received == 0) {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pm := m.provider(provider)
+	pm.BytesSent += sent
+	pm.BytesReceived += received
+}
+
+// RecordShadow counts a copy of a request sent to the shadow provider, whether it failed, and
+// whether its response matched the primary provider's.
+func (m *Metrics) RecordShadow(provider string, failed, matched bool) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	shadow := &m.provider(provider).Shadow
+	shadow.Requests++
+	if failed {
+		shadow.Errors++
+	}
+	if matched {
+		shadow.Matches++
+	}
+}
+
+// RecordShadowSkipped counts a request that wasn't copied to the shadow provider for lack of capacity.
+func (m *Metrics) RecordShadowSkipped(provider string) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.provider(provider).Shadow.Skipped++
+}
+
+// Snapshot returns a copy of the current counters keyed by provider name.
+func (m *Metrics) Snapshot() map[string]ProviderMetrics {
+	snapshot := make(map[string]ProviderMetrics)
+	if m == nil {
+		return snapshot
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, pm := range m.providers {
+		snapshot[name] = *pm
+	}
+	return snapshot
+}
+
+// provider returns the counters for name, creating them if needed. The caller must hold mu.
+func (m *Metrics) provider(name string) *ProviderMetrics {
+	pm, ok := m.providers[name]
+	if !ok {
+		pm = &ProviderMetrics{}
+		m.providers[name] = pm
+	}
+	return pm
+}
@@ -0,0 +1,60 @@
+package monitoring
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics_RecordCacheUsage(t *testing.T) {
+	metrics := NewMetrics()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			metrics.RecordCacheUsage("anthropic", 100, 5)
+		}()
+	}
+	wg.Wait()
+
+	metrics.RecordCacheUsage("openai", 0, 0)
+
+	snapshot := metrics.Snapshot()
+	assert.Equal(t, map[string]ProviderMetrics{
+		"anthropic": {CacheReadTokens: 1000, CacheCreationTokens: 50},
+	}, snapshot)
+}
+
+func TestMetrics_RecordBytes(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.RecordBytes("openai", 120, 0)
+	metrics.RecordBytes("openai", 0, 4096)
+	metrics.RecordBytes("ollama", 0, 0)
+
+	assert.Equal(t, map[string]ProviderMetrics{
+		"openai": {BytesSent: 120, BytesReceived: 4096},
+	}, metrics.Snapshot())
+}
+
+func TestMetrics_RecordRequest(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.RecordRequest("openai", false)
+	metrics.RecordRequest("openai", true)
+	metrics.RecordRequest("ollama", false)
+
+	assert.Equal(t, map[string]ProviderMetrics{
+		"openai": {Requests: 2, Errors: 1},
+		"ollama": {Requests: 1},
+	}, metrics.Snapshot())
+}
+
+func TestMetrics_Nil(t *testing.T) {
+	var metrics *Metrics
+	metrics.RecordRequest("anthropic", true)
+	metrics.RecordCacheUsage("anthropic", 100, 5)
+	metrics.RecordBytes("anthropic", 100, 5)
+	assert.Empty(t, metrics.Snapshot())
+}
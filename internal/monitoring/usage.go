@@ -0,0 +1,105 @@
+package monitoring
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RequestUsage describes the upstream request that answered a request: where it was routed,
+// the tokens it used, how long it took, and what it's estimated to have cost.
+type RequestUsage struct {
+	Provider         string `json:"provider"`
+	Model            string `json:"model"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	TotalTokens      int64  `json:"total_tokens"`
+	LatencyMS        int64  `json:"latency_ms"`
+	// EstimatedCost is in USD, and nil if the model has no configured pricing
+	EstimatedCost *float64 `json:"estimated_cost,omitempty"`
+}
+
+// UsageCollector collects the usage recorded while serving a request.
+type UsageCollector struct {
+	mu       sync.Mutex
+	usage    RequestUsage
+	recorded bool
+}
+
+type usageCollectorKey struct{}
+
+// WithUsageCollector returns a context that collects the usage recorded with RecordUsage
+// while serving a request.
+func WithUsageCollector(ctx context.Context) (context.Context, *UsageCollector) {
+	collector := &UsageCollector{}
+	return context.WithValue(ctx, usageCollectorKey{}, collector), collector
+}
+
+// CollectsUsage reports whether ctx collects usage, so usage needn't be worked out if it doesn't.
+func CollectsUsage(ctx context.Context) bool {
+	_, ok := ctx.Value(usageCollectorKey{}).(*UsageCollector)
+	return ok
+}
+
+// RecordUsage records usage for the request made with ctx, replacing any recorded before.
+// It does nothing if ctx doesn't collect usage.
+func RecordUsage(ctx context.Context, usage *RequestUsage) {
+	collector, ok := ctx.Value(usageCollectorKey{}).(*UsageCollector)
+	if !ok {
+		return
+	}
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	collector.usage = *usage
+	collector.recorded = true
+}
+
+// Usage returns the last recorded usage, or false if none was recorded.
+func (c *UsageCollector) Usage() (RequestUsage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.usage, c.recorded
+}
+
+// NewRequestUsage returns the usage of a request to provider for model that started at start and
+// was answered with result, reading the token counts in whichever format the provider reports them:
+// OpenAI's "usage", Anthropic's "usage" or Gemini's "usageMetadata" if not normalized, or Ollama's
+// eval counts.
+func NewRequestUsage(provider, model string, result interface{}, start time.Time) *RequestUsage {
+	usage := &RequestUsage{
+		Provider:  provider,
+		Model:     model,
+		LatencyMS: time.Since(start).Milliseconds(),
+	}
+
+	response, _ := result.(map[string]interface{})
+	counts, ok := response["usage"].(map[string]interface{})
+	metadata, isGemini := response["usageMetadata"].(map[string]interface{})
+	switch {
+	case ok:
+		usage.PromptTokens = firstCount(counts, "prompt_tokens", "input_tokens")
+		usage.CompletionTokens = firstCount(counts, "completion_tokens", "output_tokens")
+		usage.TotalTokens = firstCount(counts, "total_tokens")
+	case isGemini:
+		usage.PromptTokens = firstCount(metadata, "promptTokenCount")
+		usage.CompletionTokens = firstCount(metadata, "candidatesTokenCount")
+		usage.TotalTokens = firstCount(metadata, "totalTokenCount")
+	default:
+		usage.PromptTokens = firstCount(response, "prompt_eval_count")
+		usage.CompletionTokens = firstCount(response, "eval_count")
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	return usage
+}
+
+// firstCount returns the first of keys in object that is a number, or 0 if none is.
+func firstCount(object map[string]interface{}, keys ...string) int64 {
+	for _, key := range keys {
+		if count, ok := object[key].(float64); ok {
+			return int64(count)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,56 @@
+package monitoring
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRequestUsage(t *testing.T) {
+	tests := []struct {
+		name     string
+		response map[string]interface{}
+		want     [3]int64
+	}{
+		{"openai", map[string]interface{}{"usage": map[string]interface{}{
+			"prompt_tokens": float64(10), "completion_tokens": float64(5), "total_tokens": float64(15),
+		}}, [3]int64{10, 5, 15}},
+		{"anthropic", map[string]interface{}{"usage": map[string]interface{}{
+			"input_tokens": float64(10), "output_tokens": float64(5),
+		}}, [3]int64{10, 5, 15}},
+		{"gemini", map[string]interface{}{"usageMetadata": map[string]interface{}{
+			"promptTokenCount": float64(10), "candidatesTokenCount": float64(5), "totalTokenCount": float64(16),
+		}}, [3]int64{10, 5, 16}},
+		{"ollama", map[string]interface{}{"prompt_eval_count": float64(10), "eval_count": float64(5)}, [3]int64{10, 5, 15}},
+		{"no usage", map[string]interface{}{"id": "x"}, [3]int64{0, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usage := NewRequestUsage("provider", "model", tt.response, time.Now().Add(-time.Second))
+			assert.Equal(t, tt.want, [3]int64{usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens})
+			assert.GreaterOrEqual(t, usage.LatencyMS, int64(1000))
+			assert.Nil(t, usage.EstimatedCost)
+		})
+	}
+}
+
+func TestRecordUsage(t *testing.T) {
+	// Contexts that don't collect usage are ignored
+	RecordUsage(context.Background(), &RequestUsage{Provider: "openai"})
+	assert.False(t, CollectsUsage(context.Background()))
+
+	ctx, collector := WithUsageCollector(context.Background())
+	assert.True(t, CollectsUsage(ctx))
+	_, ok := collector.Usage()
+	assert.False(t, ok)
+
+	RecordUsage(ctx, &RequestUsage{Provider: "openai"})
+	RecordUsage(ctx, &RequestUsage{Provider: "anthropic"})
+	usage, ok := collector.Usage()
+	require.True(t, ok)
+	assert.Equal(t, "anthropic", usage.Provider)
+}
@@ -0,0 +1,30 @@
+package multiplexer
+
+import (
+	"context"
+	"slices"
+)
+
+type allowedModelsKey struct{}
+
+// WithAllowedModels returns a context for a request that may only use the listed models, as
+// requested: any other fails with ErrModelNotFound, as if no provider served it. A nil list
+// allows every model, and an empty one none.
+func WithAllowedModels(ctx context.Context, models []string) context.Context {
+	if models == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, allowedModelsKey{}, models)
+}
+
+// ModelAllowed reports whether the models allowed with WithAllowedModels, if any, include model.
+func ModelAllowed(ctx context.Context, model string) bool {
+	models, ok := ctx.Value(allowedModelsKey{}).([]string)
+	return !ok || slices.Contains(models, model)
+}
+
+// ModelsRestricted reports whether ctx only allows some models, with WithAllowedModels.
+func ModelsRestricted(ctx context.Context) bool {
+	_, ok := ctx.Value(allowedModelsKey{}).([]string)
+	return ok
+}
@@ -0,0 +1,41 @@
+package multiplexer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+)
+
+func TestModelMultiplexer_AllowedModels(t *testing.T) {
+	upstream := newModelEchoServer(t)
+	mux := New([]config.Provider{
+		{Name: "openai", Type: "openai", BaseURL: upstream.URL, Models: []string{"gpt-4o", "gpt-4o-mini"}},
+	})
+	mux.SetModels([]config.Model{{Name: "best", AliasFor: []string{"gpt-4o"}}})
+	messages := []map[string]interface{}{{"role": "user", "content": "Hello"}}
+
+	// Without an allowlist, every model is allowed
+	_, err := mux.ChatCompletion(context.Background(), "gpt-4o", messages, nil)
+	require.NoError(t, err)
+
+	ctx := WithAllowedModels(context.Background(), []string{"gpt-4o-mini", "best"})
+	_, err = mux.ChatCompletion(ctx, "gpt-4o-mini", messages, nil)
+	require.NoError(t, err)
+
+	// Models are allowed as requested, so an allowed alias may resolve to a model that isn't listed
+	_, err = mux.ChatCompletion(ctx, "best", messages, nil)
+	require.NoError(t, err)
+
+	_, err = mux.ChatCompletion(ctx, "gpt-4o", messages, nil)
+	assert.ErrorIs(t, err, ErrModelNotFound)
+	_, err = mux.Embeddings(ctx, "gpt-4o", "Hello", nil)
+	assert.ErrorIs(t, err, ErrModelNotFound)
+
+	// An empty allowlist allows no model
+	_, err = mux.ChatCompletion(WithAllowedModels(context.Background(), []string{}), "gpt-4o-mini", messages, nil)
+	assert.ErrorIs(t, err, ErrModelNotFound)
+}
@@ -0,0 +1,178 @@
+package multiplexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/providers"
+	"github.com/modelplex/modelplex/pkg/provider"
+)
+
+// ErrUnsupportedCapability is returned when a request requires capabilities that the requested
+// model, or every model of the requested alias, doesn't have.
+var ErrUnsupportedCapability = errors.New("unsupported capability")
+
+type requiredCapabilitiesKey struct{}
+
+// WithRequiredCapabilities returns a context for a request that may only be routed to models
+// with all of capabilities, such as "vision" or "tools".
+func WithRequiredCapabilities(ctx context.Context, capabilities []string) context.Context {
+	if len(capabilities) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, requiredCapabilitiesKey{}, capabilities)
+}
+
+// requiredCapabilities returns the capabilities set with WithRequiredCapabilities, if any.
+func requiredCapabilities(ctx context.Context) []string {
+	capabilities, _ := ctx.Value(requiredCapabilitiesKey{}).([]string)
+	return capabilities
+}
+
+// SetModels applies the configured models: their capabilities, costs, and aliases, which are
+// listed alongside the models providers serve. It must be called before the multiplexer is used.
+func (m *ModelMultiplexer) SetModels(models []config.Model) {
+	m.capabilities = make(map[string][]string)
+	m.aliases = make(map[string][]string)
+	m.costs = make(map[string]config.Model)
+	for _, model := range models {
+		if len(model.AliasFor) > 0 {
+			m.aliases[model.Name] = model.AliasFor
+			continue
+		}
+		if model.Capabilities != nil {
+			m.capabilities[model.Name] = model.Capabilities
+		}
+		if model.InputCost != 0 || model.OutputCost != 0 {
+			m.costs[model.Name] = model
+		}
+	}
+}
+
+// missingCapabilities returns those of required that model doesn't have. Models without
+// configured capabilities are assumed to have any.
+func (m *ModelMultiplexer) missingCapabilities(model string, required []string) []string {
+	capabilities, ok := m.capabilities[model]
+	if !ok {
+		return nil
+	}
+
+	var missing []string
+	for _, capability := range required {
+		if !slices.Contains(capabilities, capability) {
+			missing = append(missing, capability)
+		}
+	}
+	return missing
+}
+
+// resolveModel returns the model a request for model is sent as: model itself, or for an alias,
+// the first of its models with the capabilities ctx requires that a provider serves. If none is
+// served, the first with the capabilities is returned, for routing to report why.
+func (m *ModelMultiplexer) resolveModel(ctx context.Context, model string) (string, error) {
+	required := requiredCapabilities(ctx)
+
+	targets, ok := m.aliases[model]
+	if !ok {
+		if missing := m.missingCapabilities(model, required); len(missing) > 0 {
+			return "", fmt.Errorf("%w: %s doesn't support %s", ErrUnsupportedCapability, model,
+				strings.Join(missing, ", "))
+		}
+		return model, nil
+	}
+
+	capable := ""
+	for _, target := range targets {
+		if len(m.missingCapabilities(target, required)) > 0 {
+			continue
+		}
+		if len(m.GetProvidersForModel(target)) > 0 {
+			return target, nil
+		}
+		if capable == "" {
+			capable = target
+		}
+	}
+	if capable == "" {
+		return "", fmt.Errorf("%w: no model of %s supports %s", ErrUnsupportedCapability, model,
+			strings.Join(required, ", "))
+	}
+	return capable, nil
+}
+
+// route returns the model a request is sent as and the provider it's sent to.
+func (m *ModelMultiplexer) route(ctx context.Context, model string) (string, providers.Provider, error) {
+	model, err := m.resolveModel(ctx, model)
+	if err != nil {
+		return "", nil, err
+	}
+	provider, err := m.GetProvider(model)
+	return model, provider, err
+}
+
+// checkSupported returns an error wrapping provider.ErrNotSupported if p can't serve a request for
+// method, such as "chat.completions.stream": its operation, streaming, the tools in params, or, if
+// ctx requires vision, images. A "tool_choice" without tools is let through, since it asks nothing
+// of a reply, but a warning is logged if p drops it.
+func checkSupported(ctx context.Context, p providers.Provider, method string, params map[string]interface{}) error {
+	capabilities := providers.CapabilitiesOf(p)
+	operation, stream := strings.CutSuffix(method, ".stream")
+
+	var missing string
+	switch {
+	case operation == "chat.completions" && !capabilities.Chat:
+		missing = "chat completions"
+	case operation == "completions" && !capabilities.Completion:
+		missing = "completions"
+	case operation == "embeddings" && !capabilities.Embeddings:
+		missing = "embeddings"
+	case stream && !capabilities.Streaming:
+		missing = "streaming"
+	case params["tools"] != nil && !capabilities.Tools:
+		missing = "tools"
+	case slices.Contains(requiredCapabilities(ctx), provider.CapabilityVision) && !capabilities.Vision:
+		missing = "images"
+	default:
+		if toolChoice, ok := params["tool_choice"]; ok && !capabilities.Tools {
+			slog.Warn("Provider doesn't support tools, dropping tool_choice", "provider", p.Name(),
+				"tool_choice", toolChoice)
+		}
+		return nil
+	}
+	return fmt.Errorf("%s: %s: %w", p.Name(), missing, provider.ErrNotSupported)
+}
+
+// ProviderInfo describes a provider: the operations it supports and the models routed to it.
+type ProviderInfo struct {
+	Name         string                `json:"name"`
+	Type         string                `json:"type"`
+	Priority     int                   `json:"priority"`
+	Models       []string              `json:"models"`
+	Capabilities provider.Capabilities `json:"capabilities"`
+}
+
+// Providers describes every provider in priority order.
+func (m *ModelMultiplexer) Providers() []ProviderInfo {
+	m.mu.RLock()
+	served := m.servedModels()
+	m.mu.RUnlock()
+
+	infos := make([]ProviderInfo, 0, len(m.targets))
+	for _, target := range m.targets {
+		models := served[target.provider]
+		slices.Sort(models)
+		infos = append(infos, ProviderInfo{
+			Name:         target.provider.Name(),
+			Type:         target.config.Type,
+			Priority:     target.provider.Priority(),
+			Models:       append([]string{}, models...),
+			Capabilities: providers.CapabilitiesOf(target.provider),
+		})
+	}
+	return infos
+}
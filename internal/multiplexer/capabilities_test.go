@@ -0,0 +1,156 @@
+package multiplexer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/providers"
+	"github.com/modelplex/modelplex/pkg/provider"
+)
+
+// newModelEchoServer returns an upstream that answers each chat completion with the model it was sent.
+func newModelEchoServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"model": req.Model})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestModelMultiplexer_Capabilities(t *testing.T) {
+	upstream := newModelEchoServer(t)
+	mux := New([]config.Provider{
+		{Name: "openai", Type: "openai", BaseURL: upstream.URL, Models: []string{"gpt-4o", "gpt-4o-mini", "gpt-4"}},
+	})
+	mux.SetModels([]config.Model{
+		{Name: "gpt-4o", Capabilities: []string{"vision", "tools"}},
+		{Name: "gpt-4o-mini", Capabilities: []string{"tools"}},
+		{Name: "best", AliasFor: []string{"gpt-4o-mini", "gpt-4o"}},
+		{Name: "local", AliasFor: []string{"llama3"}},
+	})
+	messages := []map[string]interface{}{{"role": "user", "content": "Hello"}}
+	vision := WithRequiredCapabilities(context.Background(), []string{"vision"})
+
+	model := func(ctx context.Context, model string) (string, error) {
+		result, err := mux.ChatCompletion(ctx, model, messages, nil)
+		if err != nil {
+			return "", err
+		}
+		return result.(map[string]interface{})["model"].(string), nil
+	}
+
+	// An alias resolves to its first model with the required capabilities
+	got, err := model(context.Background(), "best")
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o-mini", got)
+	got, err = model(vision, "best")
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o", got)
+
+	// A model without the required capabilities isn't routed to
+	_, err = model(vision, "gpt-4o-mini")
+	require.ErrorIs(t, err, ErrUnsupportedCapability)
+	assert.Contains(t, err.Error(), "gpt-4o-mini doesn't support vision")
+	_, err = model(WithRequiredCapabilities(context.Background(), []string{"audio"}), "best")
+	require.ErrorIs(t, err, ErrUnsupportedCapability)
+	assert.Contains(t, err.Error(), "no model of best supports audio")
+
+	// Models without configured capabilities are assumed to have any
+	got, err = model(vision, "gpt-4")
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4", got)
+
+	// An alias whose models aren't served fails to route like a model would
+	_, err = model(context.Background(), "local")
+	assert.ErrorIs(t, err, ErrModelNotFound)
+
+	models := mux.ListModels()
+	sort.Strings(models)
+	assert.Equal(t, []string{"best", "gpt-4", "gpt-4o", "gpt-4o-mini", "local"}, models)
+}
+
+func TestModelMultiplexer_UnsupportedOperations(t *testing.T) {
+	limited := &MockProvider{capabilities: &provider.Capabilities{Chat: true}}
+	limited.On("Name").Return("limited")
+	mux := &ModelMultiplexer{
+		providers: []providers.Provider{limited},
+		modelMap:  map[string][]providers.Provider{"gpt-4": {limited}},
+	}
+	messages := []map[string]interface{}{{"role": "user", "content": "Hello"}}
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		send    func() error
+		wantErr string
+	}{
+		{name: "completion", wantErr: "limited: completions", send: func() error {
+			_, err := mux.Completion(ctx, "gpt-4", "Hello", nil)
+			return err
+		}},
+		{name: "stream", wantErr: "limited: streaming", send: func() error {
+			_, err := mux.ChatCompletionStream(ctx, "gpt-4", messages, nil)
+			return err
+		}},
+		{name: "embeddings", wantErr: "limited: embeddings", send: func() error {
+			_, err := mux.Embeddings(ctx, "gpt-4", "Hello", nil)
+			return err
+		}},
+		{name: "tools", wantErr: "limited: tools", send: func() error {
+			_, err := mux.ChatCompletion(ctx, "gpt-4", messages, map[string]interface{}{"tools": []interface{}{}})
+			return err
+		}},
+		{name: "images", wantErr: "limited: images", send: func() error {
+			_, err := mux.ChatCompletion(WithRequiredCapabilities(ctx, []string{"vision"}), "gpt-4", messages, nil)
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.send()
+			require.ErrorIs(t, err, provider.ErrNotSupported)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+	// Requests are rejected before they're sent
+	limited.AssertNotCalled(t, "ChatCompletion", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestModelMultiplexer_ToolChoiceWithoutTools(t *testing.T) {
+	limited := &MockProvider{capabilities: &provider.Capabilities{Chat: true}}
+	limited.On("Name").Return("limited")
+	mux := &ModelMultiplexer{
+		providers: []providers.Provider{limited},
+		modelMap:  map[string][]providers.Provider{"gpt-4": {limited}},
+	}
+
+	var buf bytes.Buffer
+	oldLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer slog.SetDefault(oldLogger)
+
+	// A tool_choice without tools is sent, for the provider to drop, with a warning
+	params := map[string]interface{}{"tool_choice": "required"}
+	limited.On("ChatCompletion", mock.Anything, "gpt-4", mock.Anything, params).Return(map[string]interface{}{}, nil)
+	_, err := mux.ChatCompletion(context.Background(), "gpt-4", nil, params)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), `msg="Provider doesn't support tools, dropping tool_choice" provider=limited`)
+}
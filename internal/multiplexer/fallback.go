@@ -0,0 +1,135 @@
+package multiplexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+
+	"github.com/modelplex/modelplex/internal/providers"
+)
+
+// ErrInvalidFallback is returned when a fallback provider a client names doesn't exist, or doesn't
+// serve the requested model.
+var ErrInvalidFallback = errors.New("invalid fallback")
+
+type fallbackKey struct{}
+
+// WithFallback returns a context for a request that, if the provider it's routed to fails, is sent
+// to each of the named providers in turn, for the same model, until one succeeds. They're tried
+// before the model's other failover candidates.
+func WithFallback(ctx context.Context, names []string) context.Context {
+	if len(names) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, fallbackKey{}, names)
+}
+
+// fallbackNames returns the providers named with WithFallback, if any.
+func fallbackNames(ctx context.Context) []string {
+	names, _ := ctx.Value(fallbackKey{}).([]string)
+	return names
+}
+
+// attempt is a provider a request may be sent to, and the model it's requested as.
+type attempt struct {
+	model    string
+	provider providers.Provider
+}
+
+// attempts returns the model and provider a request for model is routed to, followed by the
+// fallback providers ctx names, in the order named, and then the rest of the model's failover
+// candidates, in routing order. Each provider appears once. Each fallback is sent the same model,
+// or for an alias, the first of its models with the required capabilities that it serves.
+func (m *ModelMultiplexer) attempts(ctx context.Context, model string) ([]attempt, error) {
+	if !ModelAllowed(ctx, model) {
+		return nil, fmt.Errorf("%w: %s", ErrModelNotFound, model)
+	}
+	resolved, primary, err := m.route(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := []attempt{{model: resolved, provider: primary}}
+	for _, name := range fallbackNames(ctx) {
+		i := slices.IndexFunc(m.providers, func(provider providers.Provider) bool { return provider.Name() == name })
+		if i < 0 {
+			return nil, fmt.Errorf("%w: no provider named %q", ErrInvalidFallback, name)
+		}
+		provider := m.providers[i]
+		if !m.isAllowed(provider) {
+			return nil, fmt.Errorf("%w: fallback %s needs network access", ErrOffline, name)
+		}
+		if slices.ContainsFunc(attempts, func(a attempt) bool { return a.provider == provider }) {
+			continue
+		}
+
+		served, ok := m.servedModel(ctx, provider, model, resolved)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s doesn't serve %s", ErrInvalidFallback, name, model)
+		}
+		attempts = append(attempts, attempt{model: served, provider: provider})
+	}
+	for _, candidate := range m.GetProvidersForModel(resolved) {
+		if !slices.ContainsFunc(attempts, func(a attempt) bool { return a.provider == candidate }) {
+			attempts = append(attempts, attempt{model: resolved, provider: candidate})
+		}
+	}
+	return attempts, nil
+}
+
+// servedModel returns the model provider serves a request for model, resolved to resolved, as:
+// resolved itself, or if model is an alias, another of its models with the required capabilities.
+func (m *ModelMultiplexer) servedModel(
+	ctx context.Context, provider providers.Provider, model, resolved string,
+) (string, bool) {
+	if slices.Contains(m.routes(resolved), provider) {
+		return resolved, true
+	}
+	for _, target := range m.aliases[model] {
+		if len(m.missingCapabilities(target, requiredCapabilities(ctx))) == 0 &&
+			slices.Contains(m.routes(target), provider) {
+			return target, true
+		}
+	}
+	return "", false
+}
+
+// retryable reports whether a request that failed with err may succeed on another provider: it
+// couldn't reach the upstream or timed out, or the upstream answered with a server error or 429.
+// Other failures, such as an invalid request, would fail the same way anywhere.
+func retryable(err error) bool {
+	var status *providers.StatusError
+	if errors.As(err, &status) {
+		return status.StatusCode >= http.StatusInternalServerError || status.StatusCode == http.StatusTooManyRequests
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// withFallback sends a request for model with send to the provider it's routed to and, while
+// sending fails with a retryable error, to each of the other attempts in turn: the fallback
+// providers ctx names, then the model's failover candidates. It returns the first success, the
+// first failure that isn't retryable, or the last failure.
+func withFallback[T any](
+	ctx context.Context, m *ModelMultiplexer, model string,
+	send func(model string, provider providers.Provider) (T, error),
+) (T, error) {
+	attempts, err := m.attempts(ctx, model)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	for i := 0; ; i++ {
+		result, err := send(attempts[i].model, attempts[i].provider)
+		if err == nil || i == len(attempts)-1 || ctx.Err() != nil || !retryable(err) {
+			return result, err
+		}
+		slog.Warn("Request failed, falling back to the next provider", "provider", attempts[i].provider.Name(),
+			"fallback", attempts[i+1].provider.Name(), "model", attempts[i].model, "error", err)
+	}
+}
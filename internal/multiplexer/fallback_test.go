@@ -0,0 +1,185 @@
+package multiplexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/providers"
+	"github.com/modelplex/modelplex/pkg/provider"
+)
+
+// errUnavailable is an upstream failure that's retried on other providers
+var errUnavailable = &providers.StatusError{StatusCode: http.StatusServiceUnavailable, Body: "upstream unavailable"}
+
+func newFallbackMultiplexer() (mux *ModelMultiplexer, primary, fallback, other *MockProvider) {
+	primary, fallback, other = &MockProvider{}, &MockProvider{}, &MockProvider{}
+	primary.On("Name").Return("openai").Maybe()
+	fallback.On("Name").Return("anthropic").Maybe()
+	other.On("Name").Return("ollama").Maybe()
+
+	mux = &ModelMultiplexer{
+		providers: []providers.Provider{primary, fallback, other},
+		modelMap: map[string][]providers.Provider{
+			"gpt-4":  {primary, fallback},
+			"claude": {fallback},
+			"llama":  {other},
+		},
+		aliases: map[string][]string{"smart": {"gpt-4", "claude"}},
+	}
+	return mux, primary, fallback, other
+}
+
+func TestModelMultiplexer_Fallback(t *testing.T) {
+	mux, primary, fallback, _ := newFallbackMultiplexer()
+	messages := []map[string]interface{}{{"role": "user", "content": "Hello"}}
+	primary.On("ChatCompletion", mock.Anything, "gpt-4", messages, mock.Anything).
+		Return(nil, errUnavailable)
+	fallback.On("ChatCompletion", mock.Anything, "gpt-4", messages, mock.Anything).Return(chatResult("Hi"), nil)
+
+	// Without a fallback or other candidates, the routed provider's error is returned
+	mux.modelMap["gpt-4"] = []providers.Provider{primary}
+	_, err := mux.ChatCompletion(context.Background(), "gpt-4", messages, nil)
+	require.ErrorIs(t, err, errUnavailable)
+
+	mux.modelMap["gpt-4"] = []providers.Provider{primary, fallback}
+	ctx := WithFallback(context.Background(), []string{"anthropic"})
+	result, err := mux.ChatCompletion(ctx, "gpt-4", messages, nil)
+	require.NoError(t, err)
+	assert.Equal(t, chatResult("Hi"), result)
+	fallback.AssertNumberOfCalls(t, "ChatCompletion", 1)
+}
+
+func TestModelMultiplexer_Fallback_Candidates(t *testing.T) {
+	mux, primary, fallback, _ := newFallbackMultiplexer()
+	messages := []map[string]interface{}{{"role": "user", "content": "Hello"}}
+	primary.On("ChatCompletion", mock.Anything, "gpt-4", messages, mock.Anything).
+		Return(nil, errUnavailable)
+	fallback.On("ChatCompletion", mock.Anything, "gpt-4", messages, mock.Anything).Return(chatResult("Hi"), nil)
+
+	// Without a fallback header, the model's next candidate answers
+	result, err := mux.ChatCompletion(context.Background(), "gpt-4", messages, nil)
+	require.NoError(t, err)
+	assert.Equal(t, chatResult("Hi"), result)
+	fallback.AssertNumberOfCalls(t, "ChatCompletion", 1)
+}
+
+func TestModelMultiplexer_Fallback_Order(t *testing.T) {
+	mux, primary, fallback, other := newFallbackMultiplexer()
+	mux.modelMap["gpt-4"] = []providers.Provider{primary, fallback, other}
+	messages := []map[string]interface{}{{"role": "user", "content": "Hello"}}
+
+	var order []string
+	for _, provider := range []*MockProvider{primary, fallback, other} {
+		name := provider.Name()
+		provider.On("ChatCompletion", mock.Anything, "gpt-4", messages, mock.Anything).
+			Run(func(mock.Arguments) { order = append(order, name) }).
+			Return(nil, &providers.StatusError{StatusCode: 503, Body: name + " unavailable"})
+	}
+
+	// Named fallbacks come before the other candidates, and no provider is tried twice
+	ctx := WithFallback(context.Background(), []string{"ollama", "openai"})
+	_, err := mux.ChatCompletion(ctx, "gpt-4", messages, nil)
+	require.EqualError(t, err, "API request failed with status 503: anthropic unavailable")
+	assert.Equal(t, []string{"openai", "ollama", "anthropic"}, order)
+}
+
+func TestModelMultiplexer_Fallback_Alias(t *testing.T) {
+	mux, primary, fallback, _ := newFallbackMultiplexer()
+	primary.On("Completion", mock.Anything, "gpt-4", "Hello", mock.Anything).
+		Return(nil, errUnavailable)
+	fallback.On("Completion", mock.Anything, "claude", "Hello", mock.Anything).Return(map[string]interface{}{}, nil)
+
+	// anthropic is sent the alias's model it serves, not the one the alias resolved to
+	mux.modelMap["gpt-4"] = []providers.Provider{primary}
+	ctx := WithFallback(context.Background(), []string{"anthropic"})
+	_, err := mux.Completion(ctx, "smart", "Hello", nil)
+	require.NoError(t, err)
+	fallback.AssertExpectations(t)
+}
+
+func TestModelMultiplexer_Fallback_NotRetryable(t *testing.T) {
+	badRequest := &providers.StatusError{StatusCode: http.StatusBadRequest, Body: "invalid temperature"}
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{name: "client error", err: badRequest},
+		{name: "too many messages", err: fmt.Errorf("%w: 3, more than the limit of 2", providers.ErrTooManyMessages)},
+		{name: "not supported", err: fmt.Errorf("openai: tools: %w", provider.ErrNotSupported)},
+		{name: "model not pulled", err: &providers.ModelNotPulledError{Model: "gpt-4", Provider: "openai"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux, primary, fallback, _ := newFallbackMultiplexer()
+			messages := []map[string]interface{}{{"role": "user", "content": "Hello"}}
+			primary.On("ChatCompletion", mock.Anything, "gpt-4", messages, mock.Anything).Return(nil, tt.err)
+
+			// The primary's error explains the problem, and another provider would only fail the same way
+			ctx := WithFallback(context.Background(), []string{"anthropic"})
+			_, err := mux.ChatCompletion(ctx, "gpt-4", messages, nil)
+			require.Equal(t, tt.err, err)
+			fallback.AssertNotCalled(t, "ChatCompletion", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "server error", err: errUnavailable, want: true},
+		{name: "rate limited", err: &providers.StatusError{StatusCode: http.StatusTooManyRequests}, want: true},
+		{name: "gateway error page", err: fmt.Errorf("openai: %w",
+			&providers.StatusError{StatusCode: http.StatusBadGateway, Err: providers.ErrNonJSONResponse}), want: true},
+		{name: "connection refused", err: &url.Error{Op: "Post", URL: "http://127.0.0.1:1", Err: &net.OpError{
+			Op: "dial", Err: errors.New("connection refused"),
+		}}, want: true},
+		{name: "timeout", err: context.DeadlineExceeded, want: true},
+		{name: "unauthorized", err: &providers.StatusError{StatusCode: http.StatusUnauthorized}},
+		{name: "not found", err: &providers.StatusError{StatusCode: http.StatusNotFound}},
+		{name: "unprocessable", err: &providers.StatusError{StatusCode: http.StatusUnprocessableEntity}},
+		{name: "other", err: errors.New("invalid response")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, retryable(tt.err))
+		})
+	}
+}
+
+func TestModelMultiplexer_Fallback_Invalid(t *testing.T) {
+	mux, primary, _, _ := newFallbackMultiplexer()
+
+	tests := []struct {
+		name     string
+		fallback []string
+		wantErr  string
+	}{
+		{name: "unknown provider", fallback: []string{"anthropic", "mistral"}, wantErr: `no provider named "mistral"`},
+		{name: "model not served", fallback: []string{"ollama"}, wantErr: "ollama doesn't serve gpt-4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := WithFallback(context.Background(), tt.fallback)
+			_, err := mux.ChatCompletion(ctx, "gpt-4", nil, nil)
+			require.ErrorIs(t, err, ErrInvalidFallback)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+	// Invalid fallbacks are rejected before the request is sent anywhere
+	primary.AssertNotCalled(t, "ChatCompletion", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
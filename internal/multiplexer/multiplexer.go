@@ -2,88 +2,552 @@
 package multiplexer
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"slices"
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/monitoring"
 	"github.com/modelplex/modelplex/internal/providers"
 )
 
 // ModelMultiplexer routes requests to appropriate AI providers based on model names.
+//
+// Providers are ordered by Priority, lowest first, and providers with equal priority keep
+// their config order, except that a provider's model_priority overrides its Priority for
+// particular models. A model is routed to the first provider in that order that serves it, and
+// a request that fails is sent to the providers after it in turn. A model that no provider serves
+// is routed as the no-provider policy says, to the default provider or the first provider, so it
+// can still reach an upstream whose models aren't listed in the config, or not at all. Aliases resolve to
+// a model before routing, and requests are only routed to models with the capabilities they require.
 type ModelMultiplexer struct {
+	// providers is in routing order; modelMap lists the providers serving each model, in the same order
 	providers []providers.Provider
-	modelMap  map[string]providers.Provider
+	modelMap  map[string][]providers.Provider
+	// modelsVersion changes whenever a model is added to or removed from modelMap
+	modelsVersion uint64
+	// defaultProvider serves models no provider serves; nil leaves them unrouted. With
+	// fallbackFirst, the first provider serves them instead.
+	defaultProvider providers.Provider
+	fallbackFirst   bool
+	mu              sync.RWMutex
+	metrics         *monitoring.Metrics
+	// logger logs each routed request; nil disables request logging
+	logger *monitoring.Logger
+	// offline restricts routing, discovery and probing to providers that don't need network access
+	offline bool
+	// capabilities lists what each model configured with capabilities can do, and aliases the
+	// models each alias resolves to; see SetModels
+	capabilities map[string][]string
+	aliases      map[string][]string
+	// costs holds the models configured with costs, from which request costs are estimated
+	costs map[string]config.Model
+	// shadow is sent copies of chat completions to compare with the primary's; see SetShadow
+	shadow *shadow
+
+	// targets tracks each provider's probe status
+	targets []*probeTarget
 }
 
+// tokensPerCostUnit is the number of tokens model costs are given for
+const tokensPerCostUnit = 1_000_000
+
+var (
+	// ErrModelNotFound is returned when no provider serves a model and the no-provider policy
+	// doesn't route it anywhere.
+	ErrModelNotFound = errors.New("model not found")
+	// ErrOffline is returned in offline mode when a model is only served by providers that need network access.
+	ErrOffline = errors.New("offline mode")
+)
+
 // New creates a new model multiplexer with the given provider configurations.
 func New(configs []config.Provider) *ModelMultiplexer {
+	return NewWithMetrics(configs, monitoring.NewMetrics())
+}
+
+// NewWithMetrics creates a new model multiplexer that records into existing metrics,
+// so counters carry over when the multiplexer is rebuilt on config reload.
+func NewWithMetrics(configs []config.Provider, metrics *monitoring.Metrics) *ModelMultiplexer {
 	m := &ModelMultiplexer{
 		providers: make([]providers.Provider, 0),
-		modelMap:  make(map[string]providers.Provider),
+		modelMap:  make(map[string][]providers.Provider),
+		metrics:   metrics,
 	}
 
 	for _, cfg := range configs {
 		cfg := cfg // Create a copy to avoid closure issues
 		provider := providers.NewProvider(&cfg)
 		if provider != nil {
+			// Validated when the config is loaded
+			refreshInterval, _ := cfg.RefreshEvery()
+			modelPriority, _ := cfg.ModelPriorities()
 			m.providers = append(m.providers, provider)
-
-			for _, model := range cfg.Models {
-				if _, exists := m.modelMap[model]; !exists {
-					m.modelMap[model] = provider
-				}
-			}
+			m.targets = append(m.targets, &probeTarget{
+				provider:        provider,
+				config:          cfg,
+				refreshInterval: refreshInterval,
+				modelPriority:   modelPriority,
+				probe:           providers.NewProber(&cfg).Probe,
+				status:          ProviderStatus{Name: provider.Name(), Status: StatusPending},
+			})
 		}
 	}
 
-	sort.Slice(m.providers, func(i, j int) bool {
+	sort.SliceStable(m.providers, func(i, j int) bool {
 		return m.providers[i].Priority() < m.providers[j].Priority()
 	})
+	sort.SliceStable(m.targets, func(i, j int) bool {
+		return m.targets[i].provider.Priority() < m.targets[j].provider.Priority()
+	})
+
+	models := make(map[providers.Provider][]string, len(m.targets))
+	for _, target := range m.targets {
+		models[target.provider] = target.config.Models
+	}
+	m.setModelMap(m.buildModelMap(models))
 
 	return m
 }
 
-// GetProvider returns the provider responsible for the given model.
-func (m *ModelMultiplexer) GetProvider(model string) (providers.Provider, error) {
-	if provider, exists := m.modelMap[model]; exists {
-		return provider, nil
+// buildModelMap returns the providers serving each model, given the models each provider serves.
+// Each model's providers are ordered by their priority for it, and providers with equal priority
+// keep their order in providers, which is their config order, so the result doesn't depend on the
+// order models were configured or discovered in. The caller must hold mu.
+func (m *ModelMultiplexer) buildModelMap(models map[providers.Provider][]string) map[string][]providers.Provider {
+	modelMap := make(map[string][]providers.Provider)
+	for _, provider := range m.providers {
+		for _, model := range models[provider] {
+			if !slices.Contains(modelMap[model], provider) {
+				modelMap[model] = append(modelMap[model], provider)
+			}
+		}
+	}
+	for model, candidates := range modelMap {
+		slices.SortStableFunc(candidates, func(a, b providers.Provider) int {
+			return cmp.Compare(m.priority(a, model), m.priority(b, model))
+		})
+	}
+	return modelMap
+}
+
+// servedModels returns the models each provider serves according to modelMap. The caller must hold mu.
+func (m *ModelMultiplexer) servedModels() map[providers.Provider][]string {
+	models := make(map[providers.Provider][]string)
+	for model, candidates := range m.modelMap {
+		for _, provider := range candidates {
+			models[provider] = append(models[provider], model)
+		}
+	}
+	return models
+}
+
+// setModelMap replaces modelMap with next, logging the models that another provider serves first
+// from now on, and changing modelsVersion if models were added or removed. The caller must hold mu.
+func (m *ModelMultiplexer) setModelMap(next map[string][]providers.Provider) {
+	changed := len(next) != len(m.modelMap)
+	for model, candidates := range next {
+		previous, ok := m.modelMap[model]
+		if !ok {
+			changed = true
+			continue
+		}
+		if len(previous) > 0 && previous[0] != candidates[0] {
+			slog.Info("Model routed to another provider", "model", model,
+				"provider", candidates[0].Name(), "previous", previous[0].Name())
+		}
+	}
+	if changed {
+		m.modelsVersion++
+	}
+	m.modelMap = next
+}
+
+// priority returns provider's priority for routing model: its model_priority override for
+// model if it has one, or its Priority. The caller must hold mu.
+func (m *ModelMultiplexer) priority(provider providers.Provider, model string) int {
+	if target := m.target(provider); target != nil {
+		if priority, ok := target.modelPriority[model]; ok {
+			return priority
+		}
+	}
+	return provider.Priority()
+}
+
+// Metrics returns the metrics collected for requests routed through the multiplexer.
+func (m *ModelMultiplexer) Metrics() *monitoring.Metrics {
+	return m.metrics
+}
+
+// NewFromConfig creates a model multiplexer that routes as cfg says: its providers, default
+// provider, no-provider policy, offline mode, models and shadow, recording into metrics.
+func NewFromConfig(cfg *config.Config, metrics *monitoring.Metrics) *ModelMultiplexer {
+	m := NewWithMetrics(cfg.Providers, metrics)
+	m.SetShadow(cfg.Server.Shadow)
+	m.SetDefaultProvider(cfg.Server.DefaultProvider)
+	m.SetNoProviderPolicy(cfg.Server.NoProvider())
+	m.SetOffline(cfg.Server.Offline)
+	m.SetModels(cfg.Models)
+	return m
+}
+
+// SetRequestLogger sets the logger each routed request is logged to.
+func (m *ModelMultiplexer) SetRequestLogger(logger *monitoring.Logger) {
+	m.logger = logger
+}
+
+// SetDefaultProvider routes models that no provider serves to the named provider.
+// An empty or unknown name leaves them unrouted.
+func (m *ModelMultiplexer) SetDefaultProvider(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.defaultProvider = nil
+	for _, provider := range m.providers {
+		if provider.Name() == name {
+			m.defaultProvider = provider
+			return
+		}
+	}
+}
+
+// SetNoProviderPolicy sets how models no provider serves are routed, as one of the config.NoProvider*
+// policies. NoProviderFallbackDefault, the default, routes them to the provider set with
+// SetDefaultProvider if there is one.
+func (m *ModelMultiplexer) SetNoProviderPolicy(policy string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.fallbackFirst = policy == config.NoProviderFallbackFirst
+	if policy == config.NoProviderError {
+		m.defaultProvider = nil
+	}
+}
+
+// SetOffline restricts the multiplexer to providers that don't need network access, such as Ollama.
+// Models served only by other providers fail with ErrOffline, and those providers are never probed
+// or queried for models; Status reports them as "offline". It must be called before the multiplexer is used.
+func (m *ModelMultiplexer) SetOffline(offline bool) {
+	m.offline = offline
+	for _, target := range m.targets {
+		if !m.isAllowed(target.provider) {
+			target.mu.Lock()
+			target.status.Status = StatusOffline
+			target.mu.Unlock()
+		}
+	}
+}
+
+// isAllowed reports whether requests may be sent to provider, which in offline mode
+// is only true of providers that don't need network access.
+func (m *ModelMultiplexer) isAllowed(provider providers.Provider) bool {
+	if !m.offline {
+		return true
 	}
+	target := m.target(provider)
+	return target != nil && config.OfflineCapable(&target.config)
+}
 
-	if len(m.providers) > 0 {
-		return m.providers[0], nil
+// allowed returns the candidates requests may be sent to.
+func (m *ModelMultiplexer) allowed(candidates []providers.Provider) []providers.Provider {
+	if !m.offline {
+		return candidates
 	}
+	return slices.DeleteFunc(candidates, func(provider providers.Provider) bool {
+		return !m.isAllowed(provider)
+	})
+}
 
-	return nil, fmt.Errorf("no provider available for model: %s", model)
+// GetProvider returns the provider requests for the given model are routed to,
+// which is the first of GetProvidersForModel.
+func (m *ModelMultiplexer) GetProvider(model string) (providers.Provider, error) {
+	routes := m.routes(model)
+	candidates := m.allowed(routes)
+	if len(candidates) == 0 {
+		if len(routes) > 0 {
+			return nil, fmt.Errorf("%w: %s is only served by providers that need network access", ErrOffline, model)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrModelNotFound, model)
+	}
+	return candidates[0], nil
 }
 
-// ListModels returns all available models from all configured providers.
+// GetProvidersForModel returns the providers for a model in routing order: requests go to the
+// first, and failed requests to the rest in turn. A model no provider serves gets just the provider
+// the no-provider policy routes it to, if any. In offline mode, only local providers are returned.
+func (m *ModelMultiplexer) GetProvidersForModel(model string) []providers.Provider {
+	return m.allowed(m.routes(model))
+}
+
+// routes returns the providers a model is routed to, ignoring offline mode.
+func (m *ModelMultiplexer) routes(model string) []providers.Provider {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if candidates := m.modelMap[model]; len(candidates) > 0 {
+		return slices.Clone(candidates)
+	}
+	if m.fallbackFirst && len(m.providers) > 0 {
+		return []providers.Provider{m.providers[0]}
+	}
+	if m.defaultProvider != nil {
+		return []providers.Provider{m.defaultProvider}
+	}
+	return nil
+}
+
+// ListModels returns all available models from all configured providers, and the configured aliases.
 func (m *ModelMultiplexer) ListModels() []string {
-	models := make([]string, 0, len(m.modelMap))
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	models := make([]string, 0, len(m.modelMap)+len(m.aliases))
 	for model := range m.modelMap {
 		models = append(models, model)
 	}
+	for alias := range m.aliases {
+		if _, ok := m.modelMap[alias]; !ok {
+			models = append(models, alias)
+		}
+	}
 	return models
 }
 
+// ModelsVersion returns a number that changes whenever the set of models ListModels returns does,
+// so callers can cache what they build from it.
+func (m *ModelMultiplexer) ModelsVersion() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.modelsVersion
+}
+
+// DiscoverModels queries every provider that supports model discovery and adds it to the
+// providers serving each model it reports, ordered as when the multiplexer was created. Models a
+// provider no longer reports stop being routed to it, unless they're listed in its config.
+// It returns the total number of routable models afterwards.
+func (m *ModelMultiplexer) DiscoverModels(ctx context.Context) int {
+	for _, provider := range m.providers {
+		m.discoverProvider(ctx, provider)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.modelMap)
+}
+
+// discoverProvider registers the models a provider reports, if it supports model discovery.
+func (m *ModelMultiplexer) discoverProvider(ctx context.Context, provider providers.Provider) {
+	discoverer, ok := provider.(providers.ModelDiscoverer)
+	if !ok || !m.isAllowed(provider) {
+		return
+	}
+
+	models, err := discoverer.DiscoverModels(ctx)
+	if err != nil {
+		slog.Warn("Model discovery failed", "provider", provider.Name(), "error", err)
+		return
+	}
+	slog.Info("Discovered models", "provider", provider.Name(), "count", len(models))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	served := m.servedModels()
+	if target := m.target(provider); target != nil {
+		// Replace what the provider last reported, keeping its configured models
+		served[provider] = target.config.Models
+
+		now := time.Now()
+		target.mu.Lock()
+		target.status.LastRefresh = &now
+		target.mu.Unlock()
+	}
+	served[provider] = append(slices.Clone(served[provider]), models...)
+	m.setModelMap(m.buildModelMap(served))
+}
+
+// target returns the probe target tracking provider, or nil if there isn't one.
+func (m *ModelMultiplexer) target(provider providers.Provider) *probeTarget {
+	for _, target := range m.targets {
+		if target.provider == provider {
+			return target
+		}
+	}
+	return nil
+}
+
 // ChatCompletion routes a chat completion request to the appropriate provider.
 func (m *ModelMultiplexer) ChatCompletion(
-	ctx context.Context, model string, messages []map[string]interface{},
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
 ) (interface{}, error) {
-	provider, err := m.GetProvider(model)
-	if err != nil {
-		return nil, err
-	}
+	return withFallback(ctx, m, model, func(model string, provider providers.Provider) (interface{}, error) {
+		if err := checkSupported(ctx, provider, "chat.completions", params); err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		result, err := provider.ChatCompletion(ctx, model, messages, params)
+		m.logRequest(provider, model, "chat.completions", params, result, start, err)
+		if err != nil {
+			return nil, err
+		}
 
-	return provider.ChatCompletion(ctx, model, messages)
+		m.shadowChatCompletion(provider, model, messages, params, result, time.Since(start))
+		m.recordUsage(provider, result)
+		m.reportUsage(ctx, provider, model, result, start)
+		return result, nil
+	})
 }
 
 // Completion routes a completion request to the appropriate provider.
-func (m *ModelMultiplexer) Completion(ctx context.Context, model, prompt string) (interface{}, error) {
-	provider, err := m.GetProvider(model)
+func (m *ModelMultiplexer) Completion(
+	ctx context.Context, model, prompt string, params map[string]interface{},
+) (interface{}, error) {
+	return withFallback(ctx, m, model, func(model string, provider providers.Provider) (interface{}, error) {
+		if err := checkSupported(ctx, provider, "completions", params); err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		result, err := provider.Completion(ctx, model, prompt, params)
+		m.logRequest(provider, model, "completions", params, result, start, err)
+		if err != nil {
+			return nil, err
+		}
+
+		m.recordUsage(provider, result)
+		m.reportUsage(ctx, provider, model, result, start)
+		return result, nil
+	})
+}
+
+// recordUsage records the prompt cache usage reported in a provider response.
+// Anthropic reports it as "cache_read_input_tokens" and "cache_creation_input_tokens" under "usage".
+func (m *ModelMultiplexer) recordUsage(provider providers.Provider, result interface{}) {
+	response, ok := result.(map[string]interface{})
+	if !ok {
+		return
+	}
+	usage, ok := response["usage"].(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	read, _ := usage["cache_read_input_tokens"].(float64)
+	creation, _ := usage["cache_creation_input_tokens"].(float64)
+	m.metrics.RecordCacheUsage(provider.Name(), int64(read), int64(creation))
+}
+
+// reportUsage records the usage of a request to provider for model in ctx, for the proxy to
+// report to its client, with its cost estimated from the model's configured costs.
+func (m *ModelMultiplexer) reportUsage(
+	ctx context.Context, provider providers.Provider, model string, result interface{}, start time.Time,
+) {
+	if !monitoring.CollectsUsage(ctx) {
+		return
+	}
+
+	usage := monitoring.NewRequestUsage(provider.Name(), model, result, start)
+	if costs, ok := m.costs[model]; ok {
+		cost := (float64(usage.PromptTokens)*costs.InputCost + float64(usage.CompletionTokens)*costs.OutputCost) /
+			tokensPerCostUnit
+		usage.EstimatedCost = &cost
+	}
+	monitoring.RecordUsage(ctx, usage)
+}
+
+// logRequest counts a request routed to provider in the metrics, and logs it if request logging
+// is enabled. The "user" parameter clients send to identify
+// their end users is recorded in the log's metadata, whether or not the provider accepts it.
+// Streams are logged once the upstream has started responding, without token counts.
+func (m *ModelMultiplexer) logRequest(
+	provider providers.Provider, model, method string, params map[string]interface{},
+	result interface{}, start time.Time, err error,
+) {
+	if target := m.target(provider); target != nil {
+		m.metrics.RecordRequest(target.config.Name, err != nil)
+	}
+	if m.logger == nil {
+		return
+	}
+
+	reqLog := &monitoring.RequestLog{
+		Model:    model,
+		Provider: provider.Name(),
+		Method:   method,
+		Duration: time.Since(start),
+		Success:  err == nil,
+	}
 	if err != nil {
-		return nil, err
+		reqLog.Error = err.Error()
+	}
+	if user, ok := params["user"].(string); ok && user != "" {
+		reqLog.Metadata = map[string]interface{}{"user": user}
+	}
+	if response, ok := result.(map[string]interface{}); ok {
+		if usage, ok := response["usage"].(map[string]interface{}); ok {
+			total, _ := usage["total_tokens"].(float64)
+			reqLog.TokensUsed = int(total)
+		}
 	}
+	m.logger.LogRequest(reqLog)
+}
+
+// ChatCompletionStream routes a streaming chat completion request to the appropriate provider.
+func (m *ModelMultiplexer) ChatCompletionStream(
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+) (<-chan providers.StreamChunk, error) {
+	send := func(model string, provider providers.Provider) (<-chan providers.StreamChunk, error) {
+		if err := checkSupported(ctx, provider, "chat.completions.stream", params); err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		chunks, err := provider.ChatCompletionStream(ctx, model, messages, params)
+		m.logRequest(provider, model, "chat.completions.stream", params, nil, start, err)
+		return chunks, err
+	}
+	return withFallback(ctx, m, model, send)
+}
+
+// CompletionStream routes a streaming completion request to the appropriate provider.
+func (m *ModelMultiplexer) CompletionStream(
+	ctx context.Context, model, prompt string, params map[string]interface{},
+) (<-chan providers.StreamChunk, error) {
+	send := func(model string, provider providers.Provider) (<-chan providers.StreamChunk, error) {
+		if err := checkSupported(ctx, provider, "completions.stream", params); err != nil {
+			return nil, err
+		}
 
-	return provider.Completion(ctx, model, prompt)
+		start := time.Now()
+		chunks, err := provider.CompletionStream(ctx, model, prompt, params)
+		m.logRequest(provider, model, "completions.stream", params, nil, start, err)
+		return chunks, err
+	}
+	return withFallback(ctx, m, model, send)
+}
+
+// Embeddings routes an embeddings request to the appropriate provider. It fails with
+// provider.ErrNotSupported if that provider can't create embeddings.
+func (m *ModelMultiplexer) Embeddings(
+	ctx context.Context, model string, input interface{}, params map[string]interface{},
+) (interface{}, error) {
+	return withFallback(ctx, m, model, func(model string, provider providers.Provider) (interface{}, error) {
+		if err := checkSupported(ctx, provider, "embeddings", params); err != nil {
+			return nil, err
+		}
+		embedder, err := providers.AsEmbedder(provider)
+		if err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		result, err := embedder.Embeddings(ctx, model, input, params)
+		m.logRequest(provider, model, "embeddings", params, result, start, err)
+		return result, err
+	})
 }
@@ -1,8 +1,12 @@
 package multiplexer
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -10,12 +14,16 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/monitoring"
 	"github.com/modelplex/modelplex/internal/providers"
+	"github.com/modelplex/modelplex/pkg/provider"
 )
 
-// MockProvider implements the Provider interface for testing
+// MockProvider implements the Provider interface for testing. It supports every operation
+// unless capabilities is set.
 type MockProvider struct {
 	mock.Mock
+	capabilities *provider.Capabilities
 }
 
 func (m *MockProvider) Name() string {
@@ -28,21 +36,46 @@ func (m *MockProvider) Priority() int {
 	return args.Int(0)
 }
 
-func (m *MockProvider) ChatCompletion(ctx context.Context, model string, messages []map[string]interface{}) (interface{}, error) {
-	args := m.Called(ctx, model, messages)
+func (m *MockProvider) ChatCompletion(
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+) (interface{}, error) {
+	args := m.Called(ctx, model, messages, params)
 	return args.Get(0), args.Error(1)
 }
 
-func (m *MockProvider) Completion(ctx context.Context, model, prompt string) (interface{}, error) {
-	args := m.Called(ctx, model, prompt)
+func (m *MockProvider) Completion(ctx context.Context, model, prompt string, params map[string]interface{}) (interface{}, error) {
+	args := m.Called(ctx, model, prompt, params)
 	return args.Get(0), args.Error(1)
 }
 
+func (m *MockProvider) ChatCompletionStream(
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+) (<-chan providers.StreamChunk, error) {
+	args := m.Called(ctx, model, messages, params)
+	return args.Get(0).(<-chan providers.StreamChunk), args.Error(1)
+}
+
+func (m *MockProvider) CompletionStream(
+	ctx context.Context, model, prompt string, params map[string]interface{},
+) (<-chan providers.StreamChunk, error) {
+	args := m.Called(ctx, model, prompt, params)
+	return args.Get(0).(<-chan providers.StreamChunk), args.Error(1)
+}
+
 func (m *MockProvider) ListModels() []string {
 	args := m.Called()
 	return args.Get(0).([]string)
 }
 
+func (m *MockProvider) Capabilities() provider.Capabilities {
+	if m.capabilities != nil {
+		return *m.capabilities
+	}
+	return provider.Capabilities{
+		Chat: true, Completion: true, Embeddings: true, Streaming: true, Tools: true, Vision: true,
+	}
+}
+
 func TestNew(t *testing.T) {
 	configs := []config.Provider{
 		{
@@ -83,11 +116,12 @@ func TestModelMultiplexer_GetProvider(t *testing.T) {
 	// Create multiplexer with manual setup (since we can't easily mock provider creation)
 	mux := &ModelMultiplexer{
 		providers: []providers.Provider{provider1, provider2},
-		modelMap: map[string]providers.Provider{
-			"model1": provider1,
-			"model2": provider1,
-			"model3": provider2,
+		modelMap: map[string][]providers.Provider{
+			"model1": {provider1},
+			"model2": {provider1},
+			"model3": {provider2},
 		},
+		defaultProvider: provider2,
 	}
 
 	tests := []struct {
@@ -107,9 +141,9 @@ func TestModelMultiplexer_GetProvider(t *testing.T) {
 			expectedName: "provider2",
 		},
 		{
-			name:         "non-existing model falls back to first provider",
+			name:         "non-existing model falls back to the default provider",
 			model:        "unknown-model",
-			expectedName: "provider1",
+			expectedName: "provider2",
 		},
 	}
 
@@ -129,21 +163,125 @@ func TestModelMultiplexer_GetProvider(t *testing.T) {
 	}
 }
 
+func TestModelMultiplexer_GetProvidersForModel(t *testing.T) {
+	mux := New([]config.Provider{
+		{Name: "backup", Type: "openai", Models: []string{"gpt-4"}, Priority: 2},
+		{Name: "primary", Type: "openai", Models: []string{"gpt-4", "gpt-4o"}, Priority: 1},
+		{Name: "secondary", Type: "openai", Models: []string{"gpt-4"}, Priority: 1},
+	})
+
+	names := func(candidates []providers.Provider) []string {
+		result := make([]string, 0, len(candidates))
+		for _, provider := range candidates {
+			result = append(result, provider.Name())
+		}
+		return result
+	}
+
+	// Lowest priority first, ties in config order
+	assert.Equal(t, []string{"primary", "secondary", "backup"}, names(mux.GetProvidersForModel("gpt-4")))
+	assert.Equal(t, []string{"primary"}, names(mux.GetProvidersForModel("gpt-4o")))
+
+	// Unknown models aren't routed without a default provider
+	assert.Empty(t, mux.GetProvidersForModel("unknown-model"))
+	_, err := mux.GetProvider("unknown-model")
+	assert.ErrorIs(t, err, ErrModelNotFound)
+
+	mux.SetDefaultProvider("backup")
+	assert.Equal(t, []string{"backup"}, names(mux.GetProvidersForModel("unknown-model")))
+	assert.Equal(t, []string{"primary", "secondary", "backup"}, names(mux.GetProvidersForModel("gpt-4")))
+
+	mux.SetDefaultProvider("")
+	assert.Empty(t, mux.GetProvidersForModel("unknown-model"))
+
+	provider, err := mux.GetProvider("gpt-4")
+	require.NoError(t, err)
+	assert.Equal(t, "primary", provider.Name())
+
+	assert.Empty(t, New(nil).GetProvidersForModel("gpt-4"))
+}
+
+func TestModelMultiplexer_NoProviderPolicy(t *testing.T) {
+	newMux := func(policy string) *ModelMultiplexer {
+		mux := New([]config.Provider{
+			{Name: "backup", Type: "openai", Models: []string{"gpt-4"}, Priority: 2},
+			{Name: "primary", Type: "openai", Models: []string{"gpt-4o"}, Priority: 1},
+		})
+		mux.SetDefaultProvider("backup")
+		mux.SetNoProviderPolicy(policy)
+		return mux
+	}
+
+	tests := []struct {
+		policy string
+		want   string
+	}{
+		{config.NoProviderFallbackDefault, "backup"},
+		{config.NoProviderFallbackFirst, "primary"},
+		{config.NoProviderError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			mux := newMux(tt.policy)
+			provider, err := mux.GetProvider("unknown-model")
+			if tt.want == "" {
+				assert.ErrorIs(t, err, ErrModelNotFound)
+				assert.Empty(t, mux.GetProvidersForModel("unknown-model"))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, provider.Name())
+
+			// Models providers serve are routed as usual
+			provider, err = mux.GetProvider("gpt-4")
+			require.NoError(t, err)
+			assert.Equal(t, "backup", provider.Name())
+		})
+	}
+
+	// Without providers there's nothing to fall back to
+	mux := New(nil)
+	mux.SetNoProviderPolicy(config.NoProviderFallbackFirst)
+	_, err := mux.GetProvider("unknown-model")
+	assert.ErrorIs(t, err, ErrModelNotFound)
+}
+
+func TestModelMultiplexer_ModelPriority(t *testing.T) {
+	mux := New([]config.Provider{
+		{
+			Name: "openai", Type: "openai", Models: []string{"gpt-4", "text-embedding-3-small"}, Priority: 1,
+			ModelPriority: []config.ModelPriority{{Model: "text-embedding-3-small", Priority: 5}},
+		},
+		{Name: "cheap", Type: "openai", Models: []string{"gpt-4", "text-embedding-3-small"}, Priority: 2},
+	})
+
+	names := func(model string) []string {
+		var result []string
+		for _, provider := range mux.GetProvidersForModel(model) {
+			result = append(result, provider.Name())
+		}
+		return result
+	}
+
+	// The override only applies to its model
+	assert.Equal(t, []string{"openai", "cheap"}, names("gpt-4"))
+	assert.Equal(t, []string{"cheap", "openai"}, names("text-embedding-3-small"))
+}
+
 func TestModelMultiplexer_GetProvider_NoProviders(t *testing.T) {
 	mux := &ModelMultiplexer{
 		providers: []providers.Provider{},
-		modelMap:  map[string]providers.Provider{},
+		modelMap:  map[string][]providers.Provider{},
 	}
 
 	provider, err := mux.GetProvider("any-model")
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, ErrModelNotFound)
 	assert.Nil(t, provider)
-	assert.Contains(t, err.Error(), "no provider available")
 }
 
 func TestModelMultiplexer_ListModels(t *testing.T) {
 	mux := &ModelMultiplexer{
-		modelMap: map[string]providers.Provider{
+		modelMap: map[string][]providers.Provider{
 			"gpt-4":           nil,
 			"gpt-3.5-turbo":   nil,
 			"claude-3-sonnet": nil,
@@ -171,16 +309,16 @@ func TestModelMultiplexer_ChatCompletion(t *testing.T) {
 		},
 	}
 
-	provider.On("ChatCompletion", mock.Anything, "gpt-4", messages).Return(expectedResponse, nil)
+	provider.On("ChatCompletion", mock.Anything, "gpt-4", messages, mock.Anything).Return(expectedResponse, nil)
 
 	mux := &ModelMultiplexer{
 		providers: []providers.Provider{provider},
-		modelMap: map[string]providers.Provider{
-			"gpt-4": provider,
+		modelMap: map[string][]providers.Provider{
+			"gpt-4": {provider},
 		},
 	}
 
-	result, err := mux.ChatCompletion(context.Background(), "gpt-4", messages)
+	result, err := mux.ChatCompletion(context.Background(), "gpt-4", messages, nil)
 	require.NoError(t, err)
 	assert.Equal(t, expectedResponse, result)
 
@@ -195,16 +333,16 @@ func TestModelMultiplexer_ChatCompletion_Error(t *testing.T) {
 	}
 
 	expectedError := errors.New("provider error")
-	provider.On("ChatCompletion", mock.Anything, "gpt-4", messages).Return(nil, expectedError)
+	provider.On("ChatCompletion", mock.Anything, "gpt-4", messages, mock.Anything).Return(nil, expectedError)
 
 	mux := &ModelMultiplexer{
 		providers: []providers.Provider{provider},
-		modelMap: map[string]providers.Provider{
-			"gpt-4": provider,
+		modelMap: map[string][]providers.Provider{
+			"gpt-4": {provider},
 		},
 	}
 
-	result, err := mux.ChatCompletion(context.Background(), "gpt-4", messages)
+	result, err := mux.ChatCompletion(context.Background(), "gpt-4", messages, nil)
 	assert.Error(t, err)
 	assert.Nil(t, result)
 	assert.Equal(t, expectedError, err)
@@ -223,16 +361,16 @@ func TestModelMultiplexer_Completion(t *testing.T) {
 		},
 	}
 
-	provider.On("Completion", mock.Anything, "gpt-3.5-turbo-instruct", prompt).Return(expectedResponse, nil)
+	provider.On("Completion", mock.Anything, "gpt-3.5-turbo-instruct", prompt, mock.Anything).Return(expectedResponse, nil)
 
 	mux := &ModelMultiplexer{
 		providers: []providers.Provider{provider},
-		modelMap: map[string]providers.Provider{
-			"gpt-3.5-turbo-instruct": provider,
+		modelMap: map[string][]providers.Provider{
+			"gpt-3.5-turbo-instruct": {provider},
 		},
 	}
 
-	result, err := mux.Completion(context.Background(), "gpt-3.5-turbo-instruct", prompt)
+	result, err := mux.Completion(context.Background(), "gpt-3.5-turbo-instruct", prompt, nil)
 	require.NoError(t, err)
 	assert.Equal(t, expectedResponse, result)
 
@@ -242,11 +380,295 @@ func TestModelMultiplexer_Completion(t *testing.T) {
 func TestModelMultiplexer_ModelNotFound(t *testing.T) {
 	mux := &ModelMultiplexer{
 		providers: []providers.Provider{},
-		modelMap:  map[string]providers.Provider{},
+		modelMap:  map[string][]providers.Provider{},
 	}
 
-	result, err := mux.ChatCompletion(context.Background(), "nonexistent-model", nil)
-	assert.Error(t, err)
+	result, err := mux.ChatCompletion(context.Background(), "nonexistent-model", nil, nil)
+	assert.ErrorIs(t, err, ErrModelNotFound)
 	assert.Nil(t, result)
-	assert.Contains(t, err.Error(), "no provider available")
+	assert.Contains(t, err.Error(), "nonexistent-model")
+}
+
+// MockDiscoveryProvider is a MockProvider that also supports model discovery
+type MockDiscoveryProvider struct {
+	MockProvider
+}
+
+func (m *MockDiscoveryProvider) DiscoverModels(ctx context.Context) ([]string, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func TestModelMultiplexer_DiscoverModels(t *testing.T) {
+	static := &MockProvider{}
+	static.On("Name").Return("static")
+	static.On("Priority").Return(1)
+
+	discovering := &MockDiscoveryProvider{}
+	discovering.On("Name").Return("groq")
+	discovering.On("Priority").Return(1)
+	discovering.On("DiscoverModels", mock.Anything).Return([]string{"model1", "llama-3.1-8b-instant"}, nil)
+
+	failing := &MockDiscoveryProvider{}
+	failing.On("Name").Return("failing")
+	failing.On("DiscoverModels", mock.Anything).Return(nil, errors.New("unreachable"))
+
+	mux := &ModelMultiplexer{
+		providers: []providers.Provider{static, discovering, failing},
+		modelMap: map[string][]providers.Provider{
+			"model1": {static},
+		},
+	}
+
+	count := mux.DiscoverModels(context.Background())
+	assert.Equal(t, 2, count)
+
+	// Already-routed models keep their provider ahead of one with the same priority
+	provider, err := mux.GetProvider("model1")
+	require.NoError(t, err)
+	assert.Equal(t, "static", provider.Name())
+	assert.Equal(t, []providers.Provider{static, discovering}, mux.GetProvidersForModel("model1"))
+
+	provider, err = mux.GetProvider("llama-3.1-8b-instant")
+	require.NoError(t, err)
+	assert.Equal(t, "groq", provider.Name())
+
+	discovering.AssertExpectations(t)
+	failing.AssertExpectations(t)
+}
+
+func TestModelMultiplexer_DiscoverModels_Collision(t *testing.T) {
+	// Two providers of equal priority, both discovering models, in config order
+	first := &MockDiscoveryProvider{}
+	first.On("Name").Return("first")
+	first.On("Priority").Return(1)
+	second := &MockDiscoveryProvider{}
+	second.On("Name").Return("second")
+	second.On("Priority").Return(1)
+	mux := &ModelMultiplexer{
+		providers: []providers.Provider{first, second},
+		modelMap:  map[string][]providers.Provider{},
+		targets:   []*probeTarget{{provider: first}, {provider: second}},
+	}
+
+	var buf bytes.Buffer
+	oldLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer slog.SetDefault(oldLogger)
+
+	first.On("DiscoverModels", mock.Anything).Return([]string{}, nil).Once()
+	second.On("DiscoverModels", mock.Anything).Return([]string{"llama3"}, nil).Once()
+	mux.DiscoverModels(context.Background())
+	assert.Equal(t, []providers.Provider{second}, mux.GetProvidersForModel("llama3"))
+
+	// Once the first provider reports llama3 too, it takes precedence as it would have at startup,
+	// although the second provider discovered it first
+	first.On("DiscoverModels", mock.Anything).Return([]string{"llama3"}, nil)
+	second.On("DiscoverModels", mock.Anything).Return([]string{"llama3"}, nil)
+	mux.DiscoverModels(context.Background())
+	assert.Equal(t, []providers.Provider{first, second}, mux.GetProvidersForModel("llama3"))
+	assert.Contains(t, buf.String(), `msg="Model routed to another provider" model=llama3 provider=first previous=second`)
+}
+
+func TestModelMultiplexer_ModelsVersion(t *testing.T) {
+	static := &MockProvider{}
+	static.On("Name").Return("static")
+	static.On("Priority").Return(1)
+
+	discovering := &MockDiscoveryProvider{}
+	discovering.On("Name").Return("groq")
+	discovering.On("Priority").Return(1)
+
+	mux := &ModelMultiplexer{
+		providers: []providers.Provider{static, discovering},
+		modelMap:  map[string][]providers.Provider{"model1": {static}},
+		targets:   []*probeTarget{{provider: discovering}},
+	}
+	version := mux.ModelsVersion()
+
+	// Another provider for a model already listed leaves the set of models unchanged
+	discovering.On("DiscoverModels", mock.Anything).Return([]string{"model1"}, nil).Once()
+	mux.DiscoverModels(context.Background())
+	assert.Equal(t, version, mux.ModelsVersion())
+
+	discovering.On("DiscoverModels", mock.Anything).Return([]string{"model1", "model2"}, nil).Once()
+	mux.DiscoverModels(context.Background())
+	assert.NotEqual(t, version, mux.ModelsVersion())
+	version = mux.ModelsVersion()
+
+	// model1 is still served by static, so only dropping model2 changes the set
+	discovering.On("DiscoverModels", mock.Anything).Return([]string{}, nil).Once()
+	mux.DiscoverModels(context.Background())
+	assert.NotEqual(t, version, mux.ModelsVersion())
+	assert.Equal(t, []string{"model1"}, mux.ListModels())
+}
+
+func TestModelMultiplexer_Offline(t *testing.T) {
+	// Network providers must not be contacted at all in offline mode
+	upstream := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request to %s", r.URL)
+	}))
+	defer upstream.Close()
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"models": [{"name": "llama3"}]}`))
+	}))
+	defer local.Close()
+
+	mux := New([]config.Provider{
+		{Name: "openai", Type: "openai", BaseURL: upstream.URL, Models: []string{"gpt-4", "llama3"}, Priority: 1},
+		{Name: "groq", Type: "groq", BaseURL: upstream.URL, Priority: 1},
+		{Name: "local", Type: "ollama", BaseURL: local.URL, Models: []string{"llama3"}, Priority: 2},
+	})
+	mux.SetDefaultProvider("openai")
+	mux.SetOffline(true)
+
+	_, err := mux.GetProvider("gpt-4")
+	assert.ErrorIs(t, err, ErrOffline)
+	_, err = mux.GetProvider("unknown-model")
+	assert.ErrorIs(t, err, ErrOffline)
+
+	// Models also served by a local provider go to it, even with a lower priority
+	provider, err := mux.GetProvider("llama3")
+	require.NoError(t, err)
+	assert.Equal(t, "local", provider.Name())
+	assert.Len(t, mux.GetProvidersForModel("llama3"), 1)
+
+	mux.DiscoverModels(context.Background())
+	mux.ProbeProviders(context.Background(), ProbeOptions{})
+
+	statuses := map[string]string{}
+	for _, status := range mux.Status() {
+		statuses[status.Name] = status.Status
+	}
+	assert.Equal(t, StatusOffline, statuses["openai"])
+	assert.Equal(t, StatusOffline, statuses["groq"])
+	assert.Equal(t, StatusOK, statuses["local"])
+}
+
+func TestModelMultiplexer_Stream(t *testing.T) {
+	streaming := &MockProvider{}
+	chunks := make(<-chan providers.StreamChunk)
+	streaming.On("ChatCompletionStream", mock.Anything, "gpt-4", mock.Anything, mock.Anything).Return(chunks, nil)
+	streaming.On("CompletionStream", mock.Anything, "gpt-4", "Hello", mock.Anything).Return(chunks, nil)
+
+	mux := &ModelMultiplexer{
+		providers: []providers.Provider{streaming},
+		modelMap: map[string][]providers.Provider{
+			"gpt-4": {streaming},
+		},
+	}
+
+	result, err := mux.ChatCompletionStream(context.Background(), "gpt-4", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, chunks, result)
+
+	result, err = mux.CompletionStream(context.Background(), "gpt-4", "Hello", nil)
+	require.NoError(t, err)
+	assert.Equal(t, chunks, result)
+
+	streaming.AssertExpectations(t)
+}
+
+func TestModelMultiplexer_NonObjectResponses(t *testing.T) {
+	provider := &MockProvider{}
+	provider.On("Name").Return("gateway")
+
+	mux := &ModelMultiplexer{
+		providers: []providers.Provider{provider},
+		modelMap:  map[string][]providers.Provider{"gpt-4": {provider}},
+		metrics:   monitoring.NewMetrics(),
+	}
+
+	for _, response := range []interface{}{
+		[]interface{}{map[string]interface{}{"usage": "none"}},
+		"just a string",
+		nil,
+		map[string]interface{}{"usage": []interface{}{1, 2}},
+	} {
+		provider.On("Completion", mock.Anything, "gpt-4", "Hello", mock.Anything).Return(response, nil).Once()
+
+		result, err := mux.Completion(context.Background(), "gpt-4", "Hello", nil)
+		require.NoError(t, err)
+		assert.Equal(t, response, result)
+	}
+	assert.Empty(t, mux.Metrics().Snapshot())
+}
+
+func TestModelMultiplexer_RecordsCacheUsage(t *testing.T) {
+	provider := &MockProvider{}
+	provider.On("Name").Return("anthropic")
+
+	response := map[string]interface{}{
+		"id": "msg_123",
+		"usage": map[string]interface{}{
+			"input_tokens":                float64(10),
+			"cache_read_input_tokens":     float64(2048),
+			"cache_creation_input_tokens": float64(12),
+		},
+	}
+	provider.On("ChatCompletion", mock.Anything, "claude-3-sonnet", mock.Anything, mock.Anything).Return(response, nil)
+
+	mux := &ModelMultiplexer{
+		providers: []providers.Provider{provider},
+		modelMap: map[string][]providers.Provider{
+			"claude-3-sonnet": {provider},
+		},
+		metrics: monitoring.NewMetrics(),
+	}
+
+	_, err := mux.ChatCompletion(context.Background(), "claude-3-sonnet", nil, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]monitoring.ProviderMetrics{
+		"anthropic": {CacheReadTokens: 2048, CacheCreationTokens: 12},
+	}, mux.Metrics().Snapshot())
+}
+
+func TestModelMultiplexer_ReportsUsage(t *testing.T) {
+	provider := &MockProvider{}
+	provider.On("Name").Return("openai")
+	response := map[string]interface{}{
+		"usage": map[string]interface{}{
+			"prompt_tokens": float64(1000), "completion_tokens": float64(500), "total_tokens": float64(1500),
+		},
+	}
+	provider.On("ChatCompletion", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(response, nil)
+	provider.On("Completion", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(response, nil)
+
+	mux := &ModelMultiplexer{
+		providers: []providers.Provider{provider},
+		modelMap: map[string][]providers.Provider{
+			"gpt-4o": {provider},
+			"gpt-4":  {provider},
+		},
+	}
+	mux.SetModels([]config.Model{{Name: "gpt-4o", InputCost: 2.5, OutputCost: 10}})
+
+	ctx, collector := monitoring.WithUsageCollector(context.Background())
+	_, err := mux.ChatCompletion(ctx, "gpt-4o", nil, nil)
+	require.NoError(t, err)
+
+	usage, ok := collector.Usage()
+	require.True(t, ok)
+	assert.Equal(t, "openai", usage.Provider)
+	assert.Equal(t, "gpt-4o", usage.Model)
+	assert.Equal(t, int64(1000), usage.PromptTokens)
+	assert.Equal(t, int64(500), usage.CompletionTokens)
+	assert.Equal(t, int64(1500), usage.TotalTokens)
+	require.NotNil(t, usage.EstimatedCost)
+	assert.InDelta(t, 0.0075, *usage.EstimatedCost, 1e-9)
+
+	// Without configured costs, the cost isn't estimated
+	ctx, collector = monitoring.WithUsageCollector(context.Background())
+	_, err = mux.Completion(ctx, "gpt-4", "Hello", nil)
+	require.NoError(t, err)
+
+	usage, ok = collector.Usage()
+	require.True(t, ok)
+	assert.Equal(t, "gpt-4", usage.Model)
+	assert.Nil(t, usage.EstimatedCost)
 }
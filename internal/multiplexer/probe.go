@@ -0,0 +1,146 @@
+package multiplexer
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/providers"
+)
+
+const (
+	// Provider probe states reported by Status
+	StatusPending  = "pending"
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	// StatusOffline marks providers that aren't used in offline mode
+	StatusOffline = "offline"
+
+	probeTimeout = 5 * time.Second
+)
+
+// ProviderStatus reports whether a provider's upstream has been reachable.
+type ProviderStatus struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+	// LastRefresh is when the provider's models were last discovered, if it supports discovery
+	LastRefresh *time.Time `json:"last_refresh,omitempty"`
+}
+
+// ProbeOptions configures ProbeProviders.
+type ProbeOptions struct {
+	// Retries is how many times an unreachable provider is re-probed, Interval apart,
+	// before it is marked degraded.
+	Retries  int
+	Interval time.Duration
+	// RetryInterval is how often degraded providers are re-probed afterwards.
+	RetryInterval time.Duration
+}
+
+// probeTarget tracks the probe status of one provider.
+type probeTarget struct {
+	provider providers.Provider
+	config   config.Provider
+	// refreshInterval is how often RefreshModels rediscovers the provider's models, or 0 for never
+	refreshInterval time.Duration
+	// modelPriority overrides the provider's priority for routing particular models
+	modelPriority map[string]int
+	// probe checks the provider's upstream is reachable; without one, it's assumed to be
+	probe func(ctx context.Context) error
+
+	mu     sync.Mutex
+	status ProviderStatus
+}
+
+func (t *probeTarget) snapshot() ProviderStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.status
+}
+
+// Status returns the probe status of every provider in priority order.
+// Providers are "pending" until their first probe succeeds or their startup retries run out.
+func (m *ModelMultiplexer) Status() []ProviderStatus {
+	statuses := make([]ProviderStatus, 0, len(m.targets))
+	for _, target := range m.targets {
+		statuses = append(statuses, target.snapshot())
+	}
+	return statuses
+}
+
+// ProbeProviders probes every provider's upstream concurrently, blocking until all of them
+// have responded or ctx is done. A provider that doesn't respond within its startup retries
+// is marked degraded and re-probed every RetryInterval; when it recovers, its models are
+// rediscovered, since discovery at startup will have failed too.
+func (m *ModelMultiplexer) ProbeProviders(ctx context.Context, opts ProbeOptions) {
+	var wg sync.WaitGroup
+	for _, target := range m.targets {
+		if !m.isAllowed(target.provider) {
+			continue
+		}
+		wg.Add(1)
+		go func(target *probeTarget) {
+			defer wg.Done()
+			m.probeUntilUp(ctx, target, opts)
+		}(target)
+	}
+	wg.Wait()
+}
+
+func (m *ModelMultiplexer) probeUntilUp(ctx context.Context, target *probeTarget, opts ProbeOptions) {
+	for attempt := 1; ; attempt++ {
+		err := m.probeOnce(ctx, target)
+
+		target.mu.Lock()
+		target.status.Attempts = attempt
+		previous := target.status.Status
+		if err == nil {
+			target.status.Status = StatusOK
+			target.status.Error = ""
+		} else {
+			target.status.Error = err.Error()
+			if attempt > opts.Retries {
+				target.status.Status = StatusDegraded
+			}
+		}
+		current := target.status.Status
+		target.mu.Unlock()
+
+		name := target.provider.Name()
+		switch {
+		case err == nil && previous == StatusDegraded:
+			slog.Info("Provider recovered", "provider", name, "attempts", attempt)
+			m.discoverProvider(ctx, target.provider)
+			return
+		case err == nil:
+			return
+		case current == StatusDegraded && previous != StatusDegraded:
+			slog.Warn("Provider unreachable, marking degraded", "provider", name, "attempts", attempt, "error", err)
+		default:
+			slog.Debug("Provider probe failed", "provider", name, "attempt", attempt, "error", err)
+		}
+
+		interval := opts.Interval
+		if current == StatusDegraded {
+			interval = opts.RetryInterval
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (m *ModelMultiplexer) probeOnce(ctx context.Context, target *probeTarget) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	if target.probe == nil {
+		return nil
+	}
+	return target.probe(ctx)
+}
@@ -0,0 +1,103 @@
+package multiplexer
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/providers"
+)
+
+func TestModelMultiplexer_ProbeProviders(t *testing.T) {
+	up := &MockProvider{}
+	up.On("Name").Return("up")
+
+	late := &MockDiscoveryProvider{}
+	late.On("Name").Return("late")
+	late.On("DiscoverModels", mock.Anything).Return([]string{"llama2"}, nil)
+
+	var lateAttempts atomic.Int32
+	mux := &ModelMultiplexer{
+		providers: []providers.Provider{up, late},
+		modelMap:  map[string][]providers.Provider{},
+		targets: []*probeTarget{
+			{provider: up, status: ProviderStatus{Name: "up", Status: StatusPending}},
+			{provider: late, status: ProviderStatus{Name: "late", Status: StatusPending}, probe: func(context.Context) error {
+				// "late" comes up on its fourth attempt, after its startup retries run out
+				if lateAttempts.Add(1) < 4 {
+					return errors.New("connection refused")
+				}
+				return nil
+			}},
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		mux.ProbeProviders(context.Background(), ProbeOptions{
+			Retries:       1,
+			Interval:      time.Millisecond,
+			RetryInterval: 50 * time.Millisecond,
+		})
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		return mux.Status()[1].Status == StatusDegraded
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, ProviderStatus{Name: "up", Status: StatusOK, Attempts: 1}, mux.Status()[0])
+	assert.Equal(t, "connection refused", mux.Status()[1].Error)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("ProbeProviders did not return after the degraded provider recovered")
+	}
+	status := mux.Status()[1]
+	require.NotNil(t, status.LastRefresh)
+	status.LastRefresh = nil
+	assert.Equal(t, ProviderStatus{Name: "late", Status: StatusOK, Attempts: 4}, status)
+
+	// The recovered provider's models were rediscovered
+	provider, err := mux.GetProvider("llama2")
+	require.NoError(t, err)
+	assert.Equal(t, "late", provider.Name())
+}
+
+func TestModelMultiplexer_ProbeProviders_Canceled(t *testing.T) {
+	down := &MockProvider{}
+	down.On("Name").Return("down")
+
+	mux := &ModelMultiplexer{
+		providers: []providers.Provider{down},
+		targets: []*probeTarget{{provider: down, status: ProviderStatus{Name: "down", Status: StatusPending},
+			probe: func(context.Context) error {
+				return errors.New("no route to host")
+			}}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		mux.ProbeProviders(ctx, ProbeOptions{Retries: 3, Interval: time.Hour, RetryInterval: time.Hour})
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		return mux.Status()[0].Attempts == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, StatusPending, mux.Status()[0].Status)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("ProbeProviders did not return after cancellation")
+	}
+}
@@ -0,0 +1,78 @@
+package multiplexer
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/modelplex/modelplex/internal/providers"
+)
+
+const (
+	// Each wait between refreshes is lengthened at random by up to 1/refreshJitter of the interval
+	refreshJitter  = 10
+	refreshTimeout = 30 * time.Second
+)
+
+// refreshEntry schedules the next model refresh of one provider.
+type refreshEntry struct {
+	target   *probeTarget
+	interval time.Duration
+	due      time.Time
+}
+
+// RefreshModels rediscovers models from every provider with a refresh_interval, blocking until
+// ctx is done. A single goroutine refreshes providers one at a time as they come due, and each
+// wait is lengthened by up to a tenth at random, so providers configured alike don't refresh
+// in lockstep and upstreams aren't hit all at once.
+func (m *ModelMultiplexer) RefreshModels(ctx context.Context) {
+	var schedule []*refreshEntry
+	for _, target := range m.targets {
+		if _, ok := target.provider.(providers.ModelDiscoverer); !ok || target.refreshInterval <= 0 ||
+			!m.isAllowed(target.provider) {
+			continue
+		}
+		schedule = append(schedule, &refreshEntry{
+			target:   target,
+			interval: target.refreshInterval,
+			due:      time.Now().Add(jitter(target.refreshInterval)),
+		})
+	}
+	if len(schedule) == 0 {
+		return
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		next := schedule[0]
+		for _, entry := range schedule[1:] {
+			if entry.due.Before(next.due) {
+				next = entry
+			}
+		}
+
+		timer.Reset(time.Until(next.due))
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		slog.Debug("Refreshing models", "provider", next.target.provider.Name())
+		refreshCtx, cancel := context.WithTimeout(ctx, refreshTimeout)
+		m.discoverProvider(refreshCtx, next.target.provider)
+		cancel()
+		next.due = time.Now().Add(jitter(next.interval))
+	}
+}
+
+// jitter returns interval lengthened by a random amount of up to 1/refreshJitter of it.
+func jitter(interval time.Duration) time.Duration {
+	spread := interval / refreshJitter
+	if spread <= 0 {
+		return interval
+	}
+	return interval + rand.N(spread) // #nosec G404 -- jitter doesn't need a secure source
+}
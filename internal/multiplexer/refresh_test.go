@@ -0,0 +1,85 @@
+package multiplexer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/providers"
+)
+
+func TestModelMultiplexer_RefreshModels(t *testing.T) {
+	static := &MockProvider{}
+	static.On("Name").Return("static")
+
+	local := &MockDiscoveryProvider{}
+	local.On("Name").Return("ollama")
+	local.On("Priority").Return(0)
+	// The first refresh drops llama2; llama3 stays routed because it's configured
+	local.On("DiscoverModels", mock.Anything).Return([]string{"mistral"}, nil)
+
+	mux := &ModelMultiplexer{
+		providers: []providers.Provider{local, static},
+		modelMap: map[string][]providers.Provider{
+			"llama2": {local},
+			"llama3": {local},
+		},
+		targets: []*probeTarget{
+			{
+				provider:        local,
+				config:          config.Provider{Name: "ollama", Models: []string{"llama3"}},
+				refreshInterval: 10 * time.Millisecond,
+				status:          ProviderStatus{Name: "ollama", Status: StatusPending},
+			},
+			{
+				// Not a discoverer, so never refreshed despite its interval
+				provider:        static,
+				refreshInterval: time.Millisecond,
+				status:          ProviderStatus{Name: "static", Status: StatusPending},
+			},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		mux.RefreshModels(ctx)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		return mux.Status()[0].LastRefresh != nil
+	}, time.Second, time.Millisecond)
+	assert.Nil(t, mux.Status()[1].LastRefresh)
+	assert.ElementsMatch(t, []string{"llama3", "mistral"}, mux.ListModels())
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("RefreshModels did not return after cancellation")
+	}
+}
+
+func TestModelMultiplexer_RefreshModels_Nothing(t *testing.T) {
+	provider := &MockDiscoveryProvider{}
+	mux := &ModelMultiplexer{targets: []*probeTarget{{provider: provider}}}
+
+	// Returns immediately when no provider has a refresh interval
+	mux.RefreshModels(context.Background())
+	provider.AssertNotCalled(t, "DiscoverModels", mock.Anything)
+}
+
+func TestJitter(t *testing.T) {
+	for range 100 {
+		interval := jitter(time.Minute)
+		assert.GreaterOrEqual(t, interval, time.Minute)
+		assert.Less(t, interval, time.Minute+6*time.Second)
+	}
+	assert.Equal(t, time.Nanosecond, jitter(time.Nanosecond))
+}
@@ -0,0 +1,46 @@
+package multiplexer
+
+import (
+	"context"
+	"slices"
+)
+
+// Route describes how requests for a model are routed.
+type Route struct {
+	Model string `json:"model"`
+	// ResolvesTo is the model an alias is sent as, when requests don't require capabilities
+	ResolvesTo string `json:"resolves_to,omitempty"`
+	// Providers are the providers requests are sent to, in order: the first serves them and the
+	// rest are tried in turn when a request fails. Offline mode leaves out providers that need
+	// network access.
+	Providers []string `json:"providers"`
+	// Default is set when no provider serves the model and the no-provider policy routes it instead
+	Default bool `json:"default,omitempty"`
+}
+
+// Routing describes the routing of every model ListModels returns, sorted by model.
+func (m *ModelMultiplexer) Routing() []Route {
+	models := m.ListModels()
+	slices.Sort(models)
+
+	routes := make([]Route, 0, len(models))
+	for _, model := range models {
+		route := Route{Model: model, Providers: []string{}}
+		// Without required capabilities, resolving never fails
+		resolved, _ := m.resolveModel(context.Background(), model)
+		if resolved != model {
+			route.ResolvesTo = resolved
+		}
+		for _, provider := range m.GetProvidersForModel(resolved) {
+			route.Providers = append(route.Providers, provider.Name())
+		}
+
+		m.mu.RLock()
+		_, served := m.modelMap[resolved]
+		m.mu.RUnlock()
+		route.Default = !served && len(route.Providers) > 0
+
+		routes = append(routes, route)
+	}
+	return routes
+}
@@ -0,0 +1,43 @@
+package multiplexer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/modelplex/modelplex/internal/config"
+)
+
+func TestModelMultiplexer_Routing(t *testing.T) {
+	mux := New([]config.Provider{
+		{
+			Name: "openai", Type: "openai", Models: []string{"gpt-4o", "text-embedding-3-small"}, Priority: 1,
+			ModelPriority: []config.ModelPriority{{Model: "text-embedding-3-small", Priority: 5}},
+		},
+		{Name: "cheap", Type: "openai", Models: []string{"gpt-4o", "text-embedding-3-small"}, Priority: 2},
+		{Name: "ollama", Type: "ollama", Models: []string{"llama3"}, Priority: 3},
+	})
+	mux.SetModels([]config.Model{
+		{Name: "best", AliasFor: []string{"gpt-5", "gpt-4o"}},
+		{Name: "local", AliasFor: []string{"mistral"}},
+	})
+
+	routing := mux.Routing()
+	assert.Equal(t, Route{Model: "best", ResolvesTo: "gpt-4o", Providers: []string{"openai", "cheap"}}, routing[0])
+
+	// With a default provider, an alias resolves to its first model even if no provider serves it
+	mux.SetDefaultProvider("ollama")
+	assert.Equal(t, []Route{
+		{Model: "best", ResolvesTo: "gpt-5", Providers: []string{"ollama"}, Default: true},
+		{Model: "gpt-4o", Providers: []string{"openai", "cheap"}},
+		{Model: "llama3", Providers: []string{"ollama"}},
+		{Model: "local", ResolvesTo: "mistral", Providers: []string{"ollama"}, Default: true},
+		{Model: "text-embedding-3-small", Providers: []string{"cheap", "openai"}},
+	}, mux.Routing())
+
+	// Offline mode filters out providers that need network access
+	mux.SetOffline(true)
+	routing = mux.Routing()
+	assert.Equal(t, Route{Model: "gpt-4o", Providers: []string{}}, routing[1])
+	assert.Equal(t, Route{Model: "llama3", Providers: []string{"ollama"}}, routing[2])
+}
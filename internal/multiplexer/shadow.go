@@ -0,0 +1,123 @@
+package multiplexer
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/providers"
+)
+
+const (
+	// Shadow budget defaults
+	defaultShadowMaxConcurrent = 4
+	defaultShadowTimeout       = 2 * time.Minute
+)
+
+// shadow is a provider sent copies of chat completions, whose responses are compared with the
+// primary provider's. slots holds a token for each copy in flight.
+type shadow struct {
+	provider   providers.Provider
+	model      string
+	sampleRate float64
+	timeout    time.Duration
+	slots      chan struct{}
+}
+
+// SetShadow makes the provider cfg names the shadow provider, which stops serving clients and is
+// sent a copy of each chat completion that succeeds instead, within cfg's budget. An empty or
+// unknown name disables shadowing. It must be called before the multiplexer is used.
+func (m *ModelMultiplexer) SetShadow(cfg config.Shadow) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.shadow = nil
+	i := slices.IndexFunc(m.providers, func(provider providers.Provider) bool {
+		return provider.Name() == cfg.Provider
+	})
+	if cfg.Provider == "" || i < 0 {
+		return
+	}
+
+	provider := m.providers[i]
+	m.providers = slices.Delete(m.providers, i, i+1)
+	m.setModelMap(m.buildModelMap(m.servedModels()))
+
+	m.shadow = &shadow{
+		provider:   provider,
+		model:      cfg.Model,
+		sampleRate: cfg.SampleRate,
+		timeout:    cfg.Timeout.Duration,
+		slots:      make(chan struct{}, cfg.MaxConcurrent),
+	}
+	if m.shadow.sampleRate == 0 {
+		m.shadow.sampleRate = 1
+	}
+	if m.shadow.timeout == 0 {
+		m.shadow.timeout = defaultShadowTimeout
+	}
+	if cfg.MaxConcurrent == 0 {
+		m.shadow.slots = make(chan struct{}, defaultShadowMaxConcurrent)
+	}
+}
+
+// shadowChatCompletion sends a copy of a chat completion that primary answered with result, in
+// latency, to the shadow provider in the background, then logs how their responses compare and
+// counts it in the shadow provider's metrics. Requests are sampled, and not copied while the
+// shadow provider has as many copies in flight as its budget allows.
+func (m *ModelMultiplexer) shadowChatCompletion(
+	primary providers.Provider, model string, messages []map[string]interface{}, params map[string]interface{},
+	result interface{}, latency time.Duration,
+) {
+	s := m.shadow
+	if s == nil || !m.isAllowed(s.provider) {
+		return
+	}
+	if rand.Float64() >= s.sampleRate { // #nosec G404 -- sampling doesn't need a secure source
+		return
+	}
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		m.metrics.RecordShadowSkipped(s.provider.Name())
+		return
+	}
+	if s.model != "" {
+		model = s.model
+	}
+	// The proxy may still change the result once it's returned, so its text is taken now
+	want, _ := completionText(result)
+
+	go func() {
+		defer func() { <-s.slots }()
+
+		// Copies outlive the client's request, and mustn't record into its context
+		ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+		defer cancel()
+		start := time.Now()
+		shadowResult, err := s.provider.ChatCompletion(ctx, model, messages, params)
+		shadowLatency := time.Since(start)
+
+		got, ok := completionText(shadowResult)
+		matched := err == nil && ok && got == want
+		m.metrics.RecordShadow(s.provider.Name(), err != nil, matched)
+		slog.Info("Shadow comparison", "provider", primary.Name(), "shadow", s.provider.Name(), "model", model,
+			"match", matched, "latency", latency, "shadow_latency", shadowLatency, "error", err)
+	}()
+}
+
+// completionText returns the content of the first choice of a chat completion.
+func completionText(result interface{}) (string, bool) {
+	response, _ := result.(map[string]interface{})
+	choices, _ := response["choices"].([]interface{})
+	if len(choices) == 0 {
+		return "", false
+	}
+	choice, _ := choices[0].(map[string]interface{})
+	message, _ := choice["message"].(map[string]interface{})
+	content, ok := message["content"].(string)
+	return content, ok
+}
@@ -0,0 +1,95 @@
+package multiplexer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/monitoring"
+	"github.com/modelplex/modelplex/internal/providers"
+)
+
+func chatResult(content string) map[string]interface{} {
+	return map[string]interface{}{"choices": []interface{}{
+		map[string]interface{}{"message": map[string]interface{}{"role": "assistant", "content": content}},
+	}}
+}
+
+func newShadowMultiplexer(primary, shadow *MockProvider, cfg config.Shadow) *ModelMultiplexer {
+	mux := &ModelMultiplexer{
+		providers: []providers.Provider{primary, shadow},
+		modelMap: map[string][]providers.Provider{
+			"gpt-4":    {primary, shadow},
+			"gpt-next": {shadow},
+		},
+		metrics: monitoring.NewMetrics(),
+	}
+	mux.SetShadow(cfg)
+	return mux
+}
+
+func TestModelMultiplexer_Shadow(t *testing.T) {
+	primary := &MockProvider{}
+	primary.On("Name").Return("primary")
+	shadow := &MockProvider{}
+	shadow.On("Name").Return("shadow")
+	messages := []map[string]interface{}{{"role": "user", "content": "Hello"}}
+
+	mux := newShadowMultiplexer(primary, shadow, config.Shadow{Provider: "shadow", Model: "gpt-next"})
+
+	// The shadow provider no longer serves clients
+	assert.Equal(t, []string{"gpt-4"}, mux.ListModels())
+	assert.Equal(t, []providers.Provider{primary}, mux.GetProvidersForModel("gpt-4"))
+
+	primary.On("ChatCompletion", mock.Anything, "gpt-4", messages, mock.Anything).Return(chatResult("Hi!"), nil)
+	shadow.On("ChatCompletion", mock.Anything, "gpt-next", messages, mock.Anything).
+		Return(chatResult("Hi!"), nil).Once()
+	shadow.On("ChatCompletion", mock.Anything, "gpt-next", messages, mock.Anything).
+		Return(chatResult("Hello there!"), nil).Once()
+
+	for range 2 {
+		result, err := mux.ChatCompletion(context.Background(), "gpt-4", messages, nil)
+		require.NoError(t, err)
+		assert.Equal(t, chatResult("Hi!"), result, "clients get the primary's response")
+	}
+
+	require.Eventually(t, func() bool {
+		return mux.Metrics().Snapshot()["shadow"].Shadow.Requests == 2
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, monitoring.ShadowMetrics{Requests: 2, Matches: 1}, mux.Metrics().Snapshot()["shadow"].Shadow)
+	assert.Zero(t, mux.Metrics().Snapshot()["primary"].Shadow)
+	shadow.AssertExpectations(t)
+}
+
+func TestModelMultiplexer_Shadow_Budget(t *testing.T) {
+	primary := &MockProvider{}
+	primary.On("Name").Return("primary")
+	shadow := &MockProvider{}
+	shadow.On("Name").Return("shadow")
+	messages := []map[string]interface{}{{"role": "user", "content": "Hello"}}
+
+	mux := newShadowMultiplexer(primary, shadow, config.Shadow{Provider: "shadow", MaxConcurrent: 1})
+
+	// The first copy blocks until released, so the second is skipped rather than delaying the client
+	release := make(chan time.Time)
+	primary.On("ChatCompletion", mock.Anything, "gpt-4", messages, mock.Anything).Return(chatResult("Hi!"), nil)
+	shadow.On("ChatCompletion", mock.Anything, "gpt-4", messages, mock.Anything).
+		WaitUntil(release).Return(nil, assert.AnError).Once()
+
+	for range 2 {
+		_, err := mux.ChatCompletion(context.Background(), "gpt-4", messages, nil)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int64(1), mux.Metrics().Snapshot()["shadow"].Shadow.Skipped)
+
+	close(release)
+	require.Eventually(t, func() bool {
+		return mux.Metrics().Snapshot()["shadow"].Shadow.Errors == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, monitoring.ShadowMetrics{Requests: 1, Errors: 1, Skipped: 1}, mux.Metrics().Snapshot()["shadow"].Shadow)
+}
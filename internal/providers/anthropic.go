@@ -1,55 +1,90 @@
 // Package providers implements AI provider abstractions.
 // AnthropicProvider provides Anthropic Claude API integration with key differences from OpenAI:
 // - Uses "x-api-key" header instead of "Authorization: Bearer"
-// - Requires "anthropic-version" header for API versioning
+// - Requires "anthropic-version" header for API versioning (configurable via api_version)
+// - Opts into beta features with the "anthropic-beta" header (configurable via anthropic_beta)
+// - Marks the system prompt with "cache_control" when enable_prompt_caching is set
 // - Transforms OpenAI message format: system messages become separate "system" field
 // - Uses "/messages" endpoint instead of "/chat/completions"
-// - Requires explicit max_tokens parameter (defaults to 4096)
+// - Requires explicit max_tokens parameter (defaults to 4096 unless the request sets it)
+// - Returns its own response format, converted to OpenAI's when normalize_responses is set
 package providers
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/pkg/provider"
 )
 
 const (
 	// Default max tokens for Anthropic API
 	defaultMaxTokens = 4096
+	// Default "anthropic-version" header when api_version is unset
+	defaultAnthropicVersion = "2023-06-01"
 )
 
+// anthropicParams maps the OpenAI request parameters Anthropic supports onto its field names.
+// Other parameters are dropped.
+var anthropicParams = map[string]string{
+	"temperature": "temperature",
+	"top_p":       "top_p",
+	"top_k":       "top_k",
+	"max_tokens":  "max_tokens",
+}
+
 // AnthropicProvider implements the Provider interface for Anthropic Claude API.
 type AnthropicProvider struct {
-	name     string
-	baseURL  string
-	apiKey   string
-	models   []string
-	priority int
-	client   *http.Client
+	name       string
+	baseURL    string
+	auth       Authenticator
+	apiVersion string
+	beta       []string
+	caching    bool
+	normalize  bool
+	strict     bool
+	// echoUpstream names the upstream's model in normalized responses instead of the requested one
+	echoUpstream bool
+	models       []string
+	priority     int
+	client       *http.Client
+	// chunked streams request bodies instead of sending them with a Content-Length
+	chunked bool
+	// messagesPath is the path chat and text completions are sent to
+	messagesPath string
 }
 
 // NewAnthropicProvider creates a new Anthropic provider instance.
 func NewAnthropicProvider(cfg *config.Provider) *AnthropicProvider {
-	apiKey := cfg.APIKey
-	if strings.HasPrefix(apiKey, "${") && strings.HasSuffix(apiKey, "}") {
-		envVar := strings.TrimSuffix(strings.TrimPrefix(apiKey, "${"), "}")
-		apiKey = os.Getenv(envVar)
+	apiVersion := cfg.APIVersion
+	if apiVersion == "" {
+		apiVersion = defaultAnthropicVersion
 	}
 
+	// Config.Validate rejects unknown modes, which are treated as lenient here
+	strict, _ := cfg.StrictNormalization()
+	echoUpstream, _ := cfg.EchoUpstreamModel()
+
 	return &AnthropicProvider{
-		name:     cfg.Name,
-		baseURL:  cfg.BaseURL,
-		apiKey:   apiKey,
-		models:   cfg.Models,
-		priority: cfg.Priority,
-		client:   &http.Client{},
+		name:         cfg.Name,
+		baseURL:      cfg.BaseURL,
+		auth:         newAuthenticator(cfg, newAnthropicAuth),
+		apiVersion:   apiVersion,
+		beta:         cfg.AnthropicBeta,
+		caching:      cfg.EnablePromptCaching,
+		normalize:    cfg.NormalizeResponses,
+		strict:       strict,
+		echoUpstream: echoUpstream,
+		models:       cfg.Models,
+		priority:     cfg.Priority,
+		client:       newHTTPClient(cfg),
+		chunked:      cfg.ChunkedRequests,
+
+		messagesPath: endpointPath(cfg.ChatPath, "/messages"),
 	}
 }
 
@@ -63,6 +98,12 @@ func (p *AnthropicProvider) Priority() int {
 	return p.priority
 }
 
+// Capabilities reports the operations Anthropic requests are translated for. Messages are sent as
+// text, and tools aren't translated, so neither images nor tools reach the API.
+func (p *AnthropicProvider) Capabilities() provider.Capabilities {
+	return provider.Capabilities{Chat: true, Completion: true, Streaming: true}
+}
+
 // ListModels returns the list of available models for this provider.
 func (p *AnthropicProvider) ListModels() []string {
 	return p.models
@@ -70,14 +111,77 @@ func (p *AnthropicProvider) ListModels() []string {
 
 // ChatCompletion performs a chat completion request with Anthropic-specific formatting.
 func (p *AnthropicProvider) ChatCompletion(
-	ctx context.Context, model string, messages []map[string]interface{},
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
 ) (interface{}, error) {
+	return p.complete(ctx, model, messages, params, chatResponse)
+}
+
+// complete sends a "/messages" request, normalizing the response with build if configured to.
+func (p *AnthropicProvider) complete(
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+	build responseBuilder,
+) (interface{}, error) {
+	result, err := p.makeRequest(ctx, p.messagesPath, p.buildPayload(model, messages, params))
+	if err != nil || !p.normalize {
+		return result, err
+	}
+	response, err := normalizeAnthropicResponse(echoedModel(model, result, "model", p.echoUpstream), result, build)
+	if err != nil {
+		return nil, err
+	}
+	if p.strict {
+		stripNonOpenAIFields(response)
+	}
+	return response, nil
+}
+
+// normalizeAnthropicResponse converts an Anthropic message into an OpenAI-shaped response.
+// Anthropic's own usage counters, such as the prompt cache tokens, are kept alongside OpenAI's.
+func normalizeAnthropicResponse(
+	model string, result interface{}, build responseBuilder,
+) (map[string]interface{}, error) {
+	var message struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		StopReason string                 `json:"stop_reason"`
+		Usage      map[string]interface{} `json:"usage"`
+	}
+	if err := checkResponseShape(result, "content"); err != nil {
+		return nil, err
+	}
+	if err := decodeResponse(result, &message); err != nil {
+		return nil, err
+	}
+
+	var text strings.Builder
+	for _, block := range message.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+
+	input, _ := message.Usage["input_tokens"].(float64)
+	output, _ := message.Usage["output_tokens"].(float64)
+	usage := openAIUsage(int(input), int(output))
+	for key, value := range message.Usage {
+		usage[key] = value
+	}
+
+	return build(model, text.String(), anthropicFinishReason(message.StopReason), usage), nil
+}
+
+// buildPayload converts OpenAI-style messages and parameters into an Anthropic "/messages" payload.
+func (p *AnthropicProvider) buildPayload(
+	model string, messages []map[string]interface{}, params map[string]interface{},
+) map[string]interface{} {
 	anthropicMessages := make([]map[string]interface{}, 0)
 	var systemMessage string
 
 	for _, msg := range messages {
-		role := msg["role"].(string)
-		content := msg["content"].(string)
+		role, _ := msg["role"].(string)
+		content := extractText(msg["content"])
 
 		if role == "system" {
 			systemMessage = content
@@ -94,58 +198,167 @@ func (p *AnthropicProvider) ChatCompletion(
 		"messages":   anthropicMessages,
 		"max_tokens": defaultMaxTokens,
 	}
+	// OpenAI's newer max_completion_tokens means the same; max_tokens takes precedence if both are set
+	if maxTokens, ok := params["max_completion_tokens"]; ok {
+		payload["max_tokens"] = maxTokens
+	}
+	pickParams(payload, params, anthropicParams)
+	if stop, ok := stopSequences(params); ok {
+		payload["stop_sequences"] = stop
+	}
 
 	if systemMessage != "" {
-		payload["system"] = systemMessage
+		payload["system"] = p.systemPrompt(systemMessage)
 	}
 
-	return p.makeRequest(ctx, "/messages", payload)
+	return payload
+}
+
+// systemPrompt returns the "system" field for a payload. With prompt caching enabled it is
+// sent as a text block marked with "cache_control", so repeated prompts are served from cache.
+func (p *AnthropicProvider) systemPrompt(system string) interface{} {
+	if !p.caching {
+		return system
+	}
+
+	return []map[string]interface{}{
+		{
+			"type":          "text",
+			"text":          system,
+			"cache_control": map[string]interface{}{"type": "ephemeral"},
+		},
+	}
 }
 
 // Completion performs a completion request by converting to chat format.
-func (p *AnthropicProvider) Completion(ctx context.Context, model, prompt string) (interface{}, error) {
+func (p *AnthropicProvider) Completion(
+	ctx context.Context, model, prompt string, params map[string]interface{},
+) (interface{}, error) {
 	messages := []map[string]interface{}{
 		{"role": "user", "content": prompt},
 	}
-	return p.ChatCompletion(ctx, model, messages)
+	return p.complete(ctx, model, messages, params, textResponse)
 }
 
-func (p *AnthropicProvider) makeRequest(
-	ctx context.Context, endpoint string, payload interface{},
-) (interface{}, error) {
-	jsonData, err := json.Marshal(payload)
+// ChatCompletionStream performs a streaming chat completion request,
+// translating Anthropic stream events into OpenAI chat chunks.
+func (p *AnthropicProvider) ChatCompletionStream(
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+) (<-chan StreamChunk, error) {
+	return p.makeStreamRequest(ctx, model, messages, params, chatChunk)
+}
+
+// CompletionStream performs a streaming completion request by converting to chat format,
+// translating Anthropic stream events into OpenAI text completion chunks.
+func (p *AnthropicProvider) CompletionStream(
+	ctx context.Context, model, prompt string, params map[string]interface{},
+) (<-chan StreamChunk, error) {
+	messages := []map[string]interface{}{
+		{"role": "user", "content": prompt},
+	}
+	return p.makeStreamRequest(ctx, model, messages, params, textChunk)
+}
+
+func (p *AnthropicProvider) makeStreamRequest(
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+	build chunkBuilder,
+) (<-chan StreamChunk, error) {
+	payload := p.buildPayload(model, messages, params)
+	payload["stream"] = true
+
+	req, err := p.newRequest(ctx, p.messagesPath, payload)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+endpoint, bytes.NewBuffer(jsonData))
+	resp, err := startStream(p.client, req, contentTypeSSE)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", p.apiKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
+	return streamSSE(ctx, resp.Body, anthropicChunkConverter(model, build)), nil
+}
 
-	resp, err := p.client.Do(req)
-	if err != nil {
-		return nil, err
+// anthropicChunkConverter maps Anthropic stream events onto OpenAI-shaped chunks:
+// "content_block_delta" carries text, "message_delta" carries the stop reason,
+// and "message_stop" ends the stream.
+func anthropicChunkConverter(model string, build chunkBuilder) chunkConverter {
+	return func(data []byte) (interface{}, bool, error) {
+		var event struct {
+			Type  string `json:"type"`
+			Delta struct {
+				Text       string `json:"text"`
+				StopReason string `json:"stop_reason"`
+			} `json:"delta"`
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(data, &event); err != nil {
+			return nil, false, err
+		}
+
+		switch event.Type {
+		case "content_block_delta":
+			return build(model, event.Delta.Text, nil), false, nil
+		case "message_delta":
+			return build(model, "", anthropicFinishReason(event.Delta.StopReason)), false, nil
+		case "message_stop":
+			return nil, true, nil
+		case "error":
+			return nil, false, fmt.Errorf("anthropic stream error: %s", event.Error.Message)
+		default:
+			return nil, false, nil
+		}
 	}
-	defer resp.Body.Close()
+}
 
-	body, err := io.ReadAll(resp.Body)
+// anthropicFinishReason maps an Anthropic stop_reason onto the OpenAI finish_reason vocabulary.
+func anthropicFinishReason(stopReason string) string {
+	if stopReason == "max_tokens" {
+		return "length"
+	}
+	return "stop"
+}
+
+// newAnthropicAuth returns the authenticator sending the key of credentials in Anthropic's "x-api-key" header.
+func newAnthropicAuth(credentials provider.CredentialSource) Authenticator {
+	return headerAuth{name: "x-api-key", credentials: credentials}
+}
+
+func (p *AnthropicProvider) newRequest(
+	ctx context.Context, endpoint string, payload interface{},
+) (*http.Request, error) {
+	req, err := newJSONRequest(ctx, p.baseURL+endpoint, payload, p.chunked)
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	if err = p.auth.Apply(req); err != nil {
+		return nil, fmt.Errorf("%s: %w", p.name, err)
+	}
+
+	req.Header.Set("anthropic-version", p.apiVersion)
+	if len(p.beta) > 0 {
+		req.Header.Set("anthropic-beta", strings.Join(p.beta, ","))
 	}
 
-	var result interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
+	return req, nil
+}
+
+func (p *AnthropicProvider) makeRequest(
+	ctx context.Context, endpoint string, payload interface{},
+) (interface{}, error) {
+	req, err := p.newRequest(ctx, endpoint, payload)
+	if err != nil {
 		return nil, err
 	}
 
-	return result, nil
+	resp, err := doRequest(p.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return decodeJSONResponse(resp)
 }
@@ -26,7 +26,7 @@ func TestNewAnthropicProvider(t *testing.T) {
 
 	assert.Equal(t, "anthropic", provider.Name())
 	assert.Equal(t, "https://api.anthropic.com/v1", provider.baseURL)
-	assert.Equal(t, "sk-ant-test123", provider.apiKey)
+	assert.EqualValues(t, "sk-ant-test123", provider.auth.(headerAuth).credentials)
 	assert.Equal(t, []string{"claude-3-sonnet", "claude-3-haiku"}, provider.ListModels())
 	assert.Equal(t, 1, provider.Priority())
 }
@@ -36,8 +36,10 @@ func TestAnthropicProvider_ChatCompletion(t *testing.T) {
 		assert.Equal(t, "POST", r.Method)
 		assert.Equal(t, "/messages", r.URL.Path)
 		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "application/json", r.Header.Get("Accept"))
 		assert.Equal(t, "test-key", r.Header.Get("x-api-key"))
 		assert.Equal(t, "2023-06-01", r.Header.Get("anthropic-version"))
+		assert.Empty(t, r.Header.Get("anthropic-beta"))
 
 		var req map[string]interface{}
 		err := json.NewDecoder(r.Body).Decode(&req)
@@ -82,7 +84,7 @@ func TestAnthropicProvider_ChatCompletion(t *testing.T) {
 		{"role": "user", "content": "Hello"},
 	}
 
-	result, err := provider.ChatCompletion(context.Background(), "claude-3-sonnet", messages)
+	result, err := provider.ChatCompletion(context.Background(), "claude-3-sonnet", messages, nil)
 	require.NoError(t, err)
 	require.NotNil(t, result)
 
@@ -135,7 +137,7 @@ func TestAnthropicProvider_ChatCompletion_WithSystem(t *testing.T) {
 		{"role": "user", "content": "Hello"},
 	}
 
-	result, err := provider.ChatCompletion(context.Background(), "claude-3-sonnet", messages)
+	result, err := provider.ChatCompletion(context.Background(), "claude-3-sonnet", messages, nil)
 	require.NoError(t, err)
 	require.NotNil(t, result)
 }
@@ -176,7 +178,269 @@ func TestAnthropicProvider_Completion(t *testing.T) {
 		Models:  []string{"claude-3-sonnet"},
 	})
 
-	result, err := provider.Completion(context.Background(), "claude-3-sonnet", "Complete this sentence")
+	result, err := provider.Completion(context.Background(), "claude-3-sonnet", "Complete this sentence", nil)
 	require.NoError(t, err)
 	require.NotNil(t, result)
 }
+
+const anthropicStreamBody = `event: message_start
+data: {"type": "message_start", "message": {"id": "msg_123", "role": "assistant"}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": "Hi"}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": " there"}}
+
+event: message_delta
+data: {"type": "message_delta", "delta": {"stop_reason": "max_tokens"}}
+
+event: message_stop
+data: {"type": "message_stop"}
+
+`
+
+func TestAnthropicProvider_ChatCompletionStream(t *testing.T) {
+	server := newStreamServer(t, "/messages", "text/event-stream", anthropicStreamBody)
+	defer server.Close()
+
+	provider := NewAnthropicProvider(&config.Provider{Name: "anthropic", BaseURL: server.URL, APIKey: "test-key"})
+
+	messages := []map[string]interface{}{
+		{"role": "user", "content": "Hello"},
+	}
+
+	chunks, err := provider.ChatCompletionStream(context.Background(), "claude-3-sonnet", messages, nil)
+	require.NoError(t, err)
+
+	collected := collectChunks(t, chunks)
+	require.Len(t, collected, 4)
+	assert.Equal(t, "Hi", chunkText(t, collected[0]))
+	assert.Equal(t, " there", chunkText(t, collected[1]))
+
+	data := collected[0].Data.(map[string]interface{})
+	assert.Equal(t, "chat.completion.chunk", data["object"])
+	assert.Equal(t, "claude-3-sonnet", data["model"])
+
+	final := collected[2].Data.(map[string]interface{})
+	choice := final["choices"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "length", choice["finish_reason"])
+
+	assert.True(t, collected[3].Done)
+}
+
+func TestAnthropicProvider_CompletionStream(t *testing.T) {
+	server := newStreamServer(t, "/messages", "text/event-stream", anthropicStreamBody)
+	defer server.Close()
+
+	provider := NewAnthropicProvider(&config.Provider{Name: "anthropic", BaseURL: server.URL, APIKey: "test-key"})
+
+	chunks, err := provider.CompletionStream(context.Background(), "claude-3-sonnet", "Hello", nil)
+	require.NoError(t, err)
+
+	collected := collectChunks(t, chunks)
+	require.Len(t, collected, 4)
+
+	data := collected[0].Data.(map[string]interface{})
+	assert.Equal(t, "text_completion", data["object"])
+	assert.Equal(t, "Hi", chunkText(t, collected[0]))
+	assert.True(t, collected[3].Done)
+}
+
+func TestAnthropicProvider_ChatCompletionStream_ErrorEvent(t *testing.T) {
+	body := `event: error
+data: {"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}
+
+`
+	server := newStreamServer(t, "/messages", "text/event-stream", body)
+	defer server.Close()
+
+	provider := NewAnthropicProvider(&config.Provider{Name: "anthropic", BaseURL: server.URL})
+
+	chunks, err := provider.ChatCompletionStream(context.Background(), "claude-3-sonnet", nil, nil)
+	require.NoError(t, err)
+
+	collected := collectChunks(t, chunks)
+	require.Len(t, collected, 1)
+	require.Error(t, collected[0].Err)
+	assert.Contains(t, collected[0].Err.Error(), "Overloaded")
+}
+
+func TestAnthropicProvider_ChatCompletion_Params(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		assert.Equal(t, 0.2, req["temperature"])
+		assert.Equal(t, 0.9, req["top_p"])
+		assert.NotContains(t, req, "presence_penalty", "unsupported params are dropped")
+
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write([]byte(`{"id": "msg_123"}`)); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewAnthropicProvider(&config.Provider{Name: "anthropic", BaseURL: server.URL})
+
+	params := map[string]interface{}{
+		"temperature":      0.2,
+		"top_p":            0.9,
+		"presence_penalty": 0.5,
+	}
+	messages := []map[string]interface{}{
+		{"role": "user", "content": "Hello"},
+	}
+	_, err := provider.ChatCompletion(context.Background(), "claude-3-sonnet", messages, params)
+	require.NoError(t, err)
+}
+
+func TestAnthropicProvider_ChatCompletion_MaxTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		params map[string]interface{}
+		want   float64
+	}{
+		{"default", nil, defaultMaxTokens},
+		{"larger than the default", map[string]interface{}{"max_tokens": float64(8192)}, 8192},
+		{"smaller than the default", map[string]interface{}{"max_tokens": float64(256)}, 256},
+		{"max_completion_tokens", map[string]interface{}{"max_completion_tokens": float64(8192)}, 8192},
+		{"both", map[string]interface{}{"max_tokens": float64(1024), "max_completion_tokens": float64(8192)}, 1024},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req map[string]interface{}
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+				assert.Equal(t, tt.want, req["max_tokens"])
+				assert.NotContains(t, req, "max_completion_tokens")
+
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"id": "msg_123"}`))
+			}))
+			defer server.Close()
+
+			provider := NewAnthropicProvider(&config.Provider{Name: "anthropic", BaseURL: server.URL})
+			messages := []map[string]interface{}{{"role": "user", "content": "Hello"}}
+			_, err := provider.ChatCompletion(context.Background(), "claude-3-sonnet", messages, tt.params)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestAnthropicProvider_ChatCompletion_Stop(t *testing.T) {
+	tests := []struct {
+		name string
+		stop interface{}
+		want interface{}
+	}{
+		{"string", "\n\nHuman:", []interface{}{"\n\nHuman:"}},
+		{"list", []interface{}{"END", "STOP"}, []interface{}{"END", "STOP"}},
+		{"empty list", []interface{}{}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req map[string]interface{}
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+				assert.Equal(t, tt.want, req["stop_sequences"])
+				assert.NotContains(t, req, "stop")
+
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"id": "msg_123"}`))
+			}))
+			defer server.Close()
+
+			provider := NewAnthropicProvider(&config.Provider{Name: "anthropic", BaseURL: server.URL})
+			messages := []map[string]interface{}{{"role": "user", "content": "Hello"}}
+			params := map[string]interface{}{"stop": tt.stop}
+			_, err := provider.ChatCompletion(context.Background(), "claude-3-sonnet", messages, params)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestAnthropicProvider_PathOverrides(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"type": "message"}`))
+	}))
+	defer server.Close()
+
+	provider := NewAnthropicProvider(&config.Provider{Name: "anthropic", BaseURL: server.URL, ChatPath: "/anthropic/v1/messages"})
+
+	_, err := provider.ChatCompletion(context.Background(), "claude-3-sonnet", []map[string]interface{}{{"role": "user", "content": "Hi"}}, nil)
+	require.NoError(t, err)
+	// Completions are sent as messages too
+	_, err = provider.Completion(context.Background(), "claude-3-sonnet", "Hi", nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"/anthropic/v1/messages", "/anthropic/v1/messages"}, paths)
+}
+
+func TestAnthropicProvider_VersionAndBetaHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "2024-10-22", r.Header.Get("anthropic-version"))
+		assert.Equal(t, "prompt-caching-2024-07-31,output-128k-2025-02-19", r.Header.Get("anthropic-beta"))
+
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write([]byte(`{"id": "msg_123", "type": "message"}`)); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewAnthropicProvider(&config.Provider{
+		Name:          "test",
+		BaseURL:       server.URL,
+		APIVersion:    "2024-10-22",
+		AnthropicBeta: []string{"prompt-caching-2024-07-31", "output-128k-2025-02-19"},
+	})
+
+	messages := []map[string]interface{}{
+		{"role": "user", "content": "Hello"},
+	}
+	_, err := provider.ChatCompletion(context.Background(), "claude-3-sonnet", messages, nil)
+	require.NoError(t, err)
+}
+
+func TestAnthropicProvider_BuildPayload_PromptCaching(t *testing.T) {
+	messages := []map[string]interface{}{
+		{"role": "system", "content": "You are a helpful assistant"},
+		{"role": "user", "content": "Hello"},
+	}
+
+	provider := NewAnthropicProvider(&config.Provider{Name: "test", EnablePromptCaching: true})
+	payload := provider.buildPayload("claude-3-sonnet", messages, nil)
+	assert.Equal(t, []map[string]interface{}{
+		{
+			"type":          "text",
+			"text":          "You are a helpful assistant",
+			"cache_control": map[string]interface{}{"type": "ephemeral"},
+		},
+	}, payload["system"])
+
+	// Without a system prompt there is nothing to cache
+	payload = provider.buildPayload("claude-3-sonnet", messages[1:], nil)
+	assert.NotContains(t, payload, "system")
+}
+
+func TestAnthropicProvider_BuildPayload_ContentParts(t *testing.T) {
+	messages := []map[string]interface{}{
+		{"role": "system", "content": []interface{}{map[string]interface{}{"type": "text", "text": "Be brief"}}},
+		{"role": "user", "content": []interface{}{
+			map[string]interface{}{"type": "text", "text": "What's this?"},
+			map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "https://example.com/cat.png"}},
+		}},
+	}
+
+	provider := NewAnthropicProvider(&config.Provider{Name: "test"})
+	payload := provider.buildPayload("claude-3-sonnet", messages, nil)
+	assert.Equal(t, "Be brief", payload["system"])
+	assert.Equal(t, []map[string]interface{}{{"role": "user", "content": "What's this?"}}, payload["messages"])
+}
@@ -0,0 +1,102 @@
+package providers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/pkg/provider"
+)
+
+// Authenticator adds a provider's credentials to the requests sent to its upstream.
+type Authenticator interface {
+	// Apply authenticates req, returning an error if its credentials aren't available.
+	Apply(req *http.Request) error
+}
+
+// newAuthenticator returns the authenticator of providers that send an API key: by default the one
+// standard returns for the provider type, or one sending the key in the header or query parameter
+// the config names instead.
+func newAuthenticator(cfg *config.Provider, standard func(provider.CredentialSource) Authenticator) Authenticator {
+	credentials := newCredentials(cfg)
+	// Validated when the config is loaded
+	header, param, _ := cfg.APIKeyPlacement()
+	switch {
+	case header != "":
+		return headerAuth{name: header, credentials: credentials}
+	case param != "":
+		return queryAuth{name: param, credentials: credentials}
+	default:
+		return standard(credentials)
+	}
+}
+
+// bearerAuth sends the key of credentials as a bearer token in the Authorization header, as OpenAI
+// does. With optional, requests are sent without the header while the key is empty.
+type bearerAuth struct {
+	credentials provider.CredentialSource
+	optional    bool
+}
+
+// newBearerAuth returns a bearerAuth for credentials that always sends the header.
+func newBearerAuth(credentials provider.CredentialSource) Authenticator {
+	return bearerAuth{credentials: credentials}
+}
+
+func (a bearerAuth) Apply(req *http.Request) error {
+	key, err := a.credentials.Key(req.Context())
+	if err != nil {
+		return err
+	}
+	if key != "" || !a.optional {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	return nil
+}
+
+// headerAuth sends the key of credentials as is in the named header, such as Anthropic's "x-api-key".
+type headerAuth struct {
+	name        string
+	credentials provider.CredentialSource
+}
+
+func (a headerAuth) Apply(req *http.Request) error {
+	key, err := a.credentials.Key(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set(a.name, key)
+	return nil
+}
+
+// queryAuth sends the key of credentials in the named query parameter of the request URL.
+type queryAuth struct {
+	name        string
+	credentials provider.CredentialSource
+}
+
+func (a queryAuth) Apply(req *http.Request) error {
+	key, err := a.credentials.Key(req.Context())
+	if err != nil {
+		return err
+	}
+	query := req.URL.Query()
+	query.Set(a.name, key)
+	req.URL.RawQuery = query.Encode()
+	return nil
+}
+
+// doRequest sends req with client. As queryAuth puts API keys in the query, it's redacted from the
+// URL of the errors returned, which are logged.
+func doRequest(client *http.Client, req *http.Request) (*http.Response, error) {
+	resp, err := client.Do(req)
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		if i := strings.IndexByte(urlErr.URL, '?'); i >= 0 {
+			urlErr.URL = urlErr.URL[:i] + "?REDACTED"
+		}
+	}
+	return resp, err
+}
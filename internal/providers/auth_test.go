@@ -0,0 +1,94 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/pkg/provider"
+)
+
+func TestAuthenticators(t *testing.T) {
+	key := provider.StaticCredentials("secret")
+	tests := []struct {
+		name       string
+		auth       Authenticator
+		wantHeader http.Header
+		wantQuery  string
+	}{
+		{"bearer", newBearerAuth(key), http.Header{"Authorization": {"Bearer secret"}}, "a=1"},
+		{"bearer without key", newBearerAuth(provider.StaticCredentials("")),
+			http.Header{"Authorization": {"Bearer "}}, "a=1"},
+		{"optional bearer without key", newTemplateAuth(provider.StaticCredentials("")), http.Header{}, "a=1"},
+		{"anthropic", newAnthropicAuth(key), http.Header{"X-Api-Key": {"secret"}}, "a=1"},
+		{"header", headerAuth{name: "Api-Key", credentials: key}, http.Header{"Api-Key": {"secret"}}, "a=1"},
+		{"query", queryAuth{name: "key", credentials: key}, http.Header{}, "a=1&key=secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "https://api.example.com/v1/chat?a=1", http.NoBody)
+			require.NoError(t, tt.auth.Apply(req))
+			assert.Equal(t, tt.wantHeader, req.Header)
+			assert.Equal(t, tt.wantQuery, req.URL.RawQuery)
+		})
+	}
+
+	failed := failedCredentials{err: errors.New("vault is sealed")}
+	for _, auth := range []Authenticator{newBearerAuth(failed), newAnthropicAuth(failed), queryAuth{credentials: failed}} {
+		req := httptest.NewRequest(http.MethodPost, "https://api.example.com/v1/chat", http.NoBody)
+		assert.ErrorContains(t, auth.Apply(req), "vault is sealed")
+	}
+}
+
+func TestAuthenticators_Config(t *testing.T) {
+	var req *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"object": "chat.completion"}`))
+	}))
+	defer server.Close()
+	messages := []map[string]interface{}{{"role": "user", "content": "Hello"}}
+
+	// A gateway taking OpenAI's API with its key in an "api-key" header
+	openai := NewOpenAIProvider(&config.Provider{
+		Name: "azure", BaseURL: server.URL, APIKey: "secret", APIKeyHeader: "api-key",
+	})
+	_, err := openai.ChatCompletion(context.Background(), "gpt-4", messages, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", req.Header.Get("Api-Key"))
+	assert.Empty(t, req.Header.Get("Authorization"))
+
+	// And one taking Anthropic's with its key in the query
+	anthropic := NewAnthropicProvider(&config.Provider{
+		Name: "gateway", BaseURL: server.URL, APIKey: "secret", APIKeyParam: "key",
+	})
+	_, err = anthropic.ChatCompletion(context.Background(), "claude-3", messages, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", req.URL.Query().Get("key"))
+	assert.Empty(t, req.Header.Get("x-api-key"))
+	assert.NotEmpty(t, req.Header.Get("anthropic-version"))
+}
+
+func TestDoRequest_RedactsQuery(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	// Transport errors, which are logged, don't leak a key sent in the query
+	anthropic := NewAnthropicProvider(&config.Provider{
+		Name: "gateway", BaseURL: server.URL, APIKey: "secret", APIKeyParam: "key",
+	})
+	_, err := anthropic.ChatCompletion(context.Background(), "claude-3", []map[string]interface{}{
+		{"role": "user", "content": "Hello"},
+	}, nil)
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret")
+	assert.Contains(t, err.Error(), "?REDACTED")
+}
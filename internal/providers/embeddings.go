@@ -0,0 +1,59 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/modelplex/modelplex/pkg/provider"
+)
+
+// embeddingsPath is the OpenAI endpoint embeddings are requested from
+const embeddingsPath = "/embeddings"
+
+// Embedder is implemented by providers that can create embeddings. Input is a string or an array
+// of inputs, as the OpenAI API accepts it, and is forwarded as is; the response's "data" lists an
+// embedding per input.
+type Embedder interface {
+	Embeddings(ctx context.Context, model string, input interface{}, params map[string]interface{}) (interface{}, error)
+}
+
+// wrapper is implemented by the providers that wrap another, such as transformProvider.
+type wrapper interface {
+	unwrap() Provider
+}
+
+// AsEmbedder returns p, or the provider it wraps, as an Embedder, or an error wrapping
+// provider.ErrNotSupported if neither is one. Wrappers only apply to completions, so embeddings
+// are sent to the wrapped provider directly.
+func AsEmbedder(p Provider) (Embedder, error) {
+	for current := p; ; {
+		if embedder, ok := current.(Embedder); ok {
+			return embedder, nil
+		}
+		wrapped, ok := current.(wrapper)
+		if !ok {
+			return nil, fmt.Errorf("%s: embeddings: %w", p.Name(), provider.ErrNotSupported)
+		}
+		current = wrapped.unwrap()
+	}
+}
+
+// Embeddings performs an embeddings request. Params are forwarded unchanged.
+func (p *OpenAIProvider) Embeddings(
+	ctx context.Context, model string, input interface{}, params map[string]interface{},
+) (interface{}, error) {
+	payload := mergeParams(params, map[string]interface{}{
+		"model": model,
+		"input": input,
+	})
+
+	return p.makeRequest(ctx, embeddingsPath, payload)
+}
+
+func (p *transformProvider) unwrap() Provider { return p.Provider }
+
+func (p *jsonModeProvider) unwrap() Provider { return p.Provider }
+
+func (p *retryProvider) unwrap() Provider { return p.Provider }
+
+func (p *messageLimitProvider) unwrap() Provider { return p.Provider }
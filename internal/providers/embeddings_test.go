@@ -0,0 +1,59 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/pkg/provider"
+)
+
+func TestOpenAIProvider_Embeddings(t *testing.T) {
+	tests := []struct {
+		name  string
+		input interface{}
+	}{
+		{"single input", "Hello"},
+		{"batch input", []interface{}{"One", "Two"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/embeddings", r.URL.Path)
+				var req map[string]interface{}
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+				assert.Equal(t, "text-embedding-3-small", req["model"])
+				assert.Equal(t, tt.input, req["input"])
+				assert.Equal(t, "float", req["encoding_format"])
+
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"object": "list", "data": [{"object": "embedding", "index": 0}]}`))
+			}))
+			defer server.Close()
+
+			p := NewProvider(&config.Provider{Name: "openai", Type: "openai", BaseURL: server.URL, EmulateJSONMode: true})
+			embedder, err := AsEmbedder(p)
+			require.NoError(t, err)
+
+			params := map[string]interface{}{"encoding_format": "float"}
+			result, err := embedder.Embeddings(context.Background(), "text-embedding-3-small", tt.input, params)
+			require.NoError(t, err)
+			assert.Equal(t, "list", result.(map[string]interface{})["object"])
+		})
+	}
+}
+
+func TestAsEmbedder_NotSupported(t *testing.T) {
+	p := NewProvider(&config.Provider{Name: "anthropic", Type: "anthropic", SystemPrompt: "Be brief"})
+
+	_, err := AsEmbedder(p)
+	assert.ErrorIs(t, err, provider.ErrNotSupported)
+	assert.ErrorContains(t, err, "anthropic: embeddings")
+}
@@ -0,0 +1,142 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// geminiParams maps the OpenAI request parameters Gemini supports onto its "generationConfig"
+// field names. Other parameters are dropped.
+var geminiParams = map[string]string{
+	"temperature":       "temperature",
+	"top_p":             "topP",
+	"top_k":             "topK",
+	"max_tokens":        "maxOutputTokens",
+	"presence_penalty":  "presencePenalty",
+	"frequency_penalty": "frequencyPenalty",
+	"seed":              "seed",
+	"n":                 "candidateCount",
+}
+
+// geminiResponse is a Gemini "generateContent" response, or one event of a streamed one.
+type geminiResponse struct {
+	Candidates []struct {
+		Content struct {
+			Parts []struct {
+				Text string `json:"text"`
+			} `json:"parts"`
+		} `json:"content"`
+		FinishReason string `json:"finishReason"`
+	} `json:"candidates"`
+	UsageMetadata map[string]interface{} `json:"usageMetadata"`
+	Error         struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// text returns the text of the first candidate, and its finish reason if it's finished.
+func (r *geminiResponse) text() (text, finishReason string) {
+	if len(r.Candidates) == 0 {
+		return "", ""
+	}
+	var builder strings.Builder
+	for _, part := range r.Candidates[0].Content.Parts {
+		builder.WriteString(part.Text)
+	}
+	return builder.String(), r.Candidates[0].FinishReason
+}
+
+// buildGeminiPayload converts OpenAI-style messages and parameters into a Gemini "generateContent"
+// payload. System messages become "systemInstruction", and assistant messages have the "model" role.
+func buildGeminiPayload(messages []map[string]interface{}, params map[string]interface{}) map[string]interface{} {
+	contents := make([]map[string]interface{}, 0, len(messages))
+	var system []map[string]interface{}
+
+	for _, msg := range messages {
+		part := map[string]interface{}{"text": extractText(msg["content"])}
+		switch msg["role"] {
+		case "system":
+			system = append(system, part)
+		case "assistant":
+			contents = append(contents, map[string]interface{}{"role": "model", "parts": []interface{}{part}})
+		default:
+			contents = append(contents, map[string]interface{}{"role": "user", "parts": []interface{}{part}})
+		}
+	}
+
+	payload := map[string]interface{}{"contents": contents}
+	if len(system) > 0 {
+		payload["systemInstruction"] = map[string]interface{}{"parts": system}
+	}
+
+	generationConfig := make(map[string]interface{})
+	// OpenAI's newer max_completion_tokens means the same; max_tokens takes precedence if both are set
+	if maxTokens, ok := params["max_completion_tokens"]; ok {
+		generationConfig["maxOutputTokens"] = maxTokens
+	}
+	pickParams(generationConfig, params, geminiParams)
+	if stop, ok := stopSequences(params); ok {
+		generationConfig["stopSequences"] = stop
+	}
+	if len(generationConfig) > 0 {
+		payload["generationConfig"] = generationConfig
+	}
+
+	return payload
+}
+
+// normalizeGeminiResponse converts a Gemini response into an OpenAI-shaped response.
+// Gemini's own usage counters are kept alongside OpenAI's.
+func normalizeGeminiResponse(model string, result interface{}, build responseBuilder) (map[string]interface{}, error) {
+	var response geminiResponse
+	// Prompts Gemini blocks get "promptFeedback" saying why instead of candidates
+	if err := checkResponseShape(result, "candidates", "promptFeedback"); err != nil {
+		return nil, err
+	}
+	if err := decodeResponse(result, &response); err != nil {
+		return nil, err
+	}
+
+	prompt, _ := response.UsageMetadata["promptTokenCount"].(float64)
+	completion, _ := response.UsageMetadata["candidatesTokenCount"].(float64)
+	usage := openAIUsage(int(prompt), int(completion))
+	for key, value := range response.UsageMetadata {
+		usage[key] = value
+	}
+
+	text, finishReason := response.text()
+	return build(model, text, geminiFinishReason(finishReason), usage), nil
+}
+
+// geminiChunkConverter maps the events of a Gemini stream onto OpenAI-shaped chunks. Each carries
+// the next text of the first candidate, and the last its finish reason; the stream ends with the body.
+func geminiChunkConverter(model string, build chunkBuilder) chunkConverter {
+	return func(data []byte) (interface{}, bool, error) {
+		var response geminiResponse
+		if err := json.Unmarshal(data, &response); err != nil {
+			return nil, false, err
+		}
+		if response.Error.Message != "" {
+			return nil, false, fmt.Errorf("gemini stream error: %s", response.Error.Message)
+		}
+
+		text, finishReason := response.text()
+		if finishReason == "" {
+			return build(model, text, nil), false, nil
+		}
+		return build(model, text, geminiFinishReason(finishReason)), false, nil
+	}
+}
+
+// geminiFinishReason maps a Gemini finishReason onto the OpenAI finish_reason vocabulary.
+func geminiFinishReason(finishReason string) string {
+	switch finishReason {
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
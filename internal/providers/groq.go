@@ -0,0 +1,110 @@
+// Package providers implements AI provider abstractions.
+// GroqProvider wraps OpenAIProvider for Groq's OpenAI-compatible API with these differences:
+// - Defaults base_url to "https://api.groq.com/openai/v1" when unset
+// - Discovers models from Groq's "/models" endpoint when none are configured
+// - Skips models that Groq reports as inactive
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/pkg/provider"
+)
+
+const (
+	// Default base URL for Groq's OpenAI-compatible API
+	defaultGroqBaseURL = "https://api.groq.com/openai/v1"
+)
+
+// GroqProvider implements the Provider interface for Groq's OpenAI-compatible API.
+type GroqProvider struct {
+	*OpenAIProvider
+
+	mu         sync.RWMutex
+	discovered []string
+}
+
+// NewGroqProvider creates a new Groq provider instance.
+func NewGroqProvider(cfg *config.Provider) *GroqProvider {
+	groqCfg := *cfg
+	if groqCfg.BaseURL == "" {
+		groqCfg.BaseURL = defaultGroqBaseURL
+	}
+
+	return &GroqProvider{
+		OpenAIProvider: NewOpenAIProvider(&groqCfg),
+	}
+}
+
+// Capabilities reports every operation of OpenAI-compatible APIs except embeddings, which Groq doesn't offer.
+func (p *GroqProvider) Capabilities() provider.Capabilities {
+	return provider.Capabilities{Chat: true, Completion: true, Streaming: true, Tools: true, Vision: true}
+}
+
+// ListModels returns the configured models, or the discovered models if none are configured.
+func (p *GroqProvider) ListModels() []string {
+	if len(p.models) > 0 {
+		return p.models
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.discovered
+}
+
+// DiscoverModels fetches the active models from Groq's "/models" endpoint.
+func (p *GroqProvider) DiscoverModels(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/models", http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = p.authorize(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := doRequest(p.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("model discovery failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Data []struct {
+			ID     string `json:"id"`
+			Active *bool  `json:"active"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	models := make([]string, 0, len(result.Data))
+	for _, model := range result.Data {
+		if model.Active != nil && !*model.Active {
+			continue
+		}
+		models = append(models, model.ID)
+	}
+
+	p.mu.Lock()
+	p.discovered = models
+	p.mu.Unlock()
+
+	return p.ListModels(), nil
+}
@@ -0,0 +1,145 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+)
+
+func TestNewGroqProvider(t *testing.T) {
+	provider := NewGroqProvider(&config.Provider{
+		Name:     "groq",
+		Type:     "groq",
+		APIKey:   "gsk-test",
+		Priority: 3,
+	})
+
+	assert.Equal(t, "groq", provider.Name())
+	assert.Equal(t, defaultGroqBaseURL, provider.baseURL)
+	assert.EqualValues(t, "gsk-test", provider.auth.(bearerAuth).credentials)
+	assert.Equal(t, 3, provider.Priority())
+	assert.Empty(t, provider.ListModels())
+
+	custom := NewGroqProvider(&config.Provider{
+		Name:    "groq",
+		BaseURL: "https://groq.internal/openai/v1",
+		Models:  []string{"llama-3.1-8b-instant"},
+	})
+	assert.Equal(t, "https://groq.internal/openai/v1", custom.baseURL)
+	assert.Equal(t, []string{"llama-3.1-8b-instant"}, custom.ListModels())
+}
+
+func TestNewProvider_Groq(t *testing.T) {
+	provider := NewProvider(&config.Provider{Name: "groq", Type: "groq"})
+	require.NotNil(t, provider)
+	assert.IsType(t, &GroqProvider{}, provider)
+	assert.Implements(t, (*ModelDiscoverer)(nil), provider)
+	// Groq serves everything OpenAI-compatible APIs do, except embeddings
+	assert.False(t, CapabilitiesOf(provider).Embeddings)
+	assert.True(t, CapabilitiesOf(provider).Tools)
+}
+
+func TestGroqProvider_DiscoverModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GET", r.Method)
+		assert.Equal(t, "/models", r.URL.Path)
+		assert.Equal(t, "Bearer gsk-test", r.Header.Get("Authorization"))
+
+		response := map[string]interface{}{
+			"object": "list",
+			"data": []map[string]interface{}{
+				{"id": "llama-3.1-8b-instant", "object": "model", "active": true},
+				{"id": "mixtral-8x7b-32768", "object": "model", "active": false},
+				{"id": "whisper-large-v3", "object": "model"},
+			},
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			t.Errorf("Failed to encode response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewGroqProvider(&config.Provider{
+		Name:    "groq",
+		BaseURL: server.URL,
+		APIKey:  "gsk-test",
+	})
+
+	models, err := provider.DiscoverModels(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"llama-3.1-8b-instant", "whisper-large-v3"}, models)
+	assert.Equal(t, models, provider.ListModels())
+}
+
+func TestGroqProvider_DiscoverModels_ConfiguredModelsWin(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write([]byte(`{"data": [{"id": "llama-3.1-8b-instant"}]}`)); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewGroqProvider(&config.Provider{
+		Name:    "groq",
+		BaseURL: server.URL,
+		Models:  []string{"llama-3.3-70b-versatile"},
+	})
+
+	models, err := provider.DiscoverModels(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"llama-3.3-70b-versatile"}, models)
+}
+
+func TestGroqProvider_DiscoverModels_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	provider := NewGroqProvider(&config.Provider{Name: "groq", BaseURL: server.URL})
+
+	models, err := provider.DiscoverModels(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, models)
+	assert.Contains(t, err.Error(), "401")
+}
+
+func TestGroqProvider_ChatCompletion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer gsk-test", r.Header.Get("Authorization"))
+
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write([]byte(`{"id": "chatcmpl-groq", "object": "chat.completion"}`)); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewGroqProvider(&config.Provider{
+		Name:    "groq",
+		BaseURL: server.URL,
+		APIKey:  "gsk-test",
+	})
+
+	messages := []map[string]interface{}{
+		{"role": "user", "content": "Hello"},
+	}
+
+	result, err := provider.ChatCompletion(context.Background(), "llama-3.1-8b-instant", messages, nil)
+	require.NoError(t, err)
+
+	response, ok := result.(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "chatcmpl-groq", response["id"])
+}
@@ -0,0 +1,164 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// ErrInvalidJSON is returned when a provider emulating JSON mode doesn't respond with a JSON object,
+// even after a retry.
+var ErrInvalidJSON = errors.New("response is not a valid JSON object")
+
+// jsonModeInstruction is added to the system prompt of requests that emulate JSON mode
+const jsonModeInstruction = "Respond with a single JSON object only, without any other text or Markdown code fences."
+
+// withJSONMode wraps p to emulate OpenAI's JSON mode if emulate is set.
+func withJSONMode(p Provider, emulate bool) Provider {
+	if !emulate {
+		return p
+	}
+
+	wrapped := &jsonModeProvider{Provider: p}
+	if discoverer, ok := p.(ModelDiscoverer); ok {
+		return &discoveringJSONModeProvider{jsonModeProvider: wrapped, discoverer: discoverer}
+	}
+	return wrapped
+}
+
+// jsonModeProvider emulates the "response_format" parameter for a provider without native
+// support: the requested format becomes an instruction in the system prompt, and a chat
+// completion that isn't a JSON object, and can't be repaired if repair is enabled, is retried once.
+type jsonModeProvider struct {
+	Provider
+}
+
+// ChatCompletion performs a chat completion request, checking the response is JSON if requested.
+func (p *jsonModeProvider) ChatCompletion(
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+) (interface{}, error) {
+	instruction, ok := jsonModeInstructionFor(params)
+	if !ok {
+		return p.Provider.ChatCompletion(ctx, model, messages, params)
+	}
+	requested := params
+	messages, params = emulateJSONMode(messages, params, instruction)
+
+	result, err := p.Provider.ChatCompletion(ctx, model, messages, params)
+	if err != nil || isJSONResponse(result) || RepairJSONResponse(ctx, model, requested, result) {
+		return result, err
+	}
+
+	slog.Debug("Retrying request that didn't return JSON", "provider", p.Name(), "model", model)
+	result, err = p.Provider.ChatCompletion(ctx, model, messages, params)
+	if err != nil {
+		return nil, err
+	}
+	if !isJSONResponse(result) && !RepairJSONResponse(ctx, model, requested, result) {
+		return nil, fmt.Errorf("%s: %w", p.Name(), ErrInvalidJSON)
+	}
+	return result, nil
+}
+
+// ChatCompletionStream performs a streaming chat completion request. Streams are relayed as they
+// arrive, so they carry the JSON instruction but can't be checked or retried.
+func (p *jsonModeProvider) ChatCompletionStream(
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+) (<-chan StreamChunk, error) {
+	if instruction, ok := jsonModeInstructionFor(params); ok {
+		messages, params = emulateJSONMode(messages, params, instruction)
+	}
+	return p.Provider.ChatCompletionStream(ctx, model, messages, params)
+}
+
+// discoveringJSONModeProvider is a jsonModeProvider whose provider also discovers models.
+type discoveringJSONModeProvider struct {
+	*jsonModeProvider
+	discoverer ModelDiscoverer
+}
+
+// DiscoverModels discovers models from the wrapped provider.
+func (p *discoveringJSONModeProvider) DiscoverModels(ctx context.Context) ([]string, error) {
+	return p.discoverer.DiscoverModels(ctx)
+}
+
+// jsonModeInstructionFor returns the instruction that asks for the "response_format" in params,
+// or false if it doesn't request JSON. A "json_schema" format includes its schema in the instruction.
+func jsonModeInstructionFor(params map[string]interface{}) (string, bool) {
+	format, _ := params["response_format"].(map[string]interface{})
+	switch format["type"] {
+	case "json_object":
+		return jsonModeInstruction, true
+	case "json_schema":
+		spec, _ := format["json_schema"].(map[string]interface{})
+		schema, err := json.Marshal(spec["schema"])
+		if err != nil || spec["schema"] == nil {
+			return jsonModeInstruction, true
+		}
+		return jsonModeInstruction + " The object must match this JSON Schema: " + string(schema), true
+	default:
+		return "", false
+	}
+}
+
+// emulateJSONMode returns copies of messages and params that ask for JSON with instruction instead
+// of "response_format". The instruction is appended to the last system message, since some
+// providers only send one, or sent as a new system message if there isn't one.
+func emulateJSONMode(
+	messages []map[string]interface{}, params map[string]interface{}, instruction string,
+) ([]map[string]interface{}, map[string]interface{}) {
+	params = mergeParams(params, nil)
+	delete(params, "response_format")
+
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i]["role"] != "system" {
+			continue
+		}
+		content := extractText(messages[i]["content"])
+		messages = append([]map[string]interface{}(nil), messages...)
+		messages[i] = mergeParams(messages[i], map[string]interface{}{"content": content + "\n\n" + instruction})
+		return messages, params
+	}
+
+	system := map[string]interface{}{"role": "system", "content": instruction}
+	return append([]map[string]interface{}{system}, messages...), params
+}
+
+// isJSONResponse reports whether the text of a chat completion is a JSON object. The text is read
+// from an OpenAI-shaped response, or from Anthropic's or Ollama's own format if not normalized.
+func isJSONResponse(result interface{}) bool {
+	var response struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	}
+	if err := decodeResponse(result, &response); err != nil {
+		return false
+	}
+
+	var text strings.Builder
+	for _, choice := range response.Choices {
+		text.WriteString(choice.Message.Content)
+	}
+	for _, block := range response.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	text.WriteString(response.Message.Content)
+
+	var object map[string]interface{}
+	return json.Unmarshal([]byte(text.String()), &object) == nil && object != nil
+}
@@ -0,0 +1,181 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+)
+
+// scriptedProvider answers chat completions with each of its replies in turn
+type scriptedProvider struct {
+	recordingProvider
+	replies []string
+	calls   int
+}
+
+func (p *scriptedProvider) ChatCompletion(
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+) (interface{}, error) {
+	_, _ = p.recordingProvider.ChatCompletion(ctx, model, messages, params)
+	reply := p.replies[min(p.calls, len(p.replies)-1)]
+	p.calls++
+	return chatResponse(model, reply, "stop", nil), nil
+}
+
+var jsonObjectParams = map[string]interface{}{"response_format": map[string]interface{}{"type": "json_object"}}
+
+func TestWithJSONMode_Disabled(t *testing.T) {
+	inner := &recordingProvider{}
+	assert.Same(t, inner, withJSONMode(inner, false))
+}
+
+func TestJSONMode_Instruction(t *testing.T) {
+	inner := &scriptedProvider{replies: []string{`{"ok": true}`}}
+	p := withJSONMode(inner, true)
+
+	messages := []map[string]interface{}{
+		{"role": "system", "content": "You are terse."},
+		{"role": "user", "content": "Hi"},
+	}
+	params := map[string]interface{}{
+		"temperature":     0.2,
+		"response_format": map[string]interface{}{"type": "json_object"},
+	}
+	_, err := p.ChatCompletion(context.Background(), "claude", messages, params)
+	require.NoError(t, err)
+
+	// response_format is replaced by an instruction in the system prompt
+	assert.Equal(t, map[string]interface{}{"temperature": 0.2}, inner.params)
+	require.Len(t, inner.messages, 2)
+	assert.Equal(t, "You are terse.\n\n"+jsonModeInstruction, inner.messages[0]["content"])
+
+	// The caller's messages and params are left alone
+	assert.Equal(t, "You are terse.", messages[0]["content"])
+	assert.Contains(t, params, "response_format")
+}
+
+func TestJSONMode_InstructionWithoutSystemPrompt(t *testing.T) {
+	inner := &scriptedProvider{replies: []string{`{"ok": true}`}}
+	p := withJSONMode(inner, true)
+
+	schema := map[string]interface{}{"type": "object", "required": []interface{}{"answer"}}
+	params := map[string]interface{}{"response_format": map[string]interface{}{
+		"type":        "json_schema",
+		"json_schema": map[string]interface{}{"name": "answer", "schema": schema},
+	}}
+	_, err := p.ChatCompletion(context.Background(), "claude", []map[string]interface{}{
+		{"role": "user", "content": "Hi"},
+	}, params)
+	require.NoError(t, err)
+
+	require.Len(t, inner.messages, 2)
+	assert.Equal(t, "system", inner.messages[0]["role"])
+	assert.Contains(t, inner.messages[0]["content"], jsonModeInstruction)
+	assert.Contains(t, inner.messages[0]["content"], `{"required":["answer"],"type":"object"}`)
+}
+
+func TestJSONMode_InstructionWithContentParts(t *testing.T) {
+	inner := &scriptedProvider{replies: []string{`{"ok": true}`}}
+	p := withJSONMode(inner, true)
+
+	_, err := p.ChatCompletion(context.Background(), "claude", []map[string]interface{}{
+		{"role": "system", "content": []interface{}{map[string]interface{}{"type": "text", "text": "You are terse."}}},
+		{"role": "user", "content": "Hi"},
+	}, jsonObjectParams)
+	require.NoError(t, err)
+
+	require.Len(t, inner.messages, 2)
+	assert.Equal(t, "You are terse.\n\n"+jsonModeInstruction, inner.messages[0]["content"])
+}
+
+func TestJSONMode_Retry(t *testing.T) {
+	tests := []struct {
+		name    string
+		replies []string
+		calls   int
+		wantErr bool
+	}{
+		{name: "valid", replies: []string{`{"ok": true}`}, calls: 1},
+		{name: "retried", replies: []string{"Sure! Here it is:", `{"ok": true}`}, calls: 2},
+		{name: "invalid twice", replies: []string{"Sure!", "```json\n{}\n```"}, calls: 2, wantErr: true},
+		{name: "not an object", replies: []string{"[1, 2]", "null"}, calls: 2, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &scriptedProvider{replies: tt.replies}
+			result, err := withJSONMode(inner, true).ChatCompletion(context.Background(), "claude", nil, jsonObjectParams)
+
+			assert.Equal(t, tt.calls, inner.calls)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidJSON)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, isJSONResponse(result))
+		})
+	}
+}
+
+func TestJSONMode_NotRequested(t *testing.T) {
+	inner := &scriptedProvider{replies: []string{"plain text"}}
+	p := withJSONMode(inner, true)
+
+	params := map[string]interface{}{"response_format": map[string]interface{}{"type": "text"}}
+	_, err := p.ChatCompletion(context.Background(), "claude", nil, params)
+	require.NoError(t, err)
+	assert.Equal(t, 1, inner.calls)
+	assert.Equal(t, params, inner.params)
+}
+
+func TestJSONMode_Stream(t *testing.T) {
+	inner := &recordingProvider{}
+	p := withJSONMode(inner, true)
+
+	chunks, err := p.ChatCompletionStream(context.Background(), "claude", nil, jsonObjectParams)
+	require.NoError(t, err)
+	for range chunks {
+	}
+
+	assert.NotContains(t, inner.params, "response_format")
+	require.Len(t, inner.messages, 1)
+	assert.Equal(t, jsonModeInstruction, inner.messages[0]["content"])
+}
+
+func TestJSONMode_Anthropic(t *testing.T) {
+	// Anthropic has no JSON mode, so the instruction goes in "system" and the reply is checked
+	var systems []interface{}
+	replies := []string{"Here you go!", `{"answer": 42}`}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.NotContains(t, req, "response_format")
+		systems = append(systems, req["system"])
+
+		w.Header().Set("Content-Type", "application/json")
+		reply := replies[len(systems)-1]
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{
+			"content":     []interface{}{map[string]interface{}{"type": "text", "text": reply}},
+			"stop_reason": "end_turn",
+		}))
+	}))
+	defer server.Close()
+
+	p := NewProvider(&config.Provider{
+		Name: "anthropic", Type: "anthropic", BaseURL: server.URL, APIKey: "key", EmulateJSONMode: true,
+	})
+	result, err := p.ChatCompletion(context.Background(), "claude", []map[string]interface{}{
+		{"role": "user", "content": "What is the answer?"},
+	}, jsonObjectParams)
+	require.NoError(t, err)
+
+	assert.Equal(t, []interface{}{jsonModeInstruction, jsonModeInstruction}, systems)
+	assert.True(t, isJSONResponse(result))
+}
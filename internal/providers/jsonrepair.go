@@ -0,0 +1,243 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+)
+
+type jsonRepairKey struct{}
+
+// WithJSONRepair returns a context for a request whose chat completions should have malformed
+// JSON repaired, when JSON was requested with "response_format".
+func WithJSONRepair(ctx context.Context) context.Context {
+	return context.WithValue(ctx, jsonRepairKey{}, true)
+}
+
+// jsonRepairEnabled reports whether WithJSONRepair was set for ctx.
+func jsonRepairEnabled(ctx context.Context) bool {
+	enabled, _ := ctx.Value(jsonRepairKey{}).(bool)
+	return enabled
+}
+
+// RepairJSONResponse repairs the text of a chat completion that should be a JSON object, as
+// params request, but isn't, if repair is enabled for ctx. It reports whether it repaired the
+// response, which is modified in place. The text is read as isJSONResponse reads it.
+func RepairJSONResponse(ctx context.Context, model string, params map[string]interface{}, result interface{}) bool {
+	if !jsonRepairEnabled(ctx) || isJSONResponse(result) {
+		return false
+	}
+	if _, ok := jsonModeInstructionFor(params); !ok {
+		return false
+	}
+
+	response, ok := result.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	repaired := false
+	for _, text := range responseTexts(response) {
+		if fixed, ok := RepairJSON(text.get()); ok {
+			text.set(fixed)
+			repaired = true
+		}
+	}
+	if repaired && isJSONResponse(result) {
+		slog.Info("Repaired malformed JSON in response", "model", model)
+		return true
+	}
+	return false
+}
+
+// responseText is a text field of a response, which can be replaced.
+type responseText struct {
+	get func() string
+	set func(string)
+}
+
+// field returns the string field key of object as a responseText, if it is one.
+func field(object map[string]interface{}, key string) []responseText {
+	if _, ok := object[key].(string); !ok {
+		return nil
+	}
+	return []responseText{{
+		get: func() string { return object[key].(string) },
+		set: func(text string) { object[key] = text },
+	}}
+}
+
+// responseTexts returns the texts of a chat completion: its choices' messages if OpenAI-shaped,
+// or Anthropic's text blocks or Ollama's message if not normalized.
+func responseTexts(response map[string]interface{}) []responseText {
+	var texts []responseText
+	choices, _ := response["choices"].([]interface{})
+	for _, c := range choices {
+		choice, _ := c.(map[string]interface{})
+		if message, ok := choice["message"].(map[string]interface{}); ok {
+			texts = append(texts, field(message, "content")...)
+		}
+	}
+	blocks, _ := response["content"].([]interface{})
+	for _, b := range blocks {
+		if block, ok := b.(map[string]interface{}); ok && block["type"] == "text" {
+			texts = append(texts, field(block, "text")...)
+		}
+	}
+	if message, ok := response["message"].(map[string]interface{}); ok {
+		texts = append(texts, field(message, "content")...)
+	}
+	return texts
+}
+
+// RepairJSON fixes the mistakes models commonly make when asked for a JSON object: Markdown
+// code fences or prose around it, trailing commas, unquoted or single-quoted keys and strings,
+// and truncated output missing its closing quotes and brackets. It returns the repaired object,
+// or false if text still isn't a JSON object after repair.
+func RepairJSON(text string) (string, bool) {
+	start := strings.IndexByte(text, '{')
+	if start < 0 {
+		return "", false
+	}
+
+	r := &jsonRepairer{}
+	r.scan(text[start:])
+	repaired := r.finish()
+
+	var object map[string]interface{}
+	if err := json.Unmarshal(repaired, &object); err != nil || object == nil {
+		return "", false
+	}
+	return string(repaired), true
+}
+
+// jsonRepairer rewrites almost-JSON into JSON in a single pass.
+type jsonRepairer struct {
+	out []byte
+	// open holds the brackets that haven't been closed yet
+	open []byte
+	// expectKey is set where an object key may start, after "{" or ","
+	expectKey bool
+	// truncated is set if the text ended inside a string
+	truncated bool
+}
+
+// scan rewrites text up to the end of its first object.
+func (r *jsonRepairer) scan(text string) {
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '"' || c == '\'':
+			n, closed := r.scanString(text[i:])
+			i += n - 1
+			if !closed {
+				r.truncated = true
+				return
+			}
+			r.expectKey = false
+		case c == '{' || c == '[':
+			r.open = append(r.open, c)
+			r.out = append(r.out, c)
+			r.expectKey = c == '{'
+		case c == '}' || c == ']':
+			if r.close() {
+				return
+			}
+		case c == ',':
+			r.out = append(r.out, c)
+			r.expectKey = r.inObject()
+		case r.expectKey && isIdentifierByte(c):
+			n := 1
+			for i+n < len(text) && isIdentifierByte(text[i+n]) {
+				n++
+			}
+			r.out = append(r.out, '"')
+			r.out = append(r.out, text[i:i+n]...)
+			r.out = append(r.out, '"')
+			i += n - 1
+			r.expectKey = false
+		default:
+			r.out = append(r.out, c)
+		}
+	}
+}
+
+// scanString copies the string at the start of text, which may be single-quoted, as a
+// double-quoted JSON string. It returns how many bytes it consumed, and whether the string
+// was closed before text ended.
+func (r *jsonRepairer) scanString(text string) (int, bool) {
+	quote := text[0]
+	r.out = append(r.out, '"')
+	for i := 1; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text):
+			i++
+			if text[i] == '\'' {
+				r.out = append(r.out, '\'')
+			} else {
+				r.out = append(r.out, c, text[i])
+			}
+		case c == quote:
+			r.out = append(r.out, '"')
+			return i + 1, true
+		case c == '"':
+			r.out = append(r.out, '\\', '"')
+		case c == '\n':
+			r.out = append(r.out, '\\', 'n')
+		default:
+			r.out = append(r.out, c)
+		}
+	}
+	return len(text), false
+}
+
+// close closes the innermost open bracket, dropping a trailing comma before it. It reports
+// whether that closed the outermost object.
+func (r *jsonRepairer) close() bool {
+	r.trimTrailingComma()
+	if len(r.open) == 0 {
+		return true
+	}
+	r.out = append(r.out, closingBracket(r.open[len(r.open)-1]))
+	r.open = r.open[:len(r.open)-1]
+	r.expectKey = false
+	return len(r.open) == 0
+}
+
+// finish completes truncated output, closing its string and brackets, and returns it.
+func (r *jsonRepairer) finish() []byte {
+	if r.truncated {
+		r.out = append(r.out, '"')
+	}
+	r.out = []byte(strings.TrimRight(string(r.out), " \t\r\n"))
+	if len(r.out) > 0 && r.out[len(r.out)-1] == ':' {
+		r.out = append(r.out, "null"...)
+	}
+	for len(r.open) > 0 {
+		r.close()
+	}
+	return r.out
+}
+
+func (r *jsonRepairer) trimTrailingComma() {
+	trimmed := strings.TrimRight(string(r.out), " \t\r\n")
+	if strings.HasSuffix(trimmed, ",") {
+		r.out = []byte(trimmed[:len(trimmed)-1])
+	}
+}
+
+func (r *jsonRepairer) inObject() bool {
+	return len(r.open) > 0 && r.open[len(r.open)-1] == '{'
+}
+
+func closingBracket(open byte) byte {
+	if open == '{' {
+		return '}'
+	}
+	return ']'
+}
+
+func isIdentifierByte(c byte) bool {
+	return c == '_' || c == '$' || c == '-' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
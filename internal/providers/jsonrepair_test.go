@@ -0,0 +1,76 @@
+package providers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepairJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"trailing commas", `{"a": [1, 2,], "b": 3,}`, `{"a": [1, 2], "b": 3}`},
+		{"unquoted keys", `{name: "x", nested: {max_tokens: 5}}`, `{"name": "x", "nested": {"max_tokens": 5}}`},
+		{"single quotes", `{'a': 'it\'s "fine"'}`, `{"a": "it's \"fine\""}`},
+		{"truncated", `{"a": {"b": [1, 2`, `{"a": {"b": [1, 2]}}`},
+		{"truncated string", `{"a": "hel`, `{"a": "hel"}`},
+		{"truncated after key", `{"a": 1, "b":`, `{"a": 1, "b":null}`},
+		{"code fence and prose", "Here you go:\n```json\n{\"a\": 1,}\n```\nAnything else?", `{"a": 1}`},
+		{"newline in string", "{\"a\": \"line\nbreak\"}", `{"a": "line\nbreak"}`},
+		{"values aren't quoted", `{"ok": true, "n": null}`, `{"ok": true, "n": null}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repaired, ok := RepairJSON(tt.text)
+			require.True(t, ok, repaired)
+			assert.JSONEq(t, tt.want, repaired)
+		})
+	}
+
+	for _, text := range []string{`no json here`, `["an", "array"]`, `{"a": tru`} {
+		_, ok := RepairJSON(text)
+		assert.False(t, ok, text)
+	}
+}
+
+func TestRepairJSONResponse(t *testing.T) {
+	ctx := WithJSONRepair(context.Background())
+
+	result := chatResponse("llama3", `{"answer": 42,`, "stop", nil)
+	require.True(t, RepairJSONResponse(ctx, "llama3", jsonObjectParams, result))
+	assert.Equal(t, `{"answer": 42}`, result["choices"].([]interface{})[0].(map[string]interface{})["message"].(map[string]interface{})["content"])
+
+	// Ollama's own format
+	ollama := map[string]interface{}{"message": map[string]interface{}{"role": "assistant", "content": `{a: 1}`}}
+	require.True(t, RepairJSONResponse(ctx, "llama3", jsonObjectParams, ollama))
+	assert.True(t, isJSONResponse(ollama))
+
+	// Only when enabled, and JSON was requested
+	result = chatResponse("llama3", `{"answer": 42,`, "stop", nil)
+	assert.False(t, RepairJSONResponse(context.Background(), "llama3", jsonObjectParams, result))
+	assert.False(t, RepairJSONResponse(ctx, "llama3", nil, result))
+	assert.False(t, isJSONResponse(result))
+}
+
+func TestJSONMode_Repair(t *testing.T) {
+	inner := &scriptedProvider{replies: []string{"```json\n{\"ok\": true,}\n```", `{"ok": true}`}}
+	p := withJSONMode(inner, true)
+
+	// A repairable reply isn't retried
+	result, err := p.ChatCompletion(WithJSONRepair(context.Background()), "llama3", nil, jsonObjectParams)
+	require.NoError(t, err)
+	assert.True(t, isJSONResponse(result))
+	assert.Equal(t, 1, inner.calls)
+
+	// Without repair, it is
+	inner.calls = 0
+	_, err = p.ChatCompletion(context.Background(), "llama3", nil, jsonObjectParams)
+	require.NoError(t, err)
+	assert.Equal(t, 2, inner.calls)
+}
@@ -0,0 +1,51 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrTooManyMessages is returned for chat requests with more messages than a max_messages limit.
+var ErrTooManyMessages = errors.New("too many messages")
+
+// CheckMaxMessages returns an error wrapping ErrTooManyMessages if messages has more than limit
+// messages. limitedBy names the model or provider the limit is set on; a limit of 0 is no limit.
+func CheckMaxMessages(messages []map[string]interface{}, limit int, limitedBy string) error {
+	if limit <= 0 || len(messages) <= limit {
+		return nil
+	}
+	return fmt.Errorf("%w: %d, more than the limit of %d for %s", ErrTooManyMessages, len(messages), limit, limitedBy)
+}
+
+// withMessageLimit wraps p so chat requests with more than limit messages fail before they're sent.
+// It's applied outside the other wrappers, so only the messages the client sent are counted.
+func withMessageLimit(p Provider, limit int) Provider {
+	if limit <= 0 {
+		return p
+	}
+	return &messageLimitProvider{Provider: p, limit: limit}
+}
+
+type messageLimitProvider struct {
+	Provider
+	limit int
+}
+
+func (p *messageLimitProvider) ChatCompletion(
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+) (interface{}, error) {
+	if err := CheckMaxMessages(messages, p.limit, p.Name()); err != nil {
+		return nil, err
+	}
+	return p.Provider.ChatCompletion(ctx, model, messages, params)
+}
+
+func (p *messageLimitProvider) ChatCompletionStream(
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+) (<-chan StreamChunk, error) {
+	if err := CheckMaxMessages(messages, p.limit, p.Name()); err != nil {
+		return nil, err
+	}
+	return p.Provider.ChatCompletionStream(ctx, model, messages, params)
+}
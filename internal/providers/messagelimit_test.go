@@ -0,0 +1,48 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+)
+
+func TestNewProvider_MaxMessages(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "Hi"}}]}`))
+	}))
+	defer server.Close()
+
+	p := NewProvider(&config.Provider{
+		Name: "openai", Type: "openai", BaseURL: server.URL, MaxMessages: 2,
+		SystemPrompt: "Be brief.",
+	})
+	message := map[string]interface{}{"role": "user", "content": "Hello"}
+
+	// The provider's own system prompt isn't counted
+	_, err := p.ChatCompletion(context.Background(), "gpt-4", []map[string]interface{}{message, message}, nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, requests.Load())
+
+	// Requests over the limit fail without being sent, streaming or not
+	tooMany := []map[string]interface{}{message, message, message}
+	_, err = p.ChatCompletion(context.Background(), "gpt-4", tooMany, nil)
+	require.ErrorIs(t, err, ErrTooManyMessages)
+	assert.EqualError(t, err, "too many messages: 3, more than the limit of 2 for openai")
+	_, err = p.ChatCompletionStream(context.Background(), "gpt-4", tooMany, nil)
+	require.ErrorIs(t, err, ErrTooManyMessages)
+	assert.EqualValues(t, 1, requests.Load())
+
+	// Embeddings are still sent to the wrapped provider
+	_, err = AsEmbedder(p)
+	assert.NoError(t, err)
+}
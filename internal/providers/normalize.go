@@ -0,0 +1,217 @@
+package providers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// Objects and id prefixes of normalized responses
+	chatCompletionObject = "chat.completion"
+	chatCompletionPrefix = "chatcmpl-"
+	textCompletionPrefix = "cmpl-"
+
+	responseIDBytes = 16
+)
+
+// ErrUnexpectedResponse is returned when a response to be normalized doesn't have the shape of the
+// provider's API, such as an error-shaped body sent with 200 OK, or a field of the wrong type.
+var ErrUnexpectedResponse = errors.New("unexpected response from provider")
+
+// responseBuilder builds an OpenAI-shaped response from the text a provider generated.
+type responseBuilder func(model, text, finishReason string, usage map[string]interface{}) map[string]interface{}
+
+// chatResponse builds an OpenAI "chat.completion". Like every normalized response it has a
+// synthesized id, names the model echoedModel returns and is created now, since strict OpenAI
+// clients validate all three.
+func chatResponse(model, content, finishReason string, usage map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"id":      newResponseID(chatCompletionPrefix),
+		"object":  chatCompletionObject,
+		"created": time.Now().Unix(),
+		"model":   model,
+		"choices": []interface{}{
+			map[string]interface{}{
+				"index":         0,
+				"message":       map[string]interface{}{"role": "assistant", "content": content},
+				"finish_reason": finishReason,
+			},
+		},
+		"usage": usage,
+	}
+}
+
+// textResponse builds an OpenAI "text_completion".
+func textResponse(model, text, finishReason string, usage map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"id":      newResponseID(textCompletionPrefix),
+		"object":  textChunkObject,
+		"created": time.Now().Unix(),
+		"model":   model,
+		"choices": []interface{}{
+			map[string]interface{}{
+				"index":         0,
+				"text":          text,
+				"finish_reason": finishReason,
+			},
+		},
+		"usage": usage,
+	}
+}
+
+// echoedModel returns the model a normalized response names: the requested model, which strict
+// clients expect back, or with echoUpstream the model in the upstream response's field, if it has one.
+func echoedModel(requested string, result interface{}, field string, echoUpstream bool) string {
+	if !echoUpstream {
+		return requested
+	}
+	response, _ := result.(map[string]interface{})
+	if upstream, ok := response[field].(string); ok && upstream != "" {
+		return upstream
+	}
+	return requested
+}
+
+// openAIUsage builds an OpenAI "usage" object from prompt and completion token counts.
+func openAIUsage(promptTokens, completionTokens int) map[string]interface{} {
+	return map[string]interface{}{
+		"prompt_tokens":     promptTokens,
+		"completion_tokens": completionTokens,
+		"total_tokens":      promptTokens + completionTokens,
+	}
+}
+
+// The fields of each object in OpenAI's completion responses, which strict normalization keeps
+var (
+	openAIResponseFields = []string{"id", "object", "created", "model", "choices", "usage", "system_fingerprint"}
+	openAIChoiceFields   = []string{"index", "message", "text", "finish_reason", "logprobs"}
+	openAIMessageFields  = []string{"role", "content", "refusal", "tool_calls"}
+	openAIUsageFields    = []string{
+		"prompt_tokens", "completion_tokens", "total_tokens", "prompt_tokens_details", "completion_tokens_details",
+	}
+)
+
+// stripNonOpenAIFields removes the fields of a normalized response that aren't in OpenAI's
+// schema, such as Anthropic's own usage counters.
+func stripNonOpenAIFields(response map[string]interface{}) {
+	keepFields(response, openAIResponseFields)
+	if usage, ok := response["usage"].(map[string]interface{}); ok {
+		keepFields(usage, openAIUsageFields)
+	}
+
+	choices, _ := response["choices"].([]interface{})
+	for _, c := range choices {
+		choice, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		keepFields(choice, openAIChoiceFields)
+		if message, ok := choice["message"].(map[string]interface{}); ok {
+			keepFields(message, openAIMessageFields)
+		}
+	}
+}
+
+// keepFields deletes the fields of object not named in fields.
+func keepFields(object map[string]interface{}, fields []string) {
+	for key := range object {
+		if !slices.Contains(fields, key) {
+			delete(object, key)
+		}
+	}
+}
+
+// newResponseID returns prefix followed by 128 random bits in hex, unique per response.
+func newResponseID(prefix string) string {
+	var b [responseIDBytes]byte
+	_, _ = rand.Read(b[:]) // crypto/rand.Read never returns an error
+	return prefix + hex.EncodeToString(b[:])
+}
+
+// decodeResponse decodes a generic JSON response into v, a struct describing the fields normalization needs.
+// Responses that aren't JSON objects, such as arrays from a misbehaving gateway, or that have fields
+// of the wrong type, are an error wrapping ErrUnexpectedResponse.
+func decodeResponse(result, v interface{}) error {
+	if _, ok := result.(map[string]interface{}); !ok {
+		return fmt.Errorf("%w: cannot normalize response: expected a JSON object, got %s",
+			ErrUnexpectedResponse, jsonKind(result))
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, v)
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return fmt.Errorf("%w: cannot normalize response: field %q is %s", ErrUnexpectedResponse,
+			typeErr.Field, typeErr.Value)
+	}
+	return err
+}
+
+// checkResponseShape returns an error wrapping ErrUnexpectedResponse unless result is a JSON object
+// with at least one of fields, the ones normalization reads the generated text from. The error
+// describes what the response has instead: the error it reports, if it's error-shaped, or its fields.
+func checkResponseShape(result interface{}, fields ...string) error {
+	response, ok := result.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%w: cannot normalize response: expected a JSON object, got %s",
+			ErrUnexpectedResponse, jsonKind(result))
+	}
+	for _, field := range fields {
+		if _, ok := response[field]; ok {
+			return nil
+		}
+	}
+
+	missing := strings.Join(fields, " or ")
+	if message := responseError(response); message != "" {
+		return fmt.Errorf("%w: cannot normalize response without %s: the provider reported an error: %s",
+			ErrUnexpectedResponse, missing, message)
+	}
+	return fmt.Errorf("%w: cannot normalize response without %s: got fields [%s]",
+		ErrUnexpectedResponse, missing, strings.Join(slices.Sorted(maps.Keys(response)), ", "))
+}
+
+// responseError returns the message of the error an error-shaped response reports, such as
+// {"error": {"message": "Overloaded"}} or {"error": "model not found"}, or "" if it has none.
+func responseError(response map[string]interface{}) string {
+	switch reported := response["error"].(type) {
+	case string:
+		return reported
+	case map[string]interface{}:
+		if message, ok := reported["message"].(string); ok {
+			return message
+		}
+		if encoded, err := json.Marshal(reported); err == nil {
+			return string(encoded)
+		}
+	}
+	return ""
+}
+
+// jsonKind names the JSON type of a value decoded into an interface{}.
+func jsonKind(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case []interface{}:
+		return "an array"
+	case string:
+		return "a string"
+	case float64:
+		return "a number"
+	case bool:
+		return "a boolean"
+	default:
+		return "an object"
+	}
+}
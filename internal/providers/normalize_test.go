@@ -0,0 +1,330 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+)
+
+func jsonServer(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// assertNormalized checks the fields strict OpenAI clients require of a normalized response.
+func assertNormalized(t *testing.T, result interface{}, object, idPrefix, model string) map[string]interface{} {
+	t.Helper()
+	response, ok := result.(map[string]interface{})
+	require.True(t, ok, "expected a map, got %T", result)
+
+	assert.Regexp(t, "^"+idPrefix+"[0-9a-f]{32}$", response["id"])
+	assert.Equal(t, object, response["object"])
+	assert.Equal(t, model, response["model"])
+	assert.InDelta(t, time.Now().Unix(), response["created"], 5)
+
+	choices, ok := response["choices"].([]interface{})
+	require.True(t, ok)
+	require.Len(t, choices, 1)
+	return choices[0].(map[string]interface{})
+}
+
+func TestAnthropicProvider_NormalizeResponses(t *testing.T) {
+	server := jsonServer(t, `{
+		"id": "msg_01",
+		"type": "message",
+		"role": "assistant",
+		"model": "claude-3-5-sonnet-20241022",
+		"content": [{"type": "text", "text": "Hello"}, {"type": "text", "text": " there"}],
+		"stop_reason": "max_tokens",
+		"usage": {"input_tokens": 10, "output_tokens": 2, "cache_read_input_tokens": 8}
+	}`)
+	provider := NewAnthropicProvider(&config.Provider{Name: "anthropic", BaseURL: server.URL, NormalizeResponses: true})
+	messages := []map[string]interface{}{{"role": "user", "content": "Hi"}}
+
+	result, err := provider.ChatCompletion(context.Background(), "claude-3-5-sonnet", messages, nil)
+	require.NoError(t, err)
+
+	choice := assertNormalized(t, result, "chat.completion", "chatcmpl-", "claude-3-5-sonnet")
+	assert.Equal(t, map[string]interface{}{"role": "assistant", "content": "Hello there"}, choice["message"])
+	assert.Equal(t, "length", choice["finish_reason"])
+
+	usage := result.(map[string]interface{})["usage"].(map[string]interface{})
+	assert.Equal(t, 12, usage["total_tokens"])
+	assert.Equal(t, float64(8), usage["cache_read_input_tokens"])
+
+	result, err = provider.Completion(context.Background(), "claude-3-5-sonnet", "Hi", nil)
+	require.NoError(t, err)
+
+	choice = assertNormalized(t, result, "text_completion", "cmpl-", "claude-3-5-sonnet")
+	assert.Equal(t, "Hello there", choice["text"])
+}
+
+func TestOllamaProvider_NormalizeResponses(t *testing.T) {
+	server := jsonServer(t, `{
+		"model": "llama2",
+		"created_at": "2023-08-04T19:22:45.499127Z",
+		"message": {"role": "assistant", "content": "Hi!"},
+		"done": true,
+		"done_reason": "stop",
+		"prompt_eval_count": 26,
+		"eval_count": 3
+	}`)
+	provider := NewOllamaProvider(&config.Provider{Name: "local", BaseURL: server.URL, NormalizeResponses: true})
+
+	result, err := provider.ChatCompletion(context.Background(), "llama2", nil, nil)
+	require.NoError(t, err)
+
+	choice := assertNormalized(t, result, "chat.completion", "chatcmpl-", "llama2")
+	assert.Equal(t, map[string]interface{}{"role": "assistant", "content": "Hi!"}, choice["message"])
+	assert.Equal(t, "stop", choice["finish_reason"])
+	assert.Equal(t, openAIUsage(26, 3), result.(map[string]interface{})["usage"])
+}
+
+func TestOllamaProvider_RawResponses(t *testing.T) {
+	server := jsonServer(t, `{"model": "llama2", "response": "Hi!", "done": true}`)
+	provider := NewOllamaProvider(&config.Provider{Name: "local", BaseURL: server.URL})
+
+	// Without normalize_responses the upstream response passes through untouched
+	result, err := provider.Completion(context.Background(), "llama2", "Hello", nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"model": "llama2", "response": "Hi!", "done": true}, result)
+}
+
+func TestNormalizeResponses_NonObject(t *testing.T) {
+	server := jsonServer(t, `["not", "an", "object"]`)
+
+	ollama := NewOllamaProvider(&config.Provider{Name: "local", BaseURL: server.URL, NormalizeResponses: true})
+	_, err := ollama.ChatCompletion(context.Background(), "llama2", nil, nil)
+	assert.ErrorContains(t, err, "expected a JSON object, got an array")
+
+	anthropic := NewAnthropicProvider(&config.Provider{Name: "anthropic", BaseURL: server.URL, NormalizeResponses: true})
+	_, err = anthropic.Completion(context.Background(), "claude-3-5-sonnet", "Hi", nil)
+	assert.ErrorContains(t, err, "expected a JSON object, got an array")
+
+	// Raw passthrough returns the array as the upstream sent it
+	openai := NewOpenAIProvider(&config.Provider{Name: "gateway", BaseURL: server.URL})
+	result, err := openai.ChatCompletion(context.Background(), "gpt-4", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"not", "an", "object"}, result)
+}
+
+func TestNormalizeResponses_UnexpectedShape(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider func(cfg *config.Provider) Provider
+		body     string
+		wantErr  string
+	}{
+		{
+			name:     "anthropic error with 200 OK",
+			provider: func(cfg *config.Provider) Provider { return NewAnthropicProvider(cfg) },
+			body:     `{"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}`,
+			wantErr:  "cannot normalize response without content: the provider reported an error: Overloaded",
+		},
+		{
+			name:     "anthropic content of the wrong type",
+			provider: func(cfg *config.Provider) Provider { return NewAnthropicProvider(cfg) },
+			body:     `{"content": "Hi!", "stop_reason": "end_turn"}`,
+			wantErr:  `field "content" is string`,
+		},
+		{
+			name:     "ollama without a message",
+			provider: func(cfg *config.Provider) Provider { return NewOllamaProvider(cfg) },
+			body:     `{"status": "loading", "model": "llama2"}`,
+			wantErr:  "cannot normalize response without message or response: got fields [model, status]",
+		},
+		{
+			name:     "ollama error",
+			provider: func(cfg *config.Provider) Provider { return NewOllamaProvider(cfg) },
+			body:     `{"error": "model requires more system memory"}`,
+			wantErr:  "the provider reported an error: model requires more system memory",
+		},
+		{
+			name: "vertex without candidates",
+			provider: func(cfg *config.Provider) Provider {
+				cfg.Project, cfg.Region, cfg.APIKey = "project", "us-central1", "token"
+				return NewVertexAIProvider(cfg)
+			},
+			body:    `{"usageMetadata": {"promptTokenCount": 3}}`,
+			wantErr: "cannot normalize response without candidates or promptFeedback: got fields [usageMetadata]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := jsonServer(t, tt.body)
+			p := tt.provider(&config.Provider{Name: "test", BaseURL: server.URL, NormalizeResponses: true})
+
+			messages := []map[string]interface{}{{"role": "user", "content": "Hello"}}
+			result, err := p.ChatCompletion(context.Background(), "model", messages, nil)
+			require.ErrorIs(t, err, ErrUnexpectedResponse)
+			assert.ErrorContains(t, err, tt.wantErr)
+			assert.Nil(t, result)
+		})
+	}
+}
+
+// openAIChatCompletionSchema is the subset of OpenAI's chat completion schema normalized
+// responses use: each object's required fields, then the optional ones. No others are allowed.
+var openAIChatCompletionSchema = map[string][2][]string{
+	"response": {{"id", "object", "created", "model", "choices"}, {"usage", "system_fingerprint", "service_tier"}},
+	"choice":   {{"index", "message", "finish_reason"}, {"logprobs"}},
+	"message":  {{"role", "content"}, {"refusal", "tool_calls", "function_call", "audio"}},
+	"usage": {
+		{"prompt_tokens", "completion_tokens", "total_tokens"},
+		{"prompt_tokens_details", "completion_tokens_details"},
+	},
+}
+
+// assertSchema checks that object has the required fields of kind, and no fields the schema lacks.
+func assertSchema(t *testing.T, kind string, object interface{}) {
+	t.Helper()
+	fields, ok := object.(map[string]interface{})
+	require.True(t, ok, "%s: expected an object, got %T", kind, object)
+
+	required, optional := openAIChatCompletionSchema[kind][0], openAIChatCompletionSchema[kind][1]
+	for _, field := range required {
+		assert.Contains(t, fields, field, "%s: missing required field", kind)
+	}
+	for field := range fields {
+		assert.True(t, slices.Contains(required, field) || slices.Contains(optional, field),
+			"%s: unexpected field %q", kind, field)
+	}
+}
+
+func assertValidChatCompletion(t *testing.T, result interface{}) {
+	t.Helper()
+	assertSchema(t, "response", result)
+	response := result.(map[string]interface{})
+	assertSchema(t, "usage", response["usage"])
+	for _, choice := range response["choices"].([]interface{}) {
+		assertSchema(t, "choice", choice)
+		assertSchema(t, "message", choice.(map[string]interface{})["message"])
+	}
+}
+
+func TestNormalizeResponses_Strict(t *testing.T) {
+	anthropicServer := jsonServer(t, `{
+		"id": "msg_01",
+		"type": "message",
+		"content": [{"type": "text", "text": "Hello"}],
+		"stop_reason": "end_turn",
+		"usage": {"input_tokens": 10, "output_tokens": 2, "cache_read_input_tokens": 8}
+	}`)
+	ollamaServer := jsonServer(t, `{
+		"model": "llama2",
+		"message": {"role": "assistant", "content": "Hi!"},
+		"done": true,
+		"total_duration": 5589157167,
+		"prompt_eval_count": 26,
+		"eval_count": 3
+	}`)
+
+	tests := []struct {
+		name     string
+		provider Provider
+	}{
+		{"anthropic", NewAnthropicProvider(&config.Provider{
+			Name: "anthropic", BaseURL: anthropicServer.URL, NormalizeResponses: true, NormalizeMode: "strict",
+		})},
+		{"ollama", NewOllamaProvider(&config.Provider{
+			Name: "local", BaseURL: ollamaServer.URL, NormalizeResponses: true, NormalizeMode: "strict",
+		})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.provider.ChatCompletion(context.Background(), "model", nil, nil)
+			require.NoError(t, err)
+			assertValidChatCompletion(t, result)
+		})
+	}
+}
+
+func TestNormalizeResponses_Lenient(t *testing.T) {
+	server := jsonServer(t, `{
+		"content": [{"type": "text", "text": "Hello"}],
+		"usage": {"input_tokens": 10, "output_tokens": 2}
+	}`)
+	provider := NewAnthropicProvider(&config.Provider{
+		Name: "anthropic", BaseURL: server.URL, NormalizeResponses: true, NormalizeMode: "lenient",
+	})
+
+	// Anthropic's own usage counters are kept, so the response isn't strictly valid
+	result, err := provider.ChatCompletion(context.Background(), "claude-3-5-sonnet", nil, nil)
+	require.NoError(t, err)
+	usage := result.(map[string]interface{})["usage"].(map[string]interface{})
+	assert.Equal(t, float64(10), usage["input_tokens"])
+	assert.Equal(t, 12, usage["total_tokens"])
+}
+
+func TestNormalizeResponses_ModelEcho(t *testing.T) {
+	anthropicServer := jsonServer(t, `{
+		"model": "claude-3-5-sonnet-20241022",
+		"content": [{"type": "text", "text": "Hello"}],
+		"stop_reason": "end_turn"
+	}`)
+	ollamaServer := jsonServer(t, `{"model": "llama2:7b", "message": {"content": "Hi!"}, "done": true}`)
+	vertexServer := jsonServer(t, `{
+		"candidates": [{"content": {"parts": [{"text": "Hi!"}]}, "finishReason": "STOP"}],
+		"modelVersion": "gemini-1.5-pro-002"
+	}`)
+
+	tests := []struct {
+		mode     string
+		expected []string
+	}{
+		{"", []string{"claude-3-5-sonnet", "llama2", "gemini-1.5-pro"}},
+		{"request", []string{"claude-3-5-sonnet", "llama2", "gemini-1.5-pro"}},
+		{"upstream", []string{"claude-3-5-sonnet-20241022", "llama2:7b", "gemini-1.5-pro-002"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			vertex := newVertexConfig(vertexServer.URL)
+			vertex.APIKey, vertex.NormalizeResponses, vertex.ModelEcho = "static-token", true, tt.mode
+			providers := []Provider{
+				NewAnthropicProvider(&config.Provider{
+					Name: "anthropic", BaseURL: anthropicServer.URL, NormalizeResponses: true, ModelEcho: tt.mode,
+				}),
+				NewOllamaProvider(&config.Provider{
+					Name: "local", BaseURL: ollamaServer.URL, NormalizeResponses: true, ModelEcho: tt.mode,
+				}),
+				NewVertexAIProvider(vertex),
+			}
+
+			for i, model := range []string{"claude-3-5-sonnet", "llama2", "gemini-1.5-pro"} {
+				result, err := providers[i].ChatCompletion(context.Background(), model, nil, nil)
+				require.NoError(t, err)
+				assertNormalized(t, result, "chat.completion", "chatcmpl-", tt.expected[i])
+			}
+		})
+	}
+}
+
+func TestEchoedModel(t *testing.T) {
+	// Upstreams that don't report a model fall back to the requested one
+	assert.Equal(t, "gpt-4", echoedModel("gpt-4", map[string]interface{}{}, "model", true))
+	assert.Equal(t, "gpt-4", echoedModel("gpt-4", []interface{}{}, "model", true))
+	assert.Equal(t, "gpt-4-0613", echoedModel("gpt-4", map[string]interface{}{"model": "gpt-4-0613"}, "model", true))
+	assert.Equal(t, "gpt-4", echoedModel("gpt-4", map[string]interface{}{"model": "gpt-4-0613"}, "model", false))
+}
+
+func TestNewResponseID(t *testing.T) {
+	assert.NotEqual(t, newResponseID(chatCompletionPrefix), newResponseID(chatCompletionPrefix))
+}
@@ -3,8 +3,14 @@
 // - No authentication required (local server)
 // - Uses "/api/chat" and "/api/generate" endpoints instead of "/chat/completions" and "/completions"
 // - Requires explicit "stream": false parameter to disable streaming
+// - Accepts "logprobs" and "top_logprobs" as top-level fields, but other sampling parameters under "options"
+// - Applies frequency and presence penalties like OpenAI, but doesn't bound them, so they're clamped to OpenAI's range
+// - Accepts a "suffix" on "/api/generate" for fill-in-the-middle completions with code models
+// - Answers 404 for models that haven't been pulled, reported as a ModelNotPulledError
 // - Typically runs on localhost:11434 by default
 // - Supports local LLM models without external API dependencies
+// - Discovers pulled models from "/api/tags" when none are configured
+// - Returns its own response format, converted to OpenAI's when normalize_responses is set
 package providers
 
 import (
@@ -14,10 +20,58 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"sync"
 
 	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/pkg/provider"
 )
 
+// ollamaParams maps the OpenAI request parameters Ollama accepts as top-level fields.
+var ollamaParams = map[string]string{
+	"logprobs":     "logprobs",
+	"top_logprobs": "top_logprobs",
+}
+
+// ollamaGenerateParams maps the OpenAI completion parameters only "/api/generate" accepts.
+var ollamaGenerateParams = map[string]string{
+	"suffix": "suffix",
+}
+
+// ollamaOptions maps the OpenAI request parameters Ollama supports onto its "options" fields.
+// Parameters in neither ollamaParams nor ollamaOptions are dropped.
+var ollamaOptions = map[string]string{
+	"temperature": "temperature",
+	"top_p":       "top_p",
+	"top_k":       "top_k",
+	"seed":        "seed",
+	"max_tokens":  "num_predict",
+}
+
+// ollamaPenalties are the OpenAI penalty parameters, set under the same names in Ollama's
+// "options". Both APIs subtract them from the logits of tokens already generated, scaled by count
+// for frequency_penalty and once for presence_penalty, so the values carry over unchanged. Only
+// OpenAI limits them, to [minPenalty, maxPenalty]; values beyond that are clamped rather than
+// letting Ollama degenerate output, and values that aren't numbers are dropped.
+var ollamaPenalties = []string{"frequency_penalty", "presence_penalty"}
+
+const (
+	// minPenalty and maxPenalty bound the penalties OpenAI accepts
+	minPenalty = -2.0
+	maxPenalty = 2.0
+)
+
+// ModelNotPulledError is returned when Ollama doesn't have a requested model because it hasn't been pulled.
+type ModelNotPulledError struct {
+	Model    string
+	Provider string
+}
+
+func (e *ModelNotPulledError) Error() string {
+	return fmt.Sprintf("model '%s' not available on Ollama provider '%s'; pull it with `ollama pull %s`",
+		e.Model, e.Provider, e.Model)
+}
+
 // OllamaProvider implements the Provider interface for Ollama local API.
 type OllamaProvider struct {
 	name     string
@@ -25,16 +79,40 @@ type OllamaProvider struct {
 	models   []string
 	priority int
 	client   *http.Client
+	// chunked streams request bodies instead of sending them with a Content-Length
+	chunked bool
+	// normalize converts responses into OpenAI's format, and strict drops fields OpenAI's lacks
+	normalize bool
+	strict    bool
+	// echoUpstream names the upstream's model in normalized responses instead of the requested one
+	echoUpstream bool
+	// Paths chat and text completions are sent to
+	chatPath     string
+	generatePath string
+
+	mu         sync.RWMutex
+	discovered []string
 }
 
 // NewOllamaProvider creates a new Ollama provider instance.
 func NewOllamaProvider(cfg *config.Provider) *OllamaProvider {
+	// Config.Validate rejects unknown modes, which are treated as lenient here
+	strict, _ := cfg.StrictNormalization()
+	echoUpstream, _ := cfg.EchoUpstreamModel()
+
 	return &OllamaProvider{
-		name:     cfg.Name,
-		baseURL:  cfg.BaseURL,
-		models:   cfg.Models,
-		priority: cfg.Priority,
-		client:   &http.Client{},
+		name:         cfg.Name,
+		baseURL:      cfg.BaseURL,
+		models:       cfg.Models,
+		priority:     cfg.Priority,
+		client:       newHTTPClient(cfg),
+		chunked:      cfg.ChunkedRequests,
+		normalize:    cfg.NormalizeResponses,
+		strict:       strict,
+		echoUpstream: echoUpstream,
+
+		chatPath:     endpointPath(cfg.ChatPath, "/api/chat"),
+		generatePath: endpointPath(cfg.CompletionPath, "/api/generate"),
 	}
 }
 
@@ -48,67 +126,304 @@ func (p *OllamaProvider) Priority() int {
 	return p.priority
 }
 
-// ListModels returns the list of available models for this provider.
+// Capabilities reports the operations Ollama requests are translated for. Ollama takes images in
+// a message's "images" field rather than content parts, and tools aren't forwarded.
+func (p *OllamaProvider) Capabilities() provider.Capabilities {
+	return provider.Capabilities{Chat: true, Completion: true, Streaming: true}
+}
+
+// ListModels returns the configured models, or the discovered models if none are configured.
 func (p *OllamaProvider) ListModels() []string {
-	return p.models
+	if len(p.models) > 0 {
+		return p.models
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.discovered
+}
+
+// DiscoverModels fetches the locally pulled models from Ollama's "/api/tags" endpoint.
+func (p *OllamaProvider) DiscoverModels(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/api/tags", http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := doRequest(p.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("model discovery failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	models := make([]string, 0, len(result.Models))
+	for _, model := range result.Models {
+		models = append(models, model.Name)
+	}
+
+	p.mu.Lock()
+	p.discovered = models
+	p.mu.Unlock()
+
+	return p.ListModels(), nil
 }
 
 // ChatCompletion performs a chat completion request with Ollama-specific parameters.
 func (p *OllamaProvider) ChatCompletion(
-	ctx context.Context, model string, messages []map[string]interface{},
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
 ) (interface{}, error) {
 	payload := map[string]interface{}{
 		"model":    model,
 		"messages": messages,
 		"stream":   false,
 	}
+	setOllamaParams(payload, params)
 
-	return p.makeRequest(ctx, "/api/chat", payload)
+	return p.complete(ctx, p.chatPath, model, payload, chatResponse)
 }
 
 // Completion performs a completion request using Ollama's generate endpoint.
-func (p *OllamaProvider) Completion(ctx context.Context, model, prompt string) (interface{}, error) {
+func (p *OllamaProvider) Completion(
+	ctx context.Context, model, prompt string, params map[string]interface{},
+) (interface{}, error) {
 	payload := map[string]interface{}{
 		"model":  model,
 		"prompt": prompt,
 		"stream": false,
 	}
+	setOllamaParams(payload, params)
+	pickParams(payload, params, ollamaGenerateParams)
 
-	return p.makeRequest(ctx, "/api/generate", payload)
+	return p.complete(ctx, p.generatePath, model, payload, textResponse)
 }
 
-func (p *OllamaProvider) makeRequest(ctx context.Context, endpoint string, payload interface{}) (interface{}, error) {
-	jsonData, err := json.Marshal(payload)
+// complete sends a non-streaming request, normalizing the response with build if configured to.
+func (p *OllamaProvider) complete(
+	ctx context.Context, endpoint, model string, payload interface{}, build responseBuilder,
+) (interface{}, error) {
+	result, err := p.makeRequest(ctx, endpoint, model, payload)
+	if err != nil || !p.normalize {
+		return result, err
+	}
+	response, err := normalizeOllamaResponse(echoedModel(model, result, "model", p.echoUpstream), result, build)
 	if err != nil {
 		return nil, err
 	}
+	if p.strict {
+		stripNonOpenAIFields(response)
+	}
+	return response, nil
+}
+
+// normalizeOllamaResponse converts an Ollama "/api/chat" or "/api/generate" response into an OpenAI-shaped one.
+func normalizeOllamaResponse(
+	model string, result interface{}, build responseBuilder,
+) (map[string]interface{}, error) {
+	var response struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+		Response        string `json:"response"`
+		DoneReason      string `json:"done_reason"`
+		PromptEvalCount int    `json:"prompt_eval_count"`
+		EvalCount       int    `json:"eval_count"`
+	}
+	// "message" is in chat responses and "response" in text completions
+	if err := checkResponseShape(result, "message", "response"); err != nil {
+		return nil, err
+	}
+	if err := decodeResponse(result, &response); err != nil {
+		return nil, err
+	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+endpoint, bytes.NewBuffer(jsonData))
+	text := response.Message.Content + response.Response
+	usage := openAIUsage(response.PromptEvalCount, response.EvalCount)
+	return build(model, text, ollamaFinishReason(response.DoneReason), usage), nil
+}
+
+// ollamaFinishReason maps an Ollama done_reason onto the OpenAI finish_reason vocabulary.
+func ollamaFinishReason(doneReason string) string {
+	if doneReason == "length" {
+		return "length"
+	}
+	return "stop"
+}
+
+// ChatCompletionStream performs a streaming chat completion request,
+// translating Ollama's newline-delimited JSON into OpenAI chat chunks.
+func (p *OllamaProvider) ChatCompletionStream(
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+) (<-chan StreamChunk, error) {
+	payload := map[string]interface{}{
+		"model":    model,
+		"messages": messages,
+		"stream":   true,
+	}
+	setOllamaParams(payload, params)
+
+	return p.makeStreamRequest(ctx, p.chatPath, model, payload, ollamaChunkConverter(model, chatChunk))
+}
+
+// CompletionStream performs a streaming completion request,
+// translating Ollama's newline-delimited JSON into OpenAI text completion chunks.
+func (p *OllamaProvider) CompletionStream(
+	ctx context.Context, model, prompt string, params map[string]interface{},
+) (<-chan StreamChunk, error) {
+	payload := map[string]interface{}{
+		"model":  model,
+		"prompt": prompt,
+		"stream": true,
+	}
+	setOllamaParams(payload, params)
+	pickParams(payload, params, ollamaGenerateParams)
+
+	return p.makeStreamRequest(ctx, p.generatePath, model, payload, ollamaChunkConverter(model, textChunk))
+}
+
+// setOllamaParams translates supported request parameters into top-level payload fields
+// and the payload's "options" object.
+func setOllamaParams(payload, params map[string]interface{}) {
+	pickParams(payload, params, ollamaParams)
+
+	options := make(map[string]interface{})
+	pickParams(options, params, ollamaOptions)
+	for _, name := range ollamaPenalties {
+		if penalty, ok := numberParam(params[name]); ok {
+			options[name] = min(max(penalty, minPenalty), maxPenalty)
+		}
+	}
+	if stop, ok := stopSequences(params); ok {
+		options["stop"] = stop
+	}
+	if len(options) > 0 {
+		payload["options"] = options
+	}
+}
+
+// numberParam returns value as a float64 if it's a number, as decoded from JSON or set in Go.
+func numberParam(value interface{}) (float64, bool) {
+	switch number := value.(type) {
+	case float64:
+		return number, true
+	case int:
+		return float64(number), true
+	default:
+		return 0, false
+	}
+}
+
+// ollamaChunkConverter maps Ollama stream lines onto OpenAI-shaped chunks.
+// "/api/chat" carries text in message.content, "/api/generate" in response.
+func ollamaChunkConverter(model string, build chunkBuilder) chunkConverter {
+	return func(data []byte) (interface{}, bool, error) {
+		var line struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			Response   string `json:"response"`
+			Done       bool   `json:"done"`
+			DoneReason string `json:"done_reason"`
+			Error      string `json:"error"`
+		}
+		if err := json.Unmarshal(data, &line); err != nil {
+			return nil, false, err
+		}
+		if line.Error != "" {
+			return nil, false, fmt.Errorf("ollama stream error: %s", line.Error)
+		}
+
+		text := line.Message.Content + line.Response
+		if line.Done {
+			return build(model, text, ollamaFinishReason(line.DoneReason)), true, nil
+		}
+		return build(model, text, nil), false, nil
+	}
+}
+
+func (p *OllamaProvider) newRequest(ctx context.Context, endpoint string, payload interface{}) (*http.Request, error) {
+	req, err := newJSONRequest(ctx, p.baseURL+endpoint, payload, p.chunked)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
 
-	resp, err := p.client.Do(req)
+func (p *OllamaProvider) makeStreamRequest(
+	ctx context.Context, endpoint, model string, payload interface{}, convert chunkConverter,
+) (<-chan StreamChunk, error) {
+	req, err := p.newRequest(ctx, endpoint, payload)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	req.Header.Set("Accept", contentTypeNDJSON)
+	resp, err := p.do(req, model)
+	if err != nil {
+		return nil, err
+	}
+	resp, err = checkStream(resp)
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	return streamNDJSON(ctx, resp.Body, convert), nil
+}
+
+func (p *OllamaProvider) makeRequest(
+	ctx context.Context, endpoint, model string, payload interface{},
+) (interface{}, error) {
+	req, err := p.newRequest(ctx, endpoint, payload)
+	if err != nil {
+		return nil, err
 	}
 
-	var result interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
+	resp, err := p.do(req, model)
+	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
+
+	return decodeJSONResponse(resp)
+}
+
+// do sends req, returning a ModelNotPulledError if Ollama answers that it doesn't have model.
+func (p *OllamaProvider) do(req *http.Request, model string) (*http.Response, error) {
+	resp, err := doRequest(p.client, req)
+	if err != nil || resp.StatusCode != http.StatusNotFound {
+		return resp, err
+	}
 
-	return result, nil
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	// Ollama reports missing models as {"error": "model \"x\" not found, try pulling it first"}
+	var ollamaErr struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &ollamaErr) == nil && strings.Contains(ollamaErr.Error, "not found") {
+		return nil, &ModelNotPulledError{Model: model, Provider: p.name}
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
 }
@@ -34,6 +34,7 @@ func TestOllamaProvider_ChatCompletion(t *testing.T) {
 		assert.Equal(t, "POST", r.Method)
 		assert.Equal(t, "/api/chat", r.URL.Path)
 		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "application/json", r.Header.Get("Accept"))
 
 		var req map[string]interface{}
 		err := json.NewDecoder(r.Body).Decode(&req)
@@ -75,7 +76,7 @@ func TestOllamaProvider_ChatCompletion(t *testing.T) {
 		{"role": "user", "content": "Hello"},
 	}
 
-	result, err := provider.ChatCompletion(context.Background(), "llama2", messages)
+	result, err := provider.ChatCompletion(context.Background(), "llama2", messages, nil)
 	require.NoError(t, err)
 	require.NotNil(t, result)
 
@@ -128,7 +129,7 @@ func TestOllamaProvider_Completion(t *testing.T) {
 		Models:  []string{"codellama"},
 	})
 
-	result, err := provider.Completion(context.Background(), "codellama", "def fibonacci(n):")
+	result, err := provider.Completion(context.Background(), "codellama", "def fibonacci(n):", nil)
 	require.NoError(t, err)
 	require.NotNil(t, result)
 
@@ -157,8 +158,252 @@ func TestOllamaProvider_Error(t *testing.T) {
 		{"role": "user", "content": "Hello"},
 	}
 
-	result, err := provider.ChatCompletion(context.Background(), "nonexistent", messages)
+	result, err := provider.ChatCompletion(context.Background(), "nonexistent", messages, nil)
 	assert.Error(t, err)
 	assert.Nil(t, result)
-	assert.Contains(t, err.Error(), "404")
+	assert.Contains(t, err.Error(), "ollama pull nonexistent")
+}
+
+func TestOllamaProvider_ModelNotPulled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/api/generate" {
+			// Other 404s, such as a wrong path, are reported as before
+			http.Error(w, "404 page not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		if _, err := w.Write([]byte(`{"error":"model \"llama3\" not found, try pulling it first"}`)); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewOllamaProvider(&config.Provider{Name: "local", BaseURL: server.URL})
+	messages := []map[string]interface{}{{"role": "user", "content": "Hello"}}
+
+	_, err := provider.ChatCompletion(context.Background(), "llama3", messages, nil)
+	var notPulled *ModelNotPulledError
+	require.ErrorAs(t, err, &notPulled)
+	assert.Equal(t, "model 'llama3' not available on Ollama provider 'local'; pull it with `ollama pull llama3`",
+		err.Error())
+
+	_, err = provider.ChatCompletionStream(context.Background(), "llama3", messages, nil)
+	require.ErrorAs(t, err, &notPulled)
+
+	_, err = provider.Completion(context.Background(), "llama3", "Hello", nil)
+	require.Error(t, err)
+	assert.NotErrorAs(t, err, &notPulled)
+	assert.Contains(t, err.Error(), "status 404: 404 page not found")
+}
+
+func TestOllamaProvider_ChatCompletionStream(t *testing.T) {
+	body := `{"model": "llama2", "message": {"role": "assistant", "content": "Hel"}, "done": false}
+{"model": "llama2", "message": {"role": "assistant", "content": "lo"}, "done": false}
+{"model": "llama2", "message": {"role": "assistant", "content": ""}, "done": true, "done_reason": "stop"}
+`
+	server := newStreamServer(t, "/api/chat", "application/x-ndjson", body)
+	defer server.Close()
+
+	provider := NewOllamaProvider(&config.Provider{Name: "local", BaseURL: server.URL})
+
+	messages := []map[string]interface{}{
+		{"role": "user", "content": "Hello"},
+	}
+
+	chunks, err := provider.ChatCompletionStream(context.Background(), "llama2", messages, nil)
+	require.NoError(t, err)
+
+	collected := collectChunks(t, chunks)
+	require.Len(t, collected, 4)
+	assert.Equal(t, "Hel", chunkText(t, collected[0]))
+	assert.Equal(t, "lo", chunkText(t, collected[1]))
+
+	final := collected[2].Data.(map[string]interface{})
+	choice := final["choices"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "stop", choice["finish_reason"])
+
+	assert.True(t, collected[3].Done)
+}
+
+func TestOllamaProvider_CompletionStream(t *testing.T) {
+	body := `{"model": "llama2", "response": " world", "done": false}
+{"model": "llama2", "response": "", "done": true, "done_reason": "length"}
+`
+	server := newStreamServer(t, "/api/generate", "application/x-ndjson", body)
+	defer server.Close()
+
+	provider := NewOllamaProvider(&config.Provider{Name: "local", BaseURL: server.URL})
+
+	chunks, err := provider.CompletionStream(context.Background(), "llama2", "Hello", nil)
+	require.NoError(t, err)
+
+	collected := collectChunks(t, chunks)
+	require.Len(t, collected, 3)
+
+	data := collected[0].Data.(map[string]interface{})
+	assert.Equal(t, "text_completion", data["object"])
+	assert.Equal(t, " world", chunkText(t, collected[0]))
+
+	final := collected[1].Data.(map[string]interface{})
+	choice := final["choices"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "length", choice["finish_reason"])
+
+	assert.True(t, collected[2].Done)
+}
+
+func TestOllamaProvider_ChatCompletion_Options(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		assert.NotContains(t, req, "temperature")
+		assert.NotContains(t, req, "user")
+		assert.Equal(t, true, req["logprobs"])
+		assert.Equal(t, float64(2), req["top_logprobs"])
+		assert.Equal(t, map[string]interface{}{
+			"temperature": 0.2,
+			"num_predict": float64(256),
+			"seed":        float64(42),
+		}, req["options"])
+
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write([]byte(`{"model": "llama2", "done": true}`)); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewOllamaProvider(&config.Provider{Name: "local", BaseURL: server.URL})
+
+	params := map[string]interface{}{
+		"temperature":  0.2,
+		"max_tokens":   256,
+		"seed":         42,
+		"user":         "dropped",
+		"logprobs":     true,
+		"top_logprobs": 2,
+	}
+	_, err := provider.ChatCompletion(context.Background(), "llama2", nil, params)
+	require.NoError(t, err)
+}
+
+func TestSetOllamaParams_Penalties(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  map[string]interface{}
+		options interface{}
+	}{
+		{"in range", map[string]interface{}{"frequency_penalty": 0.5, "presence_penalty": -1},
+			map[string]interface{}{"frequency_penalty": 0.5, "presence_penalty": float64(-1)}},
+		{"clamped", map[string]interface{}{"frequency_penalty": 3.5, "presence_penalty": -2.5},
+			map[string]interface{}{"frequency_penalty": 2.0, "presence_penalty": -2.0}},
+		{"with other options", map[string]interface{}{"temperature": 0.7, "presence_penalty": 0.0},
+			map[string]interface{}{"temperature": 0.7, "presence_penalty": 0.0}},
+		{"not numbers", map[string]interface{}{"frequency_penalty": "high", "presence_penalty": nil}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := map[string]interface{}{}
+			setOllamaParams(payload, tt.params)
+			if tt.options == nil {
+				assert.NotContains(t, payload, "options")
+				return
+			}
+			assert.Equal(t, tt.options, payload["options"])
+			assert.NotContains(t, payload, "frequency_penalty")
+			assert.NotContains(t, payload, "presence_penalty")
+		})
+	}
+}
+
+func TestOllamaProvider_Completion_Stop(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		assert.NotContains(t, req, "stop")
+		assert.Equal(t, map[string]interface{}{"stop": []interface{}{"\n"}}, req["options"])
+
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write([]byte(`{"model": "llama2", "response": "Hi", "done": true}`)); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewOllamaProvider(&config.Provider{Name: "local", BaseURL: server.URL})
+
+	_, err := provider.Completion(context.Background(), "llama2", "Hello", map[string]interface{}{"stop": "\n"})
+	require.NoError(t, err)
+}
+
+func TestOllamaProvider_Completion_Suffix(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/generate", r.URL.Path)
+
+		var req map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "def add(a, b):\n    ", req["prompt"])
+		assert.Equal(t, "\n\nprint(add(1, 2))", req["suffix"])
+
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write([]byte(`{"model": "codellama:code", "response": "return a + b", "done": true}`)); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewOllamaProvider(&config.Provider{Name: "local", BaseURL: server.URL})
+
+	params := map[string]interface{}{"suffix": "\n\nprint(add(1, 2))"}
+	_, err := provider.Completion(context.Background(), "codellama:code", "def add(a, b):\n    ", params)
+	require.NoError(t, err)
+}
+
+func TestOllamaProvider_PathOverrides(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"done": true}`))
+	}))
+	defer server.Close()
+
+	provider := NewOllamaProvider(&config.Provider{Name: "local", BaseURL: server.URL, CompletionPath: "/ollama/api/generate"})
+
+	_, err := provider.ChatCompletion(context.Background(), "llama2", []map[string]interface{}{{"role": "user", "content": "Hi"}}, nil)
+	require.NoError(t, err)
+	_, err = provider.Completion(context.Background(), "llama2", "Hi", nil)
+	require.NoError(t, err)
+
+	// Only the overridden path changes
+	assert.Equal(t, []string{"/api/chat", "/ollama/api/generate"}, paths)
+}
+
+func TestOllamaProvider_DiscoverModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GET", r.Method)
+		assert.Equal(t, "/api/tags", r.URL.Path)
+
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write([]byte(`{"models": [{"name": "llama2:latest"}, {"name": "mistral:7b"}]}`)); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewOllamaProvider(&config.Provider{Name: "ollama", BaseURL: server.URL})
+	assert.Implements(t, (*ModelDiscoverer)(nil), provider)
+
+	models, err := provider.DiscoverModels(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"llama2:latest", "mistral:7b"}, models)
+	assert.Equal(t, models, provider.ListModels())
+
+	configured := NewOllamaProvider(&config.Provider{Name: "ollama", BaseURL: server.URL, Models: []string{"llama2"}})
+	models, err = configured.DiscoverModels(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"llama2"}, models)
 }
@@ -5,14 +5,9 @@
 package providers
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
-	"strings"
 
 	"github.com/modelplex/modelplex/internal/config"
 )
@@ -21,27 +16,30 @@ import (
 type OpenAIProvider struct {
 	name     string
 	baseURL  string
-	apiKey   string
+	auth     Authenticator
 	models   []string
 	priority int
 	client   *http.Client
+	// chunked streams request bodies instead of sending them with a Content-Length
+	chunked bool
+	// Paths chat and text completions are sent to
+	chatPath       string
+	completionPath string
 }
 
 // NewOpenAIProvider creates a new OpenAI provider instance.
 func NewOpenAIProvider(cfg *config.Provider) *OpenAIProvider {
-	apiKey := cfg.APIKey
-	if strings.HasPrefix(apiKey, "${") && strings.HasSuffix(apiKey, "}") {
-		envVar := strings.TrimSuffix(strings.TrimPrefix(apiKey, "${"), "}")
-		apiKey = os.Getenv(envVar)
-	}
-
 	return &OpenAIProvider{
 		name:     cfg.Name,
 		baseURL:  cfg.BaseURL,
-		apiKey:   apiKey,
+		auth:     newAuthenticator(cfg, newBearerAuth),
 		models:   cfg.Models,
 		priority: cfg.Priority,
-		client:   &http.Client{},
+		client:   newHTTPClient(cfg),
+		chunked:  cfg.ChunkedRequests,
+
+		chatPath:       endpointPath(cfg.ChatPath, "/chat/completions"),
+		completionPath: endpointPath(cfg.CompletionPath, "/completions"),
 	}
 }
 
@@ -60,61 +58,104 @@ func (p *OpenAIProvider) ListModels() []string {
 	return p.models
 }
 
-// ChatCompletion performs a chat completion request.
+// ChatCompletion performs a chat completion request. Params are forwarded unchanged.
 func (p *OpenAIProvider) ChatCompletion(
-	ctx context.Context, model string, messages []map[string]interface{},
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
 ) (interface{}, error) {
-	payload := map[string]interface{}{
+	payload := mergeParams(params, map[string]interface{}{
 		"model":    model,
 		"messages": messages,
-	}
+	})
 
-	return p.makeRequest(ctx, "/chat/completions", payload)
+	return p.makeRequest(ctx, p.chatPath, payload)
 }
 
-// Completion performs a completion request.
-func (p *OpenAIProvider) Completion(ctx context.Context, model, prompt string) (interface{}, error) {
-	payload := map[string]interface{}{
+// Completion performs a completion request. Params are forwarded unchanged.
+func (p *OpenAIProvider) Completion(
+	ctx context.Context, model, prompt string, params map[string]interface{},
+) (interface{}, error) {
+	payload := mergeParams(params, map[string]interface{}{
 		"model":  model,
 		"prompt": prompt,
-	}
+	})
 
-	return p.makeRequest(ctx, "/completions", payload)
+	return p.makeRequest(ctx, p.completionPath, payload)
 }
 
-func (p *OpenAIProvider) makeRequest(ctx context.Context, endpoint string, payload interface{}) (interface{}, error) {
-	jsonData, err := json.Marshal(payload)
+// ChatCompletionStream performs a streaming chat completion request.
+func (p *OpenAIProvider) ChatCompletionStream(
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+) (<-chan StreamChunk, error) {
+	payload := mergeParams(params, map[string]interface{}{
+		"model":    model,
+		"messages": messages,
+		"stream":   true,
+	})
+
+	return p.makeStreamRequest(ctx, p.chatPath, payload)
+}
+
+// CompletionStream performs a streaming completion request.
+func (p *OpenAIProvider) CompletionStream(
+	ctx context.Context, model, prompt string, params map[string]interface{},
+) (<-chan StreamChunk, error) {
+	payload := mergeParams(params, map[string]interface{}{
+		"model":  model,
+		"prompt": prompt,
+		"stream": true,
+	})
+
+	return p.makeStreamRequest(ctx, p.completionPath, payload)
+}
+
+func (p *OpenAIProvider) newRequest(ctx context.Context, endpoint string, payload interface{}) (*http.Request, error) {
+	req, err := newJSONRequest(ctx, p.baseURL+endpoint, payload, p.chunked)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+endpoint, bytes.NewBuffer(jsonData))
-	if err != nil {
+	if err = p.authorize(req); err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	return req, nil
+}
+
+// authorize authenticates req with the current API key.
+func (p *OpenAIProvider) authorize(req *http.Request) error {
+	if err := p.auth.Apply(req); err != nil {
+		return fmt.Errorf("%s: %w", p.name, err)
+	}
+	return nil
+}
 
-	resp, err := p.client.Do(req)
+func (p *OpenAIProvider) makeStreamRequest(
+	ctx context.Context, endpoint string, payload interface{},
+) (<-chan StreamChunk, error) {
+	req, err := p.newRequest(ctx, endpoint, payload)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	resp, err := startStream(p.client, req, contentTypeSSE)
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	return streamSSE(ctx, resp.Body, passthroughChunk), nil
+}
+
+func (p *OpenAIProvider) makeRequest(ctx context.Context, endpoint string, payload interface{}) (interface{}, error) {
+	req, err := p.newRequest(ctx, endpoint, payload)
+	if err != nil {
+		return nil, err
 	}
 
-	var result interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
+	resp, err := doRequest(p.client, req)
+	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 
-	return result, nil
+	return decodeJSONResponse(resp)
 }
@@ -3,15 +3,23 @@ package providers
 import (
 	"context"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/pkg/provider"
 )
 
 func TestNewOpenAIProvider(t *testing.T) {
@@ -33,7 +41,7 @@ func TestNewOpenAIProvider(t *testing.T) {
 			expected: &OpenAIProvider{
 				name:     "openai",
 				baseURL:  "https://api.openai.com/v1",
-				apiKey:   "sk-test123",
+				auth:     bearerAuth{credentials: provider.StaticCredentials("sk-test123")},
 				models:   []string{"gpt-4"},
 				priority: 1,
 			},
@@ -53,7 +61,7 @@ func TestNewOpenAIProvider(t *testing.T) {
 			expected: &OpenAIProvider{
 				name:     "openai",
 				baseURL:  "https://api.openai.com/v1",
-				apiKey:   "sk-env-test456",
+				auth:     bearerAuth{credentials: provider.StaticCredentials("sk-env-test456")},
 				models:   []string{"gpt-4", "gpt-3.5-turbo"},
 				priority: 2,
 			},
@@ -79,7 +87,7 @@ func TestNewOpenAIProvider(t *testing.T) {
 
 			assert.Equal(t, tt.expected.name, provider.Name())
 			assert.Equal(t, tt.expected.baseURL, provider.baseURL)
-			assert.Equal(t, tt.expected.apiKey, provider.apiKey)
+			assert.Equal(t, tt.expected.auth, provider.auth)
 			assert.Equal(t, tt.expected.models, provider.ListModels())
 			assert.Equal(t, tt.expected.priority, provider.Priority())
 		})
@@ -92,6 +100,7 @@ func TestOpenAIProvider_ChatCompletion(t *testing.T) {
 		assert.Equal(t, "POST", r.Method)
 		assert.Equal(t, "/chat/completions", r.URL.Path)
 		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "application/json", r.Header.Get("Accept"))
 		assert.Equal(t, "Bearer test-key", r.Header.Get("Authorization"))
 
 		// Verify request body
@@ -142,7 +151,7 @@ func TestOpenAIProvider_ChatCompletion(t *testing.T) {
 		{"role": "user", "content": "Hello"},
 	}
 
-	result, err := provider.ChatCompletion(context.Background(), "gpt-4", messages)
+	result, err := provider.ChatCompletion(context.Background(), "gpt-4", messages, nil)
 	require.NoError(t, err)
 	require.NotNil(t, result)
 
@@ -174,7 +183,7 @@ func TestOpenAIProvider_ChatCompletion_Error(t *testing.T) {
 		{"role": "user", "content": "Hello"},
 	}
 
-	result, err := provider.ChatCompletion(context.Background(), "gpt-4", messages)
+	result, err := provider.ChatCompletion(context.Background(), "gpt-4", messages, nil)
 	assert.Error(t, err)
 	assert.Nil(t, result)
 	assert.Contains(t, err.Error(), "401")
@@ -220,7 +229,7 @@ func TestOpenAIProvider_Completion(t *testing.T) {
 		Models:  []string{"gpt-3.5-turbo-instruct"},
 	})
 
-	result, err := provider.Completion(context.Background(), "gpt-3.5-turbo-instruct", "Complete this: Hello")
+	result, err := provider.Completion(context.Background(), "gpt-3.5-turbo-instruct", "Complete this: Hello", nil)
 	require.NoError(t, err)
 	require.NotNil(t, result)
 
@@ -229,3 +238,243 @@ func TestOpenAIProvider_Completion(t *testing.T) {
 	assert.Equal(t, "cmpl-123", response["id"])
 	assert.Equal(t, "text_completion", response["object"])
 }
+
+func TestOpenAIProvider_ChatCompletionStream(t *testing.T) {
+	body := `data: {"object": "chat.completion.chunk", "choices": [{"index": 0, "delta": {"content": "Hel"}}]}
+
+data: {"object": "chat.completion.chunk", "choices": [{"index": 0, "delta": {"content": "lo"}}]}
+
+data: [DONE]
+
+`
+	server := newStreamServer(t, "/chat/completions", "text/event-stream", body)
+	defer server.Close()
+
+	provider := NewOpenAIProvider(&config.Provider{Name: "test", BaseURL: server.URL, APIKey: "test-key"})
+
+	messages := []map[string]interface{}{
+		{"role": "user", "content": "Hello"},
+	}
+
+	chunks, err := provider.ChatCompletionStream(context.Background(), "gpt-4", messages, nil)
+	require.NoError(t, err)
+
+	collected := collectChunks(t, chunks)
+	require.Len(t, collected, 3)
+	assert.Equal(t, "Hel", chunkText(t, collected[0]))
+	assert.Equal(t, "lo", chunkText(t, collected[1]))
+	assert.True(t, collected[2].Done)
+}
+
+func TestOpenAIProvider_CompletionStream(t *testing.T) {
+	body := `data: {"object": "text_completion", "choices": [{"index": 0, "text": " world"}]}
+
+data: [DONE]
+
+`
+	server := newStreamServer(t, "/completions", "text/event-stream", body)
+	defer server.Close()
+
+	provider := NewOpenAIProvider(&config.Provider{Name: "test", BaseURL: server.URL, APIKey: "test-key"})
+
+	chunks, err := provider.CompletionStream(context.Background(), "gpt-3.5-turbo-instruct", "Hello", nil)
+	require.NoError(t, err)
+
+	collected := collectChunks(t, chunks)
+	require.Len(t, collected, 2)
+	assert.Equal(t, " world", chunkText(t, collected[0]))
+	assert.True(t, collected[1].Done)
+}
+
+func TestOpenAIProvider_ChatCompletion_Params(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		assert.Equal(t, "gpt-4", req["model"])
+		assert.Equal(t, 0.2, req["temperature"])
+		assert.Equal(t, float64(100), req["max_tokens"])
+		// JSON mode is native to OpenAI, so response_format is passed through as sent
+		assert.Equal(t, map[string]interface{}{"type": "json_object"}, req["response_format"])
+		assert.Equal(t, []interface{}{"END"}, req["stop"])
+
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write([]byte(`{"id": "chatcmpl-123"}`)); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewOpenAIProvider(&config.Provider{Name: "test", BaseURL: server.URL})
+
+	params := map[string]interface{}{
+		"temperature":     0.2,
+		"max_tokens":      100,
+		"model":           "ignored",
+		"response_format": map[string]interface{}{"type": "json_object"},
+		"stop":            []interface{}{"END"},
+	}
+	_, err := provider.ChatCompletion(context.Background(), "gpt-4", nil, params)
+	require.NoError(t, err)
+}
+
+func TestOpenAIProvider_ChatCompletion_ChunkedBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// With chunked_requests, the payload is streamed to the upstream, so no Content-Length is known up front
+		assert.Equal(t, int64(-1), r.ContentLength)
+		assert.Equal(t, []string{"chunked"}, r.TransferEncoding)
+
+		var req map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "gpt-4", req["model"])
+
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write([]byte(`{"id": "chatcmpl-123"}`)); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewOpenAIProvider(&config.Provider{Name: "test", BaseURL: server.URL, ChunkedRequests: true})
+
+	messages := []map[string]interface{}{
+		{"role": "user", "content": strings.Repeat("a", 1<<20)},
+	}
+	_, err := provider.ChatCompletion(context.Background(), "gpt-4", messages, nil)
+	require.NoError(t, err)
+}
+
+func TestOpenAIProvider_ChatCompletion_ContentLength(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// By default, the payload is sent with its length, as gateways that reject chunked POSTs need
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(body)), r.ContentLength)
+		assert.Empty(t, r.TransferEncoding)
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id": "chatcmpl-123"}`))
+	}))
+	defer server.Close()
+
+	provider := NewOpenAIProvider(&config.Provider{Name: "test", BaseURL: server.URL})
+
+	messages := []map[string]interface{}{{"role": "user", "content": "Hello"}}
+	_, err := provider.ChatCompletion(context.Background(), "gpt-4", messages, nil)
+	require.NoError(t, err)
+}
+
+func TestOpenAIProvider_ChatCompletion_ChunkedBodyNotSent(t *testing.T) {
+	provider.RegisterCredentialSource("failing-test", func(*config.Provider) (provider.CredentialSource, error) {
+		return provider.NewCachedCredentials(func(context.Context) (string, error) {
+			return "", errors.New("vault unavailable")
+		}, 0), nil
+	})
+	p := NewOpenAIProvider(&config.Provider{
+		Name: "openai", BaseURL: "http://127.0.0.1:0", CredentialSource: "failing-test", ChunkedRequests: true,
+	})
+
+	// Requests that fail before they're sent don't leave their bodies' encoders behind
+	before := runtime.NumGoroutine()
+	for range 50 {
+		_, err := p.ChatCompletion(context.Background(), "gpt-4", nil, nil)
+		require.ErrorContains(t, err, "vault unavailable")
+	}
+	assert.Less(t, runtime.NumGoroutine(), before+50)
+}
+
+func TestOpenAIProvider_PathOverrides(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"object": "chat.completion"}`))
+	}))
+	defer server.Close()
+
+	// A gateway that serves the API under /v1 of a bare host
+	provider := NewOpenAIProvider(&config.Provider{
+		Name:           "gateway",
+		BaseURL:        server.URL,
+		ChatPath:       "/v1/chat/completions",
+		CompletionPath: "/v1/completions",
+	})
+
+	_, err := provider.ChatCompletion(context.Background(), "gpt-4", []map[string]interface{}{{"role": "user", "content": "Hi"}}, nil)
+	require.NoError(t, err)
+	_, err = provider.Completion(context.Background(), "gpt-4", "Hi", nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"/v1/chat/completions", "/v1/completions"}, paths)
+}
+
+func TestOpenAIProvider_TLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write([]byte(`{"object": "chat.completion"}`)); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caPath, caPEM, 0o600))
+
+	tests := []struct {
+		name    string
+		cfg     config.Provider
+		wantErr bool
+	}{
+		{name: "verifies by default", cfg: config.Provider{}, wantErr: true},
+		{name: "trusts ca_cert", cfg: config.Provider{CACert: caPath}},
+		{name: "insecure_skip_verify", cfg: config.Provider{InsecureSkipVerify: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Name = "vllm"
+			tt.cfg.BaseURL = server.URL
+			provider := NewOpenAIProvider(&tt.cfg)
+
+			_, err := provider.ChatCompletion(context.Background(), "llama-3", nil, nil)
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "certificate")
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestOpenAIProvider_RotatedCredentials(t *testing.T) {
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"object": "chat.completion"}`))
+	}))
+	defer server.Close()
+
+	key := 0
+	provider.RegisterCredentialSource("rotating-test", func(*config.Provider) (provider.CredentialSource, error) {
+		return provider.NewCachedCredentials(func(context.Context) (string, error) {
+			key++
+			return "sk-" + strconv.Itoa(key), nil
+		}, 0), nil
+	})
+	p := NewOpenAIProvider(&config.Provider{Name: "openai", BaseURL: server.URL, CredentialSource: "rotating-test"})
+
+	for range 2 {
+		_, err := p.ChatCompletion(context.Background(), "gpt-4", nil, nil)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"Bearer sk-1", "Bearer sk-2"}, keys)
+}
+
+func TestOpenAIProvider_CredentialsError(t *testing.T) {
+	p := NewOpenAIProvider(&config.Provider{Name: "openai", BaseURL: "http://127.0.0.1:0", CredentialSource: "missing"})
+
+	_, err := p.ChatCompletion(context.Background(), "gpt-4", nil, nil)
+	assert.ErrorContains(t, err, `openai: credential_source: unknown source "missing"`)
+}
@@ -0,0 +1,56 @@
+package providers
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/modelplex/modelplex/internal/config"
+)
+
+// probeDrainLimit is how much of a probe's response is read, so its connection can be reused
+const probeDrainLimit = 64 * 1024
+
+// Prober checks that a provider's upstream is reachable by requesting its base URL. Its client is
+// created once, so repeated probes, such as the retries of a degraded provider, reuse its
+// connections, and probes aren't counted in the provider's traffic metrics.
+type Prober struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewProber creates a prober for the provider cfg configures.
+func NewProber(cfg *config.Provider) *Prober {
+	baseURL := cfg.BaseURL
+	if baseURL == "" && cfg.Type == "groq" {
+		baseURL = defaultGroqBaseURL
+	}
+	if baseURL == "" && cfg.Type == "vertex" {
+		baseURL = vertexBaseURL(cfg.Region)
+	}
+	if baseURL == "" {
+		return &Prober{}
+	}
+	return &Prober{baseURL: baseURL, client: &http.Client{Transport: newProviderTransport(cfg)}}
+}
+
+// Probe requests the provider's base URL. Any HTTP response counts, including errors such as 401
+// or 404: only a failure to connect means the upstream is down. Providers without a base URL are
+// assumed reachable.
+func (p *Prober) Probe(ctx context.Context) error {
+	if p.baseURL == "" {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL, http.NoBody)
+	if err != nil {
+		return err
+	}
+
+	resp, err := doRequest(p.client, req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, probeDrainLimit))
+	return resp.Body.Close()
+}
@@ -0,0 +1,62 @@
+package providers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/monitoring"
+)
+
+func TestProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	prober := NewProber(&config.Provider{Type: "openai", BaseURL: server.URL})
+
+	// Any HTTP response means the upstream is reachable
+	require.NoError(t, prober.Probe(context.Background()))
+
+	server.Close()
+	assert.Error(t, prober.Probe(context.Background()))
+
+	// Nothing to probe without a base URL
+	assert.NoError(t, NewProber(&config.Provider{Type: "custom"}).Probe(context.Background()))
+}
+
+func TestProbe_ReusesConnections(t *testing.T) {
+	metrics := monitoring.NewMetrics()
+	ConfigureTransport(config.ConnectionPool{}, metrics)
+	defer ConfigureTransport(config.ConnectionPool{}, nil)
+
+	var connections atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	// A provider with its own timeouts gets its own transport, which each probe shares
+	prober := NewProber(&config.Provider{
+		Name: "local", Type: "openai", BaseURL: server.URL, ConnectTimeout: "5s",
+	})
+	for range 3 {
+		require.NoError(t, prober.Probe(context.Background()))
+	}
+	assert.Equal(t, int32(1), connections.Load())
+
+	// Probes aren't provider traffic
+	assert.NotContains(t, metrics.Snapshot(), "local")
+}
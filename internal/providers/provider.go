@@ -2,21 +2,135 @@ package providers
 
 import (
 	"context"
+	"log/slog"
+	"strings"
 
 	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/pkg/provider"
 )
 
 // Provider defines the interface that all AI providers must implement.
-type Provider interface {
-	Name() string
-	Priority() int
-	ChatCompletion(ctx context.Context, model string, messages []map[string]interface{}) (interface{}, error)
-	Completion(ctx context.Context, model, prompt string) (interface{}, error)
-	ListModels() []string
+type Provider = provider.Provider
+
+// ModelDiscoverer is implemented by providers that can query their upstream for available models.
+type ModelDiscoverer interface {
+	DiscoverModels(ctx context.Context) ([]string, error)
+}
+
+// CapabilitiesOf returns the capabilities p, or the provider it wraps, reports as a
+// provider.CapabilityReporter. Providers that don't report theirs are assumed to support everything.
+func CapabilitiesOf(p Provider) provider.Capabilities {
+	for current := p; ; {
+		if reporter, ok := current.(provider.CapabilityReporter); ok {
+			return reporter.Capabilities()
+		}
+		wrapped, ok := current.(wrapper)
+		if !ok {
+			return provider.Capabilities{
+				Chat: true, Completion: true, Embeddings: true, Streaming: true, Tools: true, Vision: true,
+			}
+		}
+		current = wrapped.unwrap()
+	}
+}
+
+// newCredentials returns the source of the API key cfg authenticates with. If it can't be created,
+// which config validation reports, every request fails with the reason instead.
+func newCredentials(cfg *config.Provider) provider.CredentialSource {
+	source, err := cfg.Credentials()
+	if err != nil {
+		return failedCredentials{err: err}
+	}
+	return source
+}
+
+// failedCredentials is the credential source of a provider whose configured source couldn't be created.
+type failedCredentials struct {
+	err error
+}
+
+func (c failedCredentials) Key(context.Context) (string, error) { return "", c.err }
+
+// mergeParams returns a new payload with params copied in, then fields set on top.
+// Fields always win so request parameters can't override what the provider itself sets.
+func mergeParams(params, fields map[string]interface{}) map[string]interface{} {
+	payload := make(map[string]interface{}, len(params)+len(fields))
+	for key, value := range params {
+		payload[key] = value
+	}
+	for key, value := range fields {
+		payload[key] = value
+	}
+	return payload
 }
 
-// NewProvider creates a new provider instance based on the configuration type.
+// pickParams copies the params named in keys into dst, renaming them via the key's value.
+func pickParams(dst, params map[string]interface{}, keys map[string]string) {
+	for from, to := range keys {
+		if value, ok := params[from]; ok {
+			dst[to] = value
+		}
+	}
+}
+
+// stopSequences returns the OpenAI "stop" parameter, which may be a single string or a list of
+// them, as the list other APIs require. ok is false if no stop sequences were set.
+func stopSequences(params map[string]interface{}) (stop []interface{}, ok bool) {
+	switch value := params["stop"].(type) {
+	case string:
+		return []interface{}{value}, true
+	case []interface{}:
+		return value, len(value) > 0
+	case []string:
+		for _, sequence := range value {
+			stop = append(stop, sequence)
+		}
+		return stop, len(stop) > 0
+	}
+	return nil, false
+}
+
+// extractText returns the text of a message's content, which is either a string or, as in vision
+// requests, a list of parts, of which the text parts are joined with newlines. Other parts, such
+// as images, are left out, as is content of any other type.
+func extractText(content interface{}) string {
+	switch content := content.(type) {
+	case string:
+		return content
+	case []interface{}:
+		texts := make([]string, 0, len(content))
+		for _, part := range content {
+			part, _ := part.(map[string]interface{})
+			if text, ok := part["text"].(string); ok && (part["type"] == "text" || part["type"] == nil) {
+				texts = append(texts, text)
+			}
+		}
+		return strings.Join(texts, "\n")
+	default:
+		return ""
+	}
+}
+
+// NewProvider creates a new provider instance based on the configuration type, wrapped in its transforms.
+// Types registered with provider.RegisterProvider take precedence over the built-in ones.
 func NewProvider(cfg *config.Provider) Provider {
+	p := newProvider(cfg)
+	if p == nil {
+		return nil
+	}
+	if cfg.InsecureSkipVerify {
+		slog.Warn("TLS certificate verification is disabled", "provider", cfg.Name)
+	}
+	p = withSystemPrompt(withBodyRetry(p, cfg), cfg.SystemPrompt, cfg.SystemPromptMode)
+	p = withJSONMode(withTransforms(p, cfg.Transforms), cfg.EmulateJSONMode)
+	return withMessageLimit(p, cfg.MaxMessages)
+}
+
+func newProvider(cfg *config.Provider) Provider {
+	if factory, ok := provider.Lookup(cfg.Type); ok {
+		return factory(cfg)
+	}
+
 	switch cfg.Type {
 	case "openai":
 		return NewOpenAIProvider(cfg)
@@ -24,6 +138,12 @@ func NewProvider(cfg *config.Provider) Provider {
 		return NewAnthropicProvider(cfg)
 	case "ollama":
 		return NewOllamaProvider(cfg)
+	case "groq":
+		return NewGroqProvider(cfg)
+	case "vertex":
+		return NewVertexAIProvider(cfg)
+	case "template":
+		return NewTemplateProvider(cfg)
 	default:
 		return nil
 	}
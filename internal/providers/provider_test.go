@@ -0,0 +1,48 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/pkg/provider"
+)
+
+func TestNewProvider_Registered(t *testing.T) {
+	assert.Nil(t, NewProvider(&config.Provider{Name: "custom", Type: "registered-test"}))
+
+	provider.RegisterProvider("registered-test", func(cfg *config.Provider) Provider {
+		return NewOpenAIProvider(cfg)
+	})
+
+	p := NewProvider(&config.Provider{Name: "custom", Type: "registered-test"})
+	require.NotNil(t, p)
+	assert.Equal(t, "custom", p.Name())
+}
+
+func TestCapabilitiesOf(t *testing.T) {
+	// Providers that don't report their capabilities, as registered ones may not, support everything
+	all := CapabilitiesOf(struct{ Provider }{})
+	assert.Equal(t, provider.Capabilities{
+		Chat: true, Completion: true, Embeddings: true, Streaming: true, Tools: true, Vision: true,
+	}, all)
+
+	// Wrappers report the capabilities of the provider they wrap
+	groq := NewProvider(&config.Provider{Name: "groq", Type: "groq"})
+	assert.Equal(t, CapabilitiesOf(groq), CapabilitiesOf(&transformProvider{Provider: groq}))
+	assert.False(t, CapabilitiesOf(&transformProvider{Provider: groq}).Embeddings)
+}
+
+func TestExtractText(t *testing.T) {
+	assert.Equal(t, "Hello", extractText("Hello"))
+	assert.Equal(t, "Describe this\nBriefly", extractText([]interface{}{
+		map[string]interface{}{"type": "text", "text": "Describe this"},
+		map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "data:image/png;base64,"}},
+		"not a part",
+		map[string]interface{}{"type": "text", "text": "Briefly"},
+	}))
+	assert.Empty(t, extractText(nil))
+	assert.Empty(t, extractText(42.0))
+}
@@ -0,0 +1,379 @@
+package providers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/monitoring"
+	"github.com/modelplex/modelplex/pkg/provider"
+)
+
+const (
+	// Content types for upstream responses, sent as the request's Accept header
+	contentTypeJSON   = "application/json"
+	contentTypeSSE    = "text/event-stream"
+	contentTypeNDJSON = "application/x-ndjson"
+
+	// Connection pool defaults, sized for a gateway sending many concurrent requests to few upstreams
+	defaultMaxIdleConnsPerHost = 100
+	defaultIdleConnTimeout     = 90 * time.Second
+	// dialKeepAlive matches the keep-alive of Go's default transport, for dialers replacing its own
+	dialKeepAlive = 30 * time.Second
+
+	// nonJSONPreviewLength is how much of a non-JSON response body is quoted in its error
+	nonJSONPreviewLength = 200
+)
+
+// StatusError is returned when a provider answers a request with an unsuccessful status. Err, if
+// set, is a more specific error describing the response, which Error reports instead.
+type StatusError struct {
+	StatusCode int
+	Body       string
+	Err        error
+}
+
+func (e *StatusError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// ErrEmptyResponse is returned when a provider answers a request with no body at all.
+var ErrEmptyResponse = errors.New("empty response from provider")
+
+// ErrNonJSONResponse is returned when a provider answers a request with something other than JSON,
+// such as a gateway's HTML error page or a login redirect.
+var ErrNonJSONResponse = errors.New("non-JSON response from provider")
+
+var (
+	transportMu sync.Mutex
+	// sharedTransport pools connections for every provider client without its own TLS settings
+	sharedTransport = newTransport(config.ConnectionPool{})
+	// transportMetrics records the bytes each provider client sends and receives; nil records nothing
+	transportMetrics *monitoring.Metrics
+)
+
+// ConfigureTransport applies connection pool settings to provider clients created afterwards,
+// which record the bytes they send and receive to metrics. Existing clients keep their
+// connections until they are replaced, e.g. on config reload.
+func ConfigureTransport(pool config.ConnectionPool, metrics *monitoring.Metrics) {
+	transportMu.Lock()
+	defer transportMu.Unlock()
+	sharedTransport = newTransport(pool)
+	transportMetrics = metrics
+}
+
+// newTransport returns a transport with Go's defaults, except for the connection pool.
+// Go keeps only 2 idle connections per host, so under load most requests would otherwise
+// open a new connection to the upstream.
+func newTransport(pool config.ConnectionPool) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 0 // no overall limit; MaxIdleConnsPerHost bounds each upstream
+	transport.MaxIdleConnsPerHost = pool.MaxIdleConns
+	if transport.MaxIdleConnsPerHost <= 0 {
+		transport.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+	transport.MaxConnsPerHost = pool.MaxConnsPerHost
+	transport.IdleConnTimeout = pool.IdleConnTimeout.Duration
+	if transport.IdleConnTimeout <= 0 {
+		transport.IdleConnTimeout = defaultIdleConnTimeout
+	}
+	return transport
+}
+
+// newHTTPClient returns the client for requests to a provider, applying its TLS settings and
+// timeouts, and recording the bytes it sends and receives.
+func newHTTPClient(cfg *config.Provider) *http.Client {
+	transportMu.Lock()
+	metrics := transportMetrics
+	transportMu.Unlock()
+
+	var roundTripper http.RoundTripper = &countingTransport{
+		base:     &gzipTransport{base: newProviderTransport(cfg)},
+		provider: cfg.Name,
+		metrics:  metrics,
+	}
+	// Validated when the config is loaded
+	if header, _ := cfg.SessionHeaderName(); header != "" {
+		roundTripper = &sessionTransport{base: roundTripper, provider: cfg.Name, header: header}
+	}
+	return &http.Client{Transport: roundTripper}
+}
+
+// newProviderTransport returns the transport for connections to a provider: the shared transport,
+// or a clone of it with the provider's TLS settings and timeouts. Config validation rejects an
+// unusable ca_cert; should loading it fail here anyway, the transport keeps Go's defaults, which
+// still verify certificates.
+func newProviderTransport(cfg *config.Provider) *http.Transport {
+	transportMu.Lock()
+	transport := sharedTransport
+	transportMu.Unlock()
+
+	tlsConfig, err := cfg.TLSConfig()
+	if err != nil {
+		slog.Error("Invalid provider TLS settings, using defaults", "provider", cfg.Name, "error", err)
+	}
+
+	// Validated when the config is loaded
+	connectTimeout, responseHeaderTimeout, _ := cfg.Timeouts()
+	if tlsConfig != nil || connectTimeout > 0 || responseHeaderTimeout > 0 {
+		// Connections with different TLS settings or timeouts can't share a pool
+		transport = transport.Clone()
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	if connectTimeout > 0 {
+		dialer := &net.Dialer{Timeout: connectTimeout, KeepAlive: dialKeepAlive}
+		transport.DialContext = dialer.DialContext
+		transport.TLSHandshakeTimeout = connectTimeout
+	}
+	if responseHeaderTimeout > 0 {
+		transport.ResponseHeaderTimeout = responseHeaderTimeout
+	}
+	return transport
+}
+
+// countingTransport records the request and response body bytes of each request to metrics.
+// Bodies are counted as they're read and recorded once when closed, so streams are counted in full.
+type countingTransport struct {
+	base     http.RoundTripper
+	provider string
+	metrics  *monitoring.Metrics
+}
+
+// RoundTrip sends req, counting the bytes of its body and of the response's.
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.metrics == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		// RoundTrippers mustn't modify the caller's request, so count the body of a shallow copy
+		req = req.Clone(req.Context())
+		req.Body = &countingBody{ReadCloser: req.Body, record: func(n int64) {
+			t.metrics.RecordBytes(t.provider, n, 0)
+		}}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	resp.Body = &countingBody{ReadCloser: resp.Body, record: func(n int64) {
+		t.metrics.RecordBytes(t.provider, 0, n)
+	}}
+	return resp, nil
+}
+
+// countingBody counts the bytes read from a body and passes the total to record when it's closed.
+type countingBody struct {
+	io.ReadCloser
+	n      int64
+	record func(n int64)
+	once   sync.Once
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	b.once.Do(func() { b.record(b.n) })
+	return b.ReadCloser.Close()
+}
+
+// gzipTransport decompresses gzip-encoded responses that the base transport passed through.
+// Go's transport only decompresses responses when it added "Accept-Encoding" itself,
+// but some gateways gzip every response whatever the request asked for.
+type gzipTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip sends req, replacing a still gzip-encoded response body with its decompressed content.
+func (t *gzipTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.Uncompressed || !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return resp, err
+	}
+
+	resp.Body = &gzipBody{body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// gzipBody decompresses body, reading the gzip header lazily so streams aren't held up
+// waiting for their first bytes, and empty bodies read as empty.
+type gzipBody struct {
+	body   io.ReadCloser
+	reader *gzip.Reader
+	err    error
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	if b.reader == nil && b.err == nil {
+		b.reader, b.err = gzip.NewReader(b.body)
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.reader.Read(p)
+}
+
+func (b *gzipBody) Close() error {
+	return b.body.Close()
+}
+
+// endpointPath returns the configured path override, or the provider's standard path if there's none.
+func endpointPath(configured, standard string) string {
+	if configured == "" {
+		return standard
+	}
+	return configured
+}
+
+// newJSONRequest builds a POST request whose body is payload encoded as JSON, sent with a
+// Content-Length. If chunked, the body is instead encoded straight into the request stream as
+// it's sent, so large payloads (e.g. base64 images) aren't held in memory twice; the request
+// then has no Content-Length and is sent with chunked transfer encoding.
+func newJSONRequest(ctx context.Context, url string, payload interface{}, chunked bool) (*http.Request, error) {
+	var body io.Reader
+	if chunked {
+		body = &jsonBody{payload: payload}
+	} else {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if chunked {
+		req.GetBody = func() (io.ReadCloser, error) {
+			return &jsonBody{payload: payload}, nil
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Some OpenAI-compatible gateways stream by default unless JSON is asked for explicitly
+	req.Header.Set("Accept", contentTypeJSON)
+
+	return req, nil
+}
+
+// decodeJSONResponse reads resp's body and decodes it as JSON. Responses other than 200 OK,
+// and empty bodies (which some upstreams send with 200 or 204 on error), are returned as errors.
+// Either way, resp's headers are recorded for the request's client.
+func decodeJSONResponse(resp *http.Response) (interface{}, error) {
+	if resp.Request != nil {
+		provider.RecordResponseHeaders(resp.Request.Context(), resp.Header)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	succeeded := resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNoContent
+	if succeeded && len(bytes.TrimSpace(body)) == 0 {
+		return nil, fmt.Errorf("%w (status %d)", ErrEmptyResponse, resp.StatusCode)
+	}
+	if err := checkJSON(resp, body); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var result interface{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// checkJSON returns an ErrNonJSONResponse if resp's Content-Type says body isn't JSON, and it isn't,
+// wrapped in a StatusError if resp's status is unsuccessful. Plain text is let through: it's what
+// upstreams that don't label their JSON are sniffed as, and their short plain text error messages
+// read best verbatim.
+func checkJSON(resp *http.Response, body []byte) error {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mediaType == contentTypeJSON || strings.HasSuffix(mediaType, "+json") ||
+		mediaType == "text/plain" || json.Valid(body) {
+		return nil
+	}
+	err = fmt.Errorf("%w: status %d with content type %s, check the provider's base_url and authentication: %q",
+		ErrNonJSONResponse, resp.StatusCode, mediaType, provider.Preview(body, nonJSONPreviewLength))
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return &StatusError{StatusCode: resp.StatusCode, Body: string(body), Err: err}
+	}
+	return err
+}
+
+// jsonBody is a request body that yields payload as JSON, encoding it on demand. Encoding only
+// starts with the first Read, so a request that's built but never sent, such as one whose
+// authentication fails, holds nothing up. Encoding errors are returned from Read, which fails
+// the request.
+type jsonBody struct {
+	payload interface{}
+
+	mu     sync.Mutex
+	reader *io.PipeReader
+	closed bool
+}
+
+func (b *jsonBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return 0, io.ErrClosedPipe
+	}
+	if b.reader == nil {
+		var writer *io.PipeWriter
+		b.reader, writer = io.Pipe()
+		go func() {
+			writer.CloseWithError(json.NewEncoder(writer).Encode(b.payload))
+		}()
+	}
+	reader := b.reader
+	b.mu.Unlock()
+	return reader.Read(p)
+}
+
+// Close stops encoding, if it has started.
+func (b *jsonBody) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	if b.reader != nil {
+		return b.reader.Close()
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package providers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/monitoring"
+	"github.com/modelplex/modelplex/pkg/provider"
+)
+
+// newGzipServer returns a server that gzips body whatever the request's Accept-Encoding, like some gateways do.
+func newGzipServer(t *testing.T, contentType, body string) *httptest.Server {
+	t.Helper()
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, err := zw.Write([]byte(body))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Encoding", "gzip")
+		if _, err := w.Write(compressed.Bytes()); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	}))
+}
+
+// uncompressedClient doesn't ask for compression, so Go's transport leaves gzip responses encoded.
+func uncompressedClient() *http.Client {
+	return &http.Client{Transport: &gzipTransport{base: &http.Transport{DisableCompression: true}}}
+}
+
+func TestGzipTransport(t *testing.T) {
+	server := newGzipServer(t, "application/json", `{"object": "chat.completion"}`)
+	defer server.Close()
+
+	resp, err := uncompressedClient().Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"object": "chat.completion"}`, string(body))
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	assert.True(t, resp.Uncompressed)
+}
+
+func TestGzipTransport_EmptyBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	resp, err := uncompressedClient().Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Empty(t, body)
+}
+
+func TestOpenAIProvider_GzipResponses(t *testing.T) {
+	server := newGzipServer(t, "text/event-stream", `data: {"object": "chat.completion.chunk", "choices": [{"index": 0, "delta": {"content": "Hi"}}]}
+
+data: [DONE]
+
+`)
+	defer server.Close()
+
+	provider := NewOpenAIProvider(&config.Provider{Name: "gateway", BaseURL: server.URL})
+	provider.client = uncompressedClient()
+
+	chunks, err := provider.ChatCompletionStream(context.Background(), "gpt-4", nil, nil)
+	require.NoError(t, err)
+
+	collected := collectChunks(t, chunks)
+	require.Len(t, collected, 2)
+	assert.Equal(t, "Hi", chunkText(t, collected[0]))
+	assert.True(t, collected[1].Done)
+}
+
+func TestConfigureTransport(t *testing.T) {
+	defer ConfigureTransport(config.ConnectionPool{}, nil)
+
+	transportOf := func(client *http.Client) *http.Transport {
+		return client.Transport.(*countingTransport).base.(*gzipTransport).base.(*http.Transport)
+	}
+
+	// Defaults keep far more idle connections per host than Go's 2
+	transport := transportOf(newHTTPClient(&config.Provider{Name: "openai"}))
+	assert.Equal(t, 100, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 0, transport.MaxConnsPerHost)
+	assert.Equal(t, 90*time.Second, transport.IdleConnTimeout)
+
+	ConfigureTransport(config.ConnectionPool{
+		MaxIdleConns:    32,
+		MaxConnsPerHost: 64,
+		IdleConnTimeout: config.Duration{Duration: time.Minute},
+	}, nil)
+
+	first := transportOf(newHTTPClient(&config.Provider{Name: "openai"}))
+	second := transportOf(newHTTPClient(&config.Provider{Name: "groq"}))
+	assert.Same(t, first, second, "providers share one connection pool")
+	assert.Equal(t, 32, first.MaxIdleConnsPerHost)
+	assert.Equal(t, 64, first.MaxConnsPerHost)
+	assert.Equal(t, time.Minute, first.IdleConnTimeout)
+
+	// Providers with their own TLS settings get their own pool with the same limits
+	insecure := transportOf(newHTTPClient(&config.Provider{Name: "vllm", InsecureSkipVerify: true}))
+	assert.NotSame(t, first, insecure)
+	assert.Equal(t, 32, insecure.MaxIdleConnsPerHost)
+}
+
+func TestNewHTTPClient_ConnectTimeout(t *testing.T) {
+	// A server that accepts connections but never completes the TLS handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	client := newHTTPClient(&config.Provider{Name: "stalled", ConnectTimeout: "100ms"})
+	req, err := http.NewRequest("GET", "https://"+listener.Addr().String(), http.NoBody)
+	require.NoError(t, err)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "TLS handshake timeout")
+	assert.Less(t, time.Since(start), 5*time.Second, "Go's default handshake timeout is 10s")
+}
+
+func TestNewHTTPClient_ResponseHeaderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := newHTTPClient(&config.Provider{Name: "slow", ResponseHeaderTimeout: "100ms"})
+	req, err := http.NewRequest("GET", server.URL, http.NoBody)
+	require.NoError(t, err)
+
+	resp, err := client.Do(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timeout awaiting response headers")
+}
+
+func TestCountingTransport(t *testing.T) {
+	const response = `{"id": "chatcmpl-123", "choices": []}`
+	var received int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		received = len(body)
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	metrics := monitoring.NewMetrics()
+	ConfigureTransport(config.ConnectionPool{}, metrics)
+	defer ConfigureTransport(config.ConnectionPool{}, nil)
+
+	provider := NewOpenAIProvider(&config.Provider{Name: "openai", BaseURL: server.URL})
+	for range 2 {
+		_, err := provider.ChatCompletion(context.Background(), "gpt-4", []map[string]interface{}{
+			{"role": "user", "content": "Hello"},
+		}, nil)
+		require.NoError(t, err)
+	}
+
+	require.NotZero(t, received)
+	assert.Equal(t, map[string]monitoring.ProviderMetrics{
+		"openai": {BytesSent: int64(2 * received), BytesReceived: int64(2 * len(response))},
+	}, metrics.Snapshot())
+}
+
+func TestMakeRequest_EmptyBody(t *testing.T) {
+	for _, status := range []int{http.StatusOK, http.StatusNoContent} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+
+			provider := NewOpenAIProvider(&config.Provider{Name: "openai", BaseURL: server.URL})
+			messages := []map[string]interface{}{{"role": "user", "content": "Hello"}}
+
+			_, err := provider.ChatCompletion(context.Background(), "gpt-4", messages, nil)
+			require.ErrorIs(t, err, ErrEmptyResponse)
+			assert.Contains(t, err.Error(), "empty response from provider")
+		})
+	}
+}
+
+func TestMakeRequest_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	provider := NewOllamaProvider(&config.Provider{Name: "local", BaseURL: server.URL})
+
+	// An error status is reported as such, even without a body explaining it
+	_, err := provider.Completion(context.Background(), "llama2", "Hello", nil)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrEmptyResponse)
+	assert.Contains(t, err.Error(), "status 502")
+}
+
+func TestMakeRequest_NonJSON(t *testing.T) {
+	status := http.StatusOK
+	page := "<html><body>Sign in to continue" + strings.Repeat(".", 500) + "</body></html>"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(page))
+	}))
+	defer server.Close()
+
+	provider := NewOpenAIProvider(&config.Provider{Name: "openai", BaseURL: server.URL})
+	messages := []map[string]interface{}{{"role": "user", "content": "Hello"}}
+
+	// A login page is reported as what it is, quoting only the start of it
+	_, err := provider.ChatCompletion(context.Background(), "gpt-4", messages, nil)
+	require.ErrorIs(t, err, ErrNonJSONResponse)
+	assert.Contains(t, err.Error(), "status 200 with content type text/html")
+	assert.Contains(t, err.Error(), "check the provider's base_url and authentication")
+	assert.Contains(t, err.Error(), "Sign in to continue")
+	assert.NotContains(t, err.Error(), "</html>")
+
+	// And so is a gateway's error page, whether or not the request streams
+	status = http.StatusBadGateway
+	_, err = provider.ChatCompletion(context.Background(), "gpt-4", messages, nil)
+	require.ErrorIs(t, err, ErrNonJSONResponse)
+	assert.Contains(t, err.Error(), "status 502")
+	_, err = provider.ChatCompletionStream(context.Background(), "gpt-4", messages, nil)
+	require.ErrorIs(t, err, ErrNonJSONResponse)
+}
+
+func TestMakeRequest_UnlabeledJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write([]byte(`{"object": "text_completion"}`))
+	}))
+	defer server.Close()
+
+	// JSON is decoded whatever it's labeled as
+	provider := NewOpenAIProvider(&config.Provider{Name: "openai", BaseURL: server.URL})
+	result, err := provider.Completion(context.Background(), "gpt-4", "Hello", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "text_completion", result.(map[string]interface{})["object"])
+}
+
+func TestMakeRequest_RecordsResponseHeaders(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-Ratelimit-Remaining-Requests", "0")
+		w.Header().Set("Retry-After", "20")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"object": "text_completion"}`))
+	}))
+	defer server.Close()
+
+	p := NewOpenAIProvider(&config.Provider{Name: "openai", BaseURL: server.URL})
+
+	ctx, headers := provider.WithResponseHeaders(context.Background())
+	_, err := p.Completion(ctx, "gpt-4", "Hello", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "0", headers.Header().Get("X-Ratelimit-Remaining-Requests"))
+
+	// Error responses are recorded too, since that's when clients most need to back off
+	status = http.StatusTooManyRequests
+	ctx, headers = provider.WithResponseHeaders(context.Background())
+	_, err = p.CompletionStream(ctx, "gpt-4", "Hello", nil)
+	require.Error(t, err)
+	assert.Equal(t, "20", headers.Header().Get("Retry-After"))
+}
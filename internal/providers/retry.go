@@ -0,0 +1,122 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/pkg/provider"
+)
+
+// withBodyRetry wraps p to retry requests whose responses contain any of the strings in
+// cfg.RetryOnBodyContains, if there are any.
+func withBodyRetry(p Provider, cfg *config.Provider) Provider {
+	if len(cfg.RetryOnBodyContains) == 0 {
+		return p
+	}
+	retries, backoff, err := cfg.RetryPolicy()
+	if err != nil {
+		slog.Warn("Ignoring invalid retry policy", "provider", cfg.Name, "error", err)
+		retries, backoff = provider.DefaultMaxRetries, provider.DefaultRetryBackoff
+	}
+
+	matches := make([]string, 0, len(cfg.RetryOnBodyContains))
+	for _, match := range cfg.RetryOnBodyContains {
+		matches = append(matches, strings.ToLower(match))
+	}
+	wrapped := &retryProvider{Provider: p, matches: matches, retries: retries, backoff: backoff}
+	if discoverer, ok := p.(ModelDiscoverer); ok {
+		return &discoveringRetryProvider{retryProvider: wrapped, discoverer: discoverer}
+	}
+	return wrapped
+}
+
+// retryProvider retries non-streaming requests whose response, or error, contains one of matches,
+// for upstreams that answer with transient errors like "model is loading", even with 200 OK.
+// Streams are relayed as they arrive, so they aren't retried.
+type retryProvider struct {
+	Provider
+	matches []string
+	retries int
+	backoff time.Duration
+}
+
+// ChatCompletion performs a chat completion request, retrying transient failures.
+func (p *retryProvider) ChatCompletion(
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+) (interface{}, error) {
+	return p.retry(ctx, model, func() (interface{}, error) {
+		return p.Provider.ChatCompletion(ctx, model, messages, params)
+	})
+}
+
+// Completion performs a completion request, retrying transient failures.
+func (p *retryProvider) Completion(
+	ctx context.Context, model, prompt string, params map[string]interface{},
+) (interface{}, error) {
+	return p.retry(ctx, model, func() (interface{}, error) {
+		return p.Provider.Completion(ctx, model, prompt, params)
+	})
+}
+
+// retry calls send until its response doesn't match, the retries run out, or ctx is done,
+// waiting twice as long before each retry as before the last. The last response is returned.
+func (p *retryProvider) retry(
+	ctx context.Context, model string, send func() (interface{}, error),
+) (interface{}, error) {
+	backoff := p.backoff
+	for attempt := 0; ; attempt++ {
+		result, err := send()
+		match, ok := p.match(result, err)
+		if !ok || attempt == p.retries {
+			return result, err
+		}
+
+		slog.Debug("Retrying request with a transient failure", "provider", p.Name(), "model", model,
+			"match", match, "attempt", attempt+1, "backoff", backoff)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// match returns the first of p.matches found in the error, or the response if there's none.
+func (p *retryProvider) match(result interface{}, err error) (string, bool) {
+	var body string
+	if err != nil {
+		body = err.Error()
+	} else {
+		encoded, encodeErr := json.Marshal(result)
+		if encodeErr != nil {
+			return "", false
+		}
+		body = string(encoded)
+	}
+
+	body = strings.ToLower(body)
+	for _, match := range p.matches {
+		if strings.Contains(body, match) {
+			return match, true
+		}
+	}
+	return "", false
+}
+
+// discoveringRetryProvider is a retryProvider whose provider also discovers models.
+type discoveringRetryProvider struct {
+	*retryProvider
+	discoverer ModelDiscoverer
+}
+
+// DiscoverModels discovers models from the wrapped provider.
+func (p *discoveringRetryProvider) DiscoverModels(ctx context.Context) ([]string, error) {
+	return p.discoverer.DiscoverModels(ctx)
+}
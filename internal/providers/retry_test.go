@@ -0,0 +1,113 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+)
+
+// flakyProvider answers each request with the next of its responses, repeating the last
+type flakyProvider struct {
+	recordingProvider
+	responses []flakyResponse
+	calls     int
+}
+
+type flakyResponse struct {
+	result interface{}
+	err    error
+}
+
+func (p *flakyProvider) next() (interface{}, error) {
+	response := p.responses[min(p.calls, len(p.responses)-1)]
+	p.calls++
+	return response.result, response.err
+}
+
+func (p *flakyProvider) ChatCompletion(
+	context.Context, string, []map[string]interface{}, map[string]interface{},
+) (interface{}, error) {
+	return p.next()
+}
+
+func (p *flakyProvider) Completion(context.Context, string, string, map[string]interface{}) (interface{}, error) {
+	return p.next()
+}
+
+var errModelLoading = errors.New(`API request failed with status 503: {"error":"Model is loading"}`)
+
+func TestWithBodyRetry_Disabled(t *testing.T) {
+	inner := &recordingProvider{}
+	assert.Same(t, inner, withBodyRetry(inner, &config.Provider{MaxRetries: 3}))
+}
+
+func TestWithBodyRetry_Error(t *testing.T) {
+	inner := &flakyProvider{responses: []flakyResponse{
+		{err: errModelLoading},
+		{result: map[string]interface{}{"id": "chatcmpl-123"}},
+	}}
+	p := withBodyRetry(inner, &config.Provider{RetryOnBodyContains: []string{"loading"}, RetryBackoff: "1ms"})
+
+	result, err := p.ChatCompletion(context.Background(), "llama2", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"id": "chatcmpl-123"}, result)
+	assert.Equal(t, 2, inner.calls)
+}
+
+func TestWithBodyRetry_SuccessfulResponse(t *testing.T) {
+	// Some gateways report transient errors with 200 OK
+	overloaded := map[string]interface{}{"error": map[string]interface{}{"message": "Server overloaded"}}
+	inner := &flakyProvider{responses: []flakyResponse{
+		{result: overloaded},
+		{result: map[string]interface{}{"id": "cmpl-123"}},
+	}}
+	p := withBodyRetry(inner, &config.Provider{RetryOnBodyContains: []string{"overloaded"}, RetryBackoff: "1ms"})
+
+	result, err := p.Completion(context.Background(), "llama2", "Hello", nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"id": "cmpl-123"}, result)
+	assert.Equal(t, 2, inner.calls)
+}
+
+func TestWithBodyRetry_Exhausted(t *testing.T) {
+	inner := &flakyProvider{responses: []flakyResponse{{err: errModelLoading}}}
+	p := withBodyRetry(inner, &config.Provider{
+		RetryOnBodyContains: []string{"loading"}, MaxRetries: 3, RetryBackoff: "1ms",
+	})
+
+	_, err := p.ChatCompletion(context.Background(), "llama2", nil, nil)
+	assert.ErrorIs(t, err, errModelLoading)
+	assert.Equal(t, 4, inner.calls)
+}
+
+func TestWithBodyRetry_NoMatch(t *testing.T) {
+	failed := errors.New("API request failed with status 400: invalid model")
+	inner := &flakyProvider{responses: []flakyResponse{{err: failed}}}
+	p := withBodyRetry(inner, &config.Provider{RetryOnBodyContains: []string{"loading"}, RetryBackoff: "1ms"})
+
+	_, err := p.ChatCompletion(context.Background(), "llama2", nil, nil)
+	assert.ErrorIs(t, err, failed)
+	assert.Equal(t, 1, inner.calls)
+}
+
+func TestWithBodyRetry_Canceled(t *testing.T) {
+	inner := &flakyProvider{responses: []flakyResponse{{err: errModelLoading}}}
+	p := withBodyRetry(inner, &config.Provider{RetryOnBodyContains: []string{"loading"}, RetryBackoff: "1h"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := p.ChatCompletion(ctx, "llama2", nil, nil)
+	assert.ErrorIs(t, err, errModelLoading)
+	assert.Equal(t, 1, inner.calls)
+}
+
+func TestWithBodyRetry_KeepsDiscovery(t *testing.T) {
+	cfg := &config.Provider{Name: "groq", RetryOnBodyContains: []string{"overloaded"}}
+	assert.Implements(t, (*ModelDiscoverer)(nil), withBodyRetry(NewGroqProvider(cfg), cfg))
+}
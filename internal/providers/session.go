@@ -0,0 +1,59 @@
+package providers
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+// sessionTransport implements session stickiness for stateful gateways: it captures the session
+// header from the first successful response and sends it with every later request to the same host.
+// Other hosts, such as the token endpoint Vertex AI requests are authenticated with, never see it.
+type sessionTransport struct {
+	base     http.RoundTripper
+	provider string
+	header   string
+
+	mu    sync.Mutex
+	host  string
+	value string
+}
+
+// RoundTrip sends req with the captured session header, capturing it first if it hasn't been yet.
+func (t *sessionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if value := t.session(req.URL.Host); value != "" {
+		// RoundTrippers mustn't modify the caller's request
+		req = req.Clone(req.Context())
+		req.Header.Set(t.header, value)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		t.capture(req.URL.Host, resp.Header.Get(t.header))
+	}
+	return resp, err
+}
+
+// session returns the captured session header value to send to host, or "" if there's none.
+func (t *sessionTransport) session(host string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if host != t.host {
+		return ""
+	}
+	return t.value
+}
+
+// capture keeps value as the session header of host, unless one was already captured.
+func (t *sessionTransport) capture(host, value string) {
+	if value == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.value != "" {
+		return
+	}
+	t.host, t.value = host, value
+	slog.Debug("Captured provider session header", "provider", t.provider, "header", t.header)
+}
@@ -0,0 +1,95 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+)
+
+func TestSessionHeader(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests int
+		received []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		n := requests
+		received = append(received, r.Header.Get("X-Session-Id"))
+		mu.Unlock()
+
+		switch n {
+		case 1:
+			// Failed responses don't start a session
+			w.Header().Set("X-Session-Id", "rejected")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		case 2:
+			w.Header().Set("X-Session-Id", "first")
+		default:
+			// Only the first session is kept
+			w.Header().Set("X-Session-Id", "second")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "Hi"}}]}`))
+	}))
+	defer server.Close()
+
+	p := NewOpenAIProvider(&config.Provider{
+		Name:          "gateway",
+		BaseURL:       server.URL,
+		Models:        []string{"gpt-4"},
+		SessionHeader: "x-session-id",
+	})
+	messages := []map[string]interface{}{{"role": "user", "content": "Hello"}}
+
+	_, err := p.ChatCompletion(context.Background(), "gpt-4", messages, nil)
+	require.Error(t, err)
+	for range 3 {
+		_, err = p.ChatCompletion(context.Background(), "gpt-4", messages, nil)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{"", "", "first", "first"}, received)
+}
+
+func TestSessionHeader_OtherHosts(t *testing.T) {
+	transport := &sessionTransport{
+		base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			header := http.Header{}
+			header.Set("X-Session-Id", "abc")
+			return &http.Response{StatusCode: http.StatusOK, Header: header, Request: req}, nil
+		}),
+		header: "X-Session-Id",
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "https://gateway.example.com/v1/chat/completions", nil)
+			_, err := transport.RoundTrip(req)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, "abc", transport.session("gateway.example.com"))
+	assert.Empty(t, transport.session("oauth2.googleapis.com"))
+}
+
+// roundTripFunc adapts a function to http.RoundTripper.
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,185 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/modelplex/modelplex/pkg/provider"
+)
+
+const (
+	// Chunk object types for OpenAI-compatible streaming responses
+	chatChunkObject = "chat.completion.chunk"
+	textChunkObject = "text_completion"
+
+	// Streamed lines start with a buffer of initialLineBuffer bytes, growing as needed up to
+	// maxLineSize, enough for Ollama's final line carrying the whole context, or large tool call arguments
+	initialLineBuffer = 64 * 1024
+	maxLineSize       = 16 * 1024 * 1024
+)
+
+var (
+	sseDataPrefix = []byte("data:")
+	sseDone       = []byte("[DONE]")
+)
+
+// StreamChunk is a single incremental piece of a streamed completion.
+type StreamChunk = provider.StreamChunk
+
+// chunkBuilder builds an OpenAI-shaped chunk carrying a text delta.
+type chunkBuilder func(model, text string, finishReason interface{}) map[string]interface{}
+
+// chunkConverter turns one upstream event payload into an OpenAI-shaped chunk.
+// It returns a nil chunk for events that carry no content, and done=true once the upstream is finished.
+type chunkConverter func(data []byte) (chunk interface{}, done bool, err error)
+
+// startStream sends req, accepting the given streaming content type, and returns the response
+// once the upstream has accepted the stream.
+func startStream(client *http.Client, req *http.Request, accept string) (*http.Response, error) {
+	req.Header.Set("Accept", accept)
+	resp, err := doRequest(client, req)
+	if err != nil {
+		return nil, err
+	}
+	return checkStream(resp)
+}
+
+// checkStream records the headers of a stream's response, and returns an error, having closed the
+// body, if the stream failed to start.
+func checkStream(resp *http.Response) (*http.Response, error) {
+	if resp.Request != nil {
+		provider.RecordResponseHeaders(resp.Request.Context(), resp.Header)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if err := checkJSON(resp, body); err != nil {
+			return nil, err
+		}
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	return resp, nil
+}
+
+// streamSSE reads a server-sent events body and emits converted chunks on the returned channel.
+func streamSSE(ctx context.Context, body io.ReadCloser, convert chunkConverter) <-chan StreamChunk {
+	return streamNDJSON(ctx, body, func(line []byte) (interface{}, bool, error) {
+		if !bytes.HasPrefix(line, sseDataPrefix) {
+			return nil, false, nil
+		}
+		data := bytes.TrimSpace(bytes.TrimPrefix(line, sseDataPrefix))
+		if bytes.Equal(data, sseDone) {
+			return nil, true, nil
+		}
+		return convert(data)
+	})
+}
+
+// streamNDJSON reads a newline-delimited body and emits converted chunks on the returned channel.
+// The channel is closed after a Done or Err chunk, or when ctx is cancelled. Cancelling ctx,
+// e.g. when the client disconnects, also closes body, so the upstream stops generating tokens
+// nobody will read even if it's between events.
+func streamNDJSON(ctx context.Context, body io.ReadCloser, convert chunkConverter) <-chan StreamChunk {
+	chunks := make(chan StreamChunk)
+
+	go func() {
+		defer close(chunks)
+		defer body.Close()
+		stop := context.AfterFunc(ctx, func() {
+			body.Close()
+		})
+		defer stop()
+
+		send := func(chunk StreamChunk) bool {
+			select {
+			case chunks <- chunk:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 0, initialLineBuffer), maxLineSize)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+
+			data, done, err := convert(line)
+			if err != nil {
+				send(StreamChunk{Err: err})
+				return
+			}
+			if data != nil && !send(StreamChunk{Data: data}) {
+				return
+			}
+			if done {
+				send(StreamChunk{Done: true})
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			send(StreamChunk{Err: err})
+			return
+		}
+		send(StreamChunk{Done: true})
+	}()
+
+	return chunks
+}
+
+// passthroughChunk decodes an upstream chunk that is already in OpenAI format.
+func passthroughChunk(data []byte) (interface{}, bool, error) {
+	var chunk interface{}
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return nil, false, err
+	}
+	return chunk, false, nil
+}
+
+// chatChunk builds an OpenAI "chat.completion.chunk" carrying a content delta.
+func chatChunk(model, content string, finishReason interface{}) map[string]interface{} {
+	delta := map[string]interface{}{}
+	if content != "" {
+		delta["content"] = content
+	}
+
+	return map[string]interface{}{
+		"object":  chatChunkObject,
+		"created": time.Now().Unix(),
+		"model":   model,
+		"choices": []interface{}{
+			map[string]interface{}{
+				"index":         0,
+				"delta":         delta,
+				"finish_reason": finishReason,
+			},
+		},
+	}
+}
+
+// textChunk builds an OpenAI "text_completion" chunk carrying a text delta.
+func textChunk(model, text string, finishReason interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"object":  textChunkObject,
+		"created": time.Now().Unix(),
+		"model":   model,
+		"choices": []interface{}{
+			map[string]interface{}{
+				"index":         0,
+				"text":          text,
+				"finish_reason": finishReason,
+			},
+		},
+	}
+}
@@ -0,0 +1,150 @@
+package providers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+)
+
+// collectChunks drains a stream channel, failing the test if it doesn't finish promptly
+func collectChunks(t *testing.T, chunks <-chan StreamChunk) []StreamChunk {
+	t.Helper()
+
+	var collected []StreamChunk
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				return collected
+			}
+			collected = append(collected, chunk)
+		case <-timeout:
+			t.Fatal("timed out waiting for stream to finish")
+			return nil
+		}
+	}
+}
+
+// chunkText extracts the delta content or text from an OpenAI-shaped chunk
+func chunkText(t *testing.T, chunk StreamChunk) string {
+	t.Helper()
+
+	data, ok := chunk.Data.(map[string]interface{})
+	require.True(t, ok)
+	choice := data["choices"].([]interface{})[0].(map[string]interface{})
+	if delta, ok := choice["delta"].(map[string]interface{}); ok {
+		content, _ := delta["content"].(string)
+		return content
+	}
+	text, _ := choice["text"].(string)
+	return text
+}
+
+// newStreamServer serves body with the given content type, recording the decoded request
+func newStreamServer(t *testing.T, path, contentType, body string) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, path, r.URL.Path)
+		assert.Equal(t, contentType, r.Header.Get("Accept"))
+
+		reqBody, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(reqBody), `"stream":true`)
+
+		w.Header().Set("Content-Type", contentType)
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	}))
+}
+
+func TestStreamSSE_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		if _, err := w.Write([]byte(`{"error": "slow down"}`)); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewOpenAIProvider(&config.Provider{Name: "test", BaseURL: server.URL})
+
+	chunks, err := provider.ChatCompletionStream(context.Background(), "gpt-4", nil, nil)
+	assert.Error(t, err)
+	assert.Nil(t, chunks)
+	assert.Contains(t, err.Error(), "429")
+}
+
+func TestStreamSSE_MalformedChunk(t *testing.T) {
+	server := newStreamServer(t, "/chat/completions", "text/event-stream", "data: {not json}\n\n")
+	defer server.Close()
+
+	provider := NewOpenAIProvider(&config.Provider{Name: "test", BaseURL: server.URL})
+
+	chunks, err := provider.ChatCompletionStream(context.Background(), "gpt-4", nil, nil)
+	require.NoError(t, err)
+
+	collected := collectChunks(t, chunks)
+	require.Len(t, collected, 1)
+	assert.Error(t, collected[0].Err)
+}
+
+func TestStreamSSE_ContextCancelled(t *testing.T) {
+	body := strings.Repeat(`data: {"object": "chat.completion.chunk"}`+"\n\n", 10)
+	server := newStreamServer(t, "/chat/completions", "text/event-stream", body)
+	defer server.Close()
+
+	provider := NewOpenAIProvider(&config.Provider{Name: "test", BaseURL: server.URL})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	chunks, err := provider.ChatCompletionStream(ctx, "gpt-4", nil, nil)
+	require.NoError(t, err)
+
+	<-chunks
+	cancel()
+
+	// The channel must close rather than block forever once the consumer goes away
+	collectChunks(t, chunks)
+}
+
+func TestStreamNDJSON_CancelClosesBody(t *testing.T) {
+	// An upstream that has sent one event and is still generating the next
+	reader, writer := io.Pipe()
+	go func() {
+		_, _ = writer.Write([]byte(`{"response": "Hel", "done": false}` + "\n"))
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	chunks := streamNDJSON(ctx, reader, ollamaChunkConverter("llama2", textChunk))
+
+	first := <-chunks
+	require.NoError(t, first.Err)
+	cancel()
+
+	collectChunks(t, chunks)
+	_, err := writer.Write([]byte("more"))
+	assert.ErrorIs(t, err, io.ErrClosedPipe, "the upstream body should be closed")
+}
+
+func TestStreamSSE_LongLine(t *testing.T) {
+	// Lines beyond bufio.Scanner's default 64KB limit, such as a large tool call's arguments
+	arguments := strings.Repeat("a", 200*1024)
+	body := "data: {\"choices\":[{\"delta\":{\"content\":\"" + arguments + "\"}}]}\n\ndata: [DONE]\n\n"
+
+	chunks := collectChunks(t, streamSSE(context.Background(), io.NopCloser(strings.NewReader(body)), passthroughChunk))
+	require.Len(t, chunks, 2)
+	require.NoError(t, chunks[0].Err)
+	assert.Equal(t, arguments, chunkText(t, chunks[0]))
+	assert.True(t, chunks[1].Done)
+}
@@ -0,0 +1,52 @@
+package providers
+
+import (
+	"github.com/modelplex/modelplex/pkg/provider"
+)
+
+// ApplySystemPrompt returns messages with prompt added as a system message, as mode says: see
+// provider.SystemPromptFill, SystemPromptPrepend and SystemPromptOverride. An empty mode is
+// SystemPromptFill. messages is returned unchanged if prompt is empty, and is never modified.
+func ApplySystemPrompt(messages []map[string]interface{}, prompt, mode string) []map[string]interface{} {
+	if prompt == "" || messages == nil {
+		return messages
+	}
+
+	hasSystem := false
+	for _, msg := range messages {
+		if msg["role"] == "system" {
+			hasSystem = true
+			break
+		}
+	}
+	if hasSystem && (mode == "" || mode == provider.SystemPromptFill) {
+		return messages
+	}
+
+	applied := make([]map[string]interface{}, 0, len(messages)+1)
+	applied = append(applied, map[string]interface{}{"role": "system", "content": prompt})
+	for _, msg := range messages {
+		if mode == provider.SystemPromptOverride && msg["role"] == "system" {
+			continue
+		}
+		applied = append(applied, msg)
+	}
+	return applied
+}
+
+// withSystemPrompt wraps p so its chat requests get prompt as a system message, as mode says.
+func withSystemPrompt(p Provider, prompt, mode string) Provider {
+	if prompt == "" {
+		return p
+	}
+	return wrapTransforms(p, []transform{systemPrompt{prompt: prompt, mode: mode}})
+}
+
+type systemPrompt struct {
+	prompt string
+	mode   string
+}
+
+func (t systemPrompt) request(c *call) { c.messages = ApplySystemPrompt(c.messages, t.prompt, t.mode) }
+
+func (systemPrompt) response(result interface{}) interface{} { return result }
@@ -0,0 +1,90 @@
+package providers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/pkg/provider"
+)
+
+func TestApplySystemPrompt(t *testing.T) {
+	configured := map[string]interface{}{"role": "system", "content": "Answer in English."}
+	client := map[string]interface{}{"role": "system", "content": "Be brief."}
+	user := map[string]interface{}{"role": "user", "content": "Hello"}
+
+	tests := []struct {
+		name     string
+		mode     string
+		messages []map[string]interface{}
+		want     []map[string]interface{}
+	}{
+		{
+			name:     "fill without system message",
+			mode:     provider.SystemPromptFill,
+			messages: []map[string]interface{}{user},
+			want:     []map[string]interface{}{configured, user},
+		},
+		{
+			name:     "fill keeps client system message",
+			mode:     provider.SystemPromptFill,
+			messages: []map[string]interface{}{client, user},
+			want:     []map[string]interface{}{client, user},
+		},
+		{
+			name:     "default mode fills",
+			messages: []map[string]interface{}{client, user},
+			want:     []map[string]interface{}{client, user},
+		},
+		{
+			name:     "prepend",
+			mode:     provider.SystemPromptPrepend,
+			messages: []map[string]interface{}{client, user},
+			want:     []map[string]interface{}{configured, client, user},
+		},
+		{
+			name:     "prepend without system message",
+			mode:     provider.SystemPromptPrepend,
+			messages: []map[string]interface{}{user},
+			want:     []map[string]interface{}{configured, user},
+		},
+		{
+			name:     "override",
+			mode:     provider.SystemPromptOverride,
+			messages: []map[string]interface{}{client, user, client},
+			want:     []map[string]interface{}{configured, user},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := append([]map[string]interface{}(nil), tt.messages...)
+			assert.Equal(t, tt.want, ApplySystemPrompt(tt.messages, "Answer in English.", tt.mode))
+			assert.Equal(t, original, tt.messages)
+		})
+	}
+}
+
+func TestWithSystemPrompt(t *testing.T) {
+	inner := &recordingProvider{}
+	assert.Same(t, inner, withSystemPrompt(inner, "", provider.SystemPromptOverride))
+
+	p := withSystemPrompt(inner, "Answer in English.", provider.SystemPromptOverride)
+	messages := []map[string]interface{}{
+		{"role": "system", "content": "Be brief."},
+		{"role": "user", "content": "Hello"},
+	}
+	_, err := p.ChatCompletion(context.Background(), "gpt-4", messages, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{"role": "system", "content": "Answer in English."},
+		{"role": "user", "content": "Hello"},
+	}, inner.messages)
+
+	// Text completions have no messages to add it to, and pass through unchanged
+	_, err = p.Completion(context.Background(), "gpt-4", "Hello", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello", inner.prompt)
+}
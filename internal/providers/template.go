@@ -0,0 +1,178 @@
+// Package providers implements AI provider abstractions.
+// TemplateProvider reaches APIs that aren't OpenAI-compatible without code, as an escape hatch:
+// - Renders each request body with the configured request_template
+// - Renders the completion text from the response with response_template, returned as OpenAI's format
+// - Sends chat and text completions to chat_path, and text completions to completion_path if it's set
+// - Authenticates with a bearer token if it has an API key
+// - Doesn't stream, since streaming formats vary too much to template
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/pkg/provider"
+)
+
+// templateFinishReason is the finish reason of template responses, which can't tell why generation stopped
+const templateFinishReason = "stop"
+
+// templateRequest is what a request template renders the request body from.
+// Messages is nil for text completions, and Prompt empty for chat completions.
+type templateRequest struct {
+	Model    string
+	Messages []map[string]interface{}
+	Prompt   string
+	Params   map[string]interface{}
+}
+
+// TemplateProvider implements the Provider interface for APIs described by templates.
+type TemplateProvider struct {
+	name     string
+	baseURL  string
+	auth     Authenticator
+	models   []string
+	priority int
+	client   *http.Client
+	// chunked streams request bodies instead of sending them with a Content-Length
+	chunked bool
+	// Paths chat and text completions are sent to
+	chatPath       string
+	completionPath string
+	// request renders request bodies, and response the text of responses
+	request  *template.Template
+	response *template.Template
+	// err is why the templates couldn't be parsed, returned by every request
+	err error
+}
+
+// newTemplateAuth returns the authenticator sending the key of credentials as a bearer token, if
+// there is one: templated APIs may not need a key at all.
+func newTemplateAuth(credentials provider.CredentialSource) Authenticator {
+	return bearerAuth{credentials: credentials, optional: true}
+}
+
+// NewTemplateProvider creates a new template provider instance.
+func NewTemplateProvider(cfg *config.Provider) *TemplateProvider {
+	// Config.Validate rejects invalid templates, which fail every request here
+	request, response, err := cfg.Templates()
+	if err != nil {
+		err = fmt.Errorf("%s: %w", cfg.Name, err)
+	}
+
+	return &TemplateProvider{
+		name:     cfg.Name,
+		baseURL:  cfg.BaseURL,
+		auth:     newAuthenticator(cfg, newTemplateAuth),
+		models:   cfg.Models,
+		priority: cfg.Priority,
+		client:   newHTTPClient(cfg),
+		chunked:  cfg.ChunkedRequests,
+
+		chatPath:       cfg.ChatPath,
+		completionPath: endpointPath(cfg.CompletionPath, cfg.ChatPath),
+		request:        request,
+		response:       response,
+		err:            err,
+	}
+}
+
+// Name returns the provider name.
+func (p *TemplateProvider) Name() string {
+	return p.name
+}
+
+// Priority returns the provider priority for model routing.
+func (p *TemplateProvider) Priority() int {
+	return p.priority
+}
+
+// Capabilities reports that template providers serve chat and text completions, without streaming.
+// Tools and images only reach the upstream if the request template sends them, so they're reported
+// as unsupported.
+func (p *TemplateProvider) Capabilities() provider.Capabilities {
+	return provider.Capabilities{Chat: true, Completion: true}
+}
+
+// ListModels returns the list of available models for this provider.
+func (p *TemplateProvider) ListModels() []string {
+	return p.models
+}
+
+// ChatCompletion performs a chat completion request, returned as an OpenAI "chat.completion".
+func (p *TemplateProvider) ChatCompletion(
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+) (interface{}, error) {
+	data := &templateRequest{Model: model, Messages: messages, Params: params}
+	return p.complete(ctx, p.chatPath, data, chatResponse)
+}
+
+// Completion performs a completion request, returned as an OpenAI "text_completion".
+func (p *TemplateProvider) Completion(
+	ctx context.Context, model, prompt string, params map[string]interface{},
+) (interface{}, error) {
+	data := &templateRequest{Model: model, Prompt: prompt, Params: params}
+	return p.complete(ctx, p.completionPath, data, textResponse)
+}
+
+// ChatCompletionStream isn't supported.
+func (p *TemplateProvider) ChatCompletionStream(
+	context.Context, string, []map[string]interface{}, map[string]interface{},
+) (<-chan StreamChunk, error) {
+	return nil, fmt.Errorf("%s: streaming: %w", p.name, provider.ErrNotSupported)
+}
+
+// CompletionStream isn't supported.
+func (p *TemplateProvider) CompletionStream(
+	context.Context, string, string, map[string]interface{},
+) (<-chan StreamChunk, error) {
+	return nil, fmt.Errorf("%s: streaming: %w", p.name, provider.ErrNotSupported)
+}
+
+// complete renders data into a request to endpoint, and the text of its response into the
+// response build makes.
+func (p *TemplateProvider) complete(
+	ctx context.Context, endpoint string, data *templateRequest, build responseBuilder,
+) (interface{}, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	var body bytes.Buffer
+	if err := p.request.Execute(&body, data); err != nil {
+		return nil, fmt.Errorf("%s: request_template: %w", p.name, err)
+	}
+	var payload interface{}
+	if err := json.Unmarshal(body.Bytes(), &payload); err != nil {
+		return nil, fmt.Errorf("%s: request_template didn't render JSON: %w", p.name, err)
+	}
+
+	req, err := newJSONRequest(ctx, p.baseURL+endpoint, payload, p.chunked)
+	if err != nil {
+		return nil, err
+	}
+	if err = p.auth.Apply(req); err != nil {
+		return nil, fmt.Errorf("%s: %w", p.name, err)
+	}
+
+	resp, err := doRequest(p.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	result, err := decodeJSONResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var text bytes.Buffer
+	if err := p.response.Execute(&text, result); err != nil {
+		return nil, fmt.Errorf("%s: response_template: %w", p.name, err)
+	}
+	return build(data.Model, text.String(), templateFinishReason, nil), nil
+}
@@ -0,0 +1,110 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/pkg/provider"
+)
+
+func newTemplateTestServer(t *testing.T, requests chan<- map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		req["path"] = r.URL.Path
+		req["authorization"] = r.Header.Get("Authorization")
+		requests <- req
+
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write([]byte(`{"result": {"generated": "Hello there"}}`)); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	}))
+}
+
+func TestTemplateProvider(t *testing.T) {
+	requests := make(chan map[string]interface{}, 1)
+	server := newTemplateTestServer(t, requests)
+	defer server.Close()
+
+	p := NewProvider(&config.Provider{
+		Name:     "gateway",
+		Type:     "template",
+		BaseURL:  server.URL,
+		APIKey:   "secret",
+		ChatPath: "/generate",
+		RequestTemplate: `{"engine": {{json .Model}}, "turns": {{json .Messages}}, "prompt": {{json .Prompt}},
+			"temperature": {{json .Params.temperature}}}`,
+		ResponseTemplate: `{{.result.generated}}`,
+	})
+	require.NotNil(t, p)
+
+	messages := []map[string]interface{}{{"role": "user", "content": "Hi"}}
+	result, err := p.ChatCompletion(context.Background(), "niche-1", messages, map[string]interface{}{"temperature": 0.5})
+	require.NoError(t, err)
+
+	req := <-requests
+	assert.Equal(t, "/generate", req["path"])
+	assert.Equal(t, "Bearer secret", req["authorization"])
+	assert.Equal(t, "niche-1", req["engine"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"role": "user", "content": "Hi"}}, req["turns"])
+	assert.Equal(t, 0.5, req["temperature"])
+
+	response := result.(map[string]interface{})
+	assert.Equal(t, "chat.completion", response["object"])
+	assert.Equal(t, "niche-1", response["model"])
+	choice := response["choices"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "Hello there", choice["message"].(map[string]interface{})["content"])
+
+	// Text completions go to chat_path too without a completion_path, and have no messages
+	result, err = p.Completion(context.Background(), "niche-1", "Say hi", nil)
+	require.NoError(t, err)
+	req = <-requests
+	assert.Equal(t, "/generate", req["path"])
+	assert.Equal(t, "Say hi", req["prompt"])
+	assert.Nil(t, req["turns"])
+	assert.Nil(t, req["temperature"])
+	assert.Equal(t, "text_completion", result.(map[string]interface{})["object"])
+
+	_, err = p.ChatCompletionStream(context.Background(), "niche-1", messages, nil)
+	assert.ErrorIs(t, err, provider.ErrNotSupported)
+}
+
+func TestTemplateProvider_Errors(t *testing.T) {
+	requests := make(chan map[string]interface{}, 1)
+	server := newTemplateTestServer(t, requests)
+	defer server.Close()
+	messages := []map[string]interface{}{{"role": "user", "content": "Hi"}}
+
+	tests := []struct {
+		name     string
+		request  string
+		response string
+		err      string
+	}{
+		{"request isn't JSON", `{"model": {{.Model}}}`, `{{.result.generated}}`, "request_template didn't render JSON"},
+		{"response field missing", `{"model": {{json .Model}}}`, `{{.output.text}}`, "response_template"},
+		{"invalid template", `{"model": {{json .Model}`, `{{.result.generated}}`, "request_template"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewTemplateProvider(&config.Provider{
+				Name: "gateway", Type: "template", BaseURL: server.URL,
+				RequestTemplate: tt.request, ResponseTemplate: tt.response,
+			})
+			_, err := p.ChatCompletion(context.Background(), "niche-1", messages, nil)
+			assert.ErrorContains(t, err, tt.err)
+			select {
+			case <-requests:
+			default:
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package providers
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/pkg/provider"
+)
+
+// call is a provider request as seen by transforms. Messages is nil for text completions.
+type call struct {
+	model    string
+	messages []map[string]interface{}
+	prompt   string
+	params   map[string]interface{}
+}
+
+// transform rewrites a request before it is sent, and its response before it is returned.
+type transform interface {
+	request(c *call)
+	response(result interface{}) interface{}
+}
+
+// newTransform creates the built-in transform for cfg, or nil if the type is unknown.
+func newTransform(cfg *config.TransformConfig) transform {
+	switch cfg.Type {
+	case provider.TransformStripSystemPrompt:
+		return stripSystemPrompt{}
+	case provider.TransformForceModel:
+		return forceModel{model: cfg.Model}
+	case provider.TransformDefaultParams:
+		return defaultParams{params: cfg.Params}
+	case provider.TransformDropParams:
+		return dropParams{fields: cfg.Fields}
+	case provider.TransformDropResponseFields:
+		return dropResponseFields{fields: cfg.Fields}
+	default:
+		return nil
+	}
+}
+
+// withTransforms wraps p in the transforms configured for it, if any.
+func withTransforms(p Provider, configs []config.TransformConfig) Provider {
+	transforms := make([]transform, 0, len(configs))
+	for i := range configs {
+		t := newTransform(&configs[i])
+		if t == nil {
+			slog.Warn("Ignoring unknown transform", "provider", p.Name(), "type", configs[i].Type)
+			continue
+		}
+		transforms = append(transforms, t)
+	}
+	return wrapTransforms(p, transforms)
+}
+
+// wrapTransforms wraps p in transforms, if there are any, keeping its model discovery.
+func wrapTransforms(p Provider, transforms []transform) Provider {
+	if len(transforms) == 0 {
+		return p
+	}
+
+	wrapped := &transformProvider{Provider: p, transforms: transforms}
+	if discoverer, ok := p.(ModelDiscoverer); ok {
+		return &discoveringTransformProvider{transformProvider: wrapped, discoverer: discoverer}
+	}
+	return wrapped
+}
+
+// transformProvider applies an ordered chain of transforms around every call to Provider.
+type transformProvider struct {
+	Provider
+	transforms []transform
+}
+
+// ChatCompletion performs a chat completion request through the transforms.
+func (p *transformProvider) ChatCompletion(
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+) (interface{}, error) {
+	c := p.request(&call{model: model, messages: messages, params: params})
+	result, err := p.Provider.ChatCompletion(ctx, c.model, c.messages, c.params)
+	if err != nil {
+		return nil, err
+	}
+	return p.response(result), nil
+}
+
+// Completion performs a completion request through the transforms.
+func (p *transformProvider) Completion(
+	ctx context.Context, model, prompt string, params map[string]interface{},
+) (interface{}, error) {
+	c := p.request(&call{model: model, prompt: prompt, params: params})
+	result, err := p.Provider.Completion(ctx, c.model, c.prompt, c.params)
+	if err != nil {
+		return nil, err
+	}
+	return p.response(result), nil
+}
+
+// ChatCompletionStream performs a streaming chat completion request through the transforms.
+func (p *transformProvider) ChatCompletionStream(
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+) (<-chan StreamChunk, error) {
+	c := p.request(&call{model: model, messages: messages, params: params})
+	chunks, err := p.Provider.ChatCompletionStream(ctx, c.model, c.messages, c.params)
+	if err != nil {
+		return nil, err
+	}
+	return p.relay(ctx, chunks), nil
+}
+
+// CompletionStream performs a streaming completion request through the transforms.
+func (p *transformProvider) CompletionStream(
+	ctx context.Context, model, prompt string, params map[string]interface{},
+) (<-chan StreamChunk, error) {
+	c := p.request(&call{model: model, prompt: prompt, params: params})
+	chunks, err := p.Provider.CompletionStream(ctx, c.model, c.prompt, c.params)
+	if err != nil {
+		return nil, err
+	}
+	return p.relay(ctx, chunks), nil
+}
+
+// request passes c through the transforms in order. Params are copied first so
+// transforms never modify the caller's map.
+func (p *transformProvider) request(c *call) *call {
+	c.params = mergeParams(c.params, nil)
+	for _, t := range p.transforms {
+		t.request(c)
+	}
+	return c
+}
+
+// response passes result through the transforms in reverse order.
+func (p *transformProvider) response(result interface{}) interface{} {
+	for i := len(p.transforms) - 1; i >= 0; i-- {
+		result = p.transforms[i].response(result)
+	}
+	return result
+}
+
+// relay passes each streamed chunk through the response transforms.
+func (p *transformProvider) relay(ctx context.Context, chunks <-chan StreamChunk) <-chan StreamChunk {
+	out := make(chan StreamChunk)
+
+	go func() {
+		defer close(out)
+		for chunk := range chunks {
+			if chunk.Data != nil {
+				chunk.Data = p.response(chunk.Data)
+			}
+			select {
+			case out <- chunk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// discoveringTransformProvider is a transformProvider whose provider also discovers models.
+type discoveringTransformProvider struct {
+	*transformProvider
+	discoverer ModelDiscoverer
+}
+
+// DiscoverModels discovers models from the wrapped provider.
+func (p *discoveringTransformProvider) DiscoverModels(ctx context.Context) ([]string, error) {
+	return p.discoverer.DiscoverModels(ctx)
+}
+
+type stripSystemPrompt struct{}
+
+func (stripSystemPrompt) request(c *call) {
+	if c.messages == nil {
+		return
+	}
+
+	messages := make([]map[string]interface{}, 0, len(c.messages))
+	for _, msg := range c.messages {
+		if msg["role"] != "system" {
+			messages = append(messages, msg)
+		}
+	}
+	c.messages = messages
+}
+
+func (stripSystemPrompt) response(result interface{}) interface{} { return result }
+
+type forceModel struct {
+	model string
+}
+
+func (t forceModel) request(c *call) { c.model = t.model }
+
+func (forceModel) response(result interface{}) interface{} { return result }
+
+type defaultParams struct {
+	params map[string]interface{}
+}
+
+func (t defaultParams) request(c *call) {
+	for key, value := range t.params {
+		if _, ok := c.params[key]; !ok {
+			c.params[key] = value
+		}
+	}
+}
+
+func (defaultParams) response(result interface{}) interface{} { return result }
+
+type dropParams struct {
+	fields []string
+}
+
+func (t dropParams) request(c *call) {
+	for _, field := range t.fields {
+		delete(c.params, field)
+	}
+}
+
+func (dropParams) response(result interface{}) interface{} { return result }
+
+type dropResponseFields struct {
+	fields []string
+}
+
+func (dropResponseFields) request(*call) {}
+
+func (t dropResponseFields) response(result interface{}) interface{} {
+	response, ok := result.(map[string]interface{})
+	if !ok {
+		return result
+	}
+	for _, field := range t.fields {
+		delete(response, field)
+	}
+	return response
+}
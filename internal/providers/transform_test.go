@@ -0,0 +1,123 @@
+package providers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/pkg/provider"
+)
+
+// recordingProvider records the last call it received and answers with a fixed response
+type recordingProvider struct {
+	model    string
+	messages []map[string]interface{}
+	prompt   string
+	params   map[string]interface{}
+}
+
+func (p *recordingProvider) Name() string         { return "recording" }
+func (p *recordingProvider) Priority() int        { return 1 }
+func (p *recordingProvider) ListModels() []string { return []string{"gpt-4"} }
+
+func (p *recordingProvider) Capabilities() provider.Capabilities {
+	return provider.Capabilities{Chat: true, Completion: true, Streaming: true}
+}
+
+func (p *recordingProvider) ChatCompletion(
+	_ context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+) (interface{}, error) {
+	p.model, p.messages, p.params = model, messages, params
+	return map[string]interface{}{"id": "chatcmpl-123", "model": model, "system_fingerprint": "fp"}, nil
+}
+
+func (p *recordingProvider) Completion(
+	_ context.Context, model, prompt string, params map[string]interface{},
+) (interface{}, error) {
+	p.model, p.prompt, p.params = model, prompt, params
+	return map[string]interface{}{"id": "cmpl-123", "model": model}, nil
+}
+
+func (p *recordingProvider) ChatCompletionStream(
+	_ context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+) (<-chan StreamChunk, error) {
+	p.model, p.messages, p.params = model, messages, params
+	chunks := make(chan StreamChunk, 2)
+	chunks <- StreamChunk{Data: map[string]interface{}{"id": "chunk", "system_fingerprint": "fp"}}
+	chunks <- StreamChunk{Done: true}
+	close(chunks)
+	return chunks, nil
+}
+
+func (p *recordingProvider) CompletionStream(
+	ctx context.Context, model, prompt string, params map[string]interface{},
+) (<-chan StreamChunk, error) {
+	p.prompt = prompt
+	return p.ChatCompletionStream(ctx, model, nil, params)
+}
+
+func TestWithTransforms_None(t *testing.T) {
+	inner := &recordingProvider{}
+	assert.Same(t, inner, withTransforms(inner, nil))
+}
+
+func TestWithTransforms_ChatCompletion(t *testing.T) {
+	inner := &recordingProvider{}
+	p := withTransforms(inner, []config.TransformConfig{
+		{Type: "strip_system_prompt"},
+		{Type: "force_model", Model: "gpt-4o"},
+		{Type: "default_params", Params: map[string]interface{}{"stop": []interface{}{"\n\n"}, "temperature": 0.1}},
+		{Type: "drop_params", Fields: []string{"user"}},
+		{Type: "drop_response_fields", Fields: []string{"system_fingerprint"}},
+	})
+
+	messages := []map[string]interface{}{
+		{"role": "system", "content": "Be brief"},
+		{"role": "user", "content": "Hello"},
+	}
+	params := map[string]interface{}{"temperature": 0.9, "user": "agent-1"}
+
+	result, err := p.ChatCompletion(context.Background(), "gpt-4", messages, params)
+	require.NoError(t, err)
+
+	assert.Equal(t, "gpt-4o", inner.model)
+	assert.Equal(t, messages[1:], inner.messages)
+	assert.Equal(t, map[string]interface{}{"temperature": 0.9, "stop": []interface{}{"\n\n"}}, inner.params)
+	assert.Equal(t, map[string]interface{}{"id": "chatcmpl-123", "model": "gpt-4o"}, result)
+
+	// The caller's request is left untouched
+	assert.Len(t, messages, 2)
+	assert.Equal(t, map[string]interface{}{"temperature": 0.9, "user": "agent-1"}, params)
+}
+
+func TestWithTransforms_Stream(t *testing.T) {
+	inner := &recordingProvider{}
+	p := withTransforms(inner, []config.TransformConfig{
+		{Type: "force_model", Model: "gpt-4o"},
+		{Type: "drop_response_fields", Fields: []string{"system_fingerprint"}},
+	})
+
+	chunks, err := p.CompletionStream(context.Background(), "gpt-4", "Hello", nil)
+	require.NoError(t, err)
+
+	collected := collectChunks(t, chunks)
+	require.Len(t, collected, 2)
+	assert.Equal(t, map[string]interface{}{"id": "chunk"}, collected[0].Data)
+	assert.True(t, collected[1].Done)
+	assert.Equal(t, "gpt-4o", inner.model)
+	assert.Equal(t, "Hello", inner.prompt)
+}
+
+func TestWithTransforms_KeepsDiscovery(t *testing.T) {
+	groq := NewGroqProvider(&config.Provider{Name: "groq"})
+	p := withTransforms(groq, []config.TransformConfig{{Type: "strip_system_prompt"}})
+	assert.Implements(t, (*ModelDiscoverer)(nil), p)
+
+	openai := NewOpenAIProvider(&config.Provider{Name: "openai"})
+	p = withTransforms(openai, []config.TransformConfig{{Type: "strip_system_prompt"}})
+	_, ok := p.(ModelDiscoverer)
+	assert.False(t, ok)
+}
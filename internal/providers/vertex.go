@@ -0,0 +1,396 @@
+// Package providers implements AI provider abstractions.
+// VertexAIProvider provides Gemini models on Google Cloud's Vertex AI with these differences from OpenAI:
+// - Authenticates with OAuth2 access tokens for a service account, refreshed before they expire
+// - Serves models per project and region, from "https://{region}-aiplatform.googleapis.com/v1"
+// - Uses Gemini's "generateContent" and "streamGenerateContent" endpoints and payload format
+// - Returns its own response format, converted to OpenAI's when normalize_responses is set
+package providers
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/pkg/provider"
+)
+
+const (
+	// Default token endpoint for service accounts whose key file doesn't name one
+	defaultGoogleTokenURI = "https://oauth2.googleapis.com/token"
+	// OAuth2 scope of the access tokens requested for Vertex AI
+	vertexScope = "https://www.googleapis.com/auth/cloud-platform"
+	// Lifetime requested for access tokens, the longest Google allows
+	googleTokenLifetime = time.Hour
+	// Access tokens are refreshed this long before they expire, so requests never carry one
+	// that expires in flight
+	googleTokenRefreshMargin = time.Minute
+	// Environment variable naming the service account key file if credentials_file is unset
+	googleCredentialsEnv = "GOOGLE_APPLICATION_CREDENTIALS"
+)
+
+// ErrNoCredentials is returned for requests to a Vertex AI provider without credentials.
+var ErrNoCredentials = errors.New("no credentials_file, " + googleCredentialsEnv + " or api_key configured")
+
+// VertexAIProvider implements the Provider interface for Gemini models on Vertex AI.
+type VertexAIProvider struct {
+	name      string
+	baseURL   string
+	project   string
+	region    string
+	normalize bool
+	strict    bool
+	// echoUpstream names the upstream's model in normalized responses instead of the requested one
+	echoUpstream bool
+	models       []string
+	priority     int
+	client       *http.Client
+	auth         Authenticator
+	// chunked streams request bodies instead of sending them with a Content-Length
+	chunked bool
+}
+
+// NewVertexAIProvider creates a new Vertex AI provider instance.
+func NewVertexAIProvider(cfg *config.Provider) *VertexAIProvider {
+	credentialsFile := cfg.CredentialsFile
+	if credentialsFile == "" {
+		credentialsFile = os.Getenv(googleCredentialsEnv)
+	}
+
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = vertexBaseURL(cfg.Region)
+	}
+
+	// Config.Validate rejects unknown modes, which are treated as lenient here
+	strict, _ := cfg.StrictNormalization()
+	echoUpstream, _ := cfg.EchoUpstreamModel()
+
+	client := newHTTPClient(cfg)
+	return &VertexAIProvider{
+		name:         cfg.Name,
+		baseURL:      baseURL,
+		project:      cfg.Project,
+		region:       cfg.Region,
+		normalize:    cfg.NormalizeResponses,
+		strict:       strict,
+		echoUpstream: echoUpstream,
+		models:       cfg.Models,
+		priority:     cfg.Priority,
+		client:       client,
+		chunked:      cfg.ChunkedRequests,
+		auth: newBearerAuth(&googleTokenSource{
+			client: client, credentialsFile: credentialsFile, fallback: newCredentials(cfg),
+		}),
+	}
+}
+
+// vertexBaseURL returns the Vertex AI API's base URL for region.
+func vertexBaseURL(region string) string {
+	if region == "" || region == "global" {
+		return "https://aiplatform.googleapis.com/v1"
+	}
+	return "https://" + region + "-aiplatform.googleapis.com/v1"
+}
+
+// Name returns the provider name.
+func (p *VertexAIProvider) Name() string {
+	return p.name
+}
+
+// Priority returns the provider priority for model routing.
+func (p *VertexAIProvider) Priority() int {
+	return p.priority
+}
+
+// Capabilities reports the operations Gemini requests are translated for: messages are sent as
+// text parts only, and tools aren't translated.
+func (p *VertexAIProvider) Capabilities() provider.Capabilities {
+	return provider.Capabilities{Chat: true, Completion: true, Streaming: true}
+}
+
+// ListModels returns the list of available models for this provider.
+func (p *VertexAIProvider) ListModels() []string {
+	return p.models
+}
+
+// ChatCompletion performs a chat completion request with Gemini-specific formatting.
+func (p *VertexAIProvider) ChatCompletion(
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+) (interface{}, error) {
+	return p.complete(ctx, model, messages, params, chatResponse)
+}
+
+// Completion performs a completion request by converting to chat format.
+func (p *VertexAIProvider) Completion(
+	ctx context.Context, model, prompt string, params map[string]interface{},
+) (interface{}, error) {
+	messages := []map[string]interface{}{
+		{"role": "user", "content": prompt},
+	}
+	return p.complete(ctx, model, messages, params, textResponse)
+}
+
+// complete sends a "generateContent" request, normalizing the response with build if configured to.
+func (p *VertexAIProvider) complete(
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+	build responseBuilder,
+) (interface{}, error) {
+	req, err := p.newRequest(ctx, p.modelURL(model, "generateContent"), buildGeminiPayload(messages, params))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := doRequest(p.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result, err := decodeJSONResponse(resp)
+	if err != nil || !p.normalize {
+		return result, err
+	}
+	response, err := normalizeGeminiResponse(echoedModel(model, result, "modelVersion", p.echoUpstream), result, build)
+	if err != nil {
+		return nil, err
+	}
+	if p.strict {
+		stripNonOpenAIFields(response)
+	}
+	return response, nil
+}
+
+// ChatCompletionStream performs a streaming chat completion request,
+// translating Gemini stream events into OpenAI chat chunks.
+func (p *VertexAIProvider) ChatCompletionStream(
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+) (<-chan StreamChunk, error) {
+	return p.makeStreamRequest(ctx, model, messages, params, chatChunk)
+}
+
+// CompletionStream performs a streaming completion request by converting to chat format,
+// translating Gemini stream events into OpenAI text completion chunks.
+func (p *VertexAIProvider) CompletionStream(
+	ctx context.Context, model, prompt string, params map[string]interface{},
+) (<-chan StreamChunk, error) {
+	messages := []map[string]interface{}{
+		{"role": "user", "content": prompt},
+	}
+	return p.makeStreamRequest(ctx, model, messages, params, textChunk)
+}
+
+func (p *VertexAIProvider) makeStreamRequest(
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+	build chunkBuilder,
+) (<-chan StreamChunk, error) {
+	endpoint := p.modelURL(model, "streamGenerateContent") + "?alt=sse"
+	req, err := p.newRequest(ctx, endpoint, buildGeminiPayload(messages, params))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := startStream(p.client, req, contentTypeSSE)
+	if err != nil {
+		return nil, err
+	}
+
+	return streamSSE(ctx, resp.Body, geminiChunkConverter(model, build)), nil
+}
+
+// modelURL returns the URL of a method of one of the project's Google models in its region.
+func (p *VertexAIProvider) modelURL(model, method string) string {
+	return fmt.Sprintf("%s/projects/%s/locations/%s/publishers/google/models/%s:%s",
+		p.baseURL, url.PathEscape(p.project), url.PathEscape(p.region), url.PathEscape(model), method)
+}
+
+func (p *VertexAIProvider) newRequest(
+	ctx context.Context, endpoint string, payload interface{},
+) (*http.Request, error) {
+	req, err := newJSONRequest(ctx, endpoint, payload, p.chunked)
+	if err != nil {
+		return nil, err
+	}
+	if err = p.auth.Apply(req); err != nil {
+		return nil, fmt.Errorf("%s: %w", p.name, err)
+	}
+	return req, nil
+}
+
+// googleTokenSource provides OAuth2 access tokens for a service account, exchanging a signed JWT
+// for a new token whenever the last is about to expire. It's safe for concurrent use, and
+// concurrent requests share a single refresh. Without a service account it provides the key of
+// fallback, the provider's credential source, as the token.
+type googleTokenSource struct {
+	client          *http.Client
+	credentialsFile string
+	fallback        provider.CredentialSource
+
+	mu          sync.Mutex
+	credentials *serviceAccount
+	token       string
+	expiry      time.Time
+}
+
+// serviceAccount holds the fields of a service account key file needed to request tokens.
+type serviceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+
+	key *rsa.PrivateKey
+}
+
+// Key returns an access token that's valid for at least googleTokenRefreshMargin, making
+// googleTokenSource the credential source of a bearerAuth.
+func (s *googleTokenSource) Key(ctx context.Context) (string, error) {
+	if s.credentialsFile == "" {
+		token, err := s.fallback.Key(ctx)
+		if err == nil && token == "" {
+			err = ErrNoCredentials
+		}
+		return token, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Until(s.expiry) > googleTokenRefreshMargin {
+		return s.token, nil
+	}
+
+	if s.credentials == nil {
+		credentials, err := loadServiceAccount(s.credentialsFile)
+		if err != nil {
+			return "", err
+		}
+		s.credentials = credentials
+	}
+
+	token, expiry, err := s.credentials.requestToken(ctx, s.client)
+	if err != nil {
+		return "", err
+	}
+	s.token, s.expiry = token, expiry
+	return token, nil
+}
+
+// loadServiceAccount reads a service account key file, as downloaded from Google Cloud.
+func loadServiceAccount(path string) (*serviceAccount, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("credentials_file: %w", err)
+	}
+
+	var account serviceAccount
+	if err = json.Unmarshal(data, &account); err != nil {
+		return nil, fmt.Errorf("credentials_file: %w", err)
+	}
+	if account.ClientEmail == "" || account.PrivateKey == "" {
+		return nil, fmt.Errorf("credentials_file: %s is not a service account key", path)
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = defaultGoogleTokenURI
+	}
+
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return nil, errors.New("credentials_file: private_key is not PEM encoded")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("credentials_file: private_key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("credentials_file: private_key is not an RSA key")
+	}
+	account.key = rsaKey
+	return &account, nil
+}
+
+// requestToken exchanges a JWT signed with the account's key for an access token, returning
+// the token and when it expires.
+func (a *serviceAccount) requestToken(ctx context.Context, client *http.Client) (string, time.Time, error) {
+	assertion, err := a.signedJWT(time.Now())
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", a.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := doRequest(client, req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("requesting access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", time.Time{}, fmt.Errorf("requesting access token failed with status %d: %s",
+			resp.StatusCode, string(body))
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", time.Time{}, fmt.Errorf("requesting access token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", time.Time{}, errors.New("requesting access token: no access_token in response")
+	}
+	return token.AccessToken, time.Now().Add(time.Duration(token.ExpiresIn) * time.Second), nil
+}
+
+// signedJWT returns a JWT asserting the account's identity at now, signed with RS256.
+func (a *serviceAccount) signedJWT(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   a.ClientEmail,
+		"scope": vertexScope,
+		"aud":   a.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(googleTokenLifetime).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("signing token request: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
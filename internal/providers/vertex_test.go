@@ -0,0 +1,251 @@
+package providers
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+)
+
+const vertexModelPath = "/projects/my-project/locations/us-central1/publishers/google/models/gemini-1.5-pro"
+
+var geminiReply = map[string]interface{}{
+	"candidates": []interface{}{map[string]interface{}{
+		"content": map[string]interface{}{
+			"role": "model", "parts": []interface{}{map[string]interface{}{"text": "Hi!"}},
+		},
+		"finishReason": "STOP",
+	}},
+	"usageMetadata": map[string]interface{}{"promptTokenCount": 4, "candidatesTokenCount": 2, "totalTokenCount": 6},
+}
+
+func newVertexConfig(baseURL string) *config.Provider {
+	return &config.Provider{
+		Name:    "vertex",
+		Type:    "vertex",
+		BaseURL: baseURL,
+		Project: "my-project",
+		Region:  "us-central1",
+		Models:  []string{"gemini-1.5-pro"},
+	}
+}
+
+func TestVertexAIProvider_ChatCompletion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, vertexModelPath+":generateContent", r.URL.Path)
+		assert.Equal(t, "Bearer static-token", r.Header.Get("Authorization"))
+
+		var req map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, map[string]interface{}{
+			"parts": []interface{}{map[string]interface{}{"text": "Be brief"}},
+		}, req["systemInstruction"])
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{"role": "user", "parts": []interface{}{map[string]interface{}{"text": "Hello"}}},
+			map[string]interface{}{"role": "model", "parts": []interface{}{map[string]interface{}{"text": "Hi"}}},
+			map[string]interface{}{"role": "user", "parts": []interface{}{map[string]interface{}{"text": "Bye"}}},
+		}, req["contents"])
+		assert.Equal(t, map[string]interface{}{
+			"temperature": 0.2, "maxOutputTokens": float64(100), "stopSequences": []interface{}{"\n"},
+		}, req["generationConfig"])
+
+		w.Header().Set("Content-Type", "application/json")
+		assert.NoError(t, json.NewEncoder(w).Encode(geminiReply))
+	}))
+	defer server.Close()
+
+	cfg := newVertexConfig(server.URL)
+	cfg.APIKey = "static-token"
+	cfg.NormalizeResponses = true
+	p := NewVertexAIProvider(cfg)
+
+	messages := []map[string]interface{}{
+		{"role": "system", "content": "Be brief"},
+		{"role": "user", "content": "Hello"},
+		{"role": "assistant", "content": "Hi"},
+		{"role": "user", "content": "Bye"},
+	}
+	params := map[string]interface{}{"temperature": 0.2, "max_tokens": 100, "stop": "\n", "user": "agent-1"}
+	result, err := p.ChatCompletion(context.Background(), "gemini-1.5-pro", messages, params)
+	require.NoError(t, err)
+
+	response := result.(map[string]interface{})
+	assert.Equal(t, "chat.completion", response["object"])
+	choice := response["choices"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"role": "assistant", "content": "Hi!"}, choice["message"])
+	assert.Equal(t, "stop", choice["finish_reason"])
+	usage := response["usage"].(map[string]interface{})
+	assert.Equal(t, 4, usage["prompt_tokens"])
+	assert.Equal(t, 2, usage["completion_tokens"])
+}
+
+func TestVertexAIProvider_ChatCompletionStream(t *testing.T) {
+	body := `data: {"candidates": [{"content": {"parts": [{"text": "Hi"}]}}]}
+
+data: {"candidates": [{"content": {"parts": [{"text": " there"}]}, "finishReason": "MAX_TOKENS"}]}
+
+`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, vertexModelPath+":streamGenerateContent", r.URL.Path)
+		assert.Equal(t, "sse", r.URL.Query().Get("alt"))
+		w.Header().Set("Content-Type", contentTypeSSE)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	cfg := newVertexConfig(server.URL)
+	cfg.APIKey = "static-token"
+	p := NewVertexAIProvider(cfg)
+
+	chunks, err := p.ChatCompletionStream(context.Background(), "gemini-1.5-pro", []map[string]interface{}{
+		{"role": "user", "content": "Hello"},
+	}, nil)
+	require.NoError(t, err)
+
+	collected := collectChunks(t, chunks)
+	require.Len(t, collected, 3)
+	assert.Equal(t, "Hi", chunkText(t, collected[0]))
+	assert.Equal(t, " there", chunkText(t, collected[1]))
+	final := collected[1].Data.(map[string]interface{})
+	assert.Equal(t, "length", final["choices"].([]interface{})[0].(map[string]interface{})["finish_reason"])
+	assert.True(t, collected[2].Done)
+}
+
+func TestVertexAIProvider_NoCredentials(t *testing.T) {
+	t.Setenv(googleCredentialsEnv, "")
+	p := NewVertexAIProvider(newVertexConfig("http://127.0.0.1:0"))
+
+	_, err := p.ChatCompletion(context.Background(), "gemini-1.5-pro", nil, nil)
+	assert.ErrorIs(t, err, ErrNoCredentials)
+}
+
+// newServiceAccount writes a service account key file whose tokens are requested from tokenURI,
+// returning its path and public key.
+func newServiceAccount(t *testing.T, tokenURI string) (string, *rsa.PublicKey) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	data, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "modelplex@my-project.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    tokenURI,
+	})
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "service-account.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path, &key.PublicKey
+}
+
+// verifyJWT checks that assertion is signed by key and returns its claims.
+func verifyJWT(t *testing.T, assertion string, key *rsa.PublicKey) map[string]interface{} {
+	t.Helper()
+
+	parts := strings.Split(assertion, ".")
+	require.Len(t, parts, 3)
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.NoError(t, err)
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	require.NoError(t, rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature))
+
+	encoded, err := base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(t, err)
+	var claims map[string]interface{}
+	require.NoError(t, json.Unmarshal(encoded, &claims))
+	return claims
+}
+
+func TestVertexAIProvider_ServiceAccount(t *testing.T) {
+	var tokenRequests atomic.Int32
+	var key *rsa.PublicKey
+	var tokenURI string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		n := tokenRequests.Add(1)
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.PostForm.Get("grant_type"))
+
+		claims := verifyJWT(t, r.PostForm.Get("assertion"), key)
+		assert.Equal(t, "modelplex@my-project.iam.gserviceaccount.com", claims["iss"])
+		assert.Equal(t, vertexScope, claims["scope"])
+		assert.Equal(t, tokenURI, claims["aud"])
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"access_token": "token-%d", "expires_in": 3600, "token_type": "Bearer"}`, n)
+	})
+	mux.HandleFunc(vertexModelPath+":generateContent", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, fmt.Sprintf("Bearer token-%d", tokenRequests.Load()), r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		assert.NoError(t, json.NewEncoder(w).Encode(geminiReply))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tokenURI = server.URL + "/token"
+	cfg := newVertexConfig(server.URL)
+	cfg.CredentialsFile, key = newServiceAccount(t, tokenURI)
+	p := NewVertexAIProvider(cfg)
+
+	// Concurrent requests share one token
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := p.Completion(context.Background(), "gemini-1.5-pro", "Hello", nil)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), tokenRequests.Load())
+
+	// Tokens about to expire are refreshed
+	tokens := p.auth.(bearerAuth).credentials.(*googleTokenSource)
+	tokens.mu.Lock()
+	tokens.expiry = tokens.expiry.Add(-googleTokenLifetime)
+	tokens.mu.Unlock()
+	_, err := p.Completion(context.Background(), "gemini-1.5-pro", "Hello", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), tokenRequests.Load())
+}
+
+func TestVertexAIProvider_InvalidCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service-account.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"type": "authorized_user"}`), 0o600))
+
+	cfg := newVertexConfig("http://127.0.0.1:0")
+	cfg.CredentialsFile = path
+	_, err := NewVertexAIProvider(cfg).ChatCompletion(context.Background(), "gemini-1.5-pro", nil, nil)
+	assert.ErrorContains(t, err, "is not a service account key")
+}
+
+func TestVertexBaseURL(t *testing.T) {
+	assert.Equal(t, "https://europe-west4-aiplatform.googleapis.com/v1", vertexBaseURL("europe-west4"))
+	assert.Equal(t, "https://aiplatform.googleapis.com/v1", vertexBaseURL("global"))
+}
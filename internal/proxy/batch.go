@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultMaxBatchItems       = 100
+	defaultMaxBatchConcurrency = 8
+)
+
+// BatchResponse is the response to a batch of chat completion requests, with one result per
+// request in the order they were sent.
+type BatchResponse struct {
+	Object  string        `json:"object"`
+	Results []BatchResult `json:"results"`
+}
+
+// BatchResult is the outcome of one request in a batch. Status is the HTTP status the request
+// would have got on its own; Response holds its completion if that's 200, and Error the
+// OpenAI-style error object otherwise.
+type BatchResult struct {
+	Index    int             `json:"index"`
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    json.RawMessage `json:"error,omitempty"`
+}
+
+// HandleChatCompletionsBatch handles a JSON array of chat completion requests, sending up to
+// maxBatchConcurrency of them upstream at once, fewer while other batches are being served.
+// Requests fail independently: the batch returns 200 with each request's status in its result, in
+// the order they were sent, as long as the batch itself is valid. The request timeout applies to
+// the batch as a whole.
+func (p *OpenAIProxy) HandleChatCompletionsBatch(w http.ResponseWriter, r *http.Request) {
+	r, cancel, ok := p.withRequestTimeout(w, r)
+	if !ok {
+		return
+	}
+	defer cancel()
+
+	var items []json.RawMessage
+	if _, err := p.decodeJSONRequest(r, &items, w); err != nil {
+		return
+	}
+	if len(items) == 0 {
+		writeError(w, http.StatusBadRequest, "Batch must contain at least one request")
+		return
+	}
+	if len(items) > p.maxBatchItems {
+		writeError(w, http.StatusBadRequest,
+			fmt.Sprintf("Batch contains %d requests, more than the limit of %d", len(items), p.maxBatchItems))
+		return
+	}
+
+	results := make([]BatchResult, len(items))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range min(len(items), p.maxBatchConcurrency) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = p.serveBatchSlot(r, i, items[i])
+			}
+		}()
+	}
+	for i := range items {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	p.writeJSONResponse(w, &BatchResponse{Object: "batch", Results: results}, "chat completion batch")
+}
+
+// serveBatchSlot serves one request of a batch with serveBatchItem once one of the batch slots is
+// free. If the batch times out or its client goes away first, the request fails without being sent.
+func (p *OpenAIProxy) serveBatchSlot(r *http.Request, index int, data json.RawMessage) BatchResult {
+	select {
+	case p.batchSlots <- struct{}{}:
+		defer func() { <-p.batchSlots }()
+		return p.serveBatchItem(r, index, data)
+	case <-r.Context().Done():
+		rec := newResponseRecorder()
+		p.handleResponse(rec, nil, r.Context().Err(), "chat completion")
+		return newBatchResult(index, rec)
+	}
+}
+
+// serveBatchItem serves one request of a batch as HandleChatCompletions would, except that
+// streaming isn't supported, and returns its outcome.
+func (p *OpenAIProxy) serveBatchItem(r *http.Request, index int, data json.RawMessage) BatchResult {
+	rec := newResponseRecorder()
+
+	var req ChatCompletionRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		writeError(rec, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
+		return newBatchResult(index, rec)
+	}
+	if req.Stream {
+		writeError(rec, http.StatusBadRequest, "Streaming is not supported in batches")
+		return newBatchResult(index, rec)
+	}
+	r, chat, err := p.prepareChatRequest(r, &req)
+	if err != nil {
+		writeError(rec, http.StatusBadRequest, err.Error())
+		return newBatchResult(index, rec)
+	}
+
+	result, err := p.chatCompletion(r.Context(), chat.model, chat.messages, chat.params)
+	p.handleResponse(rec, result, err, "chat completion")
+	return newBatchResult(index, rec)
+}
+
+// newBatchResult converts the response recorded for a batch request into its result.
+func newBatchResult(index int, rec *responseRecorder) BatchResult {
+	result := BatchResult{Index: index, Status: rec.status}
+	body := bytes.TrimSpace(rec.body.Bytes())
+	if rec.status == http.StatusOK {
+		result.Response = body
+		return result
+	}
+
+	var response struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(body, &response); err == nil && response.Error != nil {
+		result.Error = response.Error
+		return result
+	}
+
+	// Some errors are written as plain text, e.g. by http.Error
+	result.Error, _ = json.Marshal(errorBody(strings.TrimSpace(string(body)), "server_error")["error"])
+	return result
+}
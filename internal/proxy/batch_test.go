@@ -0,0 +1,244 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/multiplexer"
+)
+
+func TestOpenAIProxy_HandleChatCompletionsBatch(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{})
+
+	mockMux.On("ChatCompletion", mock.Anything, "gpt-4", mock.Anything, mock.Anything).
+		Return(map[string]interface{}{"object": "chat.completion"}, nil)
+	mockMux.On("ChatCompletion", mock.Anything, "gpt-5", mock.Anything, mock.Anything).
+		Return(nil, fmt.Errorf("%w: gpt-5", multiplexer.ErrModelNotFound))
+	mockMux.On("ChatCompletion", mock.Anything, "broken", mock.Anything, mock.Anything).
+		Return(nil, errors.New("upstream exploded"))
+
+	body := `[
+		{"model": "gpt-4", "messages": [{"role": "user", "content": "One"}]},
+		{"model": "gpt-5", "messages": [{"role": "user", "content": "Two"}]},
+		{"model": "broken", "messages": [{"role": "user", "content": "Three"}]},
+		{"model": "gpt-4", "messages": [{"role": "user", "content": "Four"}], "stream": true},
+		"not a request"
+	]`
+	req := httptest.NewRequest("POST", "/models/v1/chat/completions/batch", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	proxy.HandleChatCompletionsBatch(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var response BatchResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, "batch", response.Object)
+	require.Len(t, response.Results, 5)
+
+	// Each request fails on its own, in order
+	expected := []struct {
+		status int
+		body   string
+	}{
+		{http.StatusOK, `{"object": "chat.completion"}`},
+		{http.StatusNotFound, `{"message": "model not found: gpt-5", "type": "invalid_request_error"}`},
+		{http.StatusInternalServerError, `{"message": "Internal server error", "type": "server_error"}`},
+		{http.StatusBadRequest, `{"message": "Streaming is not supported in batches", "type": "invalid_request_error"}`},
+		{http.StatusBadRequest, ""},
+	}
+	for i, want := range expected {
+		result := response.Results[i]
+		assert.Equal(t, i, result.Index)
+		assert.Equal(t, want.status, result.Status, "request %d", i)
+		if want.status == http.StatusOK {
+			assert.JSONEq(t, want.body, string(result.Response))
+			assert.Nil(t, result.Error)
+		} else if want.body != "" {
+			assert.JSONEq(t, want.body, string(result.Error))
+			assert.Nil(t, result.Response)
+		}
+	}
+	assert.Contains(t, string(response.Results[4].Error), "Invalid JSON")
+}
+
+func TestOpenAIProxy_HandleChatCompletionsBatch_Concurrency(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{Server: config.Server{Batch: config.Batch{MaxConcurrency: 2}}})
+
+	var running, peak atomic.Int32
+	mockMux.On("ChatCompletion", mock.Anything, "gpt-4", mock.Anything, mock.Anything).
+		Run(func(mock.Arguments) {
+			n := running.Add(1)
+			for {
+				current := peak.Load()
+				if n <= current || peak.CompareAndSwap(current, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			running.Add(-1)
+		}).
+		Return(map[string]interface{}{"object": "chat.completion"}, nil)
+
+	item := `{"model": "gpt-4", "messages": [{"role": "user", "content": "Hello"}]}`
+	body := "[" + strings.TrimSuffix(strings.Repeat(item+",", 6), ",") + "]"
+	req := httptest.NewRequest("POST", "/models/v1/chat/completions/batch", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	proxy.HandleChatCompletionsBatch(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	mockMux.AssertNumberOfCalls(t, "ChatCompletion", 6)
+	assert.Equal(t, int32(2), peak.Load())
+}
+
+func TestOpenAIProxy_HandleChatCompletionsBatch_SharedConcurrency(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{Server: config.Server{Batch: config.Batch{MaxConcurrency: 2}}})
+
+	var running, peak atomic.Int32
+	mockMux.On("ChatCompletion", mock.Anything, "gpt-4", mock.Anything, mock.Anything).
+		Run(func(mock.Arguments) {
+			n := running.Add(1)
+			for {
+				current := peak.Load()
+				if n <= current || peak.CompareAndSwap(current, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			running.Add(-1)
+		}).
+		Return(map[string]interface{}{"object": "chat.completion"}, nil)
+
+	// Concurrent batches share the limit, rather than each getting its own
+	item := `{"model": "gpt-4", "messages": [{"role": "user", "content": "Hello"}]}`
+	body := "[" + strings.TrimSuffix(strings.Repeat(item+",", 4), ",") + "]"
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest("POST", "/models/v1/chat/completions/batch", strings.NewReader(body))
+			w := httptest.NewRecorder()
+			proxy.HandleChatCompletionsBatch(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+		}()
+	}
+	wg.Wait()
+
+	mockMux.AssertNumberOfCalls(t, "ChatCompletion", 12)
+	assert.Equal(t, int32(2), peak.Load())
+}
+
+func TestOpenAIProxy_HandleChatCompletionsBatch_Order(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{})
+
+	// Slow requests finish after the fast ones sent after them
+	mockMux.On("ChatCompletion", mock.Anything, "slow", mock.Anything, mock.Anything).
+		Run(func(mock.Arguments) { time.Sleep(20 * time.Millisecond) }).
+		Return(map[string]interface{}{"model": "slow"}, nil)
+	mockMux.On("ChatCompletion", mock.Anything, "fast", mock.Anything, mock.Anything).
+		Return(map[string]interface{}{"model": "fast"}, nil)
+
+	models := []string{"slow", "fast", "slow", "fast", "fast"}
+	items := make([]string, len(models))
+	for i, model := range models {
+		items[i] = `{"model": "` + model + `", "messages": [{"role": "user", "content": "Hello"}]}`
+	}
+	req := httptest.NewRequest("POST", "/models/v1/chat/completions/batch",
+		strings.NewReader("["+strings.Join(items, ",")+"]"))
+	w := httptest.NewRecorder()
+
+	proxy.HandleChatCompletionsBatch(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var response BatchResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	require.Len(t, response.Results, len(models))
+	for i, model := range models {
+		assert.Equal(t, i, response.Results[i].Index)
+		assert.Equal(t, http.StatusOK, response.Results[i].Status)
+		assert.JSONEq(t, `{"model": "`+model+`"}`, string(response.Results[i].Response))
+	}
+}
+
+func TestOpenAIProxy_HandleChatCompletionsBatch_Timeout(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{})
+
+	// The request timeout bounds the whole batch, so each request shares it
+	mockMux.On("ChatCompletion", mock.Anything, "gpt-4", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			<-args.Get(0).(context.Context).Done()
+		}).
+		Return(nil, context.DeadlineExceeded)
+
+	body := `[{"model": "gpt-4", "messages": [{"role": "user", "content": "Hello"}]}]`
+	req := httptest.NewRequest("POST", "/models/v1/chat/completions/batch", strings.NewReader(body))
+	req.Header.Set(TimeoutHeader, "10ms")
+	w := httptest.NewRecorder()
+
+	proxy.HandleChatCompletionsBatch(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var response BatchResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	require.Len(t, response.Results, 1)
+	assert.Equal(t, http.StatusGatewayTimeout, response.Results[0].Status)
+}
+
+func TestOpenAIProxy_HandleChatCompletionsBatch_Invalid(t *testing.T) {
+	proxy := New(&MockMultiplexer{}, &config.Config{Server: config.Server{Batch: config.Batch{MaxRequests: 2}}})
+
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"empty", `[]`, "Batch must contain at least one request"},
+		{"too many", `[{}, {}, {}]`, "Batch contains 3 requests, more than the limit of 2"},
+		{"not an array", `{"model": "gpt-4"}`, "Invalid JSON"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/models/v1/chat/completions/batch", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			proxy.HandleChatCompletionsBatch(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantErr)
+		})
+	}
+}
+
+func TestOpenAIProxy_HandleChatCompletionsBatch_MaxItems(t *testing.T) {
+	// max_items takes precedence over its former name, max_requests
+	batch := config.Batch{MaxItems: 1, MaxRequests: 5}
+	proxy := New(&MockMultiplexer{}, &config.Config{Server: config.Server{Batch: batch}})
+
+	req := httptest.NewRequest("POST", "/models/v1/chat/completions/batch", strings.NewReader(`[{}, {}]`))
+	w := httptest.NewRecorder()
+	proxy.HandleChatCompletionsBatch(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Batch contains 2 requests, more than the limit of 1")
+}
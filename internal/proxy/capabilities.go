@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/modelplex/modelplex/internal/multiplexer"
+	"github.com/modelplex/modelplex/pkg/provider"
+)
+
+const (
+	// RequireHeader is the request header clients use to require capabilities of the model that
+	// serves them, as a comma-separated list such as "vision, tools"
+	RequireHeader = "X-Modelplex-Require"
+)
+
+// withRequiredCapabilities returns r with a context requiring the capabilities listed in its
+// RequireHeader, and "vision" if messages include an image.
+func withRequiredCapabilities(r *http.Request, messages []map[string]interface{}) *http.Request {
+	var required []string
+	for _, capability := range strings.Split(r.Header.Get(RequireHeader), ",") {
+		if capability = strings.TrimSpace(capability); capability != "" {
+			required = append(required, capability)
+		}
+	}
+	if hasImage(messages) && !slices.Contains(required, provider.CapabilityVision) {
+		required = append(required, provider.CapabilityVision)
+	}
+
+	if len(required) == 0 {
+		return r
+	}
+	return r.WithContext(multiplexer.WithRequiredCapabilities(r.Context(), required))
+}
+
+// hasImage reports whether any message has an image among its content parts, either
+// OpenAI's "image_url" parts or Anthropic's "image" parts.
+func hasImage(messages []map[string]interface{}) bool {
+	for _, message := range messages {
+		parts, ok := message["content"].([]interface{})
+		if !ok {
+			continue
+		}
+		for _, part := range parts {
+			part, ok := part.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if partType := part["type"]; partType == "image_url" || partType == "image" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/multiplexer"
+)
+
+func TestOpenAIProxy_RequiredCapabilities(t *testing.T) {
+	// Requests are rejected before reaching the upstream, so it needn't exist
+	mux := multiplexer.New([]config.Provider{
+		{Name: "openai", Type: "openai", BaseURL: "http://127.0.0.1:1", Models: []string{"gpt-4o-mini"}},
+	})
+	mux.SetModels([]config.Model{{Name: "gpt-4o-mini", Capabilities: []string{"tools"}}})
+	proxy := New(mux, &config.Config{})
+
+	tests := []struct {
+		name    string
+		path    string
+		body    string
+		require string
+		wantErr string
+	}{
+		{
+			name: "image in messages",
+			path: "/v1/chat/completions",
+			body: `{"model": "gpt-4o-mini", "messages": [{"role": "user", "content": [
+				{"type": "text", "text": "What's this?"},
+				{"type": "image_url", "image_url": {"url": "data:image/png;base64,AAAA"}}
+			]}]}`,
+			wantErr: "gpt-4o-mini doesn't support vision",
+		},
+		{
+			name:    "header",
+			path:    "/v1/completions",
+			body:    `{"model": "gpt-4o-mini", "prompt": "Hello"}`,
+			require: "tools, json_schema",
+			wantErr: "gpt-4o-mini doesn't support json_schema",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			if tt.require != "" {
+				req.Header.Set(RequireHeader, tt.require)
+			}
+			w := httptest.NewRecorder()
+			if tt.path == "/v1/completions" {
+				proxy.HandleCompletions(w, req)
+			} else {
+				proxy.HandleChatCompletions(w, req)
+			}
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantErr)
+			assert.Contains(t, w.Body.String(), "invalid_request_error")
+		})
+	}
+}
+
+func TestHasImage(t *testing.T) {
+	assert.False(t, hasImage([]map[string]interface{}{{"role": "user", "content": "Hello"}}))
+	assert.False(t, hasImage([]map[string]interface{}{
+		{"role": "user", "content": []interface{}{map[string]interface{}{"type": "text", "text": "Hello"}}},
+	}))
+	assert.True(t, hasImage([]map[string]interface{}{
+		{"role": "system", "content": "Describe images"},
+		{"role": "user", "content": []interface{}{map[string]interface{}{"type": "image", "source": map[string]interface{}{}}}},
+	}))
+}
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// defaultMaxEmbeddingInputs matches the most inputs OpenAI accepts in one embeddings request
+const defaultMaxEmbeddingInputs = 2048
+
+// EmbeddingsRequest represents an OpenAI embeddings request. Input is a string or an array of
+// inputs, which are strings or arrays of tokens, or a single array of tokens.
+// Fields other than model and input are collected into Params and forwarded.
+type EmbeddingsRequest struct {
+	Model  string                 `json:"model"`
+	Input  interface{}            `json:"input"`
+	Params map[string]interface{} `json:"-"`
+}
+
+// UnmarshalJSON decodes the known fields and collects the remaining ones into Params.
+func (r *EmbeddingsRequest) UnmarshalJSON(data []byte) error {
+	type plain EmbeddingsRequest
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+
+	params, err := extraParams(data, "model", "input")
+	r.Params = params
+	return err
+}
+
+// HandleEmbeddings handles embeddings requests. An array of inputs, of at most maxEmbeddingInputs,
+// is forwarded intact, and the embeddings in the response's "data" keep the index of their input.
+func (p *OpenAIProxy) HandleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	r, cancel, ok := p.withRequestTimeout(w, r)
+	if !ok {
+		return
+	}
+	defer cancel()
+
+	var req EmbeddingsRequest
+	body, err := p.decodeJSONRequest(r, &req, w)
+	if err != nil {
+		return
+	}
+	inputs, err := embeddingInputs(req.Input)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+	if inputs > p.maxEmbeddingInputs {
+		writeError(w, http.StatusBadRequest,
+			fmt.Sprintf("Request contains %d inputs, more than the limit of %d", inputs, p.maxEmbeddingInputs))
+		return
+	}
+
+	model := p.normalizeModel(req.Model)
+	r, upstream := withUpstreamHeaders(withFallback(r))
+	p.serveIdempotent(w, r, body, func(w http.ResponseWriter) {
+		result, err := p.mux.Embeddings(r.Context(), model, req.Input, req.Params)
+		forwardRateLimitHeaders(w, upstream)
+		indexEmbeddings(result)
+		p.handleResponse(w, result, err, "embeddings")
+	})
+}
+
+// embeddingInputs returns the number of inputs in an embeddings request's input: one for a string
+// or an array of tokens, or the length of an array of strings or token arrays.
+func embeddingInputs(input interface{}) (int, error) {
+	items, ok := input.([]interface{})
+	if !ok {
+		if _, ok := input.(string); ok {
+			return 1, nil
+		}
+		return 0, errors.New("input must be a string or an array")
+	}
+	if len(items) == 0 {
+		return 0, errors.New("input must not be empty")
+	}
+
+	// An array of numbers is the tokens of a single input
+	if _, ok := items[0].(float64); ok {
+		for _, item := range items {
+			if _, ok := item.(float64); !ok {
+				return 0, errors.New("token arrays must only contain numbers")
+			}
+		}
+		return 1, nil
+	}
+	for _, item := range items {
+		switch item.(type) {
+		case string, []interface{}:
+		default:
+			return 0, errors.New("input arrays must contain strings or token arrays")
+		}
+	}
+	return len(items), nil
+}
+
+// indexEmbeddings gives each embedding in a response's "data" that has no "index" its position,
+// which is that of its input, as OpenAI does.
+func indexEmbeddings(result interface{}) {
+	response, ok := result.(map[string]interface{})
+	if !ok {
+		return
+	}
+	data, _ := response["data"].([]interface{})
+	for i, item := range data {
+		embedding, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, ok := embedding["index"]; !ok {
+			embedding["index"] = i
+		}
+	}
+}
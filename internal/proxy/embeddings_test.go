@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+)
+
+func TestOpenAIProxy_HandleEmbeddings(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		input   interface{}
+		data    []interface{}
+		indexes []float64
+	}{
+		{
+			name:    "single input",
+			body:    `{"model": "modelplex-text-embedding-3-small", "input": "Hello", "dimensions": 2}`,
+			input:   "Hello",
+			data:    []interface{}{map[string]interface{}{"object": "embedding", "embedding": []interface{}{0.1, 0.2}}},
+			indexes: []float64{0},
+		},
+		{
+			name:  "batch input",
+			body:  `{"model": "text-embedding-3-small", "input": ["One", "Two", "Three"], "dimensions": 2}`,
+			input: []interface{}{"One", "Two", "Three"},
+			data: []interface{}{
+				map[string]interface{}{"object": "embedding", "embedding": []interface{}{0.1, 0.2}, "index": 0},
+				map[string]interface{}{"object": "embedding", "embedding": []interface{}{0.3, 0.4}},
+				map[string]interface{}{"object": "embedding", "embedding": []interface{}{0.5, 0.6}},
+			},
+			indexes: []float64{0, 1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMux := &MockMultiplexer{}
+			proxy := New(mockMux, &config.Config{})
+
+			params := map[string]interface{}{"dimensions": float64(2)}
+			mockMux.On("Embeddings", mock.Anything, "text-embedding-3-small", tt.input, params).
+				Return(map[string]interface{}{"object": "list", "data": tt.data}, nil)
+
+			req := httptest.NewRequest("POST", "/models/v1/embeddings", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			proxy.HandleEmbeddings(w, req)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			var response struct {
+				Data []struct {
+					Index float64 `json:"index"`
+				} `json:"data"`
+			}
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+			require.Len(t, response.Data, len(tt.indexes))
+			for i, index := range tt.indexes {
+				assert.Equal(t, index, response.Data[i].Index)
+			}
+			mockMux.AssertExpectations(t)
+		})
+	}
+}
+
+func TestOpenAIProxy_HandleEmbeddings_InvalidInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		message string
+	}{
+		{"missing", `null`, "Invalid input: input must be a string or an array"},
+		{"empty", `[]`, "Invalid input: input must not be empty"},
+		{"mixed", `["One", 2]`, "Invalid input: input arrays must contain strings or token arrays"},
+		{"bad tokens", `[1, "two"]`, "Invalid input: token arrays must only contain numbers"},
+		{"too many", `["One", "Two", "Three"]`, "Request contains 3 inputs, more than the limit of 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMux := &MockMultiplexer{}
+			proxy := New(mockMux, &config.Config{Server: config.Server{MaxEmbeddingInputs: 2}})
+
+			body := `{"model": "text-embedding-3-small", "input": ` + tt.input + `}`
+			req := httptest.NewRequest("POST", "/models/v1/embeddings", strings.NewReader(body))
+			w := httptest.NewRecorder()
+			proxy.HandleEmbeddings(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), tt.message)
+			mockMux.AssertNotCalled(t, "Embeddings")
+		})
+	}
+}
+
+func TestEmbeddingInputs(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		expected int
+	}{
+		{"Hello", 1},
+		{[]interface{}{"One", "Two"}, 2},
+		{[]interface{}{float64(1), float64(2), float64(3)}, 1},
+		{[]interface{}{[]interface{}{float64(1)}, []interface{}{float64(2)}}, 2},
+	}
+
+	for _, tt := range tests {
+		inputs, err := embeddingInputs(tt.input)
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, inputs, "%v", tt.input)
+	}
+}
@@ -0,0 +1,27 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/modelplex/modelplex/internal/multiplexer"
+)
+
+// FallbackHeader is the request header clients use to name the providers, as a comma-separated
+// list such as "anthropic, ollama", that a request is sent to in turn if the provider it's routed to fails
+const FallbackHeader = "X-Modelplex-Fallback"
+
+// withFallback returns r with a context falling back to the providers listed in its FallbackHeader.
+func withFallback(r *http.Request) *http.Request {
+	var names []string
+	for _, name := range strings.Split(r.Header.Get(FallbackHeader), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) == 0 {
+		return r
+	}
+	return r.WithContext(multiplexer.WithFallback(r.Context(), names))
+}
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/multiplexer"
+)
+
+func TestOpenAIProxy_Fallback(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id": "fallback", "choices": [{"message": {"role": "assistant", "content": "Hi"}}]}`))
+	}))
+	defer working.Close()
+
+	mux := multiplexer.New([]config.Provider{
+		{Name: "primary", Type: "openai", BaseURL: failing.URL, Models: []string{"gpt-4o-mini"}, Priority: 1},
+		{Name: "backup", Type: "openai", BaseURL: working.URL, Models: []string{"gpt-4o-mini"}, Priority: 2},
+		{Name: "local", Type: "openai", BaseURL: working.URL, Models: []string{"llama3"}, Priority: 3},
+	})
+	proxy := New(mux, &config.Config{})
+
+	tests := []struct {
+		name     string
+		fallback string
+		wantCode int
+		wantBody string
+	}{
+		{name: "failover candidate", wantCode: http.StatusOK, wantBody: `"id":"fallback"`},
+		{name: "fallback", fallback: "backup", wantCode: http.StatusOK, wantBody: `"id":"fallback"`},
+		{name: "unknown provider", fallback: "backup, mistral", wantCode: http.StatusBadRequest,
+			wantBody: `no provider named \"mistral\"`},
+		{name: "model not served", fallback: "local", wantCode: http.StatusBadRequest,
+			wantBody: "local doesn't serve gpt-4o-mini"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"model": "gpt-4o-mini", "messages": [{"role": "user", "content": "Hello"}]}`
+			req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+			if tt.fallback != "" {
+				req.Header.Set(FallbackHeader, tt.fallback)
+			}
+			w := httptest.NewRecorder()
+			proxy.HandleChatCompletions(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func TestOpenAIProxy_Fallback_ClientError(t *testing.T) {
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error": {"message": "invalid temperature"}}`))
+	}))
+	defer rejecting.Close()
+	var backupCalls int
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		backupCalls++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id": "fallback", "choices": [{"message": {"role": "assistant", "content": "Hi"}}]}`))
+	}))
+	defer backup.Close()
+
+	mux := multiplexer.New([]config.Provider{
+		{Name: "primary", Type: "openai", BaseURL: rejecting.URL, Models: []string{"gpt-4o-mini"}, Priority: 1},
+		{Name: "backup", Type: "openai", BaseURL: backup.URL, Models: []string{"gpt-4o-mini"}, Priority: 2},
+	})
+	proxy := New(mux, &config.Config{})
+
+	// A request the primary rejects isn't sent to the backup, which would bill for it again
+	body := `{"model": "gpt-4o-mini", "messages": [{"role": "user", "content": "Hello"}], "temperature": 9}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set(FallbackHeader, "backup")
+	w := httptest.NewRecorder()
+	proxy.HandleChatCompletions(w, req)
+
+	assert.NotEqual(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "fallback")
+	assert.Zero(t, backupCalls)
+}
@@ -0,0 +1,245 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/modelplex/modelplex/internal/config"
+)
+
+const (
+	// IdempotencyKeyHeader is the request header clients use to deduplicate retries
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayHeader marks responses served from the idempotency cache
+	idempotentReplayHeader = "Idempotent-Replayed"
+
+	defaultIdempotencyTTL        = 10 * time.Minute
+	defaultIdempotencyMaxEntries = 1000
+)
+
+// idempotencyEntry is a response that is either in flight (done still open) or completed.
+type idempotencyEntry struct {
+	done     chan struct{}
+	response *responseRecorder
+	expires  time.Time
+	// bodyHash is the SHA-256 of the request body the response answers
+	bodyHash [sha256.Size]byte
+}
+
+type listenerKey struct{}
+
+// WithListener returns a context for a request that arrived on the named listener, such as
+// "socket" or "http". Idempotency keys are only matched against requests on the same listener.
+func WithListener(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, listenerKey{}, name)
+}
+
+// listener returns the listener named with WithListener, if any.
+func listener(ctx context.Context) string {
+	name, _ := ctx.Value(listenerKey{}).(string)
+	return name
+}
+
+// idempotencyCache remembers responses by key for a TTL, bounded to maxEntries keys.
+type idempotencyCache struct {
+	mu         sync.Mutex
+	entries    map[string]*idempotencyEntry
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+}
+
+func newIdempotencyCache(cfg config.Idempotency) *idempotencyCache {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	ttl := cfg.TTL.Duration
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	maxEntries := cfg.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultIdempotencyMaxEntries
+	}
+
+	return &idempotencyCache{
+		entries:    make(map[string]*idempotencyEntry),
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+	}
+}
+
+// acquire returns the live entry for key, or registers a new in-flight entry owned by the caller
+// for a request whose body hashes to bodyHash. It returns a nil entry when the cache is full of
+// in-flight requests and can't track another.
+func (c *idempotencyCache) acquire(key string, bodyHash [sha256.Size]byte) (entry *idempotencyEntry, owner bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if entry, exists := c.entries[key]; exists {
+		if !entry.completed() || now.Before(entry.expires) {
+			return entry, false
+		}
+		delete(c.entries, key)
+	}
+
+	if len(c.entries) >= c.maxEntries && !c.evict(now) {
+		return nil, false
+	}
+
+	entry = &idempotencyEntry{done: make(chan struct{}), bodyHash: bodyHash}
+	c.entries[key] = entry
+	return entry, true
+}
+
+// evict drops expired entries, or failing that the completed entry closest to expiry.
+// It reports whether room was made.
+func (c *idempotencyCache) evict(now time.Time) bool {
+	var oldestKey string
+	var oldest *idempotencyEntry
+	for key, entry := range c.entries {
+		if !entry.completed() {
+			continue
+		}
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+			continue
+		}
+		if oldest == nil || entry.expires.Before(oldest.expires) {
+			oldestKey, oldest = key, entry
+		}
+	}
+
+	if len(c.entries) < c.maxEntries {
+		return true
+	}
+	if oldest == nil {
+		return false
+	}
+	delete(c.entries, oldestKey)
+	return true
+}
+
+// complete stores the owner's response and releases any waiters.
+// Server errors are released to concurrent waiters but not kept, so a later retry runs again.
+func (c *idempotencyCache) complete(key string, entry *idempotencyEntry, rec *responseRecorder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry.response = rec
+	entry.expires = c.now().Add(c.ttl)
+	close(entry.done)
+
+	if rec.status >= http.StatusInternalServerError {
+		delete(c.entries, key)
+	}
+}
+
+func (e *idempotencyEntry) completed() bool {
+	select {
+	case <-e.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// serveIdempotent runs serve once per Idempotency-Key, replaying its response to duplicate requests.
+// Keys are scoped to the listener, the client and the path, so a client can't replay another's
+// response by reusing its key, and a duplicate whose body differs from the original's is rejected
+// with 422. Requests without the header, or when idempotency is disabled, are served directly.
+func (p *OpenAIProxy) serveIdempotent(
+	w http.ResponseWriter, r *http.Request, body []byte, serve func(http.ResponseWriter),
+) {
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if p.idempotency == nil || key == "" {
+		serve(w)
+		return
+	}
+
+	key = idempotencyScope(r, key)
+	bodyHash := sha256.Sum256(body)
+	entry, owner := p.idempotency.acquire(key, bodyHash)
+	switch {
+	case entry == nil:
+		serve(w)
+	case !owner && entry.bodyHash != bodyHash:
+		writeError(w, http.StatusUnprocessableEntity,
+			IdempotencyKeyHeader+" was already used for a request with a different body")
+	case owner:
+		rec := newResponseRecorder()
+		serve(rec)
+		p.idempotency.complete(key, entry, rec)
+		rec.writeTo(w)
+	default:
+		select {
+		case <-entry.done:
+			w.Header().Set(idempotentReplayHeader, "true")
+			entry.response.writeTo(w)
+		case <-r.Context().Done():
+		}
+	}
+}
+
+// idempotencyScope returns the cache key for a request's Idempotency-Key: a hash of the key with
+// the listener, the client and the path it was sent to. Clients are told apart by their
+// Authorization header, or without one by their IP address.
+func idempotencyScope(r *http.Request, key string) string {
+	client := r.Header.Get("Authorization")
+	if client == "" {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		client = "ip:" + host
+	}
+
+	hash := sha256.New()
+	for _, part := range []string{listener(r.Context()), client, r.URL.Path, key} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder buffers a response so it can be both cached and sent.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: make(http.Header), status: http.StatusOK}
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	return r.body.Write(data)
+}
+
+func (r *responseRecorder) writeTo(w http.ResponseWriter) {
+	for name, values := range r.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(r.status)
+	if _, err := w.Write(r.body.Bytes()); err != nil {
+		return
+	}
+}
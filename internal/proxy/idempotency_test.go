@@ -0,0 +1,234 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+)
+
+// noBody is the hash idempotency cache tests acquire entries with
+var noBody = sha256.Sum256(nil)
+
+func newIdempotentProxy(mux Multiplexer, ttl time.Duration, maxEntries int) *OpenAIProxy {
+	return New(mux, &config.Config{Server: config.Server{Idempotency: config.Idempotency{
+		Enabled:    true,
+		TTL:        config.Duration{Duration: ttl},
+		MaxEntries: maxEntries,
+	}}})
+}
+
+func postChat(proxy *OpenAIProxy, key string) *httptest.ResponseRecorder {
+	return postChatAs(proxy, key, "Hello", func(r *http.Request) *http.Request { return r })
+}
+
+// postChatAs posts a chat completion saying content, with the Idempotency-Key key, as the request
+// setup returns, which sets who it's sent by.
+func postChatAs(
+	proxy *OpenAIProxy, key, content string, setup func(*http.Request) *http.Request,
+) *httptest.ResponseRecorder {
+	body := `{"model": "gpt-4", "messages": [{"role": "user", "content": "` + content + `"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	req = setup(req)
+	w := httptest.NewRecorder()
+	proxy.HandleChatCompletions(w, req)
+	return w
+}
+
+func TestIdempotency_ReplaysCompletedResponse(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := newIdempotentProxy(mockMux, time.Minute, 10)
+
+	mockMux.On("ChatCompletion", mock.Anything, "gpt-4", mock.Anything, mock.Anything).
+		Return(map[string]interface{}{"id": "chatcmpl-1"}, nil).Once()
+
+	first := postChat(proxy, "retry-1")
+	second := postChat(proxy, "retry-1")
+
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, http.StatusOK, second.Code)
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Empty(t, first.Header().Get(idempotentReplayHeader))
+	assert.Equal(t, "true", second.Header().Get(idempotentReplayHeader))
+	assert.Equal(t, "application/json", second.Header().Get("Content-Type"))
+
+	mockMux.AssertNumberOfCalls(t, "ChatCompletion", 1)
+}
+
+func TestIdempotency_WaitsForInFlightRequest(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := newIdempotentProxy(mockMux, time.Minute, 10)
+
+	release := make(chan struct{})
+	mockMux.On("ChatCompletion", mock.Anything, "gpt-4", mock.Anything, mock.Anything).
+		Run(func(mock.Arguments) { <-release }).
+		Return(map[string]interface{}{"id": "chatcmpl-1"}, nil).Once()
+
+	var wg sync.WaitGroup
+	responses := make([]*httptest.ResponseRecorder, 3)
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i] = postChat(proxy, "in-flight")
+		}(i)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for _, w := range responses {
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "chatcmpl-1")
+	}
+	mockMux.AssertNumberOfCalls(t, "ChatCompletion", 1)
+}
+
+func TestIdempotency_ServerErrorsAreNotCached(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := newIdempotentProxy(mockMux, time.Minute, 10)
+
+	mockMux.On("ChatCompletion", mock.Anything, "gpt-4", mock.Anything, mock.Anything).
+		Return(nil, errors.New("provider unavailable")).Once()
+	mockMux.On("ChatCompletion", mock.Anything, "gpt-4", mock.Anything, mock.Anything).
+		Return(map[string]interface{}{"id": "chatcmpl-2"}, nil).Once()
+
+	assert.Equal(t, http.StatusInternalServerError, postChat(proxy, "flaky").Code)
+	assert.Equal(t, http.StatusOK, postChat(proxy, "flaky").Code)
+
+	mockMux.AssertNumberOfCalls(t, "ChatCompletion", 2)
+}
+
+func TestIdempotency_RejectsDifferentBody(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := newIdempotentProxy(mockMux, time.Minute, 10)
+
+	mockMux.On("ChatCompletion", mock.Anything, "gpt-4", mock.Anything, mock.Anything).
+		Return(map[string]interface{}{"id": "chatcmpl-1"}, nil).Once()
+
+	noSetup := func(r *http.Request) *http.Request { return r }
+	assert.Equal(t, http.StatusOK, postChatAs(proxy, "retry-1", "Hello", noSetup).Code)
+	w := postChatAs(proxy, "retry-1", "Goodbye", noSetup)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "different body")
+	assert.NotContains(t, w.Body.String(), "chatcmpl-1")
+
+	mockMux.AssertNumberOfCalls(t, "ChatCompletion", 1)
+}
+
+// fromAddr returns a postChatAs setup sending requests from addr.
+func fromAddr(addr string) func(*http.Request) *http.Request {
+	return func(r *http.Request) *http.Request {
+		r.RemoteAddr = addr
+		return r
+	}
+}
+
+func TestIdempotency_ScopedToClient(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := newIdempotentProxy(mockMux, time.Minute, 10)
+
+	mockMux.On("ChatCompletion", mock.Anything, "gpt-4", mock.Anything, mock.Anything).
+		Return(map[string]interface{}{"id": "chatcmpl-1"}, nil)
+
+	clients := []struct {
+		name  string
+		setup func(*http.Request) *http.Request
+	}{
+		{name: "first IP", setup: fromAddr("192.0.2.1:1234")},
+		{name: "second IP", setup: fromAddr("192.0.2.2:1234")},
+		{name: "API key", setup: func(r *http.Request) *http.Request {
+			r.Header.Set("Authorization", "Bearer sk-1")
+			return fromAddr("192.0.2.1:1234")(r)
+		}},
+		{name: "other listener", setup: func(r *http.Request) *http.Request {
+			return fromAddr("192.0.2.1:1234")(r.WithContext(WithListener(r.Context(), "socket")))
+		}},
+	}
+
+	// Reusing a key from another client, or another listener, runs the request rather than
+	// replaying the other's response
+	for _, client := range clients {
+		w := postChatAs(proxy, "shared", "Hello", client.setup)
+		assert.Equal(t, http.StatusOK, w.Code, client.name)
+		assert.Empty(t, w.Header().Get(idempotentReplayHeader), client.name)
+	}
+	mockMux.AssertNumberOfCalls(t, "ChatCompletion", len(clients))
+
+	// The same client retrying from a new connection is still replayed
+	w := postChatAs(proxy, "shared", "Hello", fromAddr("192.0.2.1:5678"))
+	assert.Equal(t, "true", w.Header().Get(idempotentReplayHeader))
+	mockMux.AssertNumberOfCalls(t, "ChatCompletion", len(clients))
+}
+
+func TestIdempotency_DisabledOrKeyless(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	mockMux.On("ChatCompletion", mock.Anything, "gpt-4", mock.Anything, mock.Anything).
+		Return(map[string]interface{}{"id": "chatcmpl-1"}, nil)
+
+	disabled := New(mockMux, &config.Config{})
+	postChat(disabled, "same")
+	postChat(disabled, "same")
+
+	enabled := newIdempotentProxy(mockMux, time.Minute, 10)
+	postChat(enabled, "")
+	postChat(enabled, "")
+
+	mockMux.AssertNumberOfCalls(t, "ChatCompletion", 4)
+}
+
+func TestIdempotencyCache_Expiry(t *testing.T) {
+	cache := newIdempotencyCache(config.Idempotency{Enabled: true, TTL: config.Duration{Duration: time.Minute}})
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	entry, owner := cache.acquire("key", noBody)
+	require.True(t, owner)
+	cache.complete("key", entry, newResponseRecorder())
+
+	_, owner = cache.acquire("key", noBody)
+	assert.False(t, owner, "completed entry should be replayed within the TTL")
+
+	now = now.Add(2 * time.Minute)
+	_, owner = cache.acquire("key", noBody)
+	assert.True(t, owner, "expired entry should be replaced")
+}
+
+func TestIdempotencyCache_Bounded(t *testing.T) {
+	cache := newIdempotencyCache(config.Idempotency{Enabled: true, MaxEntries: 2})
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	first, _ := cache.acquire("first", noBody)
+	cache.complete("first", first, newResponseRecorder())
+	now = now.Add(time.Second)
+	second, _ := cache.acquire("second", noBody)
+	cache.complete("second", second, newResponseRecorder())
+
+	// A full cache evicts the completed entry closest to expiry
+	_, owner := cache.acquire("third", noBody)
+	assert.True(t, owner)
+	assert.Len(t, cache.entries, 2)
+	assert.NotContains(t, cache.entries, "first")
+
+	// With only in-flight entries left there is nothing safe to evict
+	_, owner = cache.acquire("fourth", noBody)
+	assert.True(t, owner)
+	entry, owner := cache.acquire("fifth", noBody)
+	assert.Nil(t, entry)
+	assert.False(t, owner)
+}
@@ -1,10 +1,25 @@
 package proxy
 
-import "context"
+import (
+	"context"
+
+	"github.com/modelplex/modelplex/internal/providers"
+)
 
 // Multiplexer defines the interface for model multiplexing
 type Multiplexer interface {
-	ChatCompletion(ctx context.Context, model string, messages []map[string]interface{}) (interface{}, error)
-	Completion(ctx context.Context, model, prompt string) (interface{}, error)
+	ChatCompletion(
+		ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+	) (interface{}, error)
+	Completion(ctx context.Context, model, prompt string, params map[string]interface{}) (interface{}, error)
+	ChatCompletionStream(
+		ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+	) (<-chan providers.StreamChunk, error)
+	CompletionStream(
+		ctx context.Context, model, prompt string, params map[string]interface{},
+	) (<-chan providers.StreamChunk, error)
+	Embeddings(ctx context.Context, model string, input interface{}, params map[string]interface{}) (interface{}, error)
 	ListModels() []string
+	// ModelsVersion changes whenever the set of models ListModels returns does
+	ModelsVersion() uint64
 }
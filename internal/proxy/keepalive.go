@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	// KeepaliveHeader is the request header clients use to keep the connection of a non-streaming
+	// request busy while it's served, e.g. "15s": the response is sent as server-sent events instead,
+	// with a keepalive comment about that often and the whole response as a single "data:" event.
+	KeepaliveHeader = "X-Modelplex-Keepalive"
+
+	// minKeepaliveInterval bounds how often keepalive comments are sent
+	minKeepaliveInterval = time.Second
+)
+
+// serveKeepalive runs serve, which writes a non-streaming response, as serveIdempotent does. If the
+// request has a KeepaliveHeader, the response is sent as server-sent events instead: the status and
+// headers are sent right away, followed by a ": keepalive" comment every interval until serve is
+// done, so idle timeouts of proxies and load balancers between the client and a slow model don't
+// drop the connection. It writes a 400 if the header isn't a positive duration.
+//
+// The response then ends with a "data:" event holding its JSON body and "data: [DONE]", or, if the
+// request failed, a "data:" event holding the error, as streams report failures. Its status is
+// always 200, and headers set by serve, such as rate limits, aren't sent.
+func (p *OpenAIProxy) serveKeepalive(w http.ResponseWriter, r *http.Request, serve func(http.ResponseWriter)) {
+	value := r.Header.Get(KeepaliveHeader)
+	if value == "" {
+		serve(w)
+		return
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		writeError(w, http.StatusBadRequest,
+			fmt.Sprintf("Invalid %s %q: expected a positive duration such as \"15s\"", KeepaliveHeader, value))
+		return
+	}
+	interval = max(interval, minKeepaliveInterval)
+
+	rec := newResponseRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serve(rec)
+	}()
+
+	rc := startEventStream(w)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for err = rc.Flush(); err == nil; {
+		select {
+		case <-done:
+			writeRecordedEvent(w, rec)
+			_ = rc.Flush()
+			return
+		case <-ticker.C:
+			if _, err = fmt.Fprint(w, ": keepalive\n\n"); err == nil {
+				err = rc.Flush()
+			}
+		}
+	}
+
+	// Once the client is gone, the request's context is canceled, which soon ends serve
+	slog.Debug("Client went away, stopping keepalive", "error", err)
+	<-done
+}
+
+// writeRecordedEvent writes the response rec recorded as SSE "data:" events: its JSON body followed
+// by "data: [DONE]" if it succeeded, or its error otherwise.
+func writeRecordedEvent(w http.ResponseWriter, rec *responseRecorder) {
+	body := bytes.TrimSpace(rec.body.Bytes())
+	var err error
+	switch {
+	case rec.status < http.StatusMultipleChoices:
+		_, err = fmt.Fprintf(w, "data: %s\n\ndata: [DONE]\n\n", body)
+	case json.Valid(body):
+		_, err = fmt.Fprintf(w, "data: %s\n\n", body)
+	default:
+		// Such as http.Error's plain text
+		err = writeSSEData(w, errorBody(string(body), "server_error"))
+	}
+	if err != nil {
+		slog.Debug("Client went away before the response was sent", "error", err)
+	}
+}
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/multiplexer"
+)
+
+func TestOpenAIProxy_Keepalive(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{})
+
+	// A slow model that answers once released
+	release := make(chan struct{})
+	mockMux.On("ChatCompletion", mock.Anything, "llama3", mock.Anything, mock.Anything).
+		Run(func(mock.Arguments) { <-release }).
+		Return(map[string]interface{}{"object": "chat.completion"}, nil)
+
+	server := httptest.NewServer(http.HandlerFunc(proxy.HandleChatCompletions))
+	defer server.Close()
+
+	body := `{"model": "llama3", "messages": [{"role": "user", "content": "Hello"}]}`
+	req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set(KeepaliveHeader, "1s")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, ": keepalive\n", line)
+
+	close(release)
+	var events []string
+	for {
+		line, err = reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+		if line = strings.TrimSpace(line); line != "" && line != ": keepalive" {
+			events = append(events, line)
+		}
+	}
+	assert.Equal(t, []string{`data: {"object":"chat.completion"}`, "data: [DONE]"}, events)
+}
+
+func TestOpenAIProxy_Keepalive_Errors(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{})
+	mockMux.On("ChatCompletion", mock.Anything, "missing", mock.Anything, mock.Anything).
+		Return(nil, multiplexer.ErrModelNotFound)
+	mockMux.On("ChatCompletion", mock.Anything, "broken", mock.Anything, mock.Anything).
+		Return(nil, errors.New("connection reset"))
+
+	send := func(model, keepalive string) *httptest.ResponseRecorder {
+		body := `{"model": "` + model + `", "messages": [{"role": "user", "content": "Hello"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set(KeepaliveHeader, keepalive)
+		w := httptest.NewRecorder()
+		proxy.HandleChatCompletions(w, req)
+		return w
+	}
+
+	// Failures are reported as an error event, since the status was already sent
+	w := send("missing", "15s")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `data: {"error":{"message":"model not found","type":"invalid_request_error"}}`+"\n\n",
+		w.Body.String())
+
+	w = send("broken", "15s")
+	assert.Equal(t, `data: {"error":{"message":"Internal server error","type":"server_error"}}`+"\n\n",
+		w.Body.String())
+
+	for _, keepalive := range []string{"soon", "0s", "-1s"} {
+		w = send("missing", keepalive)
+		assert.Equal(t, http.StatusBadRequest, w.Code, keepalive)
+		assert.Contains(t, w.Body.String(), "Invalid X-Modelplex-Keepalive", keepalive)
+	}
+}
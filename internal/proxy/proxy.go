@@ -2,38 +2,195 @@
 package proxy
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/multiplexer"
+	"github.com/modelplex/modelplex/internal/providers"
+	"github.com/modelplex/modelplex/pkg/provider"
 )
 
 const (
 	// Default model creation timestamp for OpenAI compatibility
 	defaultModelCreated = 1677610602
+	// Default request body limit when the config doesn't set one
+	defaultMaxRequestSize = 10 * 1024 * 1024
+	// Maximum number of body bytes echoed back in decode errors
+	bodyPreviewLength = 200
+	// Default prefix stripped from requested model names
+	defaultModelPrefix = "modelplex-"
 )
 
 // OpenAIProxy provides OpenAI-compatible HTTP endpoints.
 type OpenAIProxy struct {
-	mux Multiplexer
+	mux            Multiplexer
+	maxRequestSize int64
+	modelPrefix    string
+	prefixModels   bool
+	repairJSON     bool
+	injectUsage    bool
+	idempotency    *idempotencyCache
+	models         modelsCache
+	modelDefaults  map[string]map[string]interface{}
+	// systemPrompts holds the models, by name, that have a system prompt configured
+	systemPrompts map[string]config.Model
+	// maxMessages holds the message limits of models, by name, that have one configured
+	maxMessages map[string]int
+	// maxRequestTimeout caps the timeout clients can request with TimeoutHeader
+	maxRequestTimeout time.Duration
+	// maxBatchItems bounds the size of batches, and maxBatchConcurrency how many batch requests
+	// are sent upstream at once, each holding one of batchSlots, which all batches share
+	maxBatchItems       int
+	maxBatchConcurrency int
+	batchSlots          chan struct{}
+	// maxEmbeddingInputs bounds the number of inputs in an embeddings request
+	maxEmbeddingInputs int
+	// realtime enables HandleRealtime, which pings idle connections every realtimePingInterval
+	realtime             bool
+	realtimePingInterval time.Duration
 }
 
-// New creates a new OpenAI proxy with the given multiplexer.
-func New(mux Multiplexer) *OpenAIProxy {
-	return &OpenAIProxy{mux: mux}
+// New creates a new OpenAI proxy with the given multiplexer and configuration.
+func New(mux Multiplexer, cfg *config.Config) *OpenAIProxy {
+	maxRequestSize := cfg.Server.MaxRequestSize
+	if maxRequestSize <= 0 {
+		maxRequestSize = defaultMaxRequestSize
+	}
+
+	maxRequestTimeout := cfg.Server.MaxRequestTimeout.Duration
+	if maxRequestTimeout <= 0 {
+		maxRequestTimeout = defaultMaxRequestTimeout
+	}
+
+	p := &OpenAIProxy{
+		mux:            mux,
+		maxRequestSize: maxRequestSize,
+		modelPrefix:    cfg.Server.ModelPrefix,
+		prefixModels:   cfg.Server.PrefixModels,
+		repairJSON:     cfg.Server.RepairJSON,
+		injectUsage:    cfg.Server.InjectUsage,
+		idempotency:    newIdempotencyCache(cfg.Server.Idempotency),
+		modelDefaults:  make(map[string]map[string]interface{}, len(cfg.ModelDefaults)),
+		systemPrompts:  make(map[string]config.Model),
+		maxMessages:    make(map[string]int),
+
+		maxRequestTimeout:   maxRequestTimeout,
+		maxBatchItems:       cfg.Server.Batch.MaxItems,
+		maxBatchConcurrency: cfg.Server.Batch.MaxConcurrency,
+		maxEmbeddingInputs:  cfg.Server.MaxEmbeddingInputs,
+
+		realtime:             cfg.Server.Realtime.Enabled,
+		realtimePingInterval: cfg.Server.Realtime.PingInterval.Duration,
+	}
+	if p.maxBatchItems <= 0 {
+		p.maxBatchItems = cfg.Server.Batch.MaxRequests
+	}
+	if p.maxBatchItems <= 0 {
+		p.maxBatchItems = defaultMaxBatchItems
+	}
+	if p.maxBatchConcurrency <= 0 {
+		p.maxBatchConcurrency = defaultMaxBatchConcurrency
+	}
+	p.batchSlots = make(chan struct{}, p.maxBatchConcurrency)
+	if p.maxEmbeddingInputs <= 0 {
+		p.maxEmbeddingInputs = defaultMaxEmbeddingInputs
+	}
+	if p.realtimePingInterval <= 0 {
+		p.realtimePingInterval = defaultRealtimePingInterval
+	}
+
+	for _, defaults := range cfg.ModelDefaults {
+		p.modelDefaults[defaults.Model()] = defaults.Params()
+	}
+	for _, model := range cfg.Models {
+		if model.SystemPrompt != "" {
+			p.systemPrompts[model.Name] = model
+		}
+		if model.MaxMessages > 0 {
+			p.maxMessages[model.Name] = model.MaxMessages
+		}
+	}
+
+	return p
 }
 
 // ChatCompletionRequest represents an OpenAI chat completion request.
+// Fields other than model, messages and stream are collected into Params and forwarded.
 type ChatCompletionRequest struct {
 	Model    string                   `json:"model"`
 	Messages []map[string]interface{} `json:"messages"`
+	Stream   bool                     `json:"stream"`
+	Params   map[string]interface{}   `json:"-"`
+}
+
+// UnmarshalJSON decodes the known fields and collects the remaining ones into Params.
+func (r *ChatCompletionRequest) UnmarshalJSON(data []byte) error {
+	type plain ChatCompletionRequest
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+
+	params, err := extraParams(data, "model", "messages", "stream")
+	r.Params = params
+	return err
 }
 
 // CompletionRequest represents an OpenAI completion request.
+// Fields other than model, prompt, suffix and stream are collected into Params and forwarded.
+// Suffix is the text after the insertion point for fill-in-the-middle (FIM) completions.
 type CompletionRequest struct {
-	Model  string `json:"model"`
-	Prompt string `json:"prompt"`
+	Model  string                 `json:"model"`
+	Prompt string                 `json:"prompt"`
+	Suffix string                 `json:"suffix,omitempty"`
+	Stream bool                   `json:"stream"`
+	Params map[string]interface{} `json:"-"`
+}
+
+// UnmarshalJSON decodes the known fields and collects the remaining ones into Params.
+func (r *CompletionRequest) UnmarshalJSON(data []byte) error {
+	type plain CompletionRequest
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+
+	params, err := extraParams(data, "model", "prompt", "suffix", "stream")
+	r.Params = params
+	return err
+}
+
+// params returns the parameters forwarded to the provider, including the suffix if set.
+func (r *CompletionRequest) params() map[string]interface{} {
+	if r.Suffix == "" {
+		return r.Params
+	}
+
+	params := make(map[string]interface{}, len(r.Params)+1)
+	for key, value := range r.Params {
+		params[key] = value
+	}
+	params["suffix"] = r.Suffix
+	return params
+}
+
+// extraParams decodes a JSON object and returns its fields minus the known ones.
+func extraParams(data []byte, known ...string) (map[string]interface{}, error) {
+	var params map[string]interface{}
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, err
+	}
+	for _, key := range known {
+		delete(params, key)
+	}
+	return params, nil
 }
 
 // ModelsResponse represents an OpenAI models list response.
@@ -52,34 +209,171 @@ type ModelInfo struct {
 
 // HandleChatCompletions handles chat completion requests.
 func (p *OpenAIProxy) HandleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	r, cancel, ok := p.withRequestTimeout(w, r)
+	if !ok {
+		return
+	}
+	defer cancel()
+
 	var req ChatCompletionRequest
-	if err := p.decodeJSONRequest(r, &req, w); err != nil {
+	body, err := p.decodeJSONRequest(r, &req, w)
+	if err != nil {
 		return
 	}
 
+	r, chat, err := p.prepareChatRequest(r, &req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Stream {
+		chunks, err := p.mux.ChatCompletionStream(r.Context(), chat.model, chat.messages, chat.params)
+		forwardRateLimitHeaders(w, chat.upstream)
+		p.handleStream(w, chunks, err, "chat completion")
+		return
+	}
+
+	r, usage := withUsageCollector(r)
+	p.serveKeepalive(w, r, func(w http.ResponseWriter) {
+		p.serveIdempotent(w, r, body, func(w http.ResponseWriter) {
+			result, err := p.chatCompletion(r.Context(), chat.model, chat.messages, chat.params)
+			forwardRateLimitHeaders(w, chat.upstream)
+			p.reportUsage(w, usage, result)
+			p.handleResponse(w, result, err, "chat completion")
+		})
+	})
+}
+
+// chatRequest is a chat completion request prepared by prepareChatRequest.
+type chatRequest struct {
+	model    string
+	messages []map[string]interface{}
+	params   map[string]interface{}
+	// upstream collects the headers of the provider's response
+	upstream *provider.ResponseHeaders
+}
+
+// prepareChatRequest prepares req, sent with r, as every endpoint serving chat completions does:
+// it normalizes the model, checks the messages against the model's limit, applies the model's
+// defaults and system prompt, and returns r with the routing its headers and messages ask for.
+// It only fails if the request is invalid, which should be answered with a 400.
+func (p *OpenAIProxy) prepareChatRequest(
+	r *http.Request, req *ChatCompletionRequest,
+) (*http.Request, *chatRequest, error) {
 	model := p.normalizeModel(req.Model)
-	result, err := p.mux.ChatCompletion(r.Context(), model, req.Messages)
-	p.handleResponse(w, result, err, "chat completion")
+	if err := p.checkMaxMessages(model, req.Messages); err != nil {
+		return r, nil, err
+	}
+
+	chat := &chatRequest{
+		model:    model,
+		messages: p.applySystemPrompt(model, req.Messages),
+		params:   p.applyModelDefaults(model, req.Params),
+	}
+	r = withRequiredCapabilities(withFallback(r), chat.messages)
+	r, chat.upstream = withUpstreamHeaders(r)
+	return r, chat, nil
+}
+
+// chatCompletion sends a chat completion request through the multiplexer, repairing malformed
+// JSON in the response if that's enabled and the request asked for JSON.
+func (p *OpenAIProxy) chatCompletion(
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+) (interface{}, error) {
+	if !p.repairJSON {
+		return p.mux.ChatCompletion(ctx, model, messages, params)
+	}
+
+	ctx = providers.WithJSONRepair(ctx)
+	result, err := p.mux.ChatCompletion(ctx, model, messages, params)
+	if err == nil {
+		providers.RepairJSONResponse(ctx, model, params, result)
+	}
+	return result, err
 }
 
 // HandleCompletions handles completion requests.
 func (p *OpenAIProxy) HandleCompletions(w http.ResponseWriter, r *http.Request) {
+	r, cancel, ok := p.withRequestTimeout(w, r)
+	if !ok {
+		return
+	}
+	defer cancel()
+
 	var req CompletionRequest
-	if err := p.decodeJSONRequest(r, &req, w); err != nil {
+	body, err := p.decodeJSONRequest(r, &req, w)
+	if err != nil {
 		return
 	}
 
 	model := p.normalizeModel(req.Model)
-	result, err := p.mux.Completion(r.Context(), model, req.Prompt)
-	p.handleResponse(w, result, err, "completion")
+	params := p.applyModelDefaults(model, req.params())
+	r = withRequiredCapabilities(withFallback(r), nil)
+	r, upstream := withUpstreamHeaders(r)
+	if req.Stream {
+		chunks, err := p.mux.CompletionStream(r.Context(), model, req.Prompt, params)
+		forwardRateLimitHeaders(w, upstream)
+		p.handleStream(w, chunks, err, "completion")
+		return
+	}
+
+	r, usage := withUsageCollector(r)
+	p.serveKeepalive(w, r, func(w http.ResponseWriter) {
+		p.serveIdempotent(w, r, body, func(w http.ResponseWriter) {
+			result, err := p.mux.Completion(r.Context(), model, req.Prompt, params)
+			forwardRateLimitHeaders(w, upstream)
+			p.reportUsage(w, usage, result)
+			p.handleResponse(w, result, err, "completion")
+		})
+	})
 }
 
 // HandleModels handles model listing requests.
-func (p *OpenAIProxy) HandleModels(w http.ResponseWriter, _ *http.Request) {
+func (p *OpenAIProxy) HandleModels(w http.ResponseWriter, r *http.Request) {
+	response := p.models.get(p.mux.ModelsVersion(), p.buildModelsResponse)
+	p.writeJSONResponse(w, p.allowedModels(r.Context(), response), "models")
+}
+
+// allowedModels returns response with only the models ctx allows (see multiplexer.WithAllowedModels).
+// The cached response is shared by all requests, so it's copied rather than filtered in place.
+func (p *OpenAIProxy) allowedModels(ctx context.Context, response *ModelsResponse) *ModelsResponse {
+	allowed := &ModelsResponse{Object: response.Object, Data: make([]ModelInfo, 0, len(response.Data))}
+	for _, info := range response.Data {
+		if multiplexer.ModelAllowed(ctx, p.normalizeModel(info.ID)) {
+			allowed.Data = append(allowed.Data, info)
+		}
+	}
+	return allowed
+}
+
+// modelsCache holds the most recently built /models response, which is rebuilt only when
+// the multiplexer's models change, since clients poll it often and it can list hundreds of models.
+type modelsCache struct {
+	mu       sync.Mutex
+	version  uint64
+	response *ModelsResponse
+}
+
+// get returns the cached response if it was built for version, and otherwise builds and caches a new one.
+func (c *modelsCache) get(version uint64, build func() *ModelsResponse) *ModelsResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.response == nil || c.version != version {
+		c.response, c.version = build(), version
+	}
+	return c.response
+}
+
+// buildModelsResponse lists the multiplexer's models, with the model prefix if configured to advertise it.
+func (p *OpenAIProxy) buildModelsResponse() *ModelsResponse {
 	models := p.mux.ListModels()
 
 	data := make([]ModelInfo, len(models))
 	for i, model := range models {
+		if p.prefixModels {
+			model = p.prefix() + model
+		}
 		data[i] = ModelInfo{
 			ID:      model,
 			Object:  "model",
@@ -88,23 +382,74 @@ func (p *OpenAIProxy) HandleModels(w http.ResponseWriter, _ *http.Request) {
 		}
 	}
 
-	response := ModelsResponse{
+	return &ModelsResponse{
 		Object: "list",
 		Data:   data,
 	}
-
-	p.writeJSONResponse(w, response, "models")
 }
 
-func (p *OpenAIProxy) decodeJSONRequest(r *http.Request, req interface{}, w http.ResponseWriter) error {
-	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
-		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
-		return err
+// decodeJSONRequest reads the whole body (bounded by maxRequestSize) before decoding,
+// so that a decode failure can echo a preview of what the client actually sent, and returns it.
+// Chunked bodies are read in full just the same: inbound bodies are never streamed upstream.
+func (p *OpenAIProxy) decodeJSONRequest(r *http.Request, req interface{}, w http.ResponseWriter) ([]byte, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, p.maxRequestSize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeError(w, http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("Request body exceeds %d bytes", maxBytesErr.Limit))
+			return nil, err
+		}
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Failed to read request body: %v", err))
+		return nil, err
+	}
+
+	if err := json.Unmarshal(body, req); err != nil {
+		writeError(w, http.StatusBadRequest,
+			fmt.Sprintf("Invalid JSON: %v (body: %q)", err, provider.Preview(body, bodyPreviewLength)))
+		return nil, err
 	}
-	return nil
+	return body, nil
 }
 
 func (p *OpenAIProxy) handleResponse(w http.ResponseWriter, result interface{}, err error, operation string) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		slog.Warn("Operation timed out", "operation", operation, "error", err)
+		writeErrorType(w, http.StatusGatewayTimeout, "Request timed out", "timeout_error")
+		return
+	}
+	if errors.Is(err, multiplexer.ErrModelNotFound) {
+		writeErrorType(w, http.StatusNotFound, err.Error(), "invalid_request_error")
+		return
+	}
+	var notPulled *providers.ModelNotPulledError
+	if errors.As(err, &notPulled) {
+		writeErrorType(w, http.StatusNotFound, notPulled.Error(), "invalid_request_error")
+		return
+	}
+	if errors.Is(err, provider.ErrNotSupported) {
+		writeErrorType(w, http.StatusBadRequest, err.Error(), "invalid_request_error")
+		return
+	}
+	if errors.Is(err, multiplexer.ErrUnsupportedCapability) || errors.Is(err, multiplexer.ErrInvalidFallback) ||
+		errors.Is(err, providers.ErrTooManyMessages) {
+		writeErrorType(w, http.StatusBadRequest, err.Error(), "invalid_request_error")
+		return
+	}
+	if errors.Is(err, multiplexer.ErrOffline) {
+		writeErrorType(w, http.StatusForbidden, err.Error(), "permission_error")
+		return
+	}
+	if errors.Is(err, providers.ErrInvalidJSON) || errors.Is(err, providers.ErrNonJSONResponse) {
+		slog.Warn("Provider did not return JSON", "operation", operation, "error", err)
+		writeErrorType(w, http.StatusBadGateway, err.Error(), "server_error")
+		return
+	}
+	if errors.Is(err, providers.ErrUnexpectedResponse) {
+		slog.Warn("Provider returned an unexpected response", "operation", operation, "error", err)
+		writeErrorType(w, http.StatusBadGateway, err.Error(), "server_error")
+		return
+	}
 	if err != nil {
 		slog.Error("Operation failed", "operation", operation, "error", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -122,25 +467,68 @@ func (p *OpenAIProxy) writeJSONResponse(w http.ResponseWriter, data interface{},
 	}
 }
 
+// applyModelDefaults returns params with the model's configured defaults filled in.
+// Values set on the request take precedence over defaults.
+func (p *OpenAIProxy) applyModelDefaults(model string, params map[string]interface{}) map[string]interface{} {
+	defaults := p.modelDefaults[model]
+	if len(defaults) == 0 {
+		return params
+	}
+
+	merged := make(map[string]interface{}, len(defaults)+len(params))
+	for key, value := range defaults {
+		merged[key] = value
+	}
+	for key, value := range params {
+		merged[key] = value
+	}
+	return merged
+}
+
+// applySystemPrompt returns messages with the model's configured system prompt added.
+func (p *OpenAIProxy) applySystemPrompt(model string, messages []map[string]interface{}) []map[string]interface{} {
+	configured, ok := p.systemPrompts[model]
+	if !ok {
+		return messages
+	}
+	return providers.ApplySystemPrompt(messages, configured.SystemPrompt, configured.SystemPromptMode)
+}
+
+// checkMaxMessages returns an error if messages are more than the model's configured limit.
+func (p *OpenAIProxy) checkMaxMessages(model string, messages []map[string]interface{}) error {
+	return providers.CheckMaxMessages(messages, p.maxMessages[model], model)
+}
+
 func (p *OpenAIProxy) normalizeModel(model string) string {
-	if strings.HasPrefix(model, "modelplex-") {
-		return strings.TrimPrefix(model, "modelplex-")
+	return strings.TrimPrefix(model, p.prefix())
+}
+
+// prefix returns the configured model prefix, falling back to "modelplex-".
+func (p *OpenAIProxy) prefix() string {
+	if p.modelPrefix == "" {
+		return defaultModelPrefix
 	}
-	return model
+	return p.modelPrefix
 }
 
 func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeErrorType(w, statusCode, message, "invalid_request_error")
+}
+
+func writeErrorType(w http.ResponseWriter, statusCode int, message, errorType string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 
-	errorResp := map[string]interface{}{
+	if err := json.NewEncoder(w).Encode(errorBody(message, errorType)); err != nil {
+		slog.Error("Failed to encode error response", "error", err)
+	}
+}
+
+func errorBody(message, errorType string) map[string]interface{} {
+	return map[string]interface{}{
 		"error": map[string]interface{}{
 			"message": message,
-			"type":    "invalid_request_error",
+			"type":    errorType,
 		},
 	}
-
-	if err := json.NewEncoder(w).Encode(errorResp); err != nil {
-		slog.Error("Failed to encode error response", "error", err)
-	}
 }
@@ -5,27 +5,66 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/monitoring"
+	"github.com/modelplex/modelplex/internal/multiplexer"
+	"github.com/modelplex/modelplex/internal/providers"
+	"github.com/modelplex/modelplex/pkg/provider"
 )
 
 // MockMultiplexer implements the multiplexer interface for testing
 type MockMultiplexer struct {
 	mock.Mock
+	modelsVersion uint64
+}
+
+func (m *MockMultiplexer) ChatCompletion(
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+) (interface{}, error) {
+	args := m.Called(ctx, model, messages, params)
+	return args.Get(0), args.Error(1)
 }
 
-func (m *MockMultiplexer) ChatCompletion(ctx context.Context, model string, messages []map[string]interface{}) (interface{}, error) {
-	args := m.Called(ctx, model, messages)
+func (m *MockMultiplexer) Completion(ctx context.Context, model, prompt string, params map[string]interface{}) (interface{}, error) {
+	args := m.Called(ctx, model, prompt, params)
 	return args.Get(0), args.Error(1)
 }
 
-func (m *MockMultiplexer) Completion(ctx context.Context, model, prompt string) (interface{}, error) {
-	args := m.Called(ctx, model, prompt)
+func (m *MockMultiplexer) ChatCompletionStream(
+	ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+) (<-chan providers.StreamChunk, error) {
+	args := m.Called(ctx, model, messages, params)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(<-chan providers.StreamChunk), args.Error(1)
+}
+
+func (m *MockMultiplexer) CompletionStream(
+	ctx context.Context, model, prompt string, params map[string]interface{},
+) (<-chan providers.StreamChunk, error) {
+	args := m.Called(ctx, model, prompt, params)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(<-chan providers.StreamChunk), args.Error(1)
+}
+
+func (m *MockMultiplexer) Embeddings(
+	ctx context.Context, model string, input interface{}, params map[string]interface{},
+) (interface{}, error) {
+	args := m.Called(ctx, model, input, params)
 	return args.Get(0), args.Error(1)
 }
 
@@ -34,6 +73,10 @@ func (m *MockMultiplexer) ListModels() []string {
 	return args.Get(0).([]string)
 }
 
+func (m *MockMultiplexer) ModelsVersion() uint64 {
+	return m.modelsVersion
+}
+
 func TestOpenAIProxy_HandleChatCompletions(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -98,13 +141,13 @@ func TestOpenAIProxy_HandleChatCompletions(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockMux := &MockMultiplexer{}
-			proxy := New(mockMux)
+			proxy := New(mockMux, &config.Config{})
 
 			// Set up mock expectations
 			if tt.mockError != nil {
-				mockMux.On("ChatCompletion", mock.Anything, tt.expectedModel, mock.Anything).Return(nil, tt.mockError)
+				mockMux.On("ChatCompletion", mock.Anything, tt.expectedModel, mock.Anything, mock.Anything).Return(nil, tt.mockError)
 			} else {
-				mockMux.On("ChatCompletion", mock.Anything, tt.expectedModel, mock.Anything).Return(tt.mockResponse, nil)
+				mockMux.On("ChatCompletion", mock.Anything, tt.expectedModel, mock.Anything, mock.Anything).Return(tt.mockResponse, nil)
 			}
 
 			// Create request
@@ -135,7 +178,7 @@ func TestOpenAIProxy_HandleChatCompletions(t *testing.T) {
 
 func TestOpenAIProxy_HandleChatCompletions_InvalidJSON(t *testing.T) {
 	mockMux := &MockMultiplexer{}
-	proxy := New(mockMux)
+	proxy := New(mockMux, &config.Config{})
 
 	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte("invalid json")))
 	req.Header.Set("Content-Type", "application/json")
@@ -147,9 +190,85 @@ func TestOpenAIProxy_HandleChatCompletions_InvalidJSON(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "Invalid JSON")
 }
 
+func TestOpenAIProxy_HandleChatCompletions_InvalidJSONPreview(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{})
+
+	body := `{"model": "gpt-4", "messages": [` + strings.Repeat(`{"role": "user"},`, 50)
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	proxy.HandleChatCompletions(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var response map[string]interface{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+
+	message := response["error"].(map[string]interface{})["message"].(string)
+	assert.Contains(t, message, "Invalid JSON")
+	assert.Contains(t, message, `{\"model\": \"gpt-4\"`)
+	assert.True(t, strings.HasSuffix(message, `...")`), "long bodies should be truncated: %s", message)
+}
+
+func TestOpenAIProxy_HandleChatCompletions_BodyTooLarge(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{Server: config.Server{MaxRequestSize: 16}})
+
+	body := `{"model": "gpt-4", "messages": []}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	proxy.HandleChatCompletions(w, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), "exceeds 16 bytes")
+	mockMux.AssertNotCalled(t, "ChatCompletion", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestOpenAIProxy_HandleChatCompletions_Chunked(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{})
+
+	messages := []map[string]interface{}{
+		{"role": "user", "content": "Hello"},
+	}
+	mockMux.On("ChatCompletion", mock.Anything, "gpt-4", messages, mock.Anything).
+		Return(map[string]interface{}{"id": "chatcmpl-123"}, nil)
+
+	// A chunked upload carries no Content-Length
+	body := `{"model": "gpt-4", "messages": [{"role": "user", "content": "Hello"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", io.NopCloser(strings.NewReader(body)))
+	req.ContentLength = -1
+	req.TransferEncoding = []string{"chunked"}
+	w := httptest.NewRecorder()
+
+	proxy.HandleChatCompletions(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockMux.AssertExpectations(t)
+}
+
+func TestOpenAIProxy_HandleChatCompletions_ChunkedTooLarge(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{Server: config.Server{MaxRequestSize: 16}})
+
+	body := `{"model": "gpt-4", "messages": []}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", io.NopCloser(strings.NewReader(body)))
+	req.ContentLength = -1
+	req.TransferEncoding = []string{"chunked"}
+	w := httptest.NewRecorder()
+
+	proxy.HandleChatCompletions(w, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	mockMux.AssertNotCalled(t, "ChatCompletion", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
 func TestOpenAIProxy_HandleCompletions(t *testing.T) {
 	mockMux := &MockMultiplexer{}
-	proxy := New(mockMux)
+	proxy := New(mockMux, &config.Config{})
 
 	requestBody := map[string]interface{}{
 		"model":  "gpt-3.5-turbo-instruct",
@@ -168,7 +287,7 @@ func TestOpenAIProxy_HandleCompletions(t *testing.T) {
 		},
 	}
 
-	mockMux.On("Completion", mock.Anything, "gpt-3.5-turbo-instruct", "Complete this sentence").Return(mockResponse, nil)
+	mockMux.On("Completion", mock.Anything, "gpt-3.5-turbo-instruct", "Complete this sentence", mock.Anything).Return(mockResponse, nil)
 
 	reqBody, err := json.Marshal(requestBody)
 	require.NoError(t, err)
@@ -189,9 +308,230 @@ func TestOpenAIProxy_HandleCompletions(t *testing.T) {
 	mockMux.AssertExpectations(t)
 }
 
+func TestOpenAIProxy_HandleCompletions_Suffix(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{})
+
+	params := map[string]interface{}{"suffix": "\n    return result", "max_tokens": float64(64)}
+	mockMux.On("Completion", mock.Anything, "codellama", "def compute():\n", params).
+		Return(map[string]interface{}{"object": "text_completion"}, nil)
+
+	body := `{"model": "codellama", "prompt": "def compute():\n", "suffix": "\n    return result", "max_tokens": 64}`
+	req := httptest.NewRequest("POST", "/v1/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	proxy.HandleCompletions(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockMux.AssertExpectations(t)
+}
+
+func TestOpenAIProxy_HandleChatCompletions_NonObjectResponse(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{})
+
+	mockMux.On("ChatCompletion", mock.Anything, "gpt-4", mock.Anything, mock.Anything).
+		Return([]interface{}{"unexpected", float64(1)}, nil)
+
+	body := `{"model": "gpt-4", "messages": [{"role": "user", "content": "Hello"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	proxy.HandleChatCompletions(w, req)
+
+	// Whatever JSON the upstream returned is relayed as-is
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `["unexpected", 1]`, w.Body.String())
+}
+
+func TestOpenAIProxy_HandleChatCompletions_ModelNotFound(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{})
+
+	mockMux.On("ChatCompletion", mock.Anything, "gpt-5", mock.Anything, mock.Anything).
+		Return(nil, fmt.Errorf("%w: gpt-5", multiplexer.ErrModelNotFound))
+
+	body := `{"model": "gpt-5", "messages": [{"role": "user", "content": "Hello"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	proxy.HandleChatCompletions(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "model not found: gpt-5")
+	assert.Contains(t, w.Body.String(), "invalid_request_error")
+}
+
+func TestOpenAIProxy_HandleChatCompletions_Offline(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{})
+
+	mockMux.On("ChatCompletion", mock.Anything, "gpt-4", mock.Anything, mock.Anything).
+		Return(nil, fmt.Errorf("%w: gpt-4 is only served by providers that need network access", multiplexer.ErrOffline))
+
+	body := `{"model": "gpt-4", "messages": [{"role": "user", "content": "Hello"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	proxy.HandleChatCompletions(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "offline mode: gpt-4")
+}
+
+func TestOpenAIProxy_HandleCompletions_NotSupported(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{})
+
+	notSupported := fmt.Errorf("%w: text completions", provider.ErrNotSupported)
+	mockMux.On("Completion", mock.Anything, "chat-only", "Hello", mock.Anything).Return(nil, notSupported)
+	mockMux.On("CompletionStream", mock.Anything, "chat-only", "Hello", mock.Anything).Return(nil, notSupported)
+
+	for _, body := range []string{
+		`{"model": "chat-only", "prompt": "Hello"}`,
+		`{"model": "chat-only", "prompt": "Hello", "stream": true}`,
+	} {
+		req := httptest.NewRequest("POST", "/v1/completions", strings.NewReader(body))
+		w := httptest.NewRecorder()
+
+		proxy.HandleCompletions(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "not supported by provider: text completions")
+		assert.Contains(t, w.Body.String(), "invalid_request_error")
+	}
+}
+
+func TestOpenAIProxy_HandleChatCompletions_InvalidJSON_Response(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{})
+
+	mockMux.On("ChatCompletion", mock.Anything, "claude", mock.Anything, mock.Anything).
+		Return(nil, fmt.Errorf("anthropic: %w", providers.ErrInvalidJSON))
+
+	body := `{"model": "claude", "messages": [{"role": "user", "content": "Hello"}], "response_format": {"type": "json_object"}}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	proxy.HandleChatCompletions(w, req)
+
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), "not a valid JSON object")
+}
+
+func TestOpenAIProxy_HandleChatCompletions_UnexpectedResponse(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{})
+
+	mockMux.On("ChatCompletion", mock.Anything, "claude", mock.Anything, mock.Anything).
+		Return(nil, fmt.Errorf("%w: cannot normalize response without content", providers.ErrUnexpectedResponse))
+
+	body := `{"model": "claude", "messages": [{"role": "user", "content": "Hello"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	proxy.HandleChatCompletions(w, req)
+
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), "cannot normalize response without content")
+	assert.Contains(t, w.Body.String(), "server_error")
+}
+
+func TestOpenAIProxy_HandleChatCompletions_ModelNotPulled(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{})
+
+	mockMux.On("ChatCompletion", mock.Anything, "llama3", mock.Anything, mock.Anything).
+		Return(nil, &providers.ModelNotPulledError{Model: "llama3", Provider: "local"})
+
+	body := `{"model": "llama3", "messages": [{"role": "user", "content": "Hello"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	proxy.HandleChatCompletions(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "pull it with `ollama pull llama3`")
+}
+
+func TestOpenAIProxy_HandleChatCompletions_RepairJSON(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{Server: config.Server{RepairJSON: true}})
+
+	response := func() interface{} {
+		return map[string]interface{}{"choices": []interface{}{map[string]interface{}{
+			"message": map[string]interface{}{"role": "assistant", "content": `{answer: 42,`},
+		}}}
+	}
+	mockMux.On("ChatCompletion", mock.Anything, "llama3", mock.Anything, mock.Anything).
+		Return(response(), nil).Once()
+	mockMux.On("ChatCompletion", mock.Anything, "llama3", mock.Anything, mock.Anything).
+		Return(response(), nil).Once()
+
+	body := `{"model": "llama3", "messages": [{"role": "user", "content": "Hi"}], "response_format": {"type": "json_object"}}`
+	w := httptest.NewRecorder()
+	proxy.HandleChatCompletions(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"content":"{\"answer\": 42}"`)
+
+	// Responses that weren't asked to be JSON are left alone
+	body = `{"model": "llama3", "messages": [{"role": "user", "content": "Hi"}]}`
+	w = httptest.NewRecorder()
+	proxy.HandleChatCompletions(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"content":"{answer: 42,"`)
+}
+
+func TestOpenAIProxy_HandleChatCompletions_Usage(t *testing.T) {
+	cost := 0.0075
+	recordUsage := func(args mock.Arguments) {
+		monitoring.RecordUsage(args.Get(0).(context.Context), &monitoring.RequestUsage{
+			Provider: "openai", Model: "gpt-4o", PromptTokens: 1000, CompletionTokens: 500, TotalTokens: 1500,
+			LatencyMS: 120, EstimatedCost: &cost,
+		})
+	}
+	want := `{"provider": "openai", "model": "gpt-4o", "prompt_tokens": 1000, "completion_tokens": 500,
+		"total_tokens": 1500, "latency_ms": 120, "estimated_cost": 0.0075}`
+	body := `{"model": "gpt-4o", "messages": [{"role": "user", "content": "Hi"}]}`
+
+	for _, inject := range []bool{false, true} {
+		mockMux := &MockMultiplexer{}
+		proxy := New(mockMux, &config.Config{Server: config.Server{InjectUsage: inject}})
+		mockMux.On("ChatCompletion", mock.Anything, "gpt-4o", mock.Anything, mock.Anything).
+			Run(recordUsage).Return(map[string]interface{}{"id": "chatcmpl-1"}, nil)
+
+		w := httptest.NewRecorder()
+		proxy.HandleChatCompletions(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, want, w.Header().Get(UsageHeader))
+
+		var response map[string]json.RawMessage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		if inject {
+			assert.JSONEq(t, want, string(response["_modelplex"]))
+		} else {
+			assert.NotContains(t, response, "_modelplex")
+		}
+	}
+
+	// Failed requests have no usage
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{Server: config.Server{InjectUsage: true}})
+	mockMux.On("ChatCompletion", mock.Anything, "gpt-4o", mock.Anything, mock.Anything).
+		Return(nil, multiplexer.ErrModelNotFound)
+
+	w := httptest.NewRecorder()
+	proxy.HandleChatCompletions(w, httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body)))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Header().Get(UsageHeader))
+}
+
 func TestOpenAIProxy_HandleModels(t *testing.T) {
 	mockMux := &MockMultiplexer{}
-	proxy := New(mockMux)
+	proxy := New(mockMux, &config.Config{})
 
 	mockModels := []string{"gpt-4", "gpt-3.5-turbo", "claude-3-sonnet"}
 	mockMux.On("ListModels").Return(mockModels)
@@ -220,6 +560,37 @@ func TestOpenAIProxy_HandleModels(t *testing.T) {
 	mockMux.AssertExpectations(t)
 }
 
+func TestOpenAIProxy_HandleModels_Cached(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{})
+
+	listModels := func() []string {
+		w := httptest.NewRecorder()
+		proxy.HandleModels(w, httptest.NewRequest("GET", "/v1/models", http.NoBody))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response ModelsResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		ids := make([]string, 0, len(response.Data))
+		for _, model := range response.Data {
+			ids = append(ids, model.ID)
+		}
+		return ids
+	}
+
+	// The response is built once per version of the models
+	mockMux.On("ListModels").Return([]string{"gpt-4"}).Once()
+	assert.Equal(t, []string{"gpt-4"}, listModels())
+	assert.Equal(t, []string{"gpt-4"}, listModels())
+
+	mockMux.modelsVersion++
+	mockMux.On("ListModels").Return([]string{"gpt-4", "llama3"}).Once()
+	assert.Equal(t, []string{"gpt-4", "llama3"}, listModels())
+	assert.Equal(t, []string{"gpt-4", "llama3"}, listModels())
+
+	mockMux.AssertExpectations(t)
+}
+
 func TestNormalizeModel(t *testing.T) {
 	proxy := &OpenAIProxy{}
 
@@ -242,6 +613,41 @@ func TestNormalizeModel(t *testing.T) {
 	}
 }
 
+func TestNormalizeModel_CustomPrefix(t *testing.T) {
+	proxy := New(&MockMultiplexer{}, &config.Config{Server: config.Server{ModelPrefix: "acme-"}})
+
+	assert.Equal(t, "gpt-4", proxy.normalizeModel("acme-gpt-4"))
+	assert.Equal(t, "modelplex-gpt-4", proxy.normalizeModel("modelplex-gpt-4"))
+	assert.Equal(t, "gpt-4", proxy.normalizeModel("gpt-4"))
+}
+
+func TestOpenAIProxy_HandleModels_PrefixModels(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{Server: config.Server{ModelPrefix: "acme-", PrefixModels: true}})
+
+	mockMux.On("ListModels").Return([]string{"gpt-4", "claude-3-sonnet"})
+	mockMux.On("ChatCompletion", mock.Anything, "gpt-4", mock.Anything, mock.Anything).Return(map[string]interface{}{"id": "x"}, nil)
+
+	req := httptest.NewRequest("GET", "/v1/models", http.NoBody)
+	w := httptest.NewRecorder()
+	proxy.HandleModels(w, req)
+
+	var response ModelsResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	require.Len(t, response.Data, 2)
+	assert.Equal(t, "acme-gpt-4", response.Data[0].ID)
+	assert.Equal(t, "acme-claude-3-sonnet", response.Data[1].ID)
+
+	// Advertised names round-trip back to the underlying model
+	body := `{"model": "` + response.Data[0].ID + `", "messages": []}`
+	req = httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	proxy.HandleChatCompletions(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockMux.AssertExpectations(t)
+}
+
 func TestWriteError(t *testing.T) {
 	w := httptest.NewRecorder()
 
@@ -258,3 +664,146 @@ func TestWriteError(t *testing.T) {
 	assert.Equal(t, "Test error message", errorObj["message"])
 	assert.Equal(t, "invalid_request_error", errorObj["type"])
 }
+
+func TestOpenAIProxy_ModelDefaults(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{
+		ModelDefaults: []config.ModelDefaults{
+			{"model": "gpt-4", "temperature": 0.2, "max_tokens": int64(1000)},
+		},
+	})
+
+	expectedParams := map[string]interface{}{
+		"temperature": 0.9,
+		"max_tokens":  int64(1000),
+		"user":        "agent-1",
+	}
+	mockMux.On("ChatCompletion", mock.Anything, "gpt-4", mock.Anything, expectedParams).
+		Return(map[string]interface{}{"id": "x"}, nil)
+	mockMux.On("Completion", mock.Anything, "llama2", "Hi", map[string]interface{}{}).
+		Return(map[string]interface{}{"id": "y"}, nil)
+
+	// Request values override defaults, and unknown fields pass through
+	body := `{"model": "modelplex-gpt-4", "messages": [], "temperature": 0.9, "user": "agent-1"}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	proxy.HandleChatCompletions(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Models without defaults forward only what the client sent
+	req = httptest.NewRequest("POST", "/v1/completions", strings.NewReader(`{"model": "llama2", "prompt": "Hi"}`))
+	w = httptest.NewRecorder()
+	proxy.HandleCompletions(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	mockMux.AssertExpectations(t)
+}
+
+func TestOpenAIProxy_ModelSystemPrompt(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{
+		Models: []config.Model{
+			{Name: "gpt-4", SystemPrompt: "Be brief.", SystemPromptMode: "override"},
+		},
+	})
+
+	expected := []map[string]interface{}{
+		{"role": "system", "content": "Be brief."},
+		{"role": "user", "content": "Hello"},
+	}
+	mockMux.On("ChatCompletion", mock.Anything, "gpt-4", expected, mock.Anything).
+		Return(map[string]interface{}{"id": "x"}, nil)
+
+	body := `{"model": "gpt-4", "messages": [{"role": "system", "content": "Be verbose."}, ` +
+		`{"role": "user", "content": "Hello"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	proxy.HandleChatCompletions(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	mockMux.AssertExpectations(t)
+}
+
+func TestOpenAIProxy_ModelMaxMessages(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{
+		Models: []config.Model{{Name: "gpt-4", MaxMessages: 2}},
+	})
+	mockMux.On("ChatCompletion", mock.Anything, "gpt-4", mock.Anything, mock.Anything).
+		Return(map[string]interface{}{"id": "x"}, nil)
+
+	send := func(messages int) *httptest.ResponseRecorder {
+		history := strings.Repeat(`{"role": "user", "content": "Hello"}, `, messages-1)
+		body := `{"model": "gpt-4", "messages": [` + history + `{"role": "user", "content": "Hello"}]}`
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		proxy.HandleChatCompletions(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send(2).Code)
+	mockMux.AssertNumberOfCalls(t, "ChatCompletion", 1)
+
+	// Requests over the limit are rejected without being sent
+	w := send(3)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "too many messages: 3, more than the limit of 2 for gpt-4")
+	mockMux.AssertNumberOfCalls(t, "ChatCompletion", 1)
+}
+
+func TestOpenAIProxy_ToolChoice(t *testing.T) {
+	var received map[string]interface{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = nil
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id": "x", "choices": []}`))
+	}))
+	defer upstream.Close()
+
+	mux := multiplexer.New([]config.Provider{
+		{Name: "openai", Type: "openai", BaseURL: upstream.URL, Models: []string{"gpt-4o"}},
+	})
+	proxy := New(mux, &config.Config{})
+	tools := `[{"type": "function", "function": {"name": "get_weather", "parameters": {"type": "object"}}}]`
+
+	for _, toolChoice := range []string{
+		`"auto"`, `"none"`, `"required"`, `{"type": "function", "function": {"name": "get_weather"}}`,
+	} {
+		t.Run(toolChoice, func(t *testing.T) {
+			body := `{"model": "gpt-4o", "messages": [{"role": "user", "content": "Weather?"}], ` +
+				`"tools": ` + tools + `, "tool_choice": ` + toolChoice + `}`
+			req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+			w := httptest.NewRecorder()
+			proxy.HandleChatCompletions(w, req)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			var want interface{}
+			require.NoError(t, json.Unmarshal([]byte(toolChoice), &want))
+			assert.Equal(t, want, received["tool_choice"])
+			assert.NotEmpty(t, received["tools"])
+		})
+	}
+}
+
+func TestChatCompletionRequest_UnmarshalJSON(t *testing.T) {
+	var req ChatCompletionRequest
+	err := json.Unmarshal([]byte(`{
+		"model": "gpt-4",
+		"messages": [{"role": "user", "content": "Hello"}],
+		"stream": true,
+		"temperature": 0.5,
+		"metadata": {"session": "abc"}
+	}`), &req)
+	require.NoError(t, err)
+
+	assert.Equal(t, "gpt-4", req.Model)
+	assert.Len(t, req.Messages, 1)
+	assert.True(t, req.Stream)
+	assert.Equal(t, map[string]interface{}{
+		"temperature": 0.5,
+		"metadata":    map[string]interface{}{"session": "abc"},
+	}, req.Params)
+}
@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/modelplex/modelplex/pkg/provider"
+)
+
+// rateLimitHeaderPrefixes are the upstream response headers, lowercased, passed on to clients
+// verbatim so they can back off adaptively: OpenAI's "x-ratelimit-remaining-requests" and
+// the like, and Anthropic's "anthropic-ratelimit-*".
+var rateLimitHeaderPrefixes = []string{"x-ratelimit-", "anthropic-ratelimit-"}
+
+// withUpstreamHeaders returns r with a context that collects the upstream response headers.
+func withUpstreamHeaders(r *http.Request) (*http.Request, *provider.ResponseHeaders) {
+	ctx, upstream := provider.WithResponseHeaders(r.Context())
+	return r.WithContext(ctx), upstream
+}
+
+// forwardRateLimitHeaders copies the rate limit and "retry-after" headers of the upstream response
+// to w. It must be called before w's header is written.
+func forwardRateLimitHeaders(w http.ResponseWriter, upstream *provider.ResponseHeaders) {
+	for name, values := range upstream.Header() {
+		if isRateLimitHeader(name) {
+			w.Header()[name] = values
+		}
+	}
+}
+
+func isRateLimitHeader(name string) bool {
+	name = strings.ToLower(name)
+	if name == "retry-after" || name == "retry-after-ms" {
+		return true
+	}
+	for _, prefix := range rateLimitHeaderPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
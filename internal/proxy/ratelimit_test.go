@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/pkg/provider"
+)
+
+// recordUpstreamHeaders is a mock Run function that records an upstream response with rate limit headers.
+func recordUpstreamHeaders(args mock.Arguments) {
+	provider.RecordResponseHeaders(args.Get(0).(context.Context), http.Header{
+		"X-Ratelimit-Remaining-Requests":       {"59"},
+		"Anthropic-Ratelimit-Tokens-Remaining": {"1000"},
+		"Retry-After":                          {"20"},
+		"Set-Cookie":                           {"session=upstream"},
+	})
+}
+
+func TestOpenAIProxy_ForwardsRateLimitHeaders(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{})
+
+	mockMux.On("ChatCompletion", mock.Anything, "gpt-4", mock.Anything, mock.Anything).
+		Run(recordUpstreamHeaders).
+		Return(map[string]interface{}{"object": "chat.completion"}, nil)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(timeoutTestBody))
+	w := httptest.NewRecorder()
+	proxy.HandleChatCompletions(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "59", w.Header().Get("X-Ratelimit-Remaining-Requests"))
+	assert.Equal(t, "1000", w.Header().Get("Anthropic-Ratelimit-Tokens-Remaining"))
+	assert.Equal(t, "20", w.Header().Get("Retry-After"))
+	assert.Empty(t, w.Header().Get("Set-Cookie"), "only rate limit headers are forwarded")
+}
+
+func TestOpenAIProxy_ForwardsRateLimitHeaders_Error(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{})
+
+	mockMux.On("CompletionStream", mock.Anything, "gpt-4", "Hello", mock.Anything).
+		Run(recordUpstreamHeaders).
+		Return(nil, errors.New("API request failed with status 429"))
+
+	body := `{"model": "gpt-4", "prompt": "Hello", "stream": true}`
+	req := httptest.NewRequest("POST", "/v1/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	proxy.HandleCompletions(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "20", w.Header().Get("Retry-After"))
+}
@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultRealtimePingInterval = 30 * time.Second
+	// realtimeWriteTimeout bounds sending a ping or close message
+	realtimeWriteTimeout = 10 * time.Second
+
+	// realtimeDone ends the messages answering a request, like "data: [DONE]" ends a stream
+	realtimeDone = "[DONE]"
+)
+
+// realtimeError is the message answering a request that failed: the status and OpenAI-style
+// error it would have got over HTTP.
+type realtimeError struct {
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error"`
+}
+
+// AcquireFunc returns the proxy to answer one request with, and a function to call once it's
+// answered. It fails if ctx is done first.
+type AcquireFunc func(ctx context.Context) (*OpenAIProxy, func(), error)
+
+// HandleRealtime streams chat completions over a WebSocket, if enabled in the config. The client
+// sends chat completion requests as text messages, one at a time, and each is answered with the
+// chunks a stream of it would send as server-sent events, each as a text message, then "[DONE]".
+// Requests that fail are answered with a realtimeError instead, and the connection stays open.
+func (p *OpenAIProxy) HandleRealtime(w http.ResponseWriter, r *http.Request) {
+	p.ServeRealtime(w, r, func(context.Context) (*OpenAIProxy, func(), error) { return p, func() {}, nil })
+}
+
+// ServeRealtime serves a WebSocket as HandleRealtime does, except that each request is answered
+// by the proxy acquire returns for it, so a connection open across a config reload answers the
+// requests sent after it with the new config.
+func (p *OpenAIProxy) ServeRealtime(w http.ResponseWriter, r *http.Request, acquire AcquireFunc) {
+	if !p.realtime {
+		writeError(w, http.StatusNotFound, "WebSocket streaming is not enabled")
+		return
+	}
+
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		slog.Debug("WebSocket upgrade failed", "error", err)
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(p.maxRequestSize)
+
+	// Requests are read in the background, so that the client closing the connection cancels
+	// the request being answered
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	requests := make(chan []byte)
+	go func() {
+		defer cancel()
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				slog.Debug("WebSocket closed", "error", err)
+				return
+			}
+			if messageType != websocket.TextMessage {
+				closeRealtime(conn, websocket.CloseUnsupportedData, "Requests must be text messages")
+				return
+			}
+			if !utf8.Valid(data) {
+				closeRealtime(conn, websocket.CloseInvalidFramePayloadData, "Requests must be valid UTF-8")
+				return
+			}
+			select {
+			case requests <- data:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	pings := time.NewTicker(p.realtimePingInterval)
+	defer pings.Stop()
+	r = r.WithContext(ctx)
+	for {
+		select {
+		case data := <-requests:
+			proxy, release, err := acquire(ctx)
+			if err != nil {
+				closeRealtime(conn, websocket.CloseGoingAway, "")
+				return
+			}
+			proxy.serveRealtimeRequest(r, conn, data)
+			release()
+		case <-pings.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(realtimeWriteTimeout)); err != nil {
+				return
+			}
+		case <-ctx.Done():
+			// Either the client closed the connection, or the server is shutting down
+			closeRealtime(conn, websocket.CloseGoingAway, "")
+			return
+		}
+	}
+}
+
+// closeRealtime sends a close message with code and reason, which may fail if the connection
+// is already closed.
+func closeRealtime(conn *websocket.Conn, code int, reason string) {
+	message := websocket.FormatCloseMessage(code, reason)
+	_ = conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(realtimeWriteTimeout))
+}
+
+// serveRealtimeRequest answers one chat completion request sent over conn, bounded by the
+// timeout requested when the connection was opened.
+func (p *OpenAIProxy) serveRealtimeRequest(r *http.Request, conn *websocket.Conn, data []byte) {
+	rec := newResponseRecorder()
+	r, cancel, ok := p.withRequestTimeout(rec, r)
+	if !ok {
+		sendRealtimeError(conn, rec)
+		return
+	}
+	// Also stops the stream if the client can't be sent its chunks
+	defer cancel()
+
+	var req ChatCompletionRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		writeError(rec, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
+		sendRealtimeError(conn, rec)
+		return
+	}
+	r, chat, err := p.prepareChatRequest(r, &req)
+	if err != nil {
+		writeError(rec, http.StatusBadRequest, err.Error())
+		sendRealtimeError(conn, rec)
+		return
+	}
+	chunks, err := p.mux.ChatCompletionStream(r.Context(), chat.model, chat.messages, chat.params)
+	if err != nil {
+		p.handleResponse(rec, nil, err, "chat completion")
+		sendRealtimeError(conn, rec)
+		return
+	}
+
+	for chunk := range chunks {
+		var message []byte
+		switch {
+		case chunk.Err != nil:
+			slog.Error("Stream failed", "operation", "chat completion", "error", chunk.Err)
+			message, err = json.Marshal(errorBody("Stream interrupted by provider error", "server_error"))
+		case chunk.Done:
+			message = []byte(realtimeDone)
+		default:
+			message, err = json.Marshal(chunk.Data)
+		}
+		if err != nil {
+			slog.Error("Failed to encode stream chunk", "error", err)
+			continue
+		}
+
+		if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			slog.Debug("Failed to send stream chunk", "error", err)
+			return
+		}
+		if chunk.Err != nil || chunk.Done {
+			return
+		}
+	}
+}
+
+// sendRealtimeError sends the error response recorded in rec as a realtimeError.
+func sendRealtimeError(conn *websocket.Conn, rec *responseRecorder) {
+	result := newBatchResult(0, rec)
+	message, err := json.Marshal(&realtimeError{Status: result.Status, Error: result.Error})
+	if err != nil {
+		slog.Error("Failed to encode error", "error", err)
+		return
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+		slog.Debug("Failed to send error", "error", err)
+	}
+}
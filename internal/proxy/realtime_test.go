@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/multiplexer"
+	"github.com/modelplex/modelplex/internal/providers"
+	"github.com/modelplex/modelplex/test/testutil"
+)
+
+func newRealtimeServer(t *testing.T, mockMux *MockMultiplexer) *httptest.Server {
+	t.Helper()
+	cfg := &config.Config{Server: config.Server{Realtime: config.Realtime{Enabled: true}}}
+	server := httptest.NewServer(http.HandlerFunc(New(mockMux, cfg).HandleRealtime))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOpenAIProxy_HandleRealtime(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	server := newRealtimeServer(t, mockMux)
+
+	chunk := map[string]interface{}{
+		"object":  "chat.completion.chunk",
+		"choices": []interface{}{map[string]interface{}{"delta": map[string]interface{}{"content": "Hi"}}},
+	}
+	mockMux.On("ChatCompletionStream", mock.Anything, "gpt-4", mock.Anything, mock.Anything).Return(
+		chunkChannel(providers.StreamChunk{Data: chunk}, providers.StreamChunk{Done: true}), nil).Once()
+	mockMux.On("ChatCompletionStream", mock.Anything, "gpt-4", mock.Anything, mock.Anything).Return(
+		chunkChannel(providers.StreamChunk{Data: chunk}, providers.StreamChunk{Done: true}), nil).Once()
+
+	client := testutil.DialWebSocket(t, server.Listener.Addr().String(), "/models/v1/realtime")
+
+	// Requests are answered one after another on the same connection
+	for range 2 {
+		client.SendText(`{"model": "modelplex-gpt-4", "messages": [{"role": "user", "content": "Hello"}]}`)
+		var received map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(client.ReadText()), &received))
+		assert.Equal(t, "chat.completion.chunk", received["object"])
+		assert.Equal(t, "[DONE]", client.ReadText())
+	}
+
+	// The client closing the connection is acknowledged
+	client.Close(websocket.CloseNormalClosure)
+	assert.Equal(t, websocket.CloseNormalClosure, client.ReadClose())
+
+	mockMux.AssertExpectations(t)
+}
+
+func TestOpenAIProxy_HandleRealtime_Errors(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	server := newRealtimeServer(t, mockMux)
+	mockMux.On("ChatCompletionStream", mock.Anything, "unknown", mock.Anything, mock.Anything).Return(
+		nil, multiplexer.ErrModelNotFound)
+
+	client := testutil.DialWebSocket(t, server.Listener.Addr().String(), "/models/v1/realtime")
+
+	client.SendText(`{"model": "unknown", "messages": []}`)
+	var failed realtimeError
+	require.NoError(t, json.Unmarshal([]byte(client.ReadText()), &failed))
+	assert.Equal(t, http.StatusNotFound, failed.Status)
+	assert.Contains(t, string(failed.Error), "not found")
+
+	// The connection survives failed requests
+	client.SendText(`{not json`)
+	require.NoError(t, json.Unmarshal([]byte(client.ReadText()), &failed))
+	assert.Equal(t, http.StatusBadRequest, failed.Status)
+
+	// Requests must be text
+	client.Send(websocket.BinaryMessage, []byte{0x00})
+	assert.Equal(t, websocket.CloseUnsupportedData, client.ReadClose())
+}
+
+func TestOpenAIProxy_HandleRealtime_InvalidUTF8(t *testing.T) {
+	server := newRealtimeServer(t, &MockMultiplexer{})
+	client := testutil.DialWebSocket(t, server.Listener.Addr().String(), "/models/v1/realtime")
+
+	client.Send(websocket.TextMessage, []byte{'{', 0xff, '}'})
+	assert.Equal(t, websocket.CloseInvalidFramePayloadData, client.ReadClose())
+}
+
+func TestOpenAIProxy_HandleRealtime_Disabled(t *testing.T) {
+	proxy := New(&MockMultiplexer{}, &config.Config{})
+
+	w := httptest.NewRecorder()
+	proxy.HandleRealtime(w, httptest.NewRequest("GET", "/models/v1/realtime", http.NoBody))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestOpenAIProxy_HandleRealtime_MaxMessages(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	cfg := &config.Config{
+		Server: config.Server{Realtime: config.Realtime{Enabled: true}},
+		Models: []config.Model{{Name: "gpt-4", MaxMessages: 1}},
+	}
+	server := httptest.NewServer(http.HandlerFunc(New(mockMux, cfg).HandleRealtime))
+	t.Cleanup(server.Close)
+	client := testutil.DialWebSocket(t, server.Listener.Addr().String(), "/models/v1/realtime")
+
+	// Requests are checked as over HTTP, so too many messages is rejected without being sent
+	message := `{"role": "user", "content": "Hi"}`
+	client.SendText(`{"model": "gpt-4", "messages": [` + message + `, ` + message + `]}`)
+	var failed realtimeError
+	require.NoError(t, json.Unmarshal([]byte(client.ReadText()), &failed))
+	assert.Equal(t, http.StatusBadRequest, failed.Status)
+	assert.Contains(t, string(failed.Error), "too many messages")
+	mockMux.AssertNotCalled(t, "ChatCompletionStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/modelplex/modelplex/internal/providers"
+)
+
+// handleStream relays a stream started via the multiplexer to the client as server-sent events.
+// If the stream couldn't be started, err is reported like any other failed request.
+func (p *OpenAIProxy) handleStream(
+	w http.ResponseWriter, chunks <-chan providers.StreamChunk, err error, operation string,
+) {
+	if err != nil {
+		p.handleResponse(w, nil, err, operation)
+		return
+	}
+
+	p.writeStream(w, chunks, operation)
+}
+
+// writeStream writes each chunk as an SSE "data:" event, terminated by "data: [DONE]".
+// Once headers are sent the status can't change, so upstream failures become an error event.
+// If the client goes away, or can't be written to, it stops reading chunks and returns, so the
+// caller's cancel stops the upstream request.
+func (p *OpenAIProxy) writeStream(w http.ResponseWriter, chunks <-chan providers.StreamChunk, operation string) {
+	rc := startEventStream(w)
+	for chunk := range chunks {
+		var err error
+		switch {
+		case chunk.Err != nil:
+			slog.Error("Stream failed", "operation", operation, "error", chunk.Err)
+			err = writeSSEData(w, errorBody("Stream interrupted by provider error", "server_error"))
+		case chunk.Done:
+			_, err = fmt.Fprint(w, "data: [DONE]\n\n")
+		default:
+			err = writeSSEData(w, chunk.Data)
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+
+		if err != nil {
+			slog.Debug("Client went away, stopping stream", "operation", operation, "error", err)
+			return
+		}
+		if chunk.Err != nil || chunk.Done {
+			return
+		}
+	}
+}
+
+// startEventStream writes the status and headers of a server-sent events response, returning the
+// controller to flush its events with.
+func startEventStream(w http.ResponseWriter) *http.ResponseController {
+	rc := http.NewResponseController(w)
+
+	// Streams routinely outlive the server's write timeout, so lift it for this response
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		slog.Debug("Failed to clear write deadline for stream", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	return rc
+}
+
+// writeSSEData writes data as an SSE "data:" event, returning an error only if writing failed.
+// Chunks that can't be encoded are logged and skipped.
+func writeSSEData(w http.ResponseWriter, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		slog.Error("Failed to encode stream chunk", "error", err)
+		return nil
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", encoded)
+	return err
+}
@@ -0,0 +1,235 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/providers"
+)
+
+// chunkChannel returns a closed channel pre-filled with chunks
+func chunkChannel(chunks ...providers.StreamChunk) <-chan providers.StreamChunk {
+	ch := make(chan providers.StreamChunk, len(chunks))
+	for _, chunk := range chunks {
+		ch <- chunk
+	}
+	close(ch)
+	return ch
+}
+
+// readSSEData returns the payload of each "data:" event in an SSE body
+func readSSEData(t *testing.T, body string) []string {
+	t.Helper()
+
+	var events []string
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			events = append(events, data)
+		}
+	}
+	require.NoError(t, scanner.Err())
+	return events
+}
+
+func TestOpenAIProxy_HandleChatCompletions_Stream(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{})
+
+	chunks := chunkChannel(
+		providers.StreamChunk{Data: map[string]interface{}{
+			"object":  "chat.completion.chunk",
+			"choices": []interface{}{map[string]interface{}{"delta": map[string]interface{}{"content": "Hi"}}},
+		}},
+		providers.StreamChunk{Done: true},
+	)
+	mockMux.On("ChatCompletionStream", mock.Anything, "gpt-4", mock.Anything, mock.Anything).Return(chunks, nil)
+
+	body := `{"model": "modelplex-gpt-4", "messages": [{"role": "user", "content": "Hello"}], "stream": true}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	proxy.HandleChatCompletions(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+
+	events := readSSEData(t, w.Body.String())
+	require.Len(t, events, 2)
+
+	var chunk map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(events[0]), &chunk))
+	assert.Equal(t, "chat.completion.chunk", chunk["object"])
+	assert.Equal(t, "[DONE]", events[1])
+
+	mockMux.AssertExpectations(t)
+	mockMux.AssertNotCalled(t, "ChatCompletion", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestOpenAIProxy_HandleCompletions_Stream(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{})
+
+	chunks := chunkChannel(
+		providers.StreamChunk{Data: map[string]interface{}{
+			"object":  "text_completion",
+			"choices": []interface{}{map[string]interface{}{"text": " world"}},
+		}},
+		providers.StreamChunk{Done: true},
+	)
+	mockMux.On("CompletionStream", mock.Anything, "gpt-3.5-turbo-instruct", "Hello", mock.Anything).Return(chunks, nil)
+
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"model":  "gpt-3.5-turbo-instruct",
+		"prompt": "Hello",
+		"stream": true,
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/v1/completions", bytes.NewReader(reqBody))
+	w := httptest.NewRecorder()
+
+	proxy.HandleCompletions(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+
+	events := readSSEData(t, w.Body.String())
+	require.Len(t, events, 2)
+	assert.Contains(t, events[0], `"text":" world"`)
+	assert.Equal(t, "[DONE]", events[1])
+
+	mockMux.AssertExpectations(t)
+}
+
+func TestOpenAIProxy_Stream_ProviderErrorMidStream(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{})
+
+	chunks := chunkChannel(
+		providers.StreamChunk{Data: map[string]interface{}{"object": "chat.completion.chunk"}},
+		providers.StreamChunk{Err: errors.New("connection reset")},
+	)
+	mockMux.On("ChatCompletionStream", mock.Anything, "gpt-4", mock.Anything, mock.Anything).Return(chunks, nil)
+
+	body := `{"model": "gpt-4", "messages": [], "stream": true}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	proxy.HandleChatCompletions(w, req)
+
+	events := readSSEData(t, w.Body.String())
+	require.Len(t, events, 2)
+	assert.Contains(t, events[1], "server_error")
+	assert.NotContains(t, events[1], "connection reset")
+}
+
+func TestOpenAIProxy_Stream_StartError(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{})
+
+	mockMux.On("ChatCompletionStream", mock.Anything, "gpt-4", mock.Anything, mock.Anything).Return(nil, errors.New("unavailable"))
+
+	body := `{"model": "gpt-4", "messages": [], "stream": true}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	proxy.HandleChatCompletions(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestOpenAIProxy_Stream_ClientGoesAway(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{})
+
+	// An upstream that streams until it's stopped
+	chunks := make(chan providers.StreamChunk)
+	upstreamStopped := make(chan struct{})
+	mockMux.On("ChatCompletionStream", mock.Anything, "gpt-4", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			ctx := args.Get(0).(context.Context)
+			go func() {
+				defer close(upstreamStopped)
+				defer close(chunks)
+				chunk := providers.StreamChunk{Data: map[string]interface{}{"object": "chat.completion.chunk"}}
+				for {
+					select {
+					case chunks <- chunk:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+		}).
+		Return((<-chan providers.StreamChunk)(chunks), nil)
+
+	handlerDone := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(handlerDone)
+		proxy.HandleChatCompletions(w, r)
+	}))
+	defer server.Close()
+
+	body := `{"model": "gpt-4", "messages": [{"role": "user", "content": "Hello"}], "stream": true}`
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(line, "data: "))
+	resp.Body.Close()
+
+	// Closing the connection after the first chunk stops both the upstream and the handler
+	select {
+	case <-upstreamStopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("upstream still streaming after the client went away")
+	}
+	select {
+	case <-handlerDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler still running after the client went away")
+	}
+}
+
+// failingWriter is a ResponseWriter whose client has gone away
+type failingWriter struct {
+	header http.Header
+	writes int
+}
+
+func (w *failingWriter) Header() http.Header { return w.header }
+func (w *failingWriter) WriteHeader(int)     {}
+
+func (w *failingWriter) Write([]byte) (int, error) {
+	w.writes++
+	return 0, errors.New("broken pipe")
+}
+
+func TestOpenAIProxy_Stream_WriteError(t *testing.T) {
+	proxy := New(&MockMultiplexer{}, &config.Config{})
+	chunk := providers.StreamChunk{Data: map[string]interface{}{"object": "chat.completion.chunk"}}
+	chunks := make(chan providers.StreamChunk, 3)
+	chunks <- chunk
+	chunks <- chunk
+	chunks <- providers.StreamChunk{Done: true}
+
+	// Writing stops at the first failure, leaving the rest of the stream unread
+	w := &failingWriter{header: http.Header{}}
+	proxy.writeStream(w, chunks, "chat completion")
+	assert.Equal(t, 1, w.writes)
+	assert.Len(t, chunks, 2)
+}
@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// TimeoutHeader is the request header clients use to bound their own request, e.g. "10s"
+	TimeoutHeader = "X-Modelplex-Timeout"
+
+	defaultMaxRequestTimeout = 10 * time.Minute
+)
+
+// withRequestTimeout applies the client's TimeoutHeader, capped at maxRequestTimeout, to the
+// request's context. It writes a 400 and returns ok false if the header isn't a positive duration.
+// The caller must call cancel once the request is done, which also stops any upstream request
+// still running for it, such as a stream whose client went away.
+func (p *OpenAIProxy) withRequestTimeout(
+	w http.ResponseWriter, r *http.Request,
+) (_ *http.Request, cancel context.CancelFunc, ok bool) {
+	value := r.Header.Get(TimeoutHeader)
+	if value == "" {
+		ctx, cancel := context.WithCancel(r.Context())
+		return r.WithContext(ctx), cancel, true
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		writeError(w, http.StatusBadRequest,
+			fmt.Sprintf("Invalid %s %q: expected a positive duration such as \"10s\"", TimeoutHeader, value))
+		return r, nil, false
+	}
+	timeout = min(timeout, p.maxRequestTimeout)
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	return r.WithContext(ctx), cancel, true
+}
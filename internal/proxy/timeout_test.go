@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+)
+
+const timeoutTestBody = `{"model": "gpt-4", "messages": [{"role": "user", "content": "Hello"}]}`
+
+func TestOpenAIProxy_RequestTimeout(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{})
+
+	var deadline time.Time
+	mockMux.On("ChatCompletion", mock.Anything, "gpt-4", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			var ok bool
+			deadline, ok = args.Get(0).(context.Context).Deadline()
+			require.True(t, ok, "the request context should have a deadline")
+		}).
+		Return(map[string]interface{}{"object": "chat.completion"}, nil)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(timeoutTestBody))
+	req.Header.Set(TimeoutHeader, "10s")
+	w := httptest.NewRecorder()
+	proxy.HandleChatCompletions(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.WithinDuration(t, time.Now().Add(10*time.Second), deadline, time.Second)
+}
+
+func TestOpenAIProxy_RequestTimeout_Capped(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{Server: config.Server{
+		MaxRequestTimeout: config.Duration{Duration: time.Minute},
+	}})
+
+	var deadline time.Time
+	mockMux.On("Completion", mock.Anything, "gpt-4", "Hello", mock.Anything).
+		Run(func(args mock.Arguments) {
+			deadline, _ = args.Get(0).(context.Context).Deadline()
+		}).
+		Return(map[string]interface{}{"object": "text_completion"}, nil)
+
+	req := httptest.NewRequest("POST", "/v1/completions", strings.NewReader(`{"model": "gpt-4", "prompt": "Hello"}`))
+	req.Header.Set(TimeoutHeader, "24h")
+	w := httptest.NewRecorder()
+	proxy.HandleCompletions(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+}
+
+func TestOpenAIProxy_RequestTimeout_Invalid(t *testing.T) {
+	for _, value := range []string{"soon", "10", "-5s", "0s"} {
+		t.Run(value, func(t *testing.T) {
+			mockMux := &MockMultiplexer{}
+			proxy := New(mockMux, &config.Config{})
+
+			req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(timeoutTestBody))
+			req.Header.Set(TimeoutHeader, value)
+			w := httptest.NewRecorder()
+			proxy.HandleChatCompletions(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), TimeoutHeader)
+			mockMux.AssertNotCalled(t, "ChatCompletion", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestOpenAIProxy_RequestTimeout_Exceeded(t *testing.T) {
+	mockMux := &MockMultiplexer{}
+	proxy := New(mockMux, &config.Config{})
+
+	mockMux.On("ChatCompletion", mock.Anything, "gpt-4", mock.Anything, mock.Anything).
+		Return(nil, context.DeadlineExceeded)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(timeoutTestBody))
+	req.Header.Set(TimeoutHeader, "1ms")
+	w := httptest.NewRecorder()
+	proxy.HandleChatCompletions(w, req)
+
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Contains(t, w.Body.String(), "timeout_error")
+}
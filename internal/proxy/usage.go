@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/modelplex/modelplex/internal/monitoring"
+)
+
+const (
+	// UsageHeader carries the usage of a non-streaming completion as a monitoring.RequestUsage
+	// in JSON: the provider and model that answered it, token counts, latency and estimated cost.
+	UsageHeader = "X-Modelplex-Usage"
+	// usageField is the response field the usage is also added to, if InjectUsage is enabled
+	usageField = "_modelplex"
+)
+
+// withUsageCollector returns r with a context that collects the usage of its upstream request.
+func withUsageCollector(r *http.Request) (*http.Request, *monitoring.UsageCollector) {
+	ctx, collector := monitoring.WithUsageCollector(r.Context())
+	return r.WithContext(ctx), collector
+}
+
+// reportUsage sets UsageHeader on w to the usage collected for a request, and adds it to result
+// if usage injection is enabled. It does nothing if no usage was collected, as for failed requests.
+// It must be called before w's header is written.
+func (p *OpenAIProxy) reportUsage(w http.ResponseWriter, collector *monitoring.UsageCollector, result interface{}) {
+	usage, ok := collector.Usage()
+	if !ok {
+		return
+	}
+
+	encoded, err := json.Marshal(&usage)
+	if err != nil {
+		slog.Error("Failed to encode usage", "error", err)
+		return
+	}
+	w.Header().Set(UsageHeader, string(encoded))
+
+	if response, ok := result.(map[string]interface{}); ok && p.injectUsage {
+		response[usageField] = &usage
+	}
+}
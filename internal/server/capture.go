@@ -0,0 +1,128 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/modelplex/modelplex/internal/monitoring"
+)
+
+// defaultCaptureMaxSize is the size a capture file is rotated at if capture_max_size isn't set
+const defaultCaptureMaxSize = 100 << 20
+
+// redactedHeaders are the request headers that hold credentials, whose values aren't captured
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"X-Api-Key":           true,
+	"Api-Key":             true,
+}
+
+// redacted replaces the value of a redacted header in a capture
+const redacted = "[REDACTED]"
+
+// startCapture opens the capture file, if capture_file is set. The caller must hold mu.
+func (s *Server) startCapture() error {
+	cfg := s.current().config.Server
+	if cfg.CaptureFile == "" {
+		return nil
+	}
+	maxSize := cfg.CaptureMaxSize
+	if maxSize <= 0 {
+		maxSize = defaultCaptureMaxSize
+	}
+
+	capture, err := monitoring.NewCapture(cfg.CaptureFile, maxSize)
+	if err != nil {
+		return err
+	}
+	s.capture.Store(capture)
+	return nil
+}
+
+// stopCapture writes the requests still queued and closes the capture file. The caller must hold mu.
+func (s *Server) stopCapture() {
+	if capture := s.capture.Swap(nil); capture != nil {
+		capture.Close()
+	}
+}
+
+// captureRecorder records the status and body of a response while writing it.
+type captureRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *captureRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *captureRecorder) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// Unwrap lets http.ResponseController flush streamed responses through the recorder.
+func (w *captureRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// captureRequest serves r with handle, then records the request, the body handle read from it and
+// the response to capture, with credentials in the headers redacted.
+func captureRequest(
+	capture *monitoring.Capture, w http.ResponseWriter, r *http.Request,
+	handle func(http.ResponseWriter, *http.Request),
+) {
+	start := time.Now()
+	var request bytes.Buffer
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.TeeReader(r.Body, &request), r.Body}
+	recorder := &captureRecorder{ResponseWriter: w}
+
+	handle(recorder, r)
+
+	record := &monitoring.CaptureRecord{
+		Timestamp: start,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Headers:   captureHeaders(r.Header),
+		Status:    recorder.status,
+		Duration:  time.Since(start),
+	}
+	if json.Valid(request.Bytes()) {
+		record.Request = request.Bytes()
+	}
+	if response := bytes.TrimSpace(recorder.body.Bytes()); json.Valid(response) {
+		record.Response = response
+	} else {
+		record.Stream = string(response)
+	}
+	capture.Record(record)
+}
+
+// captureHeaders returns the headers of a request to capture, with credentials redacted.
+func captureHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string, len(header))
+	for name, values := range header {
+		if redactedHeaders[http.CanonicalHeaderKey(name)] {
+			headers[name] = redacted
+			continue
+		}
+		headers[name] = strings.Join(values, ", ")
+	}
+	return headers
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/modelplex/modelplex/internal/monitoring"
+	"github.com/modelplex/modelplex/internal/multiplexer"
+)
+
+// heartbeatJitter delays each heartbeat by a random amount of up to 1/heartbeatJitter of the interval
+const heartbeatJitter = 10
+
+// heartbeatSummary is what a heartbeat logs: the requests served since the last one, and the
+// providers' health now.
+type heartbeatSummary struct {
+	Requests  int64
+	Errors    int64
+	ErrorRate float64
+	Healthy   int
+	// Unhealthy names the providers that aren't reachable, or not yet known to be
+	Unhealthy []string
+}
+
+// heartbeat logs a heartbeatSummary about every interval until ctx is done.
+func heartbeat(ctx context.Context, rt *runtime, interval time.Duration) {
+	last := rt.mux.Metrics().Snapshot()
+	for {
+		jitter := rand.N(interval/heartbeatJitter + 1) // #nosec G404 -- jitter doesn't need a secure source
+		timer := time.NewTimer(interval + jitter)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		current := rt.mux.Metrics().Snapshot()
+		summary := summarize(last, current, rt.mux.Status())
+		slog.Info("Heartbeat", "requests", summary.Requests, "errors", summary.Errors,
+			"error_rate", summary.ErrorRate, "providers_healthy", summary.Healthy,
+			"providers_unhealthy", summary.Unhealthy)
+		last = current
+	}
+}
+
+// summarize returns the summary of the requests counted between the last and current metrics,
+// and of the providers' statuses.
+func summarize(
+	last, current map[string]monitoring.ProviderMetrics, statuses []multiplexer.ProviderStatus,
+) heartbeatSummary {
+	var summary heartbeatSummary
+	for name, metrics := range current {
+		summary.Requests += metrics.Requests - last[name].Requests
+		summary.Errors += metrics.Errors - last[name].Errors
+	}
+	if summary.Requests > 0 {
+		summary.ErrorRate = float64(summary.Errors) / float64(summary.Requests)
+	}
+
+	for _, status := range statuses {
+		switch status.Status {
+		case multiplexer.StatusOK:
+			summary.Healthy++
+		case multiplexer.StatusOffline:
+			// Unused in offline mode, so neither healthy nor a problem
+		default:
+			summary.Unhealthy = append(summary.Unhealthy, status.Name)
+		}
+	}
+	return summary
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/monitoring"
+	"github.com/modelplex/modelplex/internal/multiplexer"
+)
+
+func TestSummarize(t *testing.T) {
+	last := map[string]monitoring.ProviderMetrics{
+		"openai": {Requests: 10, Errors: 1, BytesSent: 100},
+	}
+	current := map[string]monitoring.ProviderMetrics{
+		"openai": {Requests: 16, Errors: 2, BytesSent: 200},
+		"local":  {Requests: 2, Errors: 1},
+	}
+	statuses := []multiplexer.ProviderStatus{
+		{Name: "openai", Status: multiplexer.StatusOK},
+		{Name: "local", Status: multiplexer.StatusDegraded},
+		{Name: "groq", Status: multiplexer.StatusPending},
+		{Name: "anthropic", Status: multiplexer.StatusOffline},
+	}
+
+	assert.Equal(t, heartbeatSummary{
+		Requests:  8,
+		Errors:    2,
+		ErrorRate: 0.25,
+		Healthy:   1,
+		Unhealthy: []string{"local", "groq"},
+	}, summarize(last, current, statuses))
+
+	// Without requests there's no error rate
+	assert.Equal(t, heartbeatSummary{}, summarize(current, current, nil))
+}
+
+func TestHeartbeat_StopsWithContext(t *testing.T) {
+	rt := newRuntime(&config.Config{}, monitoring.NewMetrics())
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		heartbeat(ctx, rt, time.Millisecond)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("heartbeat didn't stop with its context")
+	}
+}
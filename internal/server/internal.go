@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/modelplex/modelplex/internal/mcp"
+	"github.com/modelplex/modelplex/internal/monitoring"
+	"github.com/modelplex/modelplex/internal/multiplexer"
+)
+
+// setupInternalRoutes registers the "/_internal" endpoints, which are only served on the HTTP listener.
+// Those describing models and providers only describe the models the listener allows, and the
+// providers serving them.
+func (s *Server) setupInternalRoutes(router *mux.Router) {
+	internal := router.PathPrefix("/_internal").Subrouter()
+	internal.HandleFunc("/status", s.handleStatus).Methods("GET")
+	internal.HandleFunc("/models/refresh", s.handleModelsRefresh).Methods("POST")
+	internal.HandleFunc("/metrics", s.handleMetrics).Methods("GET")
+	internal.HandleFunc("/loglevel", s.handleLogLevel).Methods("POST")
+	internal.HandleFunc("/reload", s.handleReload).Methods("POST")
+	internal.HandleFunc("/mcp", s.handleMCPServers).Methods("GET")
+	internal.HandleFunc("/providers", s.handleProviders).Methods("GET")
+	internal.HandleFunc("/routing", s.handleRouting).Methods("GET")
+}
+
+// handleStatus reports whether each provider's upstream is reachable and each MCP server started.
+// The overall status is "degraded" if any provider is, or any MCP server failed, even though the
+// server keeps serving the others.
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	providers := s.current().mux.Status()
+	if visible, ok := s.visibleProviders(r.Context()); ok {
+		providers = slices.DeleteFunc(providers, func(status multiplexer.ProviderStatus) bool {
+			return !visible[status.Name]
+		})
+	}
+
+	status := multiplexer.StatusOK
+	for _, provider := range providers {
+		if provider.Status == multiplexer.StatusDegraded {
+			status = multiplexer.StatusDegraded
+		}
+	}
+
+	response := map[string]interface{}{"status": status, "providers": providers}
+	if client := s.mcp.Load(); client != nil {
+		servers := client.Status()
+		for _, server := range servers {
+			if server.Status == mcp.StatusFailed {
+				response["status"] = multiplexer.StatusDegraded
+			}
+		}
+		response["mcp"] = servers
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleMCPServers lists the configured MCP servers with how they're run, whether they started,
+// their tool counts and how many times a reload restarted them.
+func (s *Server) handleMCPServers(w http.ResponseWriter, _ *http.Request) {
+	servers := []mcp.ServerInfo{}
+	if client := s.mcp.Load(); client != nil {
+		servers = client.Servers()
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"servers": servers})
+}
+
+// handleProviders lists the providers with their types, priorities, the models routed to them
+// and the operations they support.
+func (s *Server) handleProviders(w http.ResponseWriter, r *http.Request) {
+	providers := s.current().mux.Providers()
+	if visible, ok := s.visibleProviders(r.Context()); ok {
+		providers = slices.DeleteFunc(providers, func(info multiplexer.ProviderInfo) bool {
+			return !visible[info.Name]
+		})
+		for i := range providers {
+			providers[i].Models = slices.DeleteFunc(providers[i].Models, func(model string) bool {
+				return !multiplexer.ModelAllowed(r.Context(), model)
+			})
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"providers": providers})
+}
+
+// handleRouting lists each model with the providers requests for it are sent to, in order,
+// after resolving aliases and applying priorities and offline mode.
+func (s *Server) handleRouting(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"models": s.routing(r.Context())})
+}
+
+// routing returns the routing of the models ctx allows.
+func (s *Server) routing(ctx context.Context) []multiplexer.Route {
+	return slices.DeleteFunc(s.current().mux.Routing(), func(route multiplexer.Route) bool {
+		return !multiplexer.ModelAllowed(ctx, route.Model)
+	})
+}
+
+// visibleProviders returns the names of the providers that requests for a model ctx allows are
+// routed to, and true, if ctx only allows some models (see multiplexer.WithAllowedModels).
+func (s *Server) visibleProviders(ctx context.Context) (map[string]bool, bool) {
+	if !multiplexer.ModelsRestricted(ctx) {
+		return nil, false
+	}
+	visible := make(map[string]bool)
+	for _, route := range s.routing(ctx) {
+		for _, name := range route.Providers {
+			visible[name] = true
+		}
+	}
+	return visible, true
+}
+
+// handleModelsRefresh re-runs model discovery across all providers and reports the resulting model count.
+func (s *Server) handleModelsRefresh(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), discoveryTimeout)
+	defer cancel()
+
+	count := s.current().mux.DiscoverModels(ctx)
+	slog.Info("Refreshed models", "models", count)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"models": count})
+}
+
+// handleMetrics reports the metrics collected per provider.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	metrics := s.current().mux.Metrics().Snapshot()
+	if visible, ok := s.visibleProviders(r.Context()); ok {
+		for name := range metrics {
+			if !visible[name] {
+				delete(metrics, name)
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"providers": metrics})
+}
+
+// handleLogLevel changes the process-wide log level, e.g. {"level": "debug"}, and reports the previous one.
+func (s *Server) handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Level string `json:"level"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err), "invalid_request_error")
+		return
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(req.Level)); err != nil {
+		writeError(w, http.StatusBadRequest,
+			fmt.Sprintf("Invalid level %q: expected debug, info, warn or error", req.Level), "invalid_request_error")
+		return
+	}
+
+	previous := monitoring.Level.Level()
+	monitoring.Level.Set(level)
+	slog.Info("Changed log level", "level", level, "previous", previous)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"level":    strings.ToLower(level.String()),
+		"previous": strings.ToLower(previous.String()),
+	})
+}
+
+// handleReload re-reads the config file and reports what changed. An invalid config is
+// rejected with the reason, and the running config stays in place.
+func (s *Server) handleReload(w http.ResponseWriter, _ *http.Request) {
+	summary, err := s.Reload()
+	switch {
+	case errors.Is(err, ErrReloadUnavailable):
+		writeError(w, http.StatusConflict, err.Error(), "invalid_request_error")
+	case err != nil:
+		slog.Error("Config reload failed", "error", err)
+		writeError(w, http.StatusUnprocessableEntity, err.Error(), "invalid_request_error")
+	default:
+		writeJSON(w, http.StatusOK, summary)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("Error writing response", "error", err)
+	}
+}
+
+// writeError writes an OpenAI-shaped error response.
+func writeError(w http.ResponseWriter, status int, message, errorType string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": message,
+			"type":    errorType,
+		},
+	})
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// parseListenAddress returns the HTTP listener's address, given as [HOST]:PORT, in the form
+// net.Listen takes. IPv6 hosts are bracketed, as in [::1]:8080; an empty host, as in :8080, binds
+// every interface, and so does a bare port, as in 8080.
+func parseListenAddress(addr string) (string, error) {
+	if addr != "" && strings.Trim(addr, "0123456789") == "" {
+		addr = ":" + addr
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err == nil && port == "" {
+		err = fmt.Errorf("address %s: missing port", addr)
+	}
+	if err == nil {
+		_, err = net.LookupPort("tcp", port)
+	}
+	if err != nil {
+		return "", fmt.Errorf("invalid HTTP address %q, expected [HOST]:PORT such as localhost:8080, "+
+			":8080 or [::1]:8080: %w", addr, err)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// listenTCP binds addr for the HTTP listener. SO_REUSEADDR is set so a restart can rebind
+// while connections from the previous process linger in TIME_WAIT. A positive backlog
+// overrides the system's default accept queue length.
+func listenTCP(addr string, backlog int) (net.Listener, error) {
+	lc := net.ListenConfig{Control: reuseAddr}
+	listener, err := lc.Listen(context.Background(), "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if backlog > 0 {
+		if err := setBacklog(listener, backlog); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+
+	return listener, nil
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseListenAddress(t *testing.T) {
+	tests := []struct {
+		addr    string
+		want    string
+		wantErr string
+	}{
+		{addr: "localhost:8080", want: "localhost:8080"},
+		{addr: "127.0.0.1:8080", want: "127.0.0.1:8080"},
+		{addr: "[::1]:11435", want: "[::1]:11435"},
+		{addr: "[::]:11435", want: "[::]:11435"},
+		{addr: ":8080", want: ":8080"},
+		{addr: "8080", want: ":8080"},
+		{addr: "localhost:http", want: "localhost:http"},
+		{addr: "::1:11435", wantErr: "too many colons"},
+		{addr: "localhost", wantErr: "missing port"},
+		{addr: "localhost:", wantErr: "missing port"},
+		{addr: "localhost:99999", wantErr: "invalid port"},
+		{addr: "", wantErr: "missing port"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			got, err := parseListenAddress(tt.addr)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				assert.Contains(t, err.Error(), "expected [HOST]:PORT")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestListenTCP_IPv6(t *testing.T) {
+	addr, err := parseListenAddress("[::1]:0")
+	require.NoError(t, err)
+	listener, err := listenTCP(addr, 0)
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	defer listener.Close()
+
+	ip := listener.Addr().(*net.TCPAddr).IP
+	assert.True(t, ip.Equal(net.IPv6loopback))
+}
@@ -0,0 +1,46 @@
+//go:build !windows
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// reuseAddr sets SO_REUSEADDR on a socket before it is bound.
+func reuseAddr(_, _ string, conn syscall.RawConn) error {
+	var sockErr error
+	err := conn.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// setBacklog calls listen(2) again on the bound socket, which updates its accept queue length.
+func setBacklog(listener net.Listener, backlog int) error {
+	tcp, ok := listener.(*net.TCPListener)
+	if !ok {
+		return fmt.Errorf("cannot set backlog on %T", listener)
+	}
+
+	conn, err := tcp.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var listenErr error
+	err = conn.Control(func(fd uintptr) {
+		listenErr = syscall.Listen(int(fd), backlog)
+	})
+	if err != nil {
+		return err
+	}
+	if listenErr != nil {
+		return fmt.Errorf("cannot set backlog to %d: %w", backlog, listenErr)
+	}
+	return nil
+}
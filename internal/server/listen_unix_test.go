@@ -0,0 +1,43 @@
+//go:build !windows
+
+package server
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenTCP_ReuseAddr(t *testing.T) {
+	listener, err := listenTCP("127.0.0.1:0", 16)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	conn, err := listener.(*net.TCPListener).SyscallConn()
+	require.NoError(t, err)
+
+	var value int
+	var sockErr error
+	require.NoError(t, conn.Control(func(fd uintptr) {
+		value, sockErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR)
+	}))
+	require.NoError(t, sockErr)
+	assert.NotZero(t, value)
+
+	// The port can be rebound immediately after a connection was accepted and closed
+	addr := listener.Addr().String()
+	client, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	server, err := listener.Accept()
+	require.NoError(t, err)
+	server.Close()
+	client.Close()
+	listener.Close()
+
+	listener, err = listenTCP(addr, 0)
+	require.NoError(t, err)
+	listener.Close()
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package server
+
+import (
+	"log/slog"
+	"net"
+	"syscall"
+)
+
+// reuseAddr is a no-op on Windows, where SO_REUSEADDR lets another process steal a bound port.
+func reuseAddr(_, _ string, _ syscall.RawConn) error {
+	return nil
+}
+
+// setBacklog is not supported on Windows; the system default backlog is used.
+func setBacklog(_ net.Listener, backlog int) error {
+	slog.Warn("listen_backlog is not supported on Windows, using the system default", "backlog", backlog)
+	return nil
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/modelplex/modelplex/internal/mcp"
+)
+
+// defaultToolTimeout bounds tool calls when mcp.tool_timeout isn't set
+const defaultToolTimeout = 60 * time.Second
+
+// toolCallRequest is the body of a tool call.
+type toolCallRequest struct {
+	Arguments map[string]interface{} `json:"arguments"`
+	// Stream relays the server's progress notifications as server-sent events before the result
+	Stream bool `json:"stream"`
+}
+
+// setupMCPRoutes registers the "/mcp/v1" endpoints, which expose the tools of the running MCP servers.
+func (s *Server) setupMCPRoutes(router *mux.Router) {
+	v1 := router.PathPrefix("/mcp/v1").Subrouter()
+	v1.HandleFunc("/tools", s.handleListTools).Methods("GET")
+	v1.HandleFunc("/tools/{tool}/call", s.handleCallTool).Methods("POST")
+}
+
+func (s *Server) handleListTools(w http.ResponseWriter, _ *http.Request) {
+	tools := []mcp.Tool{}
+	if client := s.mcp.Load(); client != nil {
+		tools = append(tools, client.ListTools()...)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"tools": tools})
+}
+
+// handleCallTool calls a tool and returns its result, bounded by mcp.tool_timeout. With
+// "stream": true, the result is sent as server-sent events: a "progress" event for each progress
+// notification from the server, then a final "result" or "error" event.
+func (s *Server) handleCallTool(w http.ResponseWriter, r *http.Request) {
+	client := s.mcp.Load()
+	if client == nil {
+		writeError(w, http.StatusNotFound, "No MCP servers are running", "invalid_request_error")
+		return
+	}
+
+	var req toolCallRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON in request body", "invalid_request_error")
+		return
+	}
+
+	timeout := s.current().config.MCP.ToolTimeout.Duration
+	if timeout <= 0 {
+		timeout = defaultToolTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	tool := mux.Vars(r)["tool"]
+	if !req.Stream {
+		result, err := client.CallTool(ctx, tool, req.Arguments)
+		if err != nil {
+			status, errorType := toolCallError(err)
+			writeError(w, status, err.Error(), errorType)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"result": result})
+		return
+	}
+
+	streamToolCall(ctx, w, client, tool, req.Arguments)
+}
+
+// streamToolCall calls a tool, relaying its progress to the client as server-sent events.
+// Once headers are sent the status can't change, so a failed call becomes an "error" event.
+func streamToolCall(
+	ctx context.Context, w http.ResponseWriter, client *mcp.Client, tool string, args map[string]interface{},
+) {
+	rc := http.NewResponseController(w)
+
+	// Tool calls routinely outlive the server's write timeout, so lift it for this response
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		slog.Debug("Failed to clear write deadline for tool call", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	writeEvent := func(event string, data interface{}) {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			slog.Error("Failed to encode tool call event", "tool", tool, "error", err)
+			return
+		}
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, encoded)
+		if err := rc.Flush(); err != nil {
+			slog.Debug("Failed to flush tool call event", "tool", tool, "error", err)
+		}
+	}
+
+	result, err := client.CallToolWithProgress(ctx, tool, args, func(progress mcp.Progress) {
+		writeEvent("progress", progress)
+	})
+	if err != nil {
+		_, errorType := toolCallError(err)
+		writeEvent("error", map[string]interface{}{"message": err.Error(), "type": errorType})
+		return
+	}
+	writeEvent("result", map[string]interface{}{"result": result})
+}
+
+// toolCallError maps a failed tool call to a status code and error type.
+func toolCallError(err error) (int, string) {
+	switch {
+	case errors.Is(err, mcp.ErrToolNotFound):
+		return http.StatusNotFound, "invalid_request_error"
+	case errors.Is(err, mcp.ErrToolNotAllowed):
+		return http.StatusForbidden, "permission_error"
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, "timeout_error"
+	default:
+		return http.StatusBadGateway, "server_error"
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/test/testutil"
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv(testutil.FakeMCPServerEnv) != "" {
+		testutil.RunFakeMCPServer(os.Stdin, os.Stdout)
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// newMCPServer returns a server running the fake MCP server from testutil, with its tools loaded.
+func newMCPServer(t *testing.T, toolTimeout time.Duration) *Server {
+	t.Helper()
+	srv := New(&config.Config{MCP: config.MCPConfig{
+		Servers:     []config.MCPServer{testutil.FakeMCPServer(t, "fake")},
+		ToolTimeout: config.Duration{Duration: toolTimeout},
+	}}, filepath.Join(t.TempDir(), "modelplex.socket"))
+	require.NoError(t, srv.startMCP())
+	t.Cleanup(srv.stopMCP)
+	require.Eventually(t, func() bool {
+		return len(srv.mcp.Load().ListTools()) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	return srv
+}
+
+func callTool(srv *Server, tool, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/mcp/v1/tools/"+tool+"/call", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	srv.socketRouter().ServeHTTP(w, req)
+	return w
+}
+
+func TestServer_SocketOnlyRoutes(t *testing.T) {
+	srv := newMCPServer(t, 0)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", "/mcp/v1/tools", http.NoBody),
+		httptest.NewRequest("POST", "/mcp/v1/tools/echo/call", strings.NewReader(`{"arguments":{}}`)),
+		httptest.NewRequest("GET", "/models/v1/realtime", http.NoBody),
+	} {
+		w := httptest.NewRecorder()
+		srv.httpRouter().ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code, req.URL.Path)
+	}
+}
+
+func TestServer_ListTools(t *testing.T) {
+	srv := newMCPServer(t, 0)
+
+	req := httptest.NewRequest("GET", "/mcp/v1/tools", http.NoBody)
+	w := httptest.NewRecorder()
+	srv.socketRouter().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Tools []struct {
+			Name string `json:"name"`
+		} `json:"tools"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Len(t, body.Tools, 4)
+}
+
+func TestServer_CallTool(t *testing.T) {
+	srv := newMCPServer(t, 0)
+
+	w := callTool(srv, "count", `{"arguments": {}}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"result": {"content": [{"type": "text", "text": "done"}]}}`, w.Body.String())
+}
+
+func TestServer_CallTool_Stream(t *testing.T) {
+	srv := newMCPServer(t, 0)
+
+	w := callTool(srv, "count", `{"arguments": {}, "stream": true}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Equal(t, `event: progress
+data: {"progress":1,"total":3,"message":"step 1"}
+
+event: progress
+data: {"progress":2,"total":3,"message":"step 2"}
+
+event: progress
+data: {"progress":3,"total":3,"message":"step 3"}
+
+event: result
+data: {"result":{"content":[{"text":"done","type":"text"}]}}
+
+`, w.Body.String())
+}
+
+func TestServer_CallTool_Errors(t *testing.T) {
+	srv := newMCPServer(t, 50*time.Millisecond)
+
+	tests := []struct {
+		tool   string
+		body   string
+		status int
+	}{
+		{"missing", `{}`, http.StatusNotFound},
+		{"fail", `{}`, http.StatusBadGateway},
+		{"hang", `{}`, http.StatusGatewayTimeout},
+		{"count", `{not json`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tool, func(t *testing.T) {
+			assert.Equal(t, tt.status, callTool(srv, tt.tool, tt.body).Code)
+		})
+	}
+
+	// A timed out stream ends with an error event instead
+	w := callTool(srv, "hang", `{"stream": true}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "event: error\n")
+	assert.Contains(t, w.Body.String(), context.DeadlineExceeded.Error())
+}
+
+func TestServer_CallTool_AllowedTools(t *testing.T) {
+	srv := New(&config.Config{MCP: config.MCPConfig{
+		Servers:      []config.MCPServer{testutil.FakeMCPServer(t, "fake")},
+		AllowedTools: []string{"count"},
+	}}, filepath.Join(t.TempDir(), "modelplex.socket"))
+	require.NoError(t, srv.startMCP())
+	t.Cleanup(srv.stopMCP)
+	require.Eventually(t, func() bool {
+		return len(srv.mcp.Load().ListTools()) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	w := httptest.NewRecorder()
+	srv.socketRouter().ServeHTTP(w, httptest.NewRequest("GET", "/mcp/v1/tools", http.NoBody))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"count"`)
+	assert.NotContains(t, w.Body.String(), `"name":"fail"`)
+
+	assert.Equal(t, http.StatusOK, callTool(srv, "count", `{}`).Code)
+	w = callTool(srv, "fail", `{}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "allowed_tools")
+}
+
+func TestServer_CallTool_NoMCP(t *testing.T) {
+	srv := New(&config.Config{}, filepath.Join(t.TempDir(), "modelplex.socket"))
+
+	w := callTool(srv, "count", `{}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelplex/modelplex/internal/config"
+)
+
+const (
+	defaultRateLimitMaxClients = 10000
+)
+
+// tokenBucket holds up to one minute's worth of requests and refills continuously.
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimiter enforces per-client requests-per-minute limits, tracking at most maxClients buckets.
+type rateLimiter struct {
+	mu         sync.Mutex
+	buckets    map[string]*tokenBucket
+	perMinute  int
+	keys       map[string]int
+	maxClients int
+	now        func() time.Time
+}
+
+func newRateLimiter(cfg config.RateLimit) *rateLimiter {
+	if cfg.RequestsPerMinute <= 0 && len(cfg.Keys) == 0 {
+		return nil
+	}
+
+	maxClients := cfg.MaxClients
+	if maxClients <= 0 {
+		maxClients = defaultRateLimitMaxClients
+	}
+
+	return &rateLimiter{
+		buckets:    make(map[string]*tokenBucket),
+		perMinute:  cfg.RequestsPerMinute,
+		keys:       cfg.Keys,
+		maxClients: maxClients,
+		now:        time.Now,
+	}
+}
+
+// allow takes a token for client, whose limit is perMinute requests per minute.
+// When the bucket is empty it returns false and how long until the next token is available.
+func (l *rateLimiter) allow(client string, perMinute int) (ok bool, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	capacity := float64(perMinute)
+	rate := capacity / time.Minute.Seconds()
+
+	bucket, exists := l.buckets[client]
+	if exists {
+		elapsed := now.Sub(bucket.updated).Seconds()
+		bucket.tokens = math.Min(capacity, bucket.tokens+elapsed*rate)
+		bucket.updated = now
+	} else {
+		if len(l.buckets) >= l.maxClients {
+			l.evict(now)
+		}
+		bucket = &tokenBucket{tokens: capacity, updated: now}
+		l.buckets[client] = bucket
+	}
+
+	if bucket.tokens < 1 {
+		wait := (1 - bucket.tokens) / rate
+		return false, time.Duration(wait * float64(time.Second))
+	}
+
+	bucket.tokens--
+	return true, 0
+}
+
+// evict drops buckets that have been idle long enough to refill, which are equivalent to new ones.
+// If none have, it drops the least recently used bucket. The caller must hold mu.
+func (l *rateLimiter) evict(now time.Time) {
+	var oldest string
+	for client, bucket := range l.buckets {
+		if now.Sub(bucket.updated) >= time.Minute {
+			delete(l.buckets, client)
+			continue
+		}
+		if oldest == "" || bucket.updated.Before(l.buckets[oldest].updated) {
+			oldest = client
+		}
+	}
+
+	if len(l.buckets) >= l.maxClients && oldest != "" {
+		delete(l.buckets, oldest)
+	}
+}
+
+// limit returns the client identity and its requests-per-minute limit for r. A zero limit means unlimited.
+// Clients are told apart by their bearer token only if it's one of the configured keys: tokens aren't
+// checked, so any other would let a client get a fresh bucket per request by changing its token.
+func (l *rateLimiter) limit(r *http.Request) (client string, perMinute int) {
+	if key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		if perMinute, ok := l.keys[key]; ok {
+			return "key:" + key, perMinute
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host, l.perMinute
+}
+
+// middleware rejects requests over the client's limit with 429 Too Many Requests and a Retry-After header.
+func (l *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, perMinute := l.limit(r)
+		if perMinute <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ok, retryAfter := l.allow(client, perMinute)
+		if !ok {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			writeError(w, http.StatusTooManyRequests,
+				"Rate limit exceeded, retry after "+strconv.Itoa(seconds)+"s", "rate_limit_error")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
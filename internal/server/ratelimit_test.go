@@ -0,0 +1,97 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+)
+
+func TestNewRateLimiter_Disabled(t *testing.T) {
+	assert.Nil(t, newRateLimiter(config.RateLimit{}))
+}
+
+func TestRateLimiter_Allow(t *testing.T) {
+	now := time.Now()
+	limiter := newRateLimiter(config.RateLimit{RequestsPerMinute: 2})
+	limiter.now = func() time.Time { return now }
+
+	ok, _ := limiter.allow("ip:127.0.0.1", 2)
+	assert.True(t, ok)
+	ok, _ = limiter.allow("ip:127.0.0.1", 2)
+	assert.True(t, ok)
+
+	ok, retryAfter := limiter.allow("ip:127.0.0.1", 2)
+	assert.False(t, ok)
+	assert.Equal(t, 30*time.Second, retryAfter)
+
+	// Other clients have their own bucket
+	ok, _ = limiter.allow("ip:127.0.0.2", 2)
+	assert.True(t, ok)
+
+	// Tokens refill over time
+	now = now.Add(30 * time.Second)
+	ok, _ = limiter.allow("ip:127.0.0.1", 2)
+	assert.True(t, ok)
+}
+
+func TestRateLimiter_Evict(t *testing.T) {
+	now := time.Now()
+	limiter := newRateLimiter(config.RateLimit{RequestsPerMinute: 1, MaxClients: 2})
+	limiter.now = func() time.Time { return now }
+
+	limiter.allow("a", 1)
+	now = now.Add(time.Second)
+	limiter.allow("b", 1)
+	now = now.Add(time.Second)
+	limiter.allow("c", 1)
+
+	assert.Len(t, limiter.buckets, 2)
+	assert.NotContains(t, limiter.buckets, "a")
+}
+
+func TestRateLimiter_Middleware(t *testing.T) {
+	srv := New(&config.Config{Server: config.Server{RateLimit: config.RateLimit{
+		RequestsPerMinute: 1,
+		Keys:              map[string]int{"sk-unlimited": 0, "sk-big": 100},
+	}}}, "modelplex.socket")
+	router := srv.httpRouter()
+
+	request := func(apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/health", http.NoBody)
+		if apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, request("").Code)
+	w := request("")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "rate_limit_error")
+
+	// Keys that aren't configured are limited with the client IP, so changing them doesn't help
+	assert.Equal(t, http.StatusTooManyRequests, request("sk-default").Code)
+	assert.Equal(t, http.StatusTooManyRequests, request("sk-other").Code)
+
+	// Configured keys are limited separately from the client IP
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusOK, request("sk-unlimited").Code)
+		assert.Equal(t, http.StatusOK, request("sk-big").Code)
+	}
+
+	// The socket listener is never rate limited
+	for i := 0; i < 5; i++ {
+		w := httptest.NewRecorder()
+		srv.socketRouter().ServeHTTP(w, httptest.NewRequest("GET", "/health", http.NoBody))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+}
@@ -0,0 +1,252 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/mcp"
+	"github.com/modelplex/modelplex/internal/monitoring"
+	"github.com/modelplex/modelplex/internal/multiplexer"
+	"github.com/modelplex/modelplex/internal/providers"
+	"github.com/modelplex/modelplex/internal/proxy"
+)
+
+// defaultDrainTimeout bounds a draining reload when reload.drain_timeout isn't set
+const defaultDrainTimeout = 30 * time.Second
+
+// ErrReloadUnavailable is returned by Reload when the server has no config file to reload from.
+var ErrReloadUnavailable = errors.New("no config file to reload")
+
+// runtime is everything the server builds from its config.
+// Reloading builds a new runtime and swaps it in; requests already in flight finish with the old one.
+type runtime struct {
+	config      *config.Config
+	mux         *multiplexer.ModelMultiplexer
+	proxy       *proxy.OpenAIProxy
+	rateLimiter *rateLimiter
+
+	// mu guards requests, which counts the requests in flight on the runtime (see acquire), and
+	// drained, which is closed once they're down to none if idle was called in the meantime
+	mu       sync.Mutex
+	requests int64
+	drained  chan struct{}
+}
+
+func newRuntime(cfg *config.Config, metrics *monitoring.Metrics) *runtime {
+	providers.ConfigureTransport(cfg.Server.ConnectionPool, metrics)
+	mux := multiplexer.NewFromConfig(cfg, metrics)
+	if cfg.Server.LogRequests {
+		mux.SetRequestLogger(monitoring.NewLogger(true))
+	}
+	return &runtime{
+		config:      cfg,
+		mux:         mux,
+		proxy:       proxy.New(mux, cfg),
+		rateLimiter: newRateLimiter(cfg.Server.RateLimit),
+	}
+}
+
+// current returns the runtime built from the most recently applied config.
+func (s *Server) current() *runtime {
+	return s.runtime.Load()
+}
+
+// acquire returns the runtime to serve a request with, counting the request in flight on it
+// until release is called. While a draining reload waits for the requests in flight, new ones
+// wait for it to swap in the new runtime, failing if ctx is done first.
+func (s *Server) acquire(ctx context.Context) (*runtime, error) {
+	for {
+		if gate := s.drainGate.Load(); gate != nil {
+			select {
+			case <-*gate:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		rt := s.current()
+		rt.mu.Lock()
+		rt.requests++
+		rt.mu.Unlock()
+		// A reload that started in the meantime may have missed this request, so retry with
+		// whatever runtime it swaps in
+		if s.current() == rt && s.drainGate.Load() == nil {
+			return rt, nil
+		}
+		rt.release()
+	}
+}
+
+// release ends a request counted in flight by acquire.
+func (rt *runtime) release() {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.requests--
+	if rt.requests == 0 && rt.drained != nil {
+		close(rt.drained)
+		rt.drained = nil
+	}
+}
+
+// idle returns a channel that's closed once no requests are in flight on the runtime, and the
+// number of requests in flight now.
+func (rt *runtime) idle() (<-chan struct{}, int64) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.requests == 0 {
+		idle := make(chan struct{})
+		close(idle)
+		return idle, 0
+	}
+	if rt.drained == nil {
+		rt.drained = make(chan struct{})
+	}
+	return rt.drained, rt.requests
+}
+
+// swapDrained swaps in next once the requests in flight on previous have finished, holding new
+// requests until then. If they haven't finished within timeout, next is swapped in anyway and
+// the number of requests still in flight on previous is returned.
+func (s *Server) swapDrained(previous, next *runtime, timeout time.Duration) int64 {
+	gate := make(chan struct{})
+	s.drainGate.Store(&gate)
+	defer func() {
+		s.runtime.Store(next)
+		s.drainGate.Store(nil)
+		close(gate)
+	}()
+
+	idle, _ := previous.idle()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	select {
+	case <-idle:
+		return 0
+	case <-deadline.C:
+		_, remaining := previous.idle()
+		return remaining
+	}
+}
+
+// ReloadSummary describes what a reload changed.
+type ReloadSummary struct {
+	ProvidersAdded   []string `json:"providers_added"`
+	ProvidersRemoved []string `json:"providers_removed"`
+	ProvidersChanged []string `json:"providers_changed"`
+	// Models is the number of routable models after the reload
+	Models int `json:"models"`
+	// Undrained is the number of requests still in flight with the old config when a draining
+	// reload timed out waiting for them
+	Undrained int64 `json:"undrained,omitempty"`
+	// MCP servers started, stopped and restarted; unchanged servers keep running
+	*mcp.ReloadSummary
+}
+
+// SetConfigPath sets the config file that Reload re-reads.
+func (s *Server) SetConfigPath(path string) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	s.configPath = path
+}
+
+// Reload re-reads the config file and swaps in providers, routing and request handling built from it.
+// If the new config can't be loaded, the running one is kept and the error returned.
+// Listener settings (socket path, HTTP address, listen_backlog) only take effect on restart.
+func (s *Server) Reload() (*ReloadSummary, error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	if s.configPath == "" {
+		return nil, ErrReloadUnavailable
+	}
+
+	cfg, err := config.Load(s.configPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot reload %s: %w", s.configPath, err)
+	}
+
+	previous := s.current()
+	next := newRuntime(cfg, previous.mux.Metrics())
+
+	ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+	count := next.mux.DiscoverModels(ctx)
+	cancel()
+
+	summary := diffProviders(previous.config.Providers, cfg.Providers)
+	summary.Models = count
+
+	if cfg.Server.Reload.Drain {
+		timeout := cfg.Server.Reload.DrainTimeout.Duration
+		if timeout <= 0 {
+			timeout = defaultDrainTimeout
+		}
+		summary.Undrained = s.swapDrained(previous, next, timeout)
+		if summary.Undrained > 0 {
+			slog.Warn("Requests still in flight with the old config after draining",
+				"requests", summary.Undrained, "timeout", timeout)
+		}
+	} else {
+		s.runtime.Store(next)
+	}
+
+	// Probe and refresh the new providers in place of the old ones
+	s.mu.Lock()
+	if s.running {
+		if s.stopBackground != nil {
+			s.stopBackground()
+		}
+		s.startBackground()
+	}
+	summary.ReloadSummary = s.reloadMCP()
+	s.mu.Unlock()
+
+	slog.Info("Reloaded configuration", "file", s.configPath,
+		"added", summary.ProvidersAdded, "removed", summary.ProvidersRemoved,
+		"changed", summary.ProvidersChanged, "models", count)
+	if summary.ReloadSummary != nil {
+		slog.Info("Reloaded MCP servers", "added", summary.Added, "removed", summary.Removed,
+			"restarted", summary.Restarted)
+	}
+
+	return summary, nil
+}
+
+// diffProviders compares provider configs by name.
+func diffProviders(previous, next []config.Provider) *ReloadSummary {
+	summary := &ReloadSummary{
+		ProvidersAdded:   []string{},
+		ProvidersRemoved: []string{},
+		ProvidersChanged: []string{},
+	}
+
+	old := make(map[string]config.Provider, len(previous))
+	for _, provider := range previous {
+		old[provider.Name] = provider
+	}
+
+	seen := make(map[string]bool, len(next))
+	for _, provider := range next {
+		seen[provider.Name] = true
+		before, existed := old[provider.Name]
+		switch {
+		case !existed:
+			summary.ProvidersAdded = append(summary.ProvidersAdded, provider.Name)
+		case !reflect.DeepEqual(before, provider):
+			summary.ProvidersChanged = append(summary.ProvidersChanged, provider.Name)
+		}
+	}
+
+	for _, provider := range previous {
+		if !seen[provider.Name] {
+			summary.ProvidersRemoved = append(summary.ProvidersRemoved, provider.Name)
+		}
+	}
+
+	return summary
+}
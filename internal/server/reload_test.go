@@ -0,0 +1,283 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/test/testutil"
+)
+
+func writeConfig(t *testing.T, path, data string) *config.Config {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+	cfg, err := config.Load(path)
+	require.NoError(t, err)
+	return cfg
+}
+
+func listModels(t *testing.T, router http.Handler) []string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/models", http.NoBody))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+
+	models := make([]string, 0, len(response.Data))
+	for _, model := range response.Data {
+		models = append(models, model.ID)
+	}
+	sort.Strings(models)
+	return models
+}
+
+func TestServer_Reload(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	cfg := writeConfig(t, configPath, `
+[[providers]]
+name = "openai"
+type = "openai"
+models = ["gpt-4"]
+
+[[providers]]
+name = "legacy"
+type = "openai"
+models = ["gpt-3.5-turbo"]
+`)
+
+	srv := New(cfg, filepath.Join(t.TempDir(), "modelplex.socket"))
+	srv.SetConfigPath(configPath)
+	srv.current().mux.Metrics().RecordCacheUsage("openai", 1, 0)
+	router := srv.httpRouter()
+	assert.Equal(t, []string{"gpt-3.5-turbo", "gpt-4"}, listModels(t, router))
+
+	writeConfig(t, configPath, `
+[[providers]]
+name = "openai"
+type = "openai"
+models = ["gpt-4", "gpt-4o"]
+
+[[providers]]
+name = "anthropic"
+type = "anthropic"
+models = ["claude-3-5-sonnet"]
+`)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/_internal/reload", http.NoBody))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"providers_added": ["anthropic"],
+		"providers_removed": ["legacy"],
+		"providers_changed": ["openai"],
+		"models": 3
+	}`, w.Body.String())
+
+	// The existing router serves the new config, and metrics carry over
+	assert.Equal(t, []string{"claude-3-5-sonnet", "gpt-4", "gpt-4o"}, listModels(t, router))
+	assert.Equal(t, int64(1), srv.current().mux.Metrics().Snapshot()["openai"].CacheReadTokens)
+}
+
+func TestServer_Reload_InvalidConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	cfg := writeConfig(t, configPath, `
+[[providers]]
+name = "openai"
+type = "openai"
+models = ["gpt-4"]
+`)
+
+	srv := New(cfg, filepath.Join(t.TempDir(), "modelplex.socket"))
+	srv.SetConfigPath(configPath)
+	router := srv.httpRouter()
+
+	require.NoError(t, os.WriteFile(configPath, []byte(`[server]
+log_format = "xml"
+`), 0o600))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/_internal/reload", http.NoBody))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "log_format")
+
+	// The running config is kept
+	assert.Equal(t, []string{"gpt-4"}, listModels(t, router))
+}
+
+func TestServer_Reload_NoConfigPath(t *testing.T) {
+	srv := New(&config.Config{}, filepath.Join(t.TempDir(), "modelplex.socket"))
+
+	w := httptest.NewRecorder()
+	srv.httpRouter().ServeHTTP(w, httptest.NewRequest("POST", "/_internal/reload", http.NoBody))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Not reachable over the socket
+	w = httptest.NewRecorder()
+	srv.socketRouter().ServeHTTP(w, httptest.NewRequest("POST", "/_internal/reload", http.NoBody))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestServer_Reload_MCP(t *testing.T) {
+	fake := testutil.FakeMCPServer(t, "fake")
+	mcpServer := func(name string, args ...string) string {
+		encoded, err := json.Marshal(append([]string{}, args...))
+		require.NoError(t, err)
+		return fmt.Sprintf("[[mcp.servers]]\nname = %q\ncommand = %q\nargs = %s\n", name, fake.Command, encoded)
+	}
+
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	cfg := writeConfig(t, configPath, mcpServer("files")+mcpServer("search"))
+
+	socketPath := filepath.Join(t.TempDir(), "modelplex.socket")
+	srv := New(cfg, socketPath)
+	srv.SetConfigPath(configPath)
+	go func() { _ = srv.Start() }()
+	defer srv.Stop()
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(socketPath)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	writeConfig(t, configPath, mcpServer("files")+mcpServer("search", "--v2")+mcpServer("shell"))
+
+	w := httptest.NewRecorder()
+	srv.httpRouter().ServeHTTP(w, httptest.NewRequest("POST", "/_internal/reload", http.NoBody))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"providers_added": [],
+		"providers_removed": [],
+		"providers_changed": [],
+		"models": 0,
+		"mcp_added": ["shell"],
+		"mcp_restarted": ["search"]
+	}`, w.Body.String())
+
+	var names []string
+	for _, status := range srv.mcp.Load().Status() {
+		names = append(names, status.Name)
+	}
+	assert.Equal(t, []string{"files", "search", "shell"}, names)
+}
+
+func TestServer_Reload_Drain(t *testing.T) {
+	// The upstream holds the first chat completion until released
+	received := make(chan struct{})
+	release := make(chan struct{})
+	var held atomic.Bool
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if held.CompareAndSwap(false, true) {
+			close(received)
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"object": "chat.completion"}`))
+	}))
+	defer upstream.Close()
+
+	providerConfig := func(timeout string, models string) string {
+		return fmt.Sprintf("[server.reload]\ndrain = true\ndrain_timeout = %q\n\n"+
+			"[[providers]]\nname = \"openai\"\ntype = \"openai\"\nbase_url = %q\nmodels = %s\n",
+			timeout, upstream.URL, models)
+	}
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	cfg := writeConfig(t, configPath, providerConfig("5s", `["gpt-4"]`))
+	srv := New(cfg, filepath.Join(t.TempDir(), "modelplex.socket"))
+	srv.SetConfigPath(configPath)
+	router := srv.httpRouter()
+
+	inFlight := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions",
+			strings.NewReader(`{"model": "gpt-4", "messages": [{"role": "user", "content": "Hi"}]}`)))
+		inFlight <- w.Code
+	}()
+	<-received
+
+	writeConfig(t, configPath, providerConfig("5s", `["gpt-4", "gpt-4o"]`))
+	reloaded := make(chan *ReloadSummary)
+	go func() {
+		summary, err := srv.Reload()
+		assert.NoError(t, err)
+		reloaded <- summary
+	}()
+	require.Eventually(t, func() bool { return srv.drainGate.Load() != nil }, time.Second, time.Millisecond)
+
+	// New requests wait for the request in flight, and are then served by the new config
+	models := make(chan *httptest.ResponseRecorder)
+	go func() {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/models", http.NoBody))
+		models <- w
+	}()
+	select {
+	case <-models:
+		t.Fatal("request served while draining")
+	case <-reloaded:
+		t.Fatal("reload finished while draining")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-inFlight)
+	assert.Zero(t, (<-reloaded).Undrained)
+	assert.Contains(t, (<-models).Body.String(), `"gpt-4o"`)
+}
+
+func TestServer_Reload_DrainTimeout(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	data := "[server.reload]\ndrain = true\ndrain_timeout = \"20ms\"\n"
+	srv := New(writeConfig(t, configPath, data), filepath.Join(t.TempDir(), "modelplex.socket"))
+	srv.SetConfigPath(configPath)
+
+	// A request that doesn't finish in time is left running with the old config
+	rt, err := srv.acquire(context.Background())
+	require.NoError(t, err)
+	defer rt.release()
+
+	summary, err := srv.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), summary.Undrained)
+	assert.NotSame(t, rt, srv.current())
+	assert.Nil(t, srv.drainGate.Load())
+}
+
+func TestServer_Reload_DrainRealtime(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	data := "[server.reload]\ndrain = true\ndrain_timeout = \"10s\"\n\n[server.realtime]\nenabled = true\n"
+	srv := New(writeConfig(t, configPath, data), filepath.Join(t.TempDir(), "modelplex.socket"))
+	srv.SetConfigPath(configPath)
+	server := httptest.NewServer(srv.socketRouter())
+	defer server.Close()
+
+	// An idle WebSocket connection has no request in flight to wait for
+	client := testutil.DialWebSocket(t, server.Listener.Addr().String(), "/models/v1/realtime")
+	start := time.Now()
+	summary, err := srv.Reload()
+	require.NoError(t, err)
+	assert.Zero(t, summary.Undrained)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	// Its next request is answered with the new config
+	client.SendText(`{"model": "unknown", "messages": [{"role": "user", "content": "Hello"}]}`)
+	assert.Contains(t, client.ReadText(), `"status":404`)
+}
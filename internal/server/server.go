@@ -1,54 +1,151 @@
 // Package server provides HTTP server functionality over Unix domain sockets.
+// An optional TCP listener serves the same API plus internal "/_internal" endpoints,
+// which are never exposed on the socket.
 package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io/fs"
 	"log/slog"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
 
 	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/mcp"
+	"github.com/modelplex/modelplex/internal/monitoring"
 	"github.com/modelplex/modelplex/internal/multiplexer"
 	"github.com/modelplex/modelplex/internal/proxy"
 )
 
 const (
 	// Server timeout constants
-	shutdownTimeout = 5 * time.Second
-	readTimeout     = 30 * time.Second
-	writeTimeout    = 30 * time.Second
+	shutdownTimeout  = 5 * time.Second
+	discoveryTimeout = 10 * time.Second
+	readTimeout      = 30 * time.Second
+	writeTimeout     = 30 * time.Second
+	// How long idle socket connections are kept open, unless configured otherwise
+	defaultSocketIdleTimeout = 5 * time.Minute
+	// Permissions for a socket directory created by create_socket_dir
+	socketDirMode = 0o750
+	// How long to wait for another process to answer on an existing socket before it's considered stale
+	socketDialTimeout = time.Second
+	// Startup probe defaults
+	defaultProbeRetries       = 3
+	defaultProbeInterval      = 2 * time.Second
+	defaultProbeRetryInterval = 30 * time.Second
 )
 
+// ErrServerRunning is returned by Start when the server is already running.
+var ErrServerRunning = errors.New("server is already running")
+
+// ErrSocketInUse is returned by Start when another process, such as another modelplex, is
+// accepting connections on the socket.
+var ErrSocketInUse = errors.New("socket in use by another process")
+
 // Server provides HTTP server functionality over Unix domain sockets.
+// Start and Stop are safe to call concurrently; Stop is a no-op if the server isn't running.
 type Server struct {
-	config     *config.Config
+	mu      sync.Mutex
+	running bool
+
 	socketPath string
+	httpAddr   string
 	listener   net.Listener
 	server     *http.Server
-	mux        *multiplexer.ModelMultiplexer
-	proxy      *proxy.OpenAIProxy
+	httpServer *http.Server
+	// ctx is cancelled by Stop, and every background task derives from it; Stop then
+	// waits for the tasks started with goBackground before returning
+	ctx        context.Context
+	cancel     context.CancelFunc
+	background sync.WaitGroup
+	// stopBackground stops the background provider probes and model refreshes of the current config
+	stopBackground func()
+	// mcp runs the configured MCP servers while the server is running
+	mcp atomic.Pointer[mcp.Client]
+	// capture records requests while the server is running, if capture_file is set
+	capture atomic.Pointer[monitoring.Capture]
+
+	// runtime holds everything built from the config, swapped as a whole on reload
+	runtime atomic.Pointer[runtime]
+	// drainGate is set while a draining reload waits for requests in flight, and closed once
+	// the new runtime is swapped in; see acquire
+	drainGate  atomic.Pointer[chan struct{}]
+	configPath string
+	reloadMu   sync.Mutex
 }
 
 // New creates a new server instance with the given configuration and socket path.
 func New(cfg *config.Config, socketPath string) *Server {
-	mux := multiplexer.New(cfg.Providers)
-	proxy := proxy.New(mux)
+	return NewWithHTTPAddress(cfg, socketPath, "")
+}
 
-	return &Server{
-		config:     cfg,
+// NewWithHTTPAddress creates a new server instance that also serves HTTP on httpAddr.
+// An empty httpAddr disables the HTTP listener.
+func NewWithHTTPAddress(cfg *config.Config, socketPath, httpAddr string) *Server {
+	s := &Server{
 		socketPath: socketPath,
-		mux:        mux,
-		proxy:      proxy,
+		httpAddr:   httpAddr,
 	}
+	s.runtime.Store(newRuntime(cfg, monitoring.NewMetrics()))
+	return s
 }
 
-// Start starts the HTTP server listening on the Unix socket.
+// Start starts the HTTP server listening on the Unix socket, blocking until it is stopped.
+// It returns ErrServerRunning if the server is already running.
 func (s *Server) Start() error {
-	if err := os.RemoveAll(s.socketPath); err != nil {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return ErrServerRunning
+	}
+	if err := s.startCapture(); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	if err := s.startMCP(); err != nil {
+		s.stopCapture()
+		s.mu.Unlock()
+		return err
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	if err := s.listen(); err != nil {
+		s.cancel()
+		s.background.Wait()
+		s.stopMCP()
+		s.stopCapture()
+		s.mu.Unlock()
+		return err
+	}
+	s.running = true
+	s.startBackground()
+	server, listener := s.server, s.listener
+	s.mu.Unlock()
+
+	slog.Info("Modelplex server listening", "socket", s.socketPath)
+	return server.Serve(listener)
+}
+
+// listen prepares the socket and HTTP listeners and their servers. The caller must hold mu.
+func (s *Server) listen() error {
+	if err := s.prepareSocketDir(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, discoveryTimeout)
+	count := s.current().mux.DiscoverModels(ctx)
+	cancel()
+	slog.Debug("Model routing ready", "models", count)
+
+	if err := s.removeStaleSocket(); err != nil {
 		return err
 	}
 
@@ -56,52 +153,361 @@ func (s *Server) Start() error {
 	if err != nil {
 		return err
 	}
+	if s.httpAddr != "" {
+		if err := s.startHTTP(); err != nil {
+			listener.Close()
+			return err
+		}
+	}
 	s.listener = listener
 
-	router := mux.NewRouter()
-	s.setupRoutes(router)
-
+	socket := s.current().config.Server.Socket
+	idleTimeout := socket.IdleTimeout.Duration
+	if idleTimeout == 0 {
+		idleTimeout = defaultSocketIdleTimeout
+	}
 	s.server = &http.Server{
-		Handler:      router,
+		Handler:      s.socketRouter(),
 		ReadTimeout:  readTimeout,
 		WriteTimeout: writeTimeout,
+		IdleTimeout:  idleTimeout,
 	}
+	s.server.SetKeepAlivesEnabled(!socket.DisableKeepAlives)
 
-	slog.Info("Modelplex server listening", "socket", s.socketPath)
-	return s.server.Serve(listener)
+	return nil
+}
+
+// startMCP starts the configured MCP servers. Servers that fail to start are reported in
+// /_internal/status, and fail startup if require_mcp is set. The caller must hold mu.
+func (s *Server) startMCP() error {
+	cfg := s.current().config.MCP
+	if len(cfg.Servers) == 0 {
+		return nil
+	}
+
+	client := mcp.NewMCPClient(cfg.Servers)
+	client.SetAllowedTools(cfg.AllowedTools)
+	if err := client.Err(); err != nil {
+		if cfg.RequireMCP {
+			client.Stop()
+			return fmt.Errorf("cannot start MCP servers (require_mcp is set): %w", err)
+		}
+		slog.Warn("Running without some MCP servers", "error", err)
+	}
+	s.mcp.Store(client)
+	return nil
+}
+
+// reloadMCP applies the current config's MCP servers, restarting only those that changed.
+// It returns nil if the server isn't running, since MCP servers are only started with it.
+// The caller must hold mu.
+func (s *Server) reloadMCP() *mcp.ReloadSummary {
+	if !s.running {
+		return nil
+	}
+
+	cfg := s.current().config.MCP
+	client := s.mcp.Load()
+	if client == nil {
+		client = mcp.NewMCPClient(nil)
+		s.mcp.Store(client)
+	}
+
+	client.SetAllowedTools(cfg.AllowedTools)
+	summary := client.Reload(cfg.Servers)
+	if err := client.Err(); err != nil {
+		slog.Warn("Running without some MCP servers", "error", err)
+	}
+	return summary
+}
+
+// stopMCP stops the MCP servers, if any are running. The caller must hold mu.
+func (s *Server) stopMCP() {
+	if client := s.mcp.Swap(nil); client != nil {
+		client.Stop()
+	}
+}
+
+// goBackground runs task in a goroutine that Stop waits for. Tasks that don't end by themselves
+// must return once s.ctx is cancelled. The caller must hold mu.
+func (s *Server) goBackground(task func()) {
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		task()
+	}()
+}
+
+// startBackground starts probing the providers' upstreams, refreshing their models and logging
+// heartbeats in the background until stopBackground is called, which waits for them to finish, or the server stops.
+// The caller must hold mu.
+func (s *Server) startBackground() {
+	rt := s.current()
+	ctx, cancel := context.WithCancel(s.ctx)
+	var wg sync.WaitGroup
+	s.stopBackground = func() {
+		cancel()
+		wg.Wait()
+	}
+
+	wg.Add(1)
+	s.goBackground(func() {
+		defer wg.Done()
+		rt.mux.RefreshModels(ctx)
+	})
+
+	if interval := rt.config.Server.HeartbeatInterval.Duration; interval > 0 {
+		wg.Add(1)
+		s.goBackground(func() {
+			defer wg.Done()
+			heartbeat(ctx, rt, interval)
+		})
+	}
+
+	cfg := rt.config.Server.StartupProbe
+	if cfg.Disabled {
+		return
+	}
+
+	opts := multiplexer.ProbeOptions{
+		Retries:       cfg.Retries,
+		Interval:      cfg.Interval.Duration,
+		RetryInterval: cfg.RetryInterval.Duration,
+	}
+	if opts.Retries <= 0 {
+		opts.Retries = defaultProbeRetries
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaultProbeInterval
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = defaultProbeRetryInterval
+	}
+	wg.Add(1)
+	s.goBackground(func() {
+		defer wg.Done()
+		rt.mux.ProbeProviders(ctx, opts)
+	})
+}
+
+// startHTTP starts serving the HTTP router on httpAddr in the background. The caller must hold mu.
+func (s *Server) startHTTP() error {
+	addr, err := parseListenAddress(s.httpAddr)
+	if err != nil {
+		return err
+	}
+	listener, err := listenTCP(addr, s.current().config.Server.ListenBacklog)
+	if err != nil {
+		return fmt.Errorf("cannot listen on %s: %w", s.httpAddr, err)
+	}
+
+	s.httpServer = &http.Server{
+		Handler:      s.httpRouter(),
+		ReadTimeout:  readTimeout,
+		WriteTimeout: writeTimeout,
+	}
+
+	slog.Info("Modelplex HTTP server listening", "address", listener.Addr().String())
+	httpServer := s.httpServer
+	s.goBackground(func() {
+		if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("HTTP server failed", "error", err)
+		}
+	})
+
+	return nil
+}
+
+// removeStaleSocket removes whatever is at the socket path, such as the socket of a process that
+// exited without cleaning up, unless it's a socket that still accepts connections.
+func (s *Server) removeStaleSocket() error {
+	conn, err := net.DialTimeout("unix", s.socketPath, socketDialTimeout)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%w: %s", ErrSocketInUse, s.socketPath)
+	}
+	return os.RemoveAll(s.socketPath)
+}
+
+// prepareSocketDir ensures the socket's parent directory exists, creating it if configured to.
+func (s *Server) prepareSocketDir() error {
+	dir := filepath.Dir(s.socketPath)
+
+	info, err := os.Stat(dir)
+	switch {
+	case err == nil && !info.IsDir():
+		return fmt.Errorf("cannot create socket %s: %s is not a directory", s.socketPath, dir)
+	case err == nil:
+		return nil
+	case errors.Is(err, fs.ErrNotExist) && s.current().config.Server.CreateSocketDir:
+		if err := os.MkdirAll(dir, socketDirMode); err != nil {
+			return fmt.Errorf("cannot create socket directory for %s: %w", s.socketPath, err)
+		}
+		slog.Info("Created socket directory", "dir", dir)
+		return nil
+	case errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("cannot create socket %s: directory %s does not exist "+
+			"(create it, or set create_socket_dir = true)", s.socketPath, dir)
+	default:
+		return fmt.Errorf("cannot create socket %s: %w", s.socketPath, err)
+	}
 }
 
 // Stop gracefully shuts down the server and cleans up the Unix socket.
+// It returns once requests in flight (up to a timeout) and background tasks have finished.
 func (s *Server) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.running {
+		return
+	}
+	s.running = false
+	s.cancel()
+	if s.stopBackground != nil {
+		s.stopBackground()
+		s.stopBackground = nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if s.httpServer != nil {
+		if err := s.httpServer.Shutdown(ctx); err != nil {
+			slog.Error("Error shutting down HTTP server", "error", err)
+		}
+	}
 	if s.server != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
-		defer cancel()
 		if err := s.server.Shutdown(ctx); err != nil {
 			slog.Error("Error shutting down server", "error", err)
 		}
 	}
+	// Shutdown closes the listener once Serve has started; this covers the window before it did
 	if s.listener != nil {
-		if err := s.listener.Close(); err != nil {
+		if err := s.listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
 			slog.Error("Error closing listener", "error", err)
 		}
 	}
+	s.background.Wait()
+	s.stopMCP()
+	s.stopCapture()
 	if err := os.RemoveAll(s.socketPath); err != nil {
 		slog.Error("Error removing socket path", "path", s.socketPath, "error", err)
 	}
+
+	s.server, s.httpServer, s.listener = nil, nil, nil
 }
 
-func (s *Server) setupRoutes(router *mux.Router) {
-	v1 := router.PathPrefix("/v1").Subrouter()
+// socketRouter returns the router served on the Unix socket, which adds the MCP endpoints, as
+// they run local tools, and WebSocket streaming, whose connections outlive the HTTP rate limit.
+// Both are only served to clients that can reach the socket.
+func (s *Server) socketRouter() *mux.Router {
+	router := mux.NewRouter()
+	router.Use(onListener("socket"))
+	router.Use(s.allowModels(func(cfg *config.Server) []string { return cfg.Socket.Models }))
+	s.setupMCPRoutes(router)
+	router.HandleFunc("/models/v1/realtime", s.handleRealtime).Methods("GET")
+	s.setupRoutes(router)
+	return router
+}
 
-	// OpenAI-compatible endpoints
-	v1.HandleFunc("/chat/completions", s.proxy.HandleChatCompletions).Methods("POST")
-	v1.HandleFunc("/completions", s.proxy.HandleCompletions).Methods("POST")
-	v1.HandleFunc("/models", s.proxy.HandleModels).Methods("GET")
+// httpRouter returns the router served on the HTTP listener, which adds the internal endpoints.
+func (s *Server) httpRouter() *mux.Router {
+	router := mux.NewRouter()
+	router.Use(onListener("http"))
+	router.Use(s.rateLimit)
+	router.Use(s.allowModels(func(cfg *config.Server) []string { return cfg.HTTP.Models }))
+	s.setupInternalRoutes(router)
+	s.setupRoutes(router)
+	return router
+}
+
+func (s *Server) setupRoutes(router *mux.Router) {
+	// OpenAI-compatible endpoints, served under /models/v1 and the legacy /v1 prefix
+	for _, prefix := range []string{"/models/v1", "/v1"} {
+		v1 := router.PathPrefix(prefix).Subrouter()
+		v1.HandleFunc("/chat/completions", s.proxyHandler((*proxy.OpenAIProxy).HandleChatCompletions)).Methods("POST")
+		v1.HandleFunc("/completions", s.proxyHandler((*proxy.OpenAIProxy).HandleCompletions)).Methods("POST")
+		v1.HandleFunc("/embeddings", s.proxyHandler((*proxy.OpenAIProxy).HandleEmbeddings)).Methods("POST")
+		v1.HandleFunc("/models", s.proxyHandler((*proxy.OpenAIProxy).HandleModels)).Methods("GET")
+	}
+	// Batches aren't part of the OpenAI API, so they're only served under /models/v1
+	router.HandleFunc("/models/v1/chat/completions/batch",
+		s.proxyHandler((*proxy.OpenAIProxy).HandleChatCompletionsBatch)).Methods("POST")
 
 	// Health check
 	router.HandleFunc("/health", s.handleHealth).Methods("GET")
 }
 
+// proxyHandler returns a handler that calls handle on the current proxy, so that after a reload
+// new requests use the new config while in-flight ones finish with the old.
+func (s *Server) proxyHandler(handle func(*proxy.OpenAIProxy, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rt, err := s.acquire(r.Context())
+		if err != nil {
+			return
+		}
+		defer rt.release()
+		if capture := s.capture.Load(); capture != nil {
+			captureRequest(capture, w, r, func(w http.ResponseWriter, r *http.Request) { handle(rt.proxy, w, r) })
+			return
+		}
+		handle(rt.proxy, w, r)
+	}
+}
+
+// handleRealtime serves WebSocket streaming. Shutdown doesn't close connections taken over
+// from the HTTP server, so the request's context is cancelled when the server stops instead.
+func (s *Server) handleRealtime(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	if s.ctx != nil {
+		stop := context.AfterFunc(s.ctx, cancel)
+		defer stop()
+	}
+	// Each request on the connection is counted in flight on the runtime it's answered with, rather
+	// than the connection, so an open connection doesn't hold up draining reloads
+	s.current().proxy.ServeRealtime(w, r.WithContext(ctx), func(ctx context.Context) (*proxy.OpenAIProxy, func(), error) {
+		rt, err := s.acquire(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		return rt.proxy, rt.release, nil
+	})
+}
+
+// rateLimit applies the current rate limiter, if one is configured.
+// Rate limits apply to the HTTP listener only; socket clients are trusted local processes.
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limiter := s.current().rateLimiter; limiter != nil {
+			limiter.middleware(next).ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// onListener returns middleware marking requests as arriving on the named listener.
+func onListener(name string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(proxy.WithListener(r.Context(), name)))
+		})
+	}
+}
+
+// allowModels returns middleware restricting a listener's requests to the models its section of
+// the current config allows, as returned by models, so a reload changes them.
+func (s *Server) allowModels(models func(*config.Server) []string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := multiplexer.WithAllowedModels(r.Context(), models(&s.current().config.Server))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
 func (s *Server) handleHealth(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
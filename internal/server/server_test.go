@@ -0,0 +1,585 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/modelplex/modelplex/internal/config"
+	"github.com/modelplex/modelplex/internal/monitoring"
+	"github.com/modelplex/modelplex/internal/multiplexer"
+	"github.com/modelplex/modelplex/internal/proxy"
+	"github.com/modelplex/modelplex/pkg/provider"
+	"github.com/modelplex/modelplex/test/testutil"
+)
+
+func TestServer_Start_MissingSocketDir(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "missing", "modelplex.socket")
+	srv := New(&config.Config{}, socketPath)
+
+	err := srv.Start()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), socketPath)
+	assert.Contains(t, err.Error(), "does not exist")
+	assert.Contains(t, err.Error(), "create_socket_dir")
+}
+
+func TestServer_Start_SocketParentIsFile(t *testing.T) {
+	parent := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(parent, nil, 0o600))
+
+	srv := New(&config.Config{}, filepath.Join(parent, "modelplex.socket"))
+
+	err := srv.Start()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is not a directory")
+}
+
+func TestServer_PrepareSocketDir_Create(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "nested", "run")
+	cfg := &config.Config{Server: config.Server{CreateSocketDir: true}}
+	srv := New(cfg, filepath.Join(dir, "modelplex.socket"))
+
+	require.NoError(t, srv.prepareSocketDir())
+
+	info, err := os.Stat(dir)
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+}
+
+func TestServer_ModelsRefresh(t *testing.T) {
+	srv := New(&config.Config{Providers: []config.Provider{
+		{Name: "openai", Type: "openai", Models: []string{"gpt-4", "gpt-3.5-turbo"}},
+	}}, filepath.Join(t.TempDir(), "modelplex.socket"))
+
+	req := httptest.NewRequest("POST", "/_internal/models/refresh", http.NoBody)
+	w := httptest.NewRecorder()
+	srv.httpRouter().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"models": 2}`, w.Body.String())
+}
+
+func TestServer_InternalRoutesNotOnSocket(t *testing.T) {
+	srv := New(&config.Config{}, filepath.Join(t.TempDir(), "modelplex.socket"))
+
+	req := httptest.NewRequest("POST", "/_internal/models/refresh", http.NoBody)
+	w := httptest.NewRecorder()
+	srv.socketRouter().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestServer_BatchRoute(t *testing.T) {
+	srv := New(&config.Config{}, filepath.Join(t.TempDir(), "modelplex.socket"))
+
+	// Batches are a modelplex extension, so they aren't served under the OpenAI-compatible /v1
+	for path, status := range map[string]int{
+		"/models/v1/chat/completions/batch": http.StatusBadRequest,
+		"/v1/chat/completions/batch":        http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		srv.socketRouter().ServeHTTP(w, httptest.NewRequest("POST", path, strings.NewReader("[]")))
+		assert.Equal(t, status, w.Code, path)
+	}
+}
+
+func TestServer_Capture(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	srv := New(&config.Config{Server: config.Server{CaptureFile: path}}, filepath.Join(t.TempDir(), "modelplex.socket"))
+	require.NoError(t, srv.startCapture())
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions",
+		strings.NewReader(`{"model": "missing", "messages": [{"role": "user", "content": "Hi"}]}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	srv.socketRouter().ServeHTTP(w, req)
+	srv.stopCapture()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var record monitoring.CaptureRecord
+	require.NoError(t, json.Unmarshal(data, &record))
+	assert.Equal(t, "/v1/chat/completions", record.Path)
+	assert.Equal(t, w.Code, record.Status)
+	assert.JSONEq(t, `{"model": "missing", "messages": [{"role": "user", "content": "Hi"}]}`, string(record.Request))
+	assert.JSONEq(t, w.Body.String(), string(record.Response))
+	assert.Equal(t, "[REDACTED]", record.Headers["Authorization"])
+	assert.Equal(t, "application/json", record.Headers["Content-Type"])
+	assert.NotContains(t, string(data), "secret")
+}
+
+func TestServer_Realtime_ClosedOnStop(t *testing.T) {
+	testutil.CheckGoroutineLeaks(t)
+
+	cfg := &config.Config{Server: config.Server{Realtime: config.Realtime{Enabled: true}}}
+	srv := New(cfg, filepath.Join(t.TempDir(), "modelplex.socket"))
+	srv.ctx, srv.cancel = context.WithCancel(context.Background())
+	server := httptest.NewServer(srv.socketRouter())
+	defer server.Close()
+
+	client := testutil.DialWebSocket(t, server.Listener.Addr().String(), "/models/v1/realtime")
+
+	// Shutdown doesn't close upgraded connections, so stopping the server must
+	srv.cancel()
+	assert.Equal(t, 1001, client.ReadClose())
+}
+
+func TestServer_Status(t *testing.T) {
+	srv := New(&config.Config{Providers: []config.Provider{
+		{Name: "openai", Type: "openai", Models: []string{"gpt-4"}},
+	}}, filepath.Join(t.TempDir(), "modelplex.socket"))
+
+	req := httptest.NewRequest("GET", "/_internal/status", http.NoBody)
+	w := httptest.NewRecorder()
+	srv.httpRouter().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status": "ok", "providers": [{"name": "openai", "status": "pending", "attempts": 0}]}`, w.Body.String())
+}
+
+func TestServer_Metrics(t *testing.T) {
+	srv := New(&config.Config{}, filepath.Join(t.TempDir(), "modelplex.socket"))
+	srv.current().mux.Metrics().RecordCacheUsage("anthropic", 100, 5)
+	srv.current().mux.Metrics().RecordBytes("anthropic", 2048, 512)
+	srv.current().mux.Metrics().RecordRequest("anthropic", false)
+	srv.current().mux.Metrics().RecordRequest("anthropic", true)
+
+	req := httptest.NewRequest("GET", "/_internal/metrics", http.NoBody)
+	w := httptest.NewRecorder()
+	srv.httpRouter().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"providers": {"anthropic": {
+		"requests": 2,
+		"errors": 1,
+		"cache_read_tokens": 100,
+		"cache_creation_tokens": 5,
+		"provider_bytes_sent": 2048,
+		"provider_bytes_received": 512
+	}}}`, w.Body.String())
+}
+
+func TestServer_Start_RequireMCP(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "modelplex.socket")
+	srv := New(&config.Config{MCP: config.MCPConfig{
+		Servers:    []config.MCPServer{{Name: "filesystem", Command: "modelplex-no-such-mcp-server"}},
+		RequireMCP: true,
+	}}, socketPath)
+
+	err := srv.Start()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "filesystem")
+	assert.Contains(t, err.Error(), "modelplex-no-such-mcp-server")
+
+	_, err = os.Stat(socketPath)
+	assert.True(t, os.IsNotExist(err), "the server should not have started listening")
+}
+
+func TestServer_Status_MCP(t *testing.T) {
+	srv := New(&config.Config{MCP: config.MCPConfig{
+		Servers: []config.MCPServer{{Name: "filesystem", Command: "modelplex-no-such-mcp-server"}},
+	}}, filepath.Join(t.TempDir(), "modelplex.socket"))
+
+	// Without require_mcp, a missing command is reported rather than failing startup
+	require.NoError(t, srv.startMCP())
+	defer srv.stopMCP()
+
+	req := httptest.NewRequest("GET", "/_internal/status", http.NoBody)
+	w := httptest.NewRecorder()
+	srv.httpRouter().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var status struct {
+		Status string `json:"status"`
+		MCP    []struct {
+			Name   string `json:"name"`
+			Status string `json:"status"`
+			Error  string `json:"error"`
+		} `json:"mcp"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, "degraded", status.Status)
+	require.Len(t, status.MCP, 1)
+	assert.Equal(t, "filesystem", status.MCP[0].Name)
+	assert.Equal(t, "failed", status.MCP[0].Status)
+	assert.Contains(t, status.MCP[0].Error, "modelplex-no-such-mcp-server")
+}
+
+func TestServer_MCPServers(t *testing.T) {
+	srv := New(&config.Config{MCP: config.MCPConfig{
+		Servers: []config.MCPServer{
+			{Name: "filesystem", Command: "modelplex-no-such-mcp-server", Args: []string{"/workspace"}},
+		},
+	}}, filepath.Join(t.TempDir(), "modelplex.socket"))
+	require.NoError(t, srv.startMCP())
+	defer srv.stopMCP()
+
+	w := httptest.NewRecorder()
+	srv.httpRouter().ServeHTTP(w, httptest.NewRequest("GET", "/_internal/mcp", http.NoBody))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Servers []map[string]interface{} `json:"servers"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Servers, 1)
+	server := response.Servers[0]
+	assert.Equal(t, "filesystem", server["name"])
+	assert.Equal(t, "modelplex-no-such-mcp-server", server["command"])
+	assert.Equal(t, []interface{}{"/workspace"}, server["args"])
+	assert.Equal(t, "failed", server["status"])
+	assert.Equal(t, float64(0), server["tools"])
+	assert.Equal(t, float64(0), server["restarts"])
+
+	// Not reachable over the socket
+	w = httptest.NewRecorder()
+	srv.socketRouter().ServeHTTP(w, httptest.NewRequest("GET", "/_internal/mcp", http.NoBody))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestServer_Providers(t *testing.T) {
+	srv := New(&config.Config{Providers: []config.Provider{
+		{Name: "openai", Type: "openai", BaseURL: "http://127.0.0.1:1", Models: []string{"gpt-4o", "gpt-4o-mini"}},
+		{Name: "claude", Type: "anthropic", BaseURL: "http://127.0.0.1:1", Models: []string{"claude-3"}, Priority: 2},
+	}}, filepath.Join(t.TempDir(), "modelplex.socket"))
+
+	w := httptest.NewRecorder()
+	srv.httpRouter().ServeHTTP(w, httptest.NewRequest("GET", "/_internal/providers", http.NoBody))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Providers []multiplexer.ProviderInfo `json:"providers"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, []multiplexer.ProviderInfo{
+		{Name: "openai", Type: "openai", Models: []string{"gpt-4o", "gpt-4o-mini"}, Capabilities: provider.Capabilities{
+			Chat: true, Completion: true, Embeddings: true, Streaming: true, Tools: true, Vision: true,
+		}},
+		{Name: "claude", Type: "anthropic", Priority: 2, Models: []string{"claude-3"}, Capabilities: provider.Capabilities{
+			Chat: true, Completion: true, Streaming: true,
+		}},
+	}, response.Providers)
+}
+
+func TestServer_Routing(t *testing.T) {
+	srv := New(&config.Config{
+		Providers: []config.Provider{
+			{Name: "openai", Type: "openai", BaseURL: "http://127.0.0.1:1", Models: []string{"gpt-4o"}},
+			{Name: "backup", Type: "openai", BaseURL: "http://127.0.0.1:1", Models: []string{"gpt-4o"}, Priority: 2},
+		},
+		Models: []config.Model{{Name: "fast", AliasFor: []string{"gpt-4o"}}},
+	}, filepath.Join(t.TempDir(), "modelplex.socket"))
+
+	w := httptest.NewRecorder()
+	srv.httpRouter().ServeHTTP(w, httptest.NewRequest("GET", "/_internal/routing", http.NoBody))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Models []multiplexer.Route `json:"models"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, []multiplexer.Route{
+		{Model: "fast", ResolvesTo: "gpt-4o", Providers: []string{"openai", "backup"}},
+		{Model: "gpt-4o", Providers: []string{"openai", "backup"}},
+	}, response.Models)
+
+	// Not reachable over the socket
+	w = httptest.NewRecorder()
+	srv.socketRouter().ServeHTTP(w, httptest.NewRequest("GET", "/_internal/routing", http.NoBody))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestServer_ListenerModels(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"Hi"}}]}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	srv := New(&config.Config{
+		Providers: []config.Provider{
+			{Name: "openai", Type: "openai", BaseURL: upstream.URL, Models: []string{"gpt-4o", "gpt-4o-mini", "o1"}},
+		},
+		Server: config.Server{
+			Socket: config.Socket{Models: []string{"gpt-4o-mini"}},
+			HTTP:   config.HTTP{Models: []string{"gpt-4o", "o1"}},
+		},
+	}, filepath.Join(t.TempDir(), "modelplex.socket"))
+
+	models := func(router http.Handler) []string {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/models/v1/models", http.NoBody))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response proxy.ModelsResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		ids := make([]string, len(response.Data))
+		for i, info := range response.Data {
+			ids[i] = info.ID
+		}
+		return ids
+	}
+	chat := func(router http.Handler, model string) int {
+		body := `{"model":"` + model + `","messages":[{"role":"user","content":"Hello"}]}`
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/models/v1/chat/completions", strings.NewReader(body)))
+		return w.Code
+	}
+
+	// The same multiplexer serves each listener only the models it allows
+	socket, listener := srv.socketRouter(), srv.httpRouter()
+	assert.ElementsMatch(t, []string{"gpt-4o-mini"}, models(socket))
+	assert.ElementsMatch(t, []string{"gpt-4o", "o1"}, models(listener))
+	assert.Equal(t, http.StatusOK, chat(socket, "gpt-4o-mini"))
+	assert.Equal(t, http.StatusNotFound, chat(socket, "gpt-4o"))
+	assert.Equal(t, http.StatusOK, chat(listener, "gpt-4o"))
+	assert.Equal(t, http.StatusNotFound, chat(listener, "gpt-4o-mini"))
+}
+
+func TestServer_ListenerModels_Internal(t *testing.T) {
+	srv := New(&config.Config{
+		Providers: []config.Provider{
+			{Name: "openai", Type: "openai", BaseURL: "http://127.0.0.1:1", Models: []string{"gpt-4o", "o1"}},
+			{Name: "claude", Type: "anthropic", BaseURL: "http://127.0.0.1:1", Models: []string{"claude-3"}, Priority: 2},
+		},
+		Server: config.Server{HTTP: config.HTTP{Models: []string{"gpt-4o"}}},
+	}, filepath.Join(t.TempDir(), "modelplex.socket"))
+	get := func(path string, response interface{}) {
+		w := httptest.NewRecorder()
+		srv.httpRouter().ServeHTTP(w, httptest.NewRequest("GET", path, http.NoBody))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), response))
+	}
+
+	// The internal endpoints only describe the models the listener allows, and their providers
+	var routing struct {
+		Models []multiplexer.Route `json:"models"`
+	}
+	get("/_internal/routing", &routing)
+	assert.Equal(t, []multiplexer.Route{{Model: "gpt-4o", Providers: []string{"openai"}}}, routing.Models)
+
+	var providers struct {
+		Providers []multiplexer.ProviderInfo `json:"providers"`
+	}
+	get("/_internal/providers", &providers)
+	require.Len(t, providers.Providers, 1)
+	assert.Equal(t, "openai", providers.Providers[0].Name)
+	assert.Equal(t, []string{"gpt-4o"}, providers.Providers[0].Models)
+
+	var status struct {
+		Providers []multiplexer.ProviderStatus `json:"providers"`
+	}
+	get("/_internal/status", &status)
+	require.Len(t, status.Providers, 1)
+	assert.Equal(t, "openai", status.Providers[0].Name)
+
+	srv.current().mux.Metrics().RecordRequest("claude", false)
+	var metrics struct {
+		Providers map[string]interface{} `json:"providers"`
+	}
+	get("/_internal/metrics", &metrics)
+	assert.NotContains(t, metrics.Providers, "claude")
+}
+
+func TestServer_StopBeforeStart(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "modelplex.socket")
+	require.NoError(t, os.WriteFile(socketPath, nil, 0o600))
+
+	srv := New(&config.Config{}, socketPath)
+	srv.Stop()
+
+	// Stopping a server that never started leaves the socket path alone
+	_, err := os.Stat(socketPath)
+	assert.NoError(t, err)
+}
+
+func TestServer_SocketInUse(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "modelplex.socket")
+	other, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	defer other.Close()
+
+	srv := New(&config.Config{}, socketPath)
+	require.ErrorIs(t, srv.Start(), ErrSocketInUse)
+
+	// The other process keeps its socket
+	conn, err := net.Dial("unix", socketPath)
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestServer_StaleSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "modelplex.socket")
+	stale, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+
+	// A socket nothing accepts connections on is replaced
+	srv := New(&config.Config{}, socketPath)
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Start()
+	}()
+	require.Eventually(t, func() bool {
+		conn, dialErr := net.Dial("unix", socketPath)
+		if dialErr == nil {
+			conn.Close()
+		}
+		return dialErr == nil
+	}, time.Second, 10*time.Millisecond)
+
+	srv.Stop()
+	assert.ErrorIs(t, <-done, http.ErrServerClosed)
+}
+
+func TestServer_StartTwiceAndDoubleStop(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "modelplex.socket")
+	srv := New(&config.Config{}, socketPath)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Start()
+	}()
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(socketPath)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	assert.ErrorIs(t, srv.Start(), ErrServerRunning)
+
+	srv.Stop()
+	assert.ErrorIs(t, <-done, http.ErrServerClosed)
+	srv.Stop()
+
+	_, err := os.Stat(socketPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestServer_SocketKeepAlive(t *testing.T) {
+	for _, disabled := range []bool{false, true} {
+		socketPath := filepath.Join(t.TempDir(), "modelplex.socket")
+		cfg := &config.Config{Server: config.Server{Socket: config.Socket{DisableKeepAlives: disabled}}}
+		srv := New(cfg, socketPath)
+		done := make(chan error, 1)
+		go func() {
+			done <- srv.Start()
+		}()
+		require.Eventually(t, func() bool {
+			_, err := os.Stat(socketPath)
+			return err == nil
+		}, time.Second, 10*time.Millisecond)
+
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+			},
+		}}
+		var reused []bool
+		for range 2 {
+			trace := &httptrace.ClientTrace{GotConn: func(info httptrace.GotConnInfo) {
+				reused = append(reused, info.Reused)
+			}}
+			req, err := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace),
+				"GET", "http://modelplex/health", http.NoBody)
+			require.NoError(t, err)
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			_, err = io.Copy(io.Discard, resp.Body)
+			require.NoError(t, err)
+			resp.Body.Close()
+		}
+		// Successive requests share a connection unless keep-alives are disabled
+		assert.Equal(t, []bool{false, !disabled}, reused, "disable_keep_alives = %v", disabled)
+
+		client.CloseIdleConnections()
+		srv.Stop()
+		assert.ErrorIs(t, <-done, http.ErrServerClosed)
+	}
+}
+
+func TestServer_Stop_WaitsForBackgroundTasks(t *testing.T) {
+	testutil.CheckGoroutineLeaks(t)
+
+	// An unreachable provider keeps being re-probed and rediscovered, and heartbeats logged,
+	// until the server stops
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	cfg := writeConfig(t, configPath, `
+[server]
+heartbeat_interval = "10ms"
+
+[server.startup_probe]
+interval = "10ms"
+retry_interval = "10ms"
+
+[[providers]]
+name = "local"
+type = "ollama"
+base_url = "http://127.0.0.1:1"
+refresh_interval = "10ms"
+`)
+
+	socketPath := filepath.Join(t.TempDir(), "modelplex.socket")
+	srv := NewWithHTTPAddress(cfg, socketPath, "127.0.0.1:0")
+	srv.SetConfigPath(configPath)
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Start()
+	}()
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(socketPath)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	// Reloading replaces the background tasks rather than adding to them
+	_, err := srv.Reload()
+	require.NoError(t, err)
+
+	srv.Stop()
+	assert.ErrorIs(t, <-done, http.ErrServerClosed)
+}
+
+func TestServer_LogLevel(t *testing.T) {
+	defer monitoring.Level.Set(monitoring.Level.Level())
+	monitoring.Level.Set(slog.LevelInfo)
+
+	srv := New(&config.Config{}, filepath.Join(t.TempDir(), "modelplex.socket"))
+	router := srv.httpRouter()
+
+	req := httptest.NewRequest("POST", "/_internal/loglevel", strings.NewReader(`{"level": "debug"}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"level": "debug", "previous": "info"}`, w.Body.String())
+	assert.Equal(t, slog.LevelDebug, monitoring.Level.Level())
+
+	req = httptest.NewRequest("POST", "/_internal/loglevel", strings.NewReader(`{"level": "loud"}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid level")
+	assert.Equal(t, slog.LevelDebug, monitoring.Level.Level())
+
+	// Not reachable over the socket
+	req = httptest.NewRequest("POST", "/_internal/loglevel", strings.NewReader(`{"level": "error"}`))
+	w = httptest.NewRecorder()
+	srv.socketRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,179 @@
+// Package client provides a Go client for talking to modelplex over its Unix socket.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// Default timeout for requests made by socket clients
+	defaultTimeout = 5 * time.Minute
+	// Base URL for requests; the host is ignored since every connection dials the socket
+	socketBaseURL = "http://modelplex/models/v1"
+)
+
+// Client calls the modelplex OpenAI-compatible API.
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+}
+
+// NewSocketClient creates a client that connects to the modelplex server listening on socketPath.
+func NewSocketClient(socketPath string) *Client {
+	dialer := &net.Dialer{}
+	return &Client{
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socketPath)
+				},
+			},
+			Timeout: defaultTimeout,
+		},
+		baseURL: socketBaseURL,
+	}
+}
+
+// HTTPClient returns the underlying HTTP client, for endpoints without a typed method.
+// Any host may be used in request URLs, e.g. "http://modelplex/health".
+func (c *Client) HTTPClient() *http.Client {
+	return c.httpClient
+}
+
+// Message is a single chat message.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ChatCompletionRequest is an OpenAI chat completion request.
+type ChatCompletionRequest struct {
+	Model       string    `json:"model"`
+	Messages    []Message `json:"messages"`
+	Temperature *float64  `json:"temperature,omitempty"`
+	MaxTokens   int       `json:"max_tokens,omitempty"`
+}
+
+// ChatCompletionResponse is an OpenAI chat completion response.
+type ChatCompletionResponse struct {
+	ID      string   `json:"id"`
+	Object  string   `json:"object"`
+	Created int64    `json:"created"`
+	Model   string   `json:"model"`
+	Choices []Choice `json:"choices"`
+	Usage   Usage    `json:"usage"`
+}
+
+// Choice is one generated completion.
+type Choice struct {
+	Index        int     `json:"index"`
+	Message      Message `json:"message"`
+	FinishReason string  `json:"finish_reason"`
+}
+
+// Usage reports token counts for a completion.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Model describes a model available through modelplex.
+type Model struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// APIError is returned when modelplex responds with a non-2xx status.
+type APIError struct {
+	StatusCode int
+	Message    string
+	Type       string
+}
+
+func (e *APIError) Error() string {
+	if e.Type != "" {
+		return fmt.Sprintf("modelplex: %s (status %d, type %s)", e.Message, e.StatusCode, e.Type)
+	}
+	return fmt.Sprintf("modelplex: %s (status %d)", e.Message, e.StatusCode)
+}
+
+// ChatCompletion sends a chat completion request.
+func (c *Client) ChatCompletion(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	var resp ChatCompletionResponse
+	if err := c.do(ctx, "POST", "/chat/completions", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ListModels returns the models available through modelplex.
+func (c *Client) ListModels(ctx context.Context) ([]Model, error) {
+	var resp struct {
+		Data []Model `json:"data"`
+	}
+	if err := c.do(ctx, "GET", "/models", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, result interface{}) error {
+	reqBody := io.Reader(http.NoBody)
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(jsonData)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return newAPIError(resp.StatusCode, respBody)
+	}
+
+	return json.Unmarshal(respBody, result)
+}
+
+// newAPIError parses an OpenAI-shaped error body, falling back to the raw body text.
+func newAPIError(statusCode int, body []byte) *APIError {
+	var errResp struct {
+		Error struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error.Message != "" {
+		return &APIError{StatusCode: statusCode, Message: errResp.Error.Message, Type: errResp.Error.Type}
+	}
+	return &APIError{StatusCode: statusCode, Message: strings.TrimSpace(string(body))}
+}
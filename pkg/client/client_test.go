@@ -0,0 +1,146 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveSocket serves handler on a Unix socket for the lifetime of the test
+func serveSocket(t *testing.T, handler http.Handler) string {
+	t.Helper()
+
+	socketPath := filepath.Join(t.TempDir(), "modelplex.socket")
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+
+	server := &http.Server{Handler: handler}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			t.Logf("Server error: %v", err)
+		}
+	}()
+	t.Cleanup(func() { server.Close() })
+
+	return socketPath
+}
+
+func TestClient_ChatCompletion(t *testing.T) {
+	socketPath := serveSocket(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/models/v1/chat/completions", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var req map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "gpt-4", req["model"])
+		assert.Equal(t, 0.2, req["temperature"])
+		assert.NotContains(t, req, "max_tokens")
+
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write([]byte(`{
+			"id": "chatcmpl-123", "object": "chat.completion", "created": 1677652288, "model": "gpt-4",
+			"choices": [{"index": 0, "message": {"role": "assistant", "content": "Hi!"}, "finish_reason": "stop"}],
+			"usage": {"prompt_tokens": 5, "completion_tokens": 2, "total_tokens": 7}
+		}`)); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	}))
+
+	temperature := 0.2
+	client := NewSocketClient(socketPath)
+	resp, err := client.ChatCompletion(context.Background(), &ChatCompletionRequest{
+		Model:       "gpt-4",
+		Messages:    []Message{{Role: "user", Content: "Hello"}},
+		Temperature: &temperature,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "chatcmpl-123", resp.ID)
+	require.Len(t, resp.Choices, 1)
+	assert.Equal(t, "Hi!", resp.Choices[0].Message.Content)
+	assert.Equal(t, "stop", resp.Choices[0].FinishReason)
+	assert.Equal(t, 7, resp.Usage.TotalTokens)
+}
+
+func TestClient_ListModels(t *testing.T) {
+	socketPath := serveSocket(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GET", r.Method)
+		assert.Equal(t, "/models/v1/models", r.URL.Path)
+
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write([]byte(`{"object": "list", "data": [
+			{"id": "gpt-4", "object": "model", "created": 1677610602, "owned_by": "modelplex"},
+			{"id": "llama2", "object": "model", "created": 1677610602, "owned_by": "modelplex"}
+		]}`)); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	}))
+
+	models, err := NewSocketClient(socketPath).ListModels(context.Background())
+	require.NoError(t, err)
+	require.Len(t, models, 2)
+	assert.Equal(t, "gpt-4", models[0].ID)
+	assert.Equal(t, "modelplex", models[1].OwnedBy)
+}
+
+func TestClient_APIError(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		expected *APIError
+	}{
+		{
+			name:     "openai error shape",
+			status:   http.StatusBadRequest,
+			body:     `{"error": {"message": "Invalid JSON", "type": "invalid_request_error"}}`,
+			expected: &APIError{StatusCode: 400, Message: "Invalid JSON", Type: "invalid_request_error"},
+		},
+		{
+			name:     "plain text",
+			status:   http.StatusInternalServerError,
+			body:     "Internal server error\n",
+			expected: &APIError{StatusCode: 500, Message: "Internal server error"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			socketPath := serveSocket(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tt.status)
+				if _, err := w.Write([]byte(tt.body)); err != nil {
+					t.Errorf("Failed to write response: %v", err)
+				}
+			}))
+
+			_, err := NewSocketClient(socketPath).ListModels(context.Background())
+
+			var apiErr *APIError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, tt.expected, apiErr)
+		})
+	}
+}
+
+func TestClient_HTTPClient(t *testing.T) {
+	socketPath := serveSocket(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/health", r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req, err := http.NewRequestWithContext(context.Background(), "GET", "http://modelplex/health", http.NoBody)
+	require.NoError(t, err)
+
+	resp, err := NewSocketClient(socketPath).HTTPClient().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,103 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CredentialSource supplies the API key a provider authenticates with. Providers ask for the key
+// on every request rather than holding one, so a source that fetches keys from a secret store,
+// such as Vault or AWS Secrets Manager, can rotate them without a config reload.
+type CredentialSource interface {
+	Key(ctx context.Context) (string, error)
+}
+
+// StaticCredentials is a CredentialSource for a fixed key. It's the default, for api_key.
+type StaticCredentials string
+
+// Key returns the key.
+func (c StaticCredentials) Key(context.Context) (string, error) {
+	return string(c), nil
+}
+
+// CachedCredentials is a CredentialSource that fetches a key when it has none younger than its
+// TTL, so a secret store behind it is queried about once per TTL however many requests there are.
+// Concurrent requests share a single fetch.
+type CachedCredentials struct {
+	fetch func(ctx context.Context) (string, error)
+	ttl   time.Duration
+
+	mu     sync.Mutex
+	key    string
+	expiry time.Time
+}
+
+// NewCachedCredentials returns a CachedCredentials that fetches keys with fetch and reuses each for ttl.
+func NewCachedCredentials(fetch func(ctx context.Context) (string, error), ttl time.Duration) *CachedCredentials {
+	return &CachedCredentials{fetch: fetch, ttl: ttl}
+}
+
+// Key returns the cached key, fetching a new one if it has expired. A failed fetch isn't cached.
+func (c *CachedCredentials) Key(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.key != "" && time.Now().Before(c.expiry) {
+		return c.key, nil
+	}
+	key, err := c.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.key, c.expiry = key, time.Now().Add(c.ttl)
+	return key, nil
+}
+
+// CredentialFactory creates the credential source of a provider configured with its name.
+type CredentialFactory func(cfg *Config) (CredentialSource, error)
+
+var (
+	credentialsMu sync.RWMutex
+	credentials   = map[string]CredentialFactory{}
+)
+
+// RegisterCredentialSource registers factory for providers configured with the given
+// credential_source name.
+func RegisterCredentialSource(name string, factory CredentialFactory) {
+	credentialsMu.Lock()
+	defer credentialsMu.Unlock()
+	credentials[name] = factory
+}
+
+// Credentials returns the source of the key the provider authenticates with: the source registered
+// under CredentialSource if that's set, or else APIKey, read from the environment variable it
+// names if it's of the form "${NAME}".
+func (c *Config) Credentials() (CredentialSource, error) {
+	if c.CredentialSource == "" {
+		return StaticCredentials(expandAPIKey(c.APIKey)), nil
+	}
+
+	credentialsMu.RLock()
+	factory, ok := credentials[c.CredentialSource]
+	credentialsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("credential_source: unknown source %q", c.CredentialSource)
+	}
+	source, err := factory(c)
+	if err != nil {
+		return nil, fmt.Errorf("credential_source %q: %w", c.CredentialSource, err)
+	}
+	return source, nil
+}
+
+// expandAPIKey returns the value of the environment variable apiKey names as "${NAME}", or apiKey itself.
+func expandAPIKey(apiKey string) string {
+	if strings.HasPrefix(apiKey, "${") && strings.HasSuffix(apiKey, "}") {
+		return os.Getenv(strings.TrimSuffix(strings.TrimPrefix(apiKey, "${"), "}"))
+	}
+	return apiKey
+}
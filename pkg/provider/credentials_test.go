@@ -0,0 +1,85 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_Credentials(t *testing.T) {
+	t.Setenv("CREDENTIALS_TEST_KEY", "sk-env")
+
+	source, err := (&Config{APIKey: "sk-static"}).Credentials()
+	require.NoError(t, err)
+	assert.Equal(t, StaticCredentials("sk-static"), source)
+
+	source, err = (&Config{APIKey: "${CREDENTIALS_TEST_KEY}"}).Credentials()
+	require.NoError(t, err)
+	assert.Equal(t, StaticCredentials("sk-env"), source)
+
+	_, err = (&Config{CredentialSource: "missing-test"}).Credentials()
+	assert.ErrorContains(t, err, `unknown source "missing-test"`)
+}
+
+func TestRegisterCredentialSource(t *testing.T) {
+	RegisterCredentialSource("vault-test", func(cfg *Config) (CredentialSource, error) {
+		if cfg.Name == "" {
+			return nil, errors.New("missing name")
+		}
+		return StaticCredentials("key-for-" + cfg.Name), nil
+	})
+
+	source, err := (&Config{Name: "openai", APIKey: "ignored", CredentialSource: "vault-test"}).Credentials()
+	require.NoError(t, err)
+	key, err := source.Key(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "key-for-openai", key)
+
+	_, err = (&Config{CredentialSource: "vault-test"}).Credentials()
+	assert.ErrorContains(t, err, `credential_source "vault-test": missing name`)
+}
+
+func TestCachedCredentials(t *testing.T) {
+	var mu sync.Mutex
+	fetches := 0
+	fail := false
+	source := NewCachedCredentials(func(context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			return "", errors.New("secret store unavailable")
+		}
+		fetches++
+		return fmt.Sprintf("key-%d", fetches), nil
+	}, time.Hour)
+
+	// Concurrent requests share a single fetch
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key, err := source.Key(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, "key-1", key)
+		}()
+	}
+	wg.Wait()
+
+	// Expired keys are fetched again, and failures aren't cached
+	source.expiry = time.Now()
+	fail = true
+	_, err := source.Key(context.Background())
+	require.ErrorContains(t, err, "secret store unavailable")
+
+	fail = false
+	key, err := source.Key(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "key-2", key)
+}
@@ -0,0 +1,16 @@
+package provider
+
+import "unicode/utf8"
+
+// Preview returns at most the first limit bytes of body for quoting in error messages,
+// truncated on a rune boundary and marked with "..." when cut short.
+func Preview(body []byte, limit int) string {
+	if len(body) <= limit {
+		return string(body)
+	}
+	preview := body[:limit]
+	for len(preview) > 0 && !utf8.Valid(preview) {
+		preview = preview[:len(preview)-1]
+	}
+	return string(preview) + "..."
+}
@@ -0,0 +1,15 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreview(t *testing.T) {
+	assert.Equal(t, "short", Preview([]byte("short"), 10))
+	assert.Equal(t, "0123456789", Preview([]byte("0123456789"), 10))
+	assert.Equal(t, "01234...", Preview([]byte("0123456789"), 5))
+	// "é" is two bytes, so cutting after its first byte drops it entirely
+	assert.Equal(t, "abc...", Preview([]byte("abcédef"), 4))
+}
@@ -0,0 +1,531 @@
+// Package provider defines the interface modelplex uses to talk to AI providers,
+// and a registry for adding custom provider types without modifying modelplex.
+//
+// A custom provider is compiled into a modelplex build and registered before the
+// server starts, after which config files can use its type name:
+//
+//	provider.RegisterProvider("niche", func(cfg *provider.Config) provider.Provider {
+//		return NewNicheProvider(cfg.BaseURL, cfg.APIKey, cfg.Models)
+//	})
+//
+// Sources of API keys, such as a secret store, are registered the same way, and used by
+// providers configured with their name as credential_source:
+//
+//	provider.RegisterCredentialSource("vault", func(cfg *provider.Config) (provider.CredentialSource, error) {
+//		return provider.NewCachedCredentials(vaultFetcher(cfg.Name), 5*time.Minute), nil
+//	})
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotSupported is returned, wrapped, by providers for operations they can't serve, such as
+// text completions on a chat-only provider. modelplex answers such requests with 400.
+var ErrNotSupported = errors.New("not supported by provider")
+
+// Provider defines the interface that all AI providers must implement.
+// Operations a provider has no sensible mapping for return an error wrapping ErrNotSupported,
+// rather than an approximation; Anthropic's Completion, for example, is sent as a chat message.
+type Provider interface {
+	Name() string
+	// Priority orders providers for routing: lower values are tried first.
+	Priority() int
+	ChatCompletion(
+		ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+	) (interface{}, error)
+	Completion(ctx context.Context, model, prompt string, params map[string]interface{}) (interface{}, error)
+	ChatCompletionStream(
+		ctx context.Context, model string, messages []map[string]interface{}, params map[string]interface{},
+	) (<-chan StreamChunk, error)
+	CompletionStream(ctx context.Context, model, prompt string, params map[string]interface{}) (<-chan StreamChunk, error)
+	ListModels() []string
+}
+
+// CapabilityReporter is implemented by providers that report the operations they support.
+// Requests they can't serve are answered with 400 before they're sent. Providers that don't
+// implement it are assumed to support everything.
+type CapabilityReporter interface {
+	Capabilities() Capabilities
+}
+
+// CapabilityVision is the model capability, as configured for models and required with the
+// X-Modelplex-Require header, that chat requests with images require.
+const CapabilityVision = "vision"
+
+// Capabilities describes the operations a provider supports, whatever the model. Tools and Vision
+// report whether requests' "tools" and image content parts reach the upstream, rather than being
+// dropped in translation.
+type Capabilities struct {
+	Chat       bool `json:"chat"`
+	Completion bool `json:"completion"`
+	Embeddings bool `json:"embeddings"`
+	Streaming  bool `json:"streaming"`
+	Tools      bool `json:"tools"`
+	Vision     bool `json:"vision"`
+}
+
+// StreamChunk is a single incremental piece of a streamed completion.
+// Data holds an OpenAI-shaped chunk ("chat.completion.chunk" for chat, "text_completion" for text).
+// The final chunk on a channel has Done set, or Err set if the stream failed.
+type StreamChunk struct {
+	Data interface{}
+	Done bool
+	Err  error
+}
+
+// ResponseHeaders collects the headers of the upstream response that answered a request,
+// so that modelplex can pass some of them, such as rate limits, on to its client.
+type ResponseHeaders struct {
+	mu     sync.Mutex
+	header http.Header
+}
+
+type responseHeadersKey struct{}
+
+// WithResponseHeaders returns a context that collects the upstream response headers
+// recorded by providers with RecordResponseHeaders while serving a request.
+func WithResponseHeaders(ctx context.Context) (context.Context, *ResponseHeaders) {
+	headers := &ResponseHeaders{}
+	return context.WithValue(ctx, responseHeadersKey{}, headers), headers
+}
+
+// RecordResponseHeaders records header as the upstream response to the request made with ctx,
+// replacing any recorded before, e.g. by a provider that failed over to another.
+// Providers should call it for every upstream response, including errors, which often carry
+// "retry-after". It does nothing if ctx doesn't collect headers.
+func RecordResponseHeaders(ctx context.Context, header http.Header) {
+	headers, ok := ctx.Value(responseHeadersKey{}).(*ResponseHeaders)
+	if !ok {
+		return
+	}
+	headers.mu.Lock()
+	defer headers.mu.Unlock()
+	headers.header = header.Clone()
+}
+
+// Header returns the last recorded upstream response headers, or nil if none were recorded.
+func (h *ResponseHeaders) Header() http.Header {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.header
+}
+
+// Config is the configuration for one [[providers]] entry.
+type Config struct {
+	Name     string   `toml:"name"`
+	Type     string   `toml:"type"`
+	BaseURL  string   `toml:"base_url"`
+	APIKey   string   `toml:"api_key"`
+	Models   []string `toml:"models"`
+	Priority int      `toml:"priority"`
+	// CredentialSource names a source registered with RegisterCredentialSource that supplies the
+	// API key instead of APIKey, fetched for each request; see Credentials.
+	CredentialSource string `toml:"credential_source"`
+	// APIKeyHeader or APIKeyParam send the API key in the named header, such as "api-key", or query
+	// parameter, such as "key", instead of the provider type's standard header, for gateways that
+	// authenticate differently. Ollama, which sends no key, and Vertex AI, which sends access tokens,
+	// ignore them. See APIKeyPlacement.
+	APIKeyHeader string `toml:"api_key_header"`
+	APIKeyParam  string `toml:"api_key_param"`
+	// RefreshInterval is how often models are rediscovered from a provider without a static
+	// models list, such as "10m". Empty disables background refreshing.
+	RefreshInterval string `toml:"refresh_interval"`
+
+	// ChatPath and CompletionPath override the paths, relative to BaseURL, that chat and text
+	// completions are sent to, for gateways that mount the API elsewhere. They default to each
+	// provider type's standard paths. Anthropic sends completions as messages, so only ChatPath applies.
+	ChatPath       string `toml:"chat_path"`
+	CompletionPath string `toml:"completion_path"`
+
+	// TLS settings for self-hosted upstreams. CACert is a PEM bundle trusted in addition to
+	// the system roots. InsecureSkipVerify disables certificate verification entirely, which
+	// exposes requests (and the API key) to interception; prefer CACert for private CAs.
+	CACert             string `toml:"ca_cert"`
+	InsecureSkipVerify bool   `toml:"insecure_skip_verify"`
+
+	// ConnectTimeout bounds connecting to the upstream, including the TLS handshake, and
+	// ResponseHeaderTimeout waiting for its response headers once a request is sent, such as "5s",
+	// so an unreachable upstream fails fast without limiting how long a stream may take. Non-streaming
+	// responses only send headers once generation is done. Unset, Go's defaults apply: 30s to
+	// connect, 10s for the handshake, and no limit on response headers.
+	ConnectTimeout        string `toml:"connect_timeout"`
+	ResponseHeaderTimeout string `toml:"response_header_timeout"`
+	// ChunkedRequests sends request bodies with chunked transfer encoding, encoding the JSON as
+	// it's sent rather than buffering it first, so large payloads such as base64 images aren't
+	// held in memory twice. It's off by default: bodies are sent with a Content-Length, since some
+	// gateways and proxies reject chunked POSTs.
+	ChunkedRequests bool `toml:"chunked_requests"`
+
+	// Anthropic only: the "anthropic-version" header, and "anthropic-beta" features to opt into
+	APIVersion    string   `toml:"api_version"`
+	AnthropicBeta []string `toml:"anthropic_beta"`
+	// Anthropic only: mark the system prompt as cacheable
+	EnablePromptCaching bool `toml:"enable_prompt_caching"`
+	// Vertex AI only: the Google Cloud project and region models are served from, and the
+	// service account key file whose OAuth2 access tokens authenticate requests. Without a
+	// CredentialsFile, GOOGLE_APPLICATION_CREDENTIALS is used, or failing that APIKey is sent
+	// as the access token.
+	Project         string `toml:"project"`
+	Region          string `toml:"region"`
+	CredentialsFile string `toml:"credentials_file"`
+	// Anthropic, Ollama and Vertex AI only: convert non-streaming responses into OpenAI's format
+	// instead of passing them through as the upstream sent them
+	NormalizeResponses bool `toml:"normalize_responses"`
+	// NormalizeMode is "lenient" (the default), which keeps provider-specific extras such as
+	// Anthropic's usage counters in normalized responses, or "strict", which emits only the
+	// fields in OpenAI's schema, for clients that validate responses strictly.
+	NormalizeMode string `toml:"normalize_mode"`
+	// ModelEcho decides the "model" of normalized responses: "request" (the default) echoes the
+	// model the client requested, as OpenAI does, and "upstream" the model the upstream reports,
+	// such as a version-pinned name.
+	ModelEcho string `toml:"model_echo"`
+	// EmulateJSONMode supports OpenAI's "response_format" on providers without native JSON mode:
+	// the requested format is added to the system prompt instead, and a chat completion that isn't
+	// a JSON object is retried once before failing. Streams get the instruction but aren't checked.
+	EmulateJSONMode bool `toml:"emulate_json_mode"`
+
+	// RequestTemplate and ResponseTemplate adapt providers of type "template" to APIs that aren't
+	// OpenAI-compatible. RequestTemplate is a text/template that renders the JSON request body from
+	// .Model, .Messages (chat) or .Prompt (text completions) and .Params, and ResponseTemplate one
+	// that renders the completion text from the decoded JSON response; see Templates.
+	RequestTemplate  string `toml:"request_template"`
+	ResponseTemplate string `toml:"response_template"`
+
+	// RetryOnBodyContains retries non-streaming requests whose response, successful or not,
+	// contains any of these strings (ignoring case), for upstreams that report transient errors
+	// such as "model is loading" in the body. Retries wait RetryBackoff, doubling each time,
+	// and stop after MaxRetries; see RetryPolicy for the defaults.
+	RetryOnBodyContains []string `toml:"retry_on_body_contains"`
+	MaxRetries          int      `toml:"max_retries"`
+	RetryBackoff        string   `toml:"retry_backoff"`
+
+	// Transforms rewrite requests before they are sent and responses before they are returned.
+	// Requests pass through them in order, responses in reverse order.
+	Transforms []TransformConfig `toml:"transforms"`
+
+	// ModelPriority overrides Priority for routing particular models, so a provider can be
+	// primary for one model and a failover candidate for another.
+	ModelPriority []ModelPriority `toml:"model_priority"`
+
+	// SystemPrompt is added to chat requests sent to the provider, as SystemPromptMode says:
+	// see the SystemPrompt* modes. The default mode is SystemPromptFill.
+	SystemPrompt     string `toml:"system_prompt"`
+	SystemPromptMode string `toml:"system_prompt_mode"`
+
+	// MaxMessages, if set, rejects chat requests with more messages than it before they're sent,
+	// as a cheap guard against runaway agent loops accumulating enormous histories.
+	MaxMessages int `toml:"max_messages"`
+
+	// SessionHeader names a response header, such as "X-Session-Id", that stateful gateways use to
+	// issue a session token: the value from the provider's first successful response is sent with
+	// every later request to it, until the provider is recreated on restart or config reload.
+	SessionHeader string `toml:"session_header"`
+}
+
+// ModelPriority is the priority of a provider for routing one model:
+//
+//	[[providers.model_priority]]
+//	model = "text-embedding-3-small"
+//	priority = 5
+type ModelPriority struct {
+	Model    string `toml:"model"`
+	Priority int    `toml:"priority"`
+}
+
+// TLSConfig returns the TLS configuration for requests to the provider,
+// or nil if neither CACert nor InsecureSkipVerify is set and Go's defaults apply.
+func (c *Config) TLSConfig() (*tls.Config, error) {
+	if c.CACert == "" && !c.InsecureSkipVerify {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.InsecureSkipVerify, // #nosec G402 -- explicitly opted into per provider
+	}
+
+	if c.CACert != "" {
+		pem, err := os.ReadFile(c.CACert) // #nosec G304 -- CA path is provided by the config file
+		if err != nil {
+			return nil, fmt.Errorf("ca_cert: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_cert: no PEM certificates found in %s", c.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// Normalization modes, see NormalizeMode
+const (
+	NormalizeLenient = "lenient"
+	NormalizeStrict  = "strict"
+)
+
+// StrictNormalization reports whether NormalizeMode is strict, returning an error if it's unknown.
+func (c *Config) StrictNormalization() (bool, error) {
+	switch c.NormalizeMode {
+	case "", NormalizeLenient:
+		return false, nil
+	case NormalizeStrict:
+		return true, nil
+	}
+	return false, fmt.Errorf("normalize_mode: unknown mode %q (expected %q or %q)",
+		c.NormalizeMode, NormalizeLenient, NormalizeStrict)
+}
+
+// Model echo modes, which decide the model normalized responses name.
+const (
+	ModelEchoRequest  = "request"
+	ModelEchoUpstream = "upstream"
+)
+
+// EchoUpstreamModel reports whether ModelEcho is upstream, returning an error if it's unknown.
+func (c *Config) EchoUpstreamModel() (bool, error) {
+	switch c.ModelEcho {
+	case "", ModelEchoRequest:
+		return false, nil
+	case ModelEchoUpstream:
+		return true, nil
+	}
+	return false, fmt.Errorf("model_echo: unknown mode %q (expected %q or %q)",
+		c.ModelEcho, ModelEchoRequest, ModelEchoUpstream)
+}
+
+// System prompt modes, which decide how a configured system prompt combines with the system
+// messages of a request
+const (
+	// SystemPromptFill adds the system prompt only to requests without a system message
+	SystemPromptFill = "fill"
+	// SystemPromptPrepend adds the system prompt before any system message of the request
+	SystemPromptPrepend = "prepend"
+	// SystemPromptOverride replaces the system messages of the request with the system prompt
+	SystemPromptOverride = "override"
+)
+
+// ParseSystemPromptMode returns mode, or SystemPromptFill if it's empty, returning an error if
+// it's unknown.
+func ParseSystemPromptMode(mode string) (string, error) {
+	switch mode {
+	case "":
+		return SystemPromptFill, nil
+	case SystemPromptFill, SystemPromptPrepend, SystemPromptOverride:
+		return mode, nil
+	}
+	return "", fmt.Errorf("system_prompt_mode: unknown mode %q (expected %q, %q or %q)",
+		mode, SystemPromptFill, SystemPromptPrepend, SystemPromptOverride)
+}
+
+// PromptMode returns the system prompt mode, SystemPromptFill by default, or an error if it's
+// unknown.
+func (c *Config) PromptMode() (string, error) {
+	return ParseSystemPromptMode(c.SystemPromptMode)
+}
+
+// SessionHeaderName returns the canonical form of SessionHeader, or "" if it's unset, returning an
+// error if it isn't a valid header name.
+func (c *Config) SessionHeaderName() (string, error) {
+	return headerName("session_header", c.SessionHeader)
+}
+
+// APIKeyPlacement returns the header, in canonical form, or query parameter the API key is sent in
+// instead of the provider type's standard header: at most one is set, and neither by default. It
+// returns an error if both are set, or the header isn't a valid header name.
+func (c *Config) APIKeyPlacement() (header, param string, err error) {
+	if c.APIKeyHeader != "" && c.APIKeyParam != "" {
+		return "", "", errors.New("api_key_header and api_key_param can't both be set")
+	}
+	header, err = headerName("api_key_header", c.APIKeyHeader)
+	return header, c.APIKeyParam, err
+}
+
+// headerName returns the canonical form of the header name configured as key, or "" if it's unset,
+// returning an error if it isn't a valid header name.
+func headerName(key, name string) (string, error) {
+	for _, r := range name {
+		if !isTokenChar(r) {
+			return "", fmt.Errorf("%s: %q is not a valid header name", key, name)
+		}
+	}
+	return http.CanonicalHeaderKey(name), nil
+}
+
+// isTokenChar reports whether r may appear in a header name (RFC 9110's "tchar").
+func isTokenChar(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+		strings.ContainsRune("!#$%&'*+-.^_`|~", r)
+}
+
+// ModelPriorities returns the ModelPriority overrides by model, returning an error if one is
+// missing its model or a model is overridden twice.
+func (c *Config) ModelPriorities() (map[string]int, error) {
+	priorities := make(map[string]int, len(c.ModelPriority))
+	for i, override := range c.ModelPriority {
+		if override.Model == "" {
+			return nil, fmt.Errorf("model_priority[%d]: missing model", i)
+		}
+		if _, ok := priorities[override.Model]; ok {
+			return nil, fmt.Errorf("model_priority[%d]: model %q is already overridden", i, override.Model)
+		}
+		priorities[override.Model] = override.Priority
+	}
+	return priorities, nil
+}
+
+// Defaults for retrying requests with RetryOnBodyContains
+const (
+	DefaultMaxRetries   = 2
+	DefaultRetryBackoff = time.Second
+)
+
+// RetryPolicy returns how many times a request may be retried and how long to wait before the
+// first retry, DefaultMaxRetries and DefaultRetryBackoff if they're unset.
+func (c *Config) RetryPolicy() (retries int, backoff time.Duration, err error) {
+	retries, backoff = c.MaxRetries, DefaultRetryBackoff
+	if retries < 0 {
+		return 0, 0, fmt.Errorf("max_retries: must not be negative, got %d", retries)
+	}
+	if retries == 0 {
+		retries = DefaultMaxRetries
+	}
+	if c.RetryBackoff != "" {
+		backoff, err = time.ParseDuration(c.RetryBackoff)
+		if err != nil {
+			return 0, 0, fmt.Errorf("retry_backoff: %w", err)
+		}
+		if backoff < 0 {
+			return 0, 0, fmt.Errorf("retry_backoff: must not be negative, got %s", c.RetryBackoff)
+		}
+	}
+	return retries, backoff, nil
+}
+
+// RefreshEvery parses RefreshInterval, returning 0 if it's unset.
+func (c *Config) RefreshEvery() (time.Duration, error) {
+	if c.RefreshInterval == "" {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(c.RefreshInterval)
+	if err != nil {
+		return 0, fmt.Errorf("refresh_interval: %w", err)
+	}
+	if interval < 0 {
+		return 0, fmt.Errorf("refresh_interval: must not be negative, got %s", c.RefreshInterval)
+	}
+	return interval, nil
+}
+
+// Timeouts parses ConnectTimeout and ResponseHeaderTimeout, returning 0 for those that are unset.
+func (c *Config) Timeouts() (connect, responseHeader time.Duration, err error) {
+	if connect, err = parseTimeout("connect_timeout", c.ConnectTimeout); err != nil {
+		return 0, 0, err
+	}
+	if responseHeader, err = parseTimeout("response_header_timeout", c.ResponseHeaderTimeout); err != nil {
+		return 0, 0, err
+	}
+	return connect, responseHeader, nil
+}
+
+// parseTimeout parses the timeout set as the named field, returning 0 if it's unset.
+func parseTimeout(field, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", field, err)
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("%s: must be positive, got %s", field, value)
+	}
+	return timeout, nil
+}
+
+// Built-in transform types
+const (
+	// TransformStripSystemPrompt removes system messages from chat requests
+	TransformStripSystemPrompt = "strip_system_prompt"
+	// TransformForceModel sends every request to Model, whatever model was requested
+	TransformForceModel = "force_model"
+	// TransformDefaultParams sets Params on requests that don't already set them
+	TransformDefaultParams = "default_params"
+	// TransformDropParams removes the request parameters named in Fields
+	TransformDropParams = "drop_params"
+	// TransformDropResponseFields removes the top-level response fields named in Fields
+	TransformDropResponseFields = "drop_response_fields"
+)
+
+// TransformConfig configures one built-in transform:
+//
+//	[[providers.transforms]]
+//	type = "default_params"
+//	params = { stop = ["\n\n"] }
+type TransformConfig struct {
+	Type   string                 `toml:"type"`
+	Model  string                 `toml:"model"`
+	Params map[string]interface{} `toml:"params"`
+	Fields []string               `toml:"fields"`
+}
+
+// Validate checks that the transform type is known and has the settings it needs.
+func (t *TransformConfig) Validate() error {
+	switch t.Type {
+	case TransformStripSystemPrompt:
+	case TransformForceModel:
+		if t.Model == "" {
+			return fmt.Errorf("%s: missing model", t.Type)
+		}
+	case TransformDefaultParams:
+		if len(t.Params) == 0 {
+			return fmt.Errorf("%s: missing params", t.Type)
+		}
+	case TransformDropParams, TransformDropResponseFields:
+		if len(t.Fields) == 0 {
+			return fmt.Errorf("%s: missing fields", t.Type)
+		}
+	default:
+		return fmt.Errorf("unknown transform type %q", t.Type)
+	}
+	return nil
+}
+
+// Factory creates a provider from its configuration.
+type Factory func(cfg *Config) Provider
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// RegisterProvider registers factory for providers configured with the given type name.
+// Registered types take precedence over the built-in ones, so a built-in type can be replaced.
+func RegisterProvider(typeName string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[typeName] = factory
+}
+
+// Lookup returns the factory registered for typeName, if any.
+func Lookup(typeName string) (Factory, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	factory, ok := registry[typeName]
+	return factory, ok
+}
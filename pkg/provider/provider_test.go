@@ -0,0 +1,235 @@
+package provider
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticProvider struct {
+	cfg *Config
+}
+
+func (p *staticProvider) Name() string  { return p.cfg.Name }
+func (p *staticProvider) Priority() int { return p.cfg.Priority }
+
+func (p *staticProvider) ChatCompletion(
+	_ context.Context, model string, _ []map[string]interface{}, _ map[string]interface{},
+) (interface{}, error) {
+	return map[string]interface{}{"model": model}, nil
+}
+
+func (p *staticProvider) Completion(
+	_ context.Context, model, _ string, _ map[string]interface{},
+) (interface{}, error) {
+	return map[string]interface{}{"model": model}, nil
+}
+
+func (p *staticProvider) ChatCompletionStream(
+	_ context.Context, _ string, _ []map[string]interface{}, _ map[string]interface{},
+) (<-chan StreamChunk, error) {
+	return nil, errors.New("streaming not implemented")
+}
+
+func (p *staticProvider) CompletionStream(
+	_ context.Context, _, _ string, _ map[string]interface{},
+) (<-chan StreamChunk, error) {
+	return nil, errors.New("streaming not implemented")
+}
+
+func (p *staticProvider) ListModels() []string { return p.cfg.Models }
+
+func TestRegisterProvider(t *testing.T) {
+	_, ok := Lookup("static-test")
+	assert.False(t, ok)
+
+	RegisterProvider("static-test", func(cfg *Config) Provider {
+		return &staticProvider{cfg: cfg}
+	})
+
+	factory, ok := Lookup("static-test")
+	require.True(t, ok)
+
+	p := factory(&Config{Name: "static", Models: []string{"static-1"}})
+	assert.Equal(t, "static", p.Name())
+	assert.Equal(t, []string{"static-1"}, p.ListModels())
+}
+
+func TestRecordResponseHeaders(t *testing.T) {
+	// Without a collector, recording does nothing
+	RecordResponseHeaders(context.Background(), http.Header{"Retry-After": {"1"}})
+
+	ctx, headers := WithResponseHeaders(context.Background())
+	assert.Nil(t, headers.Header())
+
+	first := http.Header{"Retry-After": {"1"}}
+	RecordResponseHeaders(ctx, first)
+	first.Set("Retry-After", "2")
+	assert.Equal(t, "1", headers.Header().Get("Retry-After"), "recorded headers are copied")
+
+	// A later response, e.g. from a fallback provider, replaces the earlier one
+	RecordResponseHeaders(ctx, http.Header{"X-Ratelimit-Remaining-Requests": {"9"}})
+	assert.Equal(t, http.Header{"X-Ratelimit-Remaining-Requests": {"9"}}, headers.Header())
+}
+
+func TestConfig_TLSConfig(t *testing.T) {
+	tlsConfig, err := (&Config{}).TLSConfig()
+	require.NoError(t, err)
+	assert.Nil(t, tlsConfig, "default verification needs no TLS config")
+
+	tlsConfig, err = (&Config{InsecureSkipVerify: true}).TLSConfig()
+	require.NoError(t, err)
+	assert.True(t, tlsConfig.InsecureSkipVerify)
+
+	server := httptest.NewTLSServer(nil)
+	defer server.Close()
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caPath, caPEM, 0o600))
+
+	tlsConfig, err = (&Config{CACert: caPath}).TLSConfig()
+	require.NoError(t, err)
+	assert.False(t, tlsConfig.InsecureSkipVerify)
+	assert.NotNil(t, tlsConfig.RootCAs)
+
+	notPEM := filepath.Join(t.TempDir(), "ca.txt")
+	require.NoError(t, os.WriteFile(notPEM, []byte("not a certificate"), 0o600))
+	_, err = (&Config{CACert: notPEM}).TLSConfig()
+	assert.ErrorContains(t, err, "no PEM certificates")
+
+	_, err = (&Config{CACert: filepath.Join(t.TempDir(), "missing.pem")}).TLSConfig()
+	assert.Error(t, err)
+}
+
+func TestConfig_ModelPriorities(t *testing.T) {
+	cfg := &Config{ModelPriority: []ModelPriority{{Model: "gpt-4", Priority: 5}, {Model: "gpt-4o", Priority: 0}}}
+	priorities, err := cfg.ModelPriorities()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"gpt-4": 5, "gpt-4o": 0}, priorities)
+
+	_, err = (&Config{ModelPriority: []ModelPriority{{Priority: 5}}}).ModelPriorities()
+	assert.ErrorContains(t, err, "model_priority[0]: missing model")
+
+	cfg.ModelPriority = append(cfg.ModelPriority, ModelPriority{Model: "gpt-4", Priority: 1})
+	_, err = cfg.ModelPriorities()
+	assert.ErrorContains(t, err, `model_priority[2]: model "gpt-4" is already overridden`)
+}
+
+func TestConfig_PromptMode(t *testing.T) {
+	mode, err := (&Config{}).PromptMode()
+	require.NoError(t, err)
+	assert.Equal(t, SystemPromptFill, mode)
+
+	mode, err = (&Config{SystemPromptMode: SystemPromptOverride}).PromptMode()
+	require.NoError(t, err)
+	assert.Equal(t, SystemPromptOverride, mode)
+
+	_, err = (&Config{SystemPromptMode: "append"}).PromptMode()
+	assert.ErrorContains(t, err, `unknown mode "append"`)
+}
+
+func TestConfig_SessionHeaderName(t *testing.T) {
+	header, err := (&Config{}).SessionHeaderName()
+	require.NoError(t, err)
+	assert.Empty(t, header)
+
+	header, err = (&Config{SessionHeader: "x-session-id"}).SessionHeaderName()
+	require.NoError(t, err)
+	assert.Equal(t, "X-Session-Id", header)
+
+	_, err = (&Config{SessionHeader: "X-Session: Id"}).SessionHeaderName()
+	assert.ErrorContains(t, err, `session_header: "X-Session: Id" is not a valid header name`)
+}
+
+func TestConfig_APIKeyPlacement(t *testing.T) {
+	header, param, err := (&Config{}).APIKeyPlacement()
+	require.NoError(t, err)
+	assert.Empty(t, header)
+	assert.Empty(t, param)
+
+	header, _, err = (&Config{APIKeyHeader: "api-key"}).APIKeyPlacement()
+	require.NoError(t, err)
+	assert.Equal(t, "Api-Key", header)
+
+	_, param, err = (&Config{APIKeyParam: "key"}).APIKeyPlacement()
+	require.NoError(t, err)
+	assert.Equal(t, "key", param)
+
+	_, _, err = (&Config{APIKeyHeader: "api-key", APIKeyParam: "key"}).APIKeyPlacement()
+	assert.ErrorContains(t, err, "can't both be set")
+
+	_, _, err = (&Config{APIKeyHeader: "api key"}).APIKeyPlacement()
+	assert.ErrorContains(t, err, `api_key_header: "api key" is not a valid header name`)
+}
+
+func TestConfig_RetryPolicy(t *testing.T) {
+	retries, backoff, err := (&Config{}).RetryPolicy()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultMaxRetries, retries)
+	assert.Equal(t, DefaultRetryBackoff, backoff)
+
+	retries, backoff, err = (&Config{MaxRetries: 5, RetryBackoff: "250ms"}).RetryPolicy()
+	require.NoError(t, err)
+	assert.Equal(t, 5, retries)
+	assert.Equal(t, 250*time.Millisecond, backoff)
+
+	_, _, err = (&Config{MaxRetries: -1}).RetryPolicy()
+	assert.ErrorContains(t, err, "max_retries")
+
+	_, _, err = (&Config{RetryBackoff: "soon"}).RetryPolicy()
+	assert.ErrorContains(t, err, "retry_backoff")
+}
+
+func TestConfig_Timeouts(t *testing.T) {
+	connect, responseHeader, err := (&Config{}).Timeouts()
+	require.NoError(t, err)
+	assert.Zero(t, connect)
+	assert.Zero(t, responseHeader)
+
+	connect, responseHeader, err = (&Config{ConnectTimeout: "2s", ResponseHeaderTimeout: "1m"}).Timeouts()
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Second, connect)
+	assert.Equal(t, time.Minute, responseHeader)
+
+	_, _, err = (&Config{ConnectTimeout: "0s"}).Timeouts()
+	assert.ErrorContains(t, err, "connect_timeout: must be positive")
+
+	_, _, err = (&Config{ResponseHeaderTimeout: "slow"}).Timeouts()
+	assert.ErrorContains(t, err, "response_header_timeout")
+}
+
+func TestConfig_Templates(t *testing.T) {
+	request, response, err := (&Config{Type: "openai"}).Templates()
+	require.NoError(t, err)
+	assert.Nil(t, request)
+	assert.Nil(t, response)
+
+	cfg := &Config{
+		Type:             "template",
+		RequestTemplate:  `{"model": {{json .Model}}, "input": {{json .Prompt}}}`,
+		ResponseTemplate: `{{.output.text}}`,
+	}
+	request, response, err = cfg.Templates()
+	require.NoError(t, err)
+	var body strings.Builder
+	require.NoError(t, request.Execute(&body, map[string]interface{}{"Model": "m", "Prompt": `say "hi"`}))
+	assert.JSONEq(t, `{"model": "m", "input": "say \"hi\""}`, body.String())
+	assert.Error(t, response.Execute(&body, map[string]interface{}{"output": map[string]interface{}{}}),
+		"missing response fields are errors")
+
+	_, _, err = (&Config{Type: "template", RequestTemplate: "{}"}).Templates()
+	assert.ErrorContains(t, err, "need a request_template and a response_template")
+
+	_, _, err = (&Config{RequestTemplate: "{{.Model", ResponseTemplate: "{{.text}}"}).Templates()
+	assert.ErrorContains(t, err, "request_template")
+}
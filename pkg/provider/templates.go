@@ -0,0 +1,49 @@
+package provider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"text/template"
+)
+
+// templateFuncs are available to RequestTemplate and ResponseTemplate besides text/template's
+// built-ins: "json" encodes a value as JSON, such as {{json .Messages}}.
+var templateFuncs = template.FuncMap{
+	"json": templateJSON,
+}
+
+// Templates parses RequestTemplate and ResponseTemplate, either of which is nil if it's unset.
+// Providers of type "template" need both. A field the response template refers to that's missing
+// from a response fails it, rather than rendering as "<no value>".
+func (c *Config) Templates() (request, response *template.Template, err error) {
+	if c.Type == "template" && (c.RequestTemplate == "" || c.ResponseTemplate == "") {
+		return nil, nil, errors.New("template providers need a request_template and a response_template")
+	}
+	if request, err = parseTemplate("request_template", c.RequestTemplate); err != nil {
+		return nil, nil, err
+	}
+	if response, err = parseTemplate("response_template", c.ResponseTemplate); err != nil {
+		return nil, nil, err
+	}
+	if response != nil {
+		response.Option("missingkey=error")
+	}
+	return request, response, nil
+}
+
+func parseTemplate(field, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New(field).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", field, err)
+	}
+	return tmpl, nil
+}
+
+func templateJSON(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	return string(data), err
+}
@@ -1,13 +1,17 @@
 package integration
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
-	"net"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -16,6 +20,8 @@ import (
 
 	"github.com/modelplex/modelplex/internal/config"
 	"github.com/modelplex/modelplex/internal/server"
+	modelplex "github.com/modelplex/modelplex/pkg/client"
+	"github.com/modelplex/modelplex/test/testutil"
 )
 
 func TestIntegration_FullAPIFlow(t *testing.T) {
@@ -94,6 +100,13 @@ func TestIntegration_FullAPIFlow(t *testing.T) {
 		assert.NotEmpty(t, data)
 	})
 
+	// Test the /models/v1 prefix serves the same endpoints as legacy /v1
+	t.Run("List Models Under Models Prefix", func(t *testing.T) {
+		response := makeUnixRequest(t, socketPath, "GET", "/models/v1/models", nil)
+		defer response.Body.Close()
+		assert.Equal(t, 200, response.StatusCode)
+	})
+
 	// Test chat completions with error (since we don't have a real provider)
 	t.Run("Chat Completions Error", func(t *testing.T) {
 		requestBody := map[string]interface{}{
@@ -112,6 +125,34 @@ func TestIntegration_FullAPIFlow(t *testing.T) {
 		assert.Equal(t, 500, response.StatusCode)
 	})
 
+	// Test streaming completions with error before any chunk is sent
+	t.Run("Streaming Completions Error", func(t *testing.T) {
+		body := []byte(`{"model": "test-model", "prompt": "Hello", "stream": true}`)
+		for _, path := range []string{"/v1/completions", "/models/v1/completions"} {
+			response := makeUnixRequest(t, socketPath, "POST", path, bytes.NewReader(body))
+			response.Body.Close()
+			assert.Equal(t, 500, response.StatusCode, path)
+		}
+	})
+
+	// Test the typed Go client against the live server
+	t.Run("Go Client", func(t *testing.T) {
+		client := modelplex.NewSocketClient(socketPath)
+
+		models, err := client.ListModels(context.Background())
+		require.NoError(t, err)
+		assert.Len(t, models, 1)
+		assert.Equal(t, "test-model", models[0].ID)
+
+		_, err = client.ChatCompletion(context.Background(), &modelplex.ChatCompletionRequest{
+			Model:    "test-model",
+			Messages: []modelplex.Message{{Role: "user", Content: "Hello"}},
+		})
+		var apiErr *modelplex.APIError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, 500, apiErr.StatusCode)
+	})
+
 	// Test invalid endpoints
 	t.Run("Invalid Endpoint", func(t *testing.T) {
 		response := makeUnixRequest(t, socketPath, "GET", "/invalid", nil)
@@ -120,6 +161,68 @@ func TestIntegration_FullAPIFlow(t *testing.T) {
 	})
 }
 
+func TestIntegration_LogprobsPassthrough(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	upstream := testutil.CreateMockHTTPServer(t, map[string]func(w http.ResponseWriter, r *http.Request){
+		"/chat/completions": func(w http.ResponseWriter, r *http.Request) {
+			var req map[string]interface{}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.Equal(t, true, req["logprobs"])
+			assert.Equal(t, float64(3), req["top_logprobs"])
+
+			response := testutil.CreateOpenAIMockResponse()
+			response["choices"] = []map[string]interface{}{
+				{
+					"index":   0,
+					"message": map[string]interface{}{"role": "assistant", "content": "Hi"},
+					"logprobs": map[string]interface{}{
+						"content": []map[string]interface{}{
+							{"token": "Hi", "logprob": -0.01, "top_logprobs": []interface{}{}},
+						},
+					},
+					"finish_reason": "stop",
+				},
+			}
+			w.Header().Set("Content-Type", "application/json")
+			assert.NoError(t, json.NewEncoder(w).Encode(response))
+		},
+	})
+	defer upstream.Close()
+
+	socketPath := filepath.Join(t.TempDir(), "test.socket")
+	srv := server.New(&config.Config{
+		Providers: []config.Provider{
+			{Name: "mock", Type: "openai", BaseURL: upstream.URL, Models: []string{"gpt-4"}},
+		},
+	}, socketPath)
+
+	go func() {
+		if err := srv.Start(); err != nil && err != http.ErrServerClosed {
+			t.Logf("Server error: %v", err)
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	body := []byte(`{
+		"model": "gpt-4",
+		"messages": [{"role": "user", "content": "Hello"}],
+		"logprobs": true,
+		"top_logprobs": 3
+	}`)
+	response := makeUnixRequest(t, socketPath, "POST", "/v1/chat/completions", bytes.NewReader(body))
+	defer response.Body.Close()
+	require.Equal(t, 200, response.StatusCode)
+
+	var result map[string]interface{}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&result))
+	choice := result["choices"].([]interface{})[0].(map[string]interface{})
+	assert.Contains(t, choice, "logprobs")
+}
+
 func TestIntegration_ConfigValidation(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping integration test in short mode")
@@ -199,16 +302,226 @@ func TestIntegration_ConfigValidation(t *testing.T) {
 	}
 }
 
-// makeUnixRequest makes an HTTP request over a Unix socket
-func makeUnixRequest(t *testing.T, socketPath, method, path string, body *bytes.Reader) *http.Response {
-	client := &http.Client{
-		Transport: &http.Transport{
-			DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
-				return net.Dial("unix", socketPath)
-			},
+func TestIntegration_StoreMetadataPassthrough(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	metadata := map[string]interface{}{
+		"session": "abc123",
+		"tags":    map[string]interface{}{"team": "agents", "priority": "high"},
+	}
+
+	openai := testutil.CreateMockHTTPServer(t, map[string]func(w http.ResponseWriter, r *http.Request){
+		"/chat/completions": func(w http.ResponseWriter, r *http.Request) {
+			var req map[string]interface{}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.Equal(t, true, req["store"])
+			assert.Equal(t, metadata, req["metadata"])
+
+			w.Header().Set("Content-Type", "application/json")
+			assert.NoError(t, json.NewEncoder(w).Encode(testutil.CreateOpenAIMockResponse()))
+		},
+	})
+	defer openai.Close()
+
+	// Providers without these fields drop them rather than failing the request
+	anthropic := testutil.CreateMockHTTPServer(t, map[string]func(w http.ResponseWriter, r *http.Request){
+		"/messages": func(w http.ResponseWriter, r *http.Request) {
+			var req map[string]interface{}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.NotContains(t, req, "store")
+			assert.NotContains(t, req, "metadata")
+
+			w.Header().Set("Content-Type", "application/json")
+			assert.NoError(t, json.NewEncoder(w).Encode(testutil.CreateAnthropicMockResponse()))
+		},
+	})
+	defer anthropic.Close()
+
+	socketPath := filepath.Join(t.TempDir(), "test.socket")
+	srv := server.New(&config.Config{
+		Providers: []config.Provider{
+			{Name: "openai", Type: "openai", BaseURL: openai.URL, Models: []string{"gpt-4"}},
+			{Name: "anthropic", Type: "anthropic", BaseURL: anthropic.URL, Models: []string{"claude-3-sonnet"}},
 		},
-		Timeout: 5 * time.Second,
+	}, socketPath)
+
+	go func() {
+		if err := srv.Start(); err != nil && err != http.ErrServerClosed {
+			t.Logf("Server error: %v", err)
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	for _, model := range []string{"gpt-4", "claude-3-sonnet"} {
+		body := []byte(`{
+			"model": "` + model + `",
+			"messages": [{"role": "user", "content": "Hello"}],
+			"store": true,
+			"metadata": {"session": "abc123", "tags": {"team": "agents", "priority": "high"}}
+		}`)
+		response := makeUnixRequest(t, socketPath, "POST", "/v1/chat/completions", bytes.NewReader(body))
+		response.Body.Close()
+		assert.Equal(t, 200, response.StatusCode, model)
 	}
+}
+
+// lockedBuffer is a bytes.Buffer safe to log to from the server's goroutines.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestIntegration_UserPassthrough(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	var logs lockedBuffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	openai := testutil.CreateMockHTTPServer(t, map[string]func(w http.ResponseWriter, r *http.Request){
+		"/chat/completions": func(w http.ResponseWriter, r *http.Request) {
+			var req map[string]interface{}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.Equal(t, "agent-42", req["user"])
+
+			w.Header().Set("Content-Type", "application/json")
+			assert.NoError(t, json.NewEncoder(w).Encode(testutil.CreateOpenAIMockResponse()))
+		},
+	})
+	defer openai.Close()
+
+	// Anthropic has no "user" field, so it's only recorded locally
+	anthropic := testutil.CreateMockHTTPServer(t, map[string]func(w http.ResponseWriter, r *http.Request){
+		"/messages": func(w http.ResponseWriter, r *http.Request) {
+			var req map[string]interface{}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.NotContains(t, req, "user")
+
+			w.Header().Set("Content-Type", "application/json")
+			assert.NoError(t, json.NewEncoder(w).Encode(testutil.CreateAnthropicMockResponse()))
+		},
+	})
+	defer anthropic.Close()
+
+	socketPath := filepath.Join(t.TempDir(), "test.socket")
+	srv := server.New(&config.Config{
+		Server: config.Server{LogRequests: true},
+		Providers: []config.Provider{
+			{Name: "openai", Type: "openai", BaseURL: openai.URL, Models: []string{"gpt-4"}},
+			{Name: "anthropic", Type: "anthropic", BaseURL: anthropic.URL, Models: []string{"claude-3-sonnet"}},
+		},
+	}, socketPath)
+
+	go func() {
+		if err := srv.Start(); err != nil && err != http.ErrServerClosed {
+			t.Logf("Server error: %v", err)
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	for _, model := range []string{"gpt-4", "claude-3-sonnet"} {
+		body := []byte(`{"model": "` + model + `", "messages": [{"role": "user", "content": "Hello"}], "user": "agent-42"}`)
+		response := makeUnixRequest(t, socketPath, "POST", "/v1/chat/completions", bytes.NewReader(body))
+		response.Body.Close()
+		assert.Equal(t, 200, response.StatusCode, model)
+	}
+
+	// Both requests are attributed to the user in the request log
+	users := map[string]interface{}{}
+	for _, line := range strings.Split(logs.String(), "\n") {
+		var entry struct {
+			Msg      string                 `json:"msg"`
+			Provider string                 `json:"provider"`
+			Metadata map[string]interface{} `json:"metadata"`
+		}
+		if json.Unmarshal([]byte(line), &entry) == nil && entry.Msg == "Request logged" {
+			users[entry.Provider] = entry.Metadata["user"]
+		}
+	}
+	assert.Equal(t, map[string]interface{}{"openai": "agent-42", "anthropic": "agent-42"}, users)
+}
+
+func TestIntegration_StreamClientDisconnect(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	cancelled := make(chan struct{})
+	upstream := testutil.CreateMockHTTPServer(t, map[string]func(w http.ResponseWriter, r *http.Request){
+		"/chat/completions": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, `data: {"object": "chat.completion.chunk", "choices": [{"index": 0, "delta": {"content": "Hel"}}]}`+"\n\n")
+			w.(http.Flusher).Flush()
+
+			// Keep "generating" until modelplex gives up on the request
+			select {
+			case <-r.Context().Done():
+				close(cancelled)
+			case <-time.After(10 * time.Second):
+			}
+		},
+	})
+	defer upstream.Close()
+
+	socketPath := filepath.Join(t.TempDir(), "test.socket")
+	srv := server.New(&config.Config{
+		Providers: []config.Provider{
+			{Name: "mock", Type: "openai", BaseURL: upstream.URL, Models: []string{"gpt-4"}},
+		},
+	}, socketPath)
+
+	go func() {
+		if err := srv.Start(); err != nil && err != http.ErrServerClosed {
+			t.Logf("Server error: %v", err)
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+	defer srv.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	body := `{"model": "gpt-4", "stream": true, "messages": [{"role": "user", "content": "Hello"}]}`
+	req, err := http.NewRequestWithContext(ctx, "POST", "http://unix/v1/chat/completions", strings.NewReader(body))
+	require.NoError(t, err)
+
+	response, err := modelplex.NewSocketClient(socketPath).HTTPClient().Do(req)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	line, err := bufio.NewReader(response.Body).ReadString('\n')
+	require.NoError(t, err)
+	assert.Contains(t, line, "Hel")
+
+	// Disconnect mid-stream
+	cancel()
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("upstream request was not cancelled after the client disconnected")
+	}
+}
+
+// makeUnixRequest makes an HTTP request over a Unix socket
+func makeUnixRequest(t *testing.T, socketPath, method, path string, body *bytes.Reader) *http.Response {
+	client := modelplex.NewSocketClient(socketPath).HTTPClient()
 
 	var req *http.Request
 	var err error
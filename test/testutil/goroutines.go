@@ -0,0 +1,36 @@
+package testutil
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+const (
+	// goroutineExitTimeout is how long goroutines get to exit after a test before they count as leaked
+	goroutineExitTimeout  = 5 * time.Second
+	goroutinePollInterval = 10 * time.Millisecond
+	// goroutineDumpSize bounds the stack dump reported for leaked goroutines
+	goroutineDumpSize = 1 << 20
+)
+
+// CheckGoroutineLeaks fails t if more goroutines are running once t and its cleanups have finished
+// than when it was called, reporting the stacks of all goroutines. Call it first thing in a test,
+// and don't use it in parallel tests, whose goroutines it can't tell apart.
+func CheckGoroutineLeaks(t *testing.T) {
+	t.Helper()
+	before := runtime.NumGoroutine()
+
+	t.Cleanup(func() {
+		deadline := time.Now().Add(goroutineExitTimeout)
+		for runtime.NumGoroutine() > before {
+			if time.Now().After(deadline) {
+				stacks := make([]byte, goroutineDumpSize)
+				stacks = stacks[:runtime.Stack(stacks, true)]
+				t.Errorf("%d goroutines leaked:\n%s", runtime.NumGoroutine()-before, stacks)
+				return
+			}
+			time.Sleep(goroutinePollInterval)
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package testutil
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/modelplex/modelplex/internal/config"
+)
+
+// FakeMCPServerEnv is set in the environment of a test binary re-run as a fake MCP server.
+const FakeMCPServerEnv = "MODELPLEX_FAKE_MCP_SERVER"
+
+const (
+	// FakeMCPServerProgressSteps is how many progress notifications the fake "count" tool sends.
+	FakeMCPServerProgressSteps = 3
+	// FakeMCPServerLargeResultSize is the length of the text the fake "large" tool returns,
+	// which is more than bufio.Scanner reads by default.
+	FakeMCPServerLargeResultSize = 100 * 1024
+)
+
+// FakeMCPServer returns the config for an MCP server that re-runs the test binary as a fake MCP
+// server. The test package's TestMain must call RunFakeMCPServer when FakeMCPServerEnv is set.
+//
+// The fake server provides four tools: "count" sends FakeMCPServerProgressSteps progress
+// notifications when asked for progress, then returns "done"; "fail" returns an error;
+// "hang" never responds; and "large" returns FakeMCPServerLargeResultSize bytes of text.
+func FakeMCPServer(t *testing.T, name string) config.MCPServer {
+	t.Helper()
+	t.Setenv(FakeMCPServerEnv, "1")
+	return config.MCPServer{Name: name, Command: os.Args[0]}
+}
+
+// RunFakeMCPServer serves the fake MCP server over in and out until in is closed.
+func RunFakeMCPServer(in io.Reader, out io.Writer) {
+	encoder := json.NewEncoder(out)
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		var req struct {
+			ID     int    `json:"id"`
+			Method string `json:"method"`
+			Params struct {
+				Name string `json:"name"`
+				Meta *struct {
+					ProgressToken int `json:"progressToken"`
+				} `json:"_meta"`
+			} `json:"params"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			continue
+		}
+
+		respond := func(result interface{}) {
+			_ = encoder.Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+		}
+
+		switch {
+		case req.Method == "initialize":
+			respond(map[string]interface{}{"protocolVersion": "2024-11-05"})
+		case req.Method == "tools/list":
+			tools := []map[string]interface{}{}
+			for _, name := range []string{"count", "fail", "hang", "large"} {
+				tools = append(tools, map[string]interface{}{"name": name, "description": "Fake " + name + " tool"})
+			}
+			respond(map[string]interface{}{"tools": tools})
+		case req.Method == "tools/call" && req.Params.Name == "count":
+			for step := 1; req.Params.Meta != nil && step <= FakeMCPServerProgressSteps; step++ {
+				_ = encoder.Encode(map[string]interface{}{
+					"jsonrpc": "2.0",
+					"method":  "notifications/progress",
+					"params": map[string]interface{}{
+						"progressToken": req.Params.Meta.ProgressToken,
+						"progress":      step,
+						"total":         FakeMCPServerProgressSteps,
+						"message":       fmt.Sprintf("step %d", step),
+					},
+				})
+			}
+			respond(map[string]interface{}{"content": []map[string]interface{}{{"type": "text", "text": "done"}}})
+		case req.Method == "tools/call" && req.Params.Name == "large":
+			text := strings.Repeat("x", FakeMCPServerLargeResultSize)
+			respond(map[string]interface{}{"content": []map[string]interface{}{{"type": "text", "text": text}}})
+		case req.Method == "tools/call" && req.Params.Name == "fail":
+			_ = encoder.Encode(map[string]interface{}{
+				"jsonrpc": "2.0",
+				"id":      req.ID,
+				"error":   map[string]interface{}{"code": -32000, "message": "tool failed"},
+			})
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package testutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+const webSocketTimeout = 5 * time.Second
+
+// WebSocketClient is a WebSocket client for testing servers, whose reads fail the test if the
+// server doesn't send anything in time.
+type WebSocketClient struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+// DialWebSocket connects to the WebSocket endpoint at path on the HTTP server at addr
+// (host:port), failing t unless the server accepts the upgrade. The connection is closed
+// when t ends.
+func DialWebSocket(t *testing.T, addr, path string) *WebSocketClient {
+	t.Helper()
+	dialer := websocket.Dialer{HandshakeTimeout: webSocketTimeout}
+	conn, resp, err := dialer.Dial("ws://"+addr+path, nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	t.Cleanup(func() { conn.Close() })
+	return &WebSocketClient{t: t, conn: conn}
+}
+
+// Send sends data as one message of the given type, such as websocket.BinaryMessage.
+func (c *WebSocketClient) Send(messageType int, data []byte) {
+	c.t.Helper()
+	require.NoError(c.t, c.conn.SetWriteDeadline(time.Now().Add(webSocketTimeout)))
+	require.NoError(c.t, c.conn.WriteMessage(messageType, data))
+}
+
+// SendText sends text as a text message.
+func (c *WebSocketClient) SendText(text string) {
+	c.t.Helper()
+	c.Send(websocket.TextMessage, []byte(text))
+}
+
+// Close sends a close message with code.
+func (c *WebSocketClient) Close(code int) {
+	c.t.Helper()
+	c.Send(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""))
+}
+
+// ReadText returns the next text message.
+func (c *WebSocketClient) ReadText() string {
+	c.t.Helper()
+	require.NoError(c.t, c.conn.SetReadDeadline(time.Now().Add(webSocketTimeout)))
+	messageType, data, err := c.conn.ReadMessage()
+	require.NoError(c.t, err)
+	require.Equal(c.t, websocket.TextMessage, messageType, "unexpected message: %q", data)
+	return string(data)
+}
+
+// ReadClose reads messages until the server closes the connection, returning the code it closed
+// it with.
+func (c *WebSocketClient) ReadClose() int {
+	c.t.Helper()
+	require.NoError(c.t, c.conn.SetReadDeadline(time.Now().Add(webSocketTimeout)))
+	for {
+		_, _, err := c.conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var closeErr *websocket.CloseError
+		require.True(c.t, errors.As(err, &closeErr), "connection not closed with a close message: %v", err)
+		return closeErr.Code
+	}
+}